@@ -94,15 +94,15 @@ func (h *MyHook) PreWrite(path string, buf []byte, offset int64) (bool, hookfs.H
 }
 
 // PostWrite implements hookfs.HookOnWrite
-func (h *MyHook) PostWrite(realRetCode int32, ctx hookfs.HookContext) (bool, error) {
+func (h *MyHook) PostWrite(realRetCode int32, ctx hookfs.HookContext) (uint32, bool, error) {
 	if probab(70) {
 		log.WithFields(log.Fields{
 			"h":   h,
 			"ctx": ctx,
 		}).Info("MyPostWrite: returning ENOSPC")
-		return true, syscall.ENOSPC
+		return 0, true, syscall.ENOSPC
 	}
-	return false, nil
+	return 0, false, nil
 }
 
 // PreMkdir implements hookfs.HookOnMkdir
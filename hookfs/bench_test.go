@@ -0,0 +1,137 @@
+package hookfs
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/hanwen/go-fuse/fuse/pathfs"
+)
+
+// benchFileSystems returns the bare loopback of a new directory holding a file of size bytes,
+// and a HookFs of it without a hook, for the benchmarks comparing the two.
+func benchFileSystems(b *testing.B, size int) (loopback pathfs.FileSystem, nilHook pathfs.FileSystem) {
+	b.Helper()
+	original := b.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(original, "file"), bytes.Repeat([]byte("x"), size), 0644); err != nil {
+		b.Fatal(err)
+	}
+	h, err := NewHookFs(original, b.TempDir(), nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return pathfs.NewLoopbackFileSystem(original), h
+}
+
+func benchGetAttr(b *testing.B, fs pathfs.FileSystem) {
+	ctx := &fuse.Context{}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, code := fs.GetAttr("file", ctx); !code.Ok() {
+			b.Fatal(code)
+		}
+	}
+}
+
+func benchRead(b *testing.B, fs pathfs.FileSystem) {
+	const size = 4096
+	f, code := fs.Open("file", syscall.O_RDONLY, &fuse.Context{})
+	if !code.Ok() {
+		b.Fatal(code)
+	}
+	defer f.Release()
+	buf := make([]byte, size)
+	b.SetBytes(size)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		res, code := f.Read(buf, 0)
+		if !code.Ok() {
+			b.Fatal(code)
+		}
+		if _, code := res.Bytes(buf); !code.Ok() {
+			b.Fatal(code)
+		}
+		res.Done()
+	}
+}
+
+func BenchmarkLoopbackGetAttr(b *testing.B) {
+	loopback, _ := benchFileSystems(b, 4096)
+	benchGetAttr(b, loopback)
+}
+
+func BenchmarkNilHookGetAttr(b *testing.B) {
+	_, nilHook := benchFileSystems(b, 4096)
+	benchGetAttr(b, nilHook)
+}
+
+func BenchmarkLoopbackRead(b *testing.B) {
+	loopback, _ := benchFileSystems(b, 4096)
+	benchRead(b, loopback)
+}
+
+func BenchmarkNilHookRead(b *testing.B) {
+	_, nilHook := benchFileSystems(b, 4096)
+	benchRead(b, nilHook)
+}
+
+// readDataHook passes reads through, but as a HookOnRead the data is handed to it.
+type readDataHook struct{}
+
+func (readDataHook) PreRead(path string, length int64, offset int64) ([]byte, bool, HookContext, error) {
+	return nil, false, nil, nil
+}
+
+func (readDataHook) PostRead(realRetCode int32, realBuf []byte, prehookCtx HookContext) ([]byte, bool, error) {
+	return nil, false, nil
+}
+
+// readMetadataHook passes reads through as a HookOnReadMetadata.
+type readMetadataHook struct{}
+
+func (readMetadataHook) PreReadMetadata(path string, length int64, offset int64) (bool, HookContext, error) {
+	return false, nil, nil
+}
+
+func (readMetadataHook) PostReadMetadata(realRetCode int32, realSize int, prehookCtx HookContext) (bool, error) {
+	return false, nil
+}
+
+// benchSequentialRead reads a large file through a mount with hook from start to end, with
+// DirectIO so that every read reaches hookfs rather than the page cache.
+func benchSequentialRead(b *testing.B, hook Hook) {
+	const size = 16 << 20
+	_, original, mnt := mount(b, hook, &Options{DirectIO: true})
+	if err := ioutil.WriteFile(filepath.Join(original, "file"), bytes.Repeat([]byte("x"), size), 0644); err != nil {
+		b.Fatal(err)
+	}
+	buf := make([]byte, 128<<10)
+	b.SetBytes(size)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f, err := os.Open(filepath.Join(mnt, "file"))
+		if err != nil {
+			b.Fatal(err)
+		}
+		n, err := io.CopyBuffer(ioutil.Discard, struct{ io.Reader }{f}, buf)
+		f.Close()
+		if err != nil || n != size {
+			b.Fatalf("read %d bytes: %v, want %d", n, err, size)
+		}
+	}
+}
+
+func BenchmarkSequentialReadDataHook(b *testing.B) {
+	benchSequentialRead(b, readDataHook{})
+}
+
+func BenchmarkSequentialReadMetadataHook(b *testing.B) {
+	benchSequentialRead(b, readMetadataHook{})
+}
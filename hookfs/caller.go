@@ -0,0 +1,188 @@
+package hookfs
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CallerGroups returns the supplementary group IDs of the process pid (e.g. fuse.Context.Pid).
+//
+// fuse.Context only carries the primary uid and gid of the caller, so the groups are read from
+// /proc/<pid>/status. This is Linux only and costs an open and a parse on every call;
+// hooks calling it on hot paths should cache the result per pid.
+// An error is returned if the process has already exited.
+func CallerGroups(pid uint32) ([]uint32, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "Groups:") {
+			continue
+		}
+		var groups []uint32
+		for _, field := range strings.Fields(strings.TrimPrefix(line, "Groups:")) {
+			gid, err := strconv.ParseUint(field, 10, 32)
+			if err != nil {
+				return nil, err
+			}
+			groups = append(groups, uint32(gid))
+		}
+		return groups, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("no Groups in /proc/%d/status", pid)
+}
+
+// CallerCgroup returns the cgroup of the process pid (e.g. fuse.Context.Pid), read from
+// /proc/<pid>/cgroup. With cgroup v2 this is the unified hierarchy path; with v1 it is
+// the path in the first hierarchy listed.
+// This is Linux only. An error is returned if the process has already exited.
+func CallerCgroup(pid uint32) (string, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/cgroup", pid))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var first string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// hierarchy-ID:controller-list:cgroup-path
+		fields := strings.SplitN(scanner.Text(), ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		if fields[0] == "0" && fields[1] == "" {
+			return fields[2], nil
+		}
+		if first == "" {
+			first = fields[2]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	if first == "" {
+		return "", fmt.Errorf("no cgroup in /proc/%d/cgroup", pid)
+	}
+	return first, nil
+}
+
+// ContainerID extracts a container ID from a cgroup path as returned by CallerCgroup,
+// e.g. "/kubepods/burstable/pod<uid>/<id>" or ".../cri-containerd-<id>.scope".
+// The ID is the last 64-character hexadecimal path component, stripped of the runtime prefix
+// and ".scope" suffix that systemd adds. An empty string is returned if there is none,
+// e.g. for processes running on the host.
+func ContainerID(cgroup string) string {
+	parts := strings.Split(cgroup, "/")
+	for i := len(parts) - 1; i >= 0; i-- {
+		part := strings.TrimSuffix(parts[i], ".scope")
+		if j := strings.LastIndexAny(part, "-:"); j >= 0 {
+			part = part[j+1:]
+		}
+		if isContainerID(part) {
+			return part
+		}
+	}
+	return ""
+}
+
+func isContainerID(s string) bool {
+	if len(s) != 64 {
+		return false
+	}
+	for _, c := range s {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// CallerContainerID returns the container ID of the process pid, or an empty string if it does
+// not run in a container. See CallerCgroup and ContainerID.
+func CallerContainerID(pid uint32) (string, error) {
+	cgroup, err := CallerCgroup(pid)
+	if err != nil {
+		return "", err
+	}
+	return ContainerID(cgroup), nil
+}
+
+// ContainerResolver caches CallerContainerID per pid, so that hooks targeting containers
+// don't read /proc on every operation.
+//
+// Entries expire after TTL, as pids get reused. Lookups that fail (typically because the
+// process has exited) are not cached.
+type ContainerResolver struct {
+	// TTL is how long a resolved ID is reused.
+	TTL time.Duration
+	// Lookup resolves a pid. nil means CallerContainerID. It can be replaced,
+	// e.g. by a fake in tests.
+	Lookup func(pid uint32) (string, error)
+
+	mu    sync.Mutex
+	cache map[uint32]resolvedContainer
+}
+
+type resolvedContainer struct {
+	id      string
+	expires time.Time
+}
+
+// NewContainerResolver creates a ContainerResolver caching IDs for ttl.
+func NewContainerResolver(ttl time.Duration) *ContainerResolver {
+	return &ContainerResolver{
+		TTL:   ttl,
+		cache: make(map[uint32]resolvedContainer),
+	}
+}
+
+// Resolve returns the container ID of the process pid, or an empty string if it does not
+// run in a container.
+func (r *ContainerResolver) Resolve(pid uint32) (string, error) {
+	now := time.Now()
+	r.mu.Lock()
+	if c, ok := r.cache[pid]; ok && now.Before(c.expires) {
+		r.mu.Unlock()
+		return c.id, nil
+	}
+	r.mu.Unlock()
+
+	lookup := r.Lookup
+	if lookup == nil {
+		lookup = CallerContainerID
+	}
+	id, err := lookup(pid)
+	if err != nil {
+		return "", err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cache == nil {
+		r.cache = make(map[uint32]resolvedContainer)
+	}
+	if len(r.cache) > 4096 {
+		// pids come and go, don't let the dead ones pile up
+		for pid, c := range r.cache {
+			if !now.Before(c.expires) {
+				delete(r.cache, pid)
+			}
+		}
+	}
+	r.cache[pid] = resolvedContainer{id: id, expires: now.Add(r.TTL)}
+	return id, nil
+}
@@ -0,0 +1,153 @@
+package hookfs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+// groupAccessHook denies access to callers outside of group, looking their groups up with
+// groups.
+type groupAccessHook struct {
+	group  uint32
+	groups func(pid uint32) ([]uint32, error)
+}
+
+func (h *groupAccessHook) PreAccessWithContext(name string, mode uint32, context *fuse.Context) (bool, HookContext, error) {
+	groups, err := h.groups(context.Pid)
+	if err != nil {
+		return true, nil, err
+	}
+	for _, g := range groups {
+		if g == h.group {
+			return false, nil, nil
+		}
+	}
+	return true, nil, syscall.EACCES
+}
+
+func (h *groupAccessHook) PostAccess(realRetCode int32, prehookCtx HookContext) (bool, error) {
+	return false, nil
+}
+
+func TestCallerGroups(t *testing.T) {
+	want, err := os.Getgroups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups, err := CallerGroups(uint32(os.Getpid()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]int, 0, len(groups))
+	for _, g := range groups {
+		got = append(got, int(g))
+	}
+	if len(want) == 0 {
+		want = []int{}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CallerGroups = %v, want %v", got, want)
+	}
+}
+
+func TestAccessHookDecidesByCallerGroups(t *testing.T) {
+	const member, outsider = 100, 200
+	hook := &groupAccessHook{
+		group: 42,
+		groups: func(pid uint32) ([]uint32, error) {
+			switch pid {
+			case member:
+				return []uint32{7, 42}, nil
+			case outsider:
+				return []uint32{7}, nil
+			}
+			return nil, syscall.ESRCH
+		},
+	}
+	h, err := NewHookFs(t.TempDir(), t.TempDir(), hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for pid, want := range map[uint32]fuse.Status{member: fuse.OK, outsider: fuse.EACCES} {
+		context := &fuse.Context{Pid: pid}
+		if code := h.Access("", fuse.R_OK, context); code != want {
+			t.Errorf("access by pid %d = %v, want %v", pid, code, want)
+		}
+	}
+}
+
+// containerFaultHook fails the opens of the callers running in container.
+type containerFaultHook struct {
+	container string
+	resolver  *ContainerResolver
+}
+
+func (h *containerFaultHook) PreOpenWithContext(path string, flags uint32, context *fuse.Context) (bool, HookContext, error) {
+	id, err := h.resolver.Resolve(context.Pid)
+	if err != nil || id != h.container {
+		return false, nil, nil
+	}
+	return true, nil, syscall.EIO
+}
+
+func (h *containerFaultHook) PostOpen(realRetCode int32, prehookCtx HookContext) (bool, error) {
+	return false, nil
+}
+
+func TestContainerID(t *testing.T) {
+	const id = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	for cgroup, want := range map[string]string{
+		"/kubepods/burstable/pod1234/" + id:                              id,
+		"/system.slice/cri-containerd-" + id + ".scope":                  id,
+		"/kubepods.slice/kubepods-pod1234.slice/docker-" + id + ".scope": id,
+		"/user.slice/user-1000.slice/session-1.scope":                    "",
+		"/": "",
+	} {
+		if got := ContainerID(cgroup); got != want {
+			t.Errorf("ContainerID(%q) = %q, want %q", cgroup, got, want)
+		}
+	}
+}
+
+func TestContainerScopedInjection(t *testing.T) {
+	const inContainer, onHost = 100, 200
+	lookups := 0
+	resolver := NewContainerResolver(time.Hour)
+	resolver.Lookup = func(pid uint32) (string, error) {
+		lookups++
+		if pid == inContainer {
+			return "target", nil
+		}
+		return "", nil
+	}
+	original := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(original, "file"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	h, err := NewHookFs(original, t.TempDir(), &containerFaultHook{container: "target", resolver: resolver})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		for pid, want := range map[uint32]fuse.Status{inContainer: fuse.EIO, onHost: fuse.OK} {
+			f, code := h.Open("file", syscall.O_RDONLY, &fuse.Context{Pid: pid})
+			if code != want {
+				t.Errorf("open by pid %d = %v, want %v", pid, code, want)
+			}
+			if f != nil {
+				f.Release()
+			}
+		}
+	}
+	if lookups != 2 {
+		t.Errorf("%d lookups for 2 pids, want them cached", lookups)
+	}
+}
@@ -0,0 +1,1181 @@
+package hookfs
+
+import (
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/hanwen/go-fuse/fuse/pathfs"
+)
+
+// HookChain runs several hooks on a single mount, in order. It implements every HookXXX
+// interface, and each operation goes to the members implementing the matching interface
+// (or a variant of it); the other members are skipped.
+//
+// Prehooks run in order until one returns hooked, which short-circuits the rest: its results
+// go to the caller. Posthooks run in order for every member whose prehook ran, each with the
+// context it returned; members after a short-circuiting prehook get no posthook. All posthooks
+// see the real results, and the first one returning hooked decides what goes to the caller.
+//
+// Since a chain implements HookOnReadIntoWithHandle, reads always go through the data path, even
+// if all its members implement HookOnReadMetadata only.
+type HookChain []Hook
+
+// chainMemberCtx is the context a member of a HookChain returned from its prehook.
+type chainMemberCtx struct {
+	member Hook
+	ctx    HookContext
+}
+
+type chainCtx []chainMemberCtx
+
+// NewHookChain creates a HookChain running hooks in order.
+func NewHookChain(hooks ...Hook) Hook {
+	return HookChain(hooks)
+}
+
+// Init implements HookWithInit. All members are initialized, and the first error is returned.
+func (c HookChain) Init() error {
+	var firstErr error
+	for _, member := range c {
+		if hook, ok := member.(HookWithInit); ok {
+			if err := hook.Init(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// Stop implements HookWithStop
+func (c HookChain) Stop() {
+	for _, member := range c {
+		if hook, ok := member.(HookWithStop); ok {
+			hook.Stop()
+		}
+	}
+}
+
+// SetMetadata implements HookWithMetadata
+func (c HookChain) SetMetadata(metadata map[string]string) {
+	for _, member := range c {
+		if hook, ok := member.(HookWithMetadata); ok {
+			hook.SetMetadata(metadata)
+		}
+	}
+}
+
+// SetBackend implements HookWithBackend
+func (c HookChain) SetBackend(fs pathfs.FileSystem) {
+	for _, member := range c {
+		if hook, ok := member.(HookWithBackend); ok {
+			hook.SetBackend(fs)
+		}
+	}
+}
+
+// BeforeOp implements GlobalHook
+func (c HookChain) BeforeOp(op string, path string) {
+	for _, member := range c {
+		if hook, ok := member.(GlobalHook); ok {
+			hook.BeforeOp(op, path)
+		}
+	}
+}
+
+// AfterOp implements GlobalHook
+func (c HookChain) AfterOp(op string, path string, status fuse.Status, took time.Duration) {
+	for _, member := range c {
+		if hook, ok := member.(GlobalHook); ok {
+			hook.AfterOp(op, path, status, took)
+		}
+	}
+}
+
+// VirtualOpenDir implements HookWithVirtualDirs. The first member returning hooked wins.
+func (c HookChain) VirtualOpenDir(path string) ([]fuse.DirEntry, bool, error) {
+	for _, member := range c {
+		if hook, ok := member.(HookWithVirtualDirs); ok {
+			if entries, hooked, err := hook.VirtualOpenDir(path); hooked {
+				return entries, true, err
+			}
+		}
+	}
+	return nil, false, nil
+}
+
+// VirtualGetAttr implements HookWithVirtualDirs. The first member returning hooked wins.
+func (c HookChain) VirtualGetAttr(path string) (*fuse.Attr, bool, error) {
+	for _, member := range c {
+		if hook, ok := member.(HookWithVirtualDirs); ok {
+			if attr, hooked, err := hook.VirtualGetAttr(path); hooked {
+				return attr, true, err
+			}
+		}
+	}
+	return nil, false, nil
+}
+
+// readMetadataHookAdapter lets HookOnReadMetadata members take part in a chain's reads.
+type readMetadataHookAdapter struct {
+	HookOnReadMetadata
+}
+
+func (a readMetadataHookAdapter) PreReadWithHandle(path string, length int64, offset int64, handle uint64) ([]byte, bool, HookContext, error) {
+	hooked, ctx, err := a.PreReadMetadata(path, length, offset)
+	return nil, hooked, ctx, err
+}
+
+func (a readMetadataHookAdapter) PostRead(realRetCode int32, realBuf []byte, prehookCtx HookContext) ([]byte, bool, error) {
+	hooked, err := a.PostReadMetadata(realRetCode, len(realBuf), prehookCtx)
+	return realBuf, hooked, err
+}
+
+func chainReadHook(hook Hook) (HookOnReadWithHandle, bool) {
+	if h, ok := readHook(hook); ok {
+		return h, true
+	}
+	if h, ok := hook.(HookOnReadMetadata); ok {
+		return readMetadataHookAdapter{h}, true
+	}
+	return nil, false
+}
+
+// PreOpenWithContext implements HookOnOpenWithContext
+func (c HookChain) PreOpenWithContext(path string, flags uint32, context *fuse.Context) (bool, HookContext, error) {
+	var ctxs chainCtx
+	for _, member := range c {
+		hook, ok := openHook(member)
+		if !ok {
+			continue
+		}
+		hooked, ctx, err := hook.PreOpenWithContext(path, flags, context)
+		ctxs = append(ctxs, chainMemberCtx{member: member, ctx: ctx})
+		if hooked {
+			return true, ctxs, err
+		}
+	}
+	return false, ctxs, nil
+}
+
+// PostOpen implements HookOnOpenWithContext
+func (c HookChain) PostOpen(realRetCode int32, prehookCtx HookContext) (bool, error) {
+	ctxs, _ := prehookCtx.(chainCtx)
+	var hooked bool
+	var err error
+	for _, mc := range ctxs {
+		hook, _ := openHook(mc.member)
+		mHooked, mErr := hook.PostOpen(realRetCode, mc.ctx)
+		if mHooked && !hooked {
+			hooked = true
+			err = mErr
+		}
+	}
+	return hooked, err
+}
+
+// PreReadIntoWithHandle implements HookOnReadIntoWithHandle. The members which do not read
+// in place have their data copied to dest.
+func (c HookChain) PreReadIntoWithHandle(path string, dest []byte, offset int64, handle uint64) (int, bool, HookContext, error) {
+	var ctxs chainCtx
+	for _, member := range c {
+		var n int
+		var hooked bool
+		var ctx HookContext
+		var err error
+		if hook, ok := readIntoHook(member); ok {
+			n, hooked, ctx, err = hook.PreReadIntoWithHandle(path, dest, offset, handle)
+		} else if hook, ok := chainReadHook(member); ok {
+			var buf []byte
+			buf, hooked, ctx, err = hook.PreReadWithHandle(path, int64(len(dest)), offset, handle)
+			n = copy(dest, buf)
+		} else {
+			continue
+		}
+		ctxs = append(ctxs, chainMemberCtx{member: member, ctx: ctx})
+		if hooked {
+			return n, true, ctxs, err
+		}
+	}
+	return 0, false, ctxs, nil
+}
+
+// PostRead implements HookOnReadIntoWithHandle
+func (c HookChain) PostRead(realRetCode int32, realBuf []byte, prehookCtx HookContext) ([]byte, bool, error) {
+	ctxs, _ := prehookCtx.(chainCtx)
+	var buf []byte
+	var hooked bool
+	var err error
+	for _, mc := range ctxs {
+		hook, _ := chainReadHook(mc.member)
+		mBuf, mHooked, mErr := hook.PostRead(realRetCode, realBuf, mc.ctx)
+		if mHooked && !hooked {
+			hooked = true
+			buf = mBuf
+			err = mErr
+		}
+	}
+	return buf, hooked, err
+}
+
+// PreWrite implements HookOnWrite
+func (c HookChain) PreWrite(path string, buf []byte, offset int64) (bool, HookContext, error) {
+	var ctxs chainCtx
+	for _, member := range c {
+		hook, ok := member.(HookOnWrite)
+		if !ok {
+			continue
+		}
+		hooked, ctx, err := hook.PreWrite(path, buf, offset)
+		ctxs = append(ctxs, chainMemberCtx{member: member, ctx: ctx})
+		if hooked {
+			return true, ctxs, err
+		}
+	}
+	return false, ctxs, nil
+}
+
+// PostWrite implements HookOnWrite
+func (c HookChain) PostWrite(realRetCode int32, prehookCtx HookContext) (uint32, bool, error) {
+	ctxs, _ := prehookCtx.(chainCtx)
+	var written uint32
+	var hooked bool
+	var err error
+	for _, mc := range ctxs {
+		hook, _ := mc.member.(HookOnWrite)
+		mWritten, mHooked, mErr := hook.PostWrite(realRetCode, mc.ctx)
+		if mHooked && !hooked {
+			hooked = true
+			written = mWritten
+			err = mErr
+		}
+	}
+	return written, hooked, err
+}
+
+// PreMkdirWithContext implements HookOnMkdirWithContext
+func (c HookChain) PreMkdirWithContext(path string, mode uint32, context *fuse.Context) (bool, HookContext, error) {
+	var ctxs chainCtx
+	for _, member := range c {
+		hook, ok := mkdirHook(member)
+		if !ok {
+			continue
+		}
+		hooked, ctx, err := hook.PreMkdirWithContext(path, mode, context)
+		ctxs = append(ctxs, chainMemberCtx{member: member, ctx: ctx})
+		if hooked {
+			return true, ctxs, err
+		}
+	}
+	return false, ctxs, nil
+}
+
+// PostMkdir implements HookOnMkdirWithContext
+func (c HookChain) PostMkdir(realRetCode int32, prehookCtx HookContext) (bool, error) {
+	ctxs, _ := prehookCtx.(chainCtx)
+	var hooked bool
+	var err error
+	for _, mc := range ctxs {
+		hook, _ := mkdirHook(mc.member)
+		mHooked, mErr := hook.PostMkdir(realRetCode, mc.ctx)
+		if mHooked && !hooked {
+			hooked = true
+			err = mErr
+		}
+	}
+	return hooked, err
+}
+
+// PreRmdirWithContext implements HookOnRmdirWithContext
+func (c HookChain) PreRmdirWithContext(path string, context *fuse.Context) (bool, HookContext, error) {
+	var ctxs chainCtx
+	for _, member := range c {
+		hook, ok := rmdirHook(member)
+		if !ok {
+			continue
+		}
+		hooked, ctx, err := hook.PreRmdirWithContext(path, context)
+		ctxs = append(ctxs, chainMemberCtx{member: member, ctx: ctx})
+		if hooked {
+			return true, ctxs, err
+		}
+	}
+	return false, ctxs, nil
+}
+
+// PostRmdir implements HookOnRmdirWithContext
+func (c HookChain) PostRmdir(realRetCode int32, prehookCtx HookContext) (bool, error) {
+	ctxs, _ := prehookCtx.(chainCtx)
+	var hooked bool
+	var err error
+	for _, mc := range ctxs {
+		hook, _ := rmdirHook(mc.member)
+		mHooked, mErr := hook.PostRmdir(realRetCode, mc.ctx)
+		if mHooked && !hooked {
+			hooked = true
+			err = mErr
+		}
+	}
+	return hooked, err
+}
+
+// PreOpenDir implements HookOnOpenDirWithEntries
+func (c HookChain) PreOpenDir(path string) (bool, HookContext, error) {
+	var ctxs chainCtx
+	for _, member := range c {
+		hook, ok := openDirHook(member)
+		if !ok {
+			continue
+		}
+		hooked, ctx, err := hook.PreOpenDir(path)
+		ctxs = append(ctxs, chainMemberCtx{member: member, ctx: ctx})
+		if hooked {
+			return true, ctxs, err
+		}
+	}
+	return false, ctxs, nil
+}
+
+// PostOpenDirWithEntries implements HookOnOpenDirWithEntries
+func (c HookChain) PostOpenDirWithEntries(realRetCode int32, realEntries []fuse.DirEntry, prehookCtx HookContext) ([]fuse.DirEntry, bool, error) {
+	ctxs, _ := prehookCtx.(chainCtx)
+	var entries []fuse.DirEntry
+	var hooked bool
+	var err error
+	for _, mc := range ctxs {
+		hook, _ := openDirHook(mc.member)
+		mEntries, mHooked, mErr := hook.PostOpenDirWithEntries(realRetCode, realEntries, mc.ctx)
+		if mHooked && !hooked {
+			hooked = true
+			entries = mEntries
+			err = mErr
+		}
+	}
+	return entries, hooked, err
+}
+
+// PreFsync implements HookOnFsync
+func (c HookChain) PreFsync(path string, flags uint32) (bool, HookContext, error) {
+	var ctxs chainCtx
+	for _, member := range c {
+		hook, ok := member.(HookOnFsync)
+		if !ok {
+			continue
+		}
+		hooked, ctx, err := hook.PreFsync(path, flags)
+		ctxs = append(ctxs, chainMemberCtx{member: member, ctx: ctx})
+		if hooked {
+			return true, ctxs, err
+		}
+	}
+	return false, ctxs, nil
+}
+
+// PostFsync implements HookOnFsync
+func (c HookChain) PostFsync(realRetCode int32, prehookCtx HookContext) (bool, error) {
+	ctxs, _ := prehookCtx.(chainCtx)
+	var hooked bool
+	var err error
+	for _, mc := range ctxs {
+		hook, _ := mc.member.(HookOnFsync)
+		mHooked, mErr := hook.PostFsync(realRetCode, mc.ctx)
+		if mHooked && !hooked {
+			hooked = true
+			err = mErr
+		}
+	}
+	return hooked, err
+}
+
+// PreFlush implements HookOnFlush
+func (c HookChain) PreFlush(path string) (bool, HookContext, error) {
+	var ctxs chainCtx
+	for _, member := range c {
+		hook, ok := member.(HookOnFlush)
+		if !ok {
+			continue
+		}
+		hooked, ctx, err := hook.PreFlush(path)
+		ctxs = append(ctxs, chainMemberCtx{member: member, ctx: ctx})
+		if hooked {
+			return true, ctxs, err
+		}
+	}
+	return false, ctxs, nil
+}
+
+// PostFlush implements HookOnFlush
+func (c HookChain) PostFlush(realRetCode int32, prehookCtx HookContext) (bool, error) {
+	ctxs, _ := prehookCtx.(chainCtx)
+	var hooked bool
+	var err error
+	for _, mc := range ctxs {
+		hook, _ := mc.member.(HookOnFlush)
+		mHooked, mErr := hook.PostFlush(realRetCode, mc.ctx)
+		if mHooked && !hooked {
+			hooked = true
+			err = mErr
+		}
+	}
+	return hooked, err
+}
+
+// PreReleaseWithHandle implements HookOnReleaseWithHandle
+func (c HookChain) PreReleaseWithHandle(path string, flags uint32, handle uint64) (bool, HookContext) {
+	var ctxs chainCtx
+	for _, member := range c {
+		hook, ok := releaseHook(member)
+		if !ok {
+			continue
+		}
+		hooked, ctx := hook.PreReleaseWithHandle(path, flags, handle)
+		ctxs = append(ctxs, chainMemberCtx{member: member, ctx: ctx})
+		if hooked {
+			return true, ctxs
+		}
+	}
+	return false, ctxs
+}
+
+// PostRelease implements HookOnReleaseWithHandle
+func (c HookChain) PostRelease(prehookCtx HookContext) bool {
+	ctxs, _ := prehookCtx.(chainCtx)
+	var hooked bool
+	for _, mc := range ctxs {
+		hook, _ := releaseHook(mc.member)
+		mHooked := hook.PostRelease(mc.ctx)
+		if mHooked {
+			hooked = true
+		}
+	}
+	return hooked
+}
+
+// PreTruncateWithContext implements HookOnTruncateWithContext
+func (c HookChain) PreTruncateWithContext(path string, size uint64, context *fuse.Context) (bool, HookContext, error) {
+	var ctxs chainCtx
+	for _, member := range c {
+		hook, ok := truncateHook(member)
+		if !ok {
+			continue
+		}
+		hooked, ctx, err := hook.PreTruncateWithContext(path, size, context)
+		ctxs = append(ctxs, chainMemberCtx{member: member, ctx: ctx})
+		if hooked {
+			return true, ctxs, err
+		}
+	}
+	return false, ctxs, nil
+}
+
+// PostTruncate implements HookOnTruncateWithContext
+func (c HookChain) PostTruncate(realRetCode int32, prehookCtx HookContext) (bool, error) {
+	ctxs, _ := prehookCtx.(chainCtx)
+	var hooked bool
+	var err error
+	for _, mc := range ctxs {
+		hook, _ := truncateHook(mc.member)
+		mHooked, mErr := hook.PostTruncate(realRetCode, mc.ctx)
+		if mHooked && !hooked {
+			hooked = true
+			err = mErr
+		}
+	}
+	return hooked, err
+}
+
+// PreGetAttrWithContext implements HookOnGetAttrWithContext
+func (c HookChain) PreGetAttrWithContext(path string, context *fuse.Context) (bool, HookContext, error) {
+	var ctxs chainCtx
+	for _, member := range c {
+		hook, ok := getAttrHook(member)
+		if !ok {
+			continue
+		}
+		hooked, ctx, err := hook.PreGetAttrWithContext(path, context)
+		ctxs = append(ctxs, chainMemberCtx{member: member, ctx: ctx})
+		if hooked {
+			return true, ctxs, err
+		}
+	}
+	return false, ctxs, nil
+}
+
+// PostGetAttr implements HookOnGetAttrWithContext
+func (c HookChain) PostGetAttr(realRetCode int32, realAttr *fuse.Attr, prehookCtx HookContext) (*fuse.Attr, bool, error) {
+	ctxs, _ := prehookCtx.(chainCtx)
+	var attr *fuse.Attr
+	var hooked bool
+	var err error
+	for _, mc := range ctxs {
+		hook, _ := getAttrHook(mc.member)
+		mAttr, mHooked, mErr := hook.PostGetAttr(realRetCode, realAttr, mc.ctx)
+		if mHooked && !hooked {
+			hooked = true
+			attr = mAttr
+			err = mErr
+		}
+	}
+	return attr, hooked, err
+}
+
+// PreChownWithContext implements HookOnChownWithContext
+func (c HookChain) PreChownWithContext(path string, uid uint32, gid uint32, context *fuse.Context) (bool, HookContext, error) {
+	var ctxs chainCtx
+	for _, member := range c {
+		hook, ok := chownHook(member)
+		if !ok {
+			continue
+		}
+		hooked, ctx, err := hook.PreChownWithContext(path, uid, gid, context)
+		ctxs = append(ctxs, chainMemberCtx{member: member, ctx: ctx})
+		if hooked {
+			return true, ctxs, err
+		}
+	}
+	return false, ctxs, nil
+}
+
+// PostChown implements HookOnChownWithContext
+func (c HookChain) PostChown(realRetCode int32, prehookCtx HookContext) (bool, error) {
+	ctxs, _ := prehookCtx.(chainCtx)
+	var hooked bool
+	var err error
+	for _, mc := range ctxs {
+		hook, _ := chownHook(mc.member)
+		mHooked, mErr := hook.PostChown(realRetCode, mc.ctx)
+		if mHooked && !hooked {
+			hooked = true
+			err = mErr
+		}
+	}
+	return hooked, err
+}
+
+// PreChmodWithContext implements HookOnChmodWithContext
+func (c HookChain) PreChmodWithContext(path string, perms uint32, context *fuse.Context) (bool, HookContext, error) {
+	var ctxs chainCtx
+	for _, member := range c {
+		hook, ok := chmodHook(member)
+		if !ok {
+			continue
+		}
+		hooked, ctx, err := hook.PreChmodWithContext(path, perms, context)
+		ctxs = append(ctxs, chainMemberCtx{member: member, ctx: ctx})
+		if hooked {
+			return true, ctxs, err
+		}
+	}
+	return false, ctxs, nil
+}
+
+// PostChmod implements HookOnChmodWithContext
+func (c HookChain) PostChmod(realRetCode int32, prehookCtx HookContext) (bool, error) {
+	ctxs, _ := prehookCtx.(chainCtx)
+	var hooked bool
+	var err error
+	for _, mc := range ctxs {
+		hook, _ := chmodHook(mc.member)
+		mHooked, mErr := hook.PostChmod(realRetCode, mc.ctx)
+		if mHooked && !hooked {
+			hooked = true
+			err = mErr
+		}
+	}
+	return hooked, err
+}
+
+// PreUtimensWithContext implements HookOnUtimensWithContext
+func (c HookChain) PreUtimensWithContext(path string, atime *time.Time, mtime *time.Time, context *fuse.Context) (bool, HookContext, error) {
+	var ctxs chainCtx
+	for _, member := range c {
+		hook, ok := utimensHook(member)
+		if !ok {
+			continue
+		}
+		hooked, ctx, err := hook.PreUtimensWithContext(path, atime, mtime, context)
+		ctxs = append(ctxs, chainMemberCtx{member: member, ctx: ctx})
+		if hooked {
+			return true, ctxs, err
+		}
+	}
+	return false, ctxs, nil
+}
+
+// PostUtimens implements HookOnUtimensWithContext
+func (c HookChain) PostUtimens(realRetCode int32, prehookCtx HookContext) (bool, error) {
+	ctxs, _ := prehookCtx.(chainCtx)
+	var hooked bool
+	var err error
+	for _, mc := range ctxs {
+		hook, _ := utimensHook(mc.member)
+		mHooked, mErr := hook.PostUtimens(realRetCode, mc.ctx)
+		if mHooked && !hooked {
+			hooked = true
+			err = mErr
+		}
+	}
+	return hooked, err
+}
+
+// PreAllocate implements HookOnAllocate
+func (c HookChain) PreAllocate(path string, off uint64, size uint64, mode uint32) (bool, HookContext, error) {
+	var ctxs chainCtx
+	for _, member := range c {
+		hook, ok := member.(HookOnAllocate)
+		if !ok {
+			continue
+		}
+		hooked, ctx, err := hook.PreAllocate(path, off, size, mode)
+		ctxs = append(ctxs, chainMemberCtx{member: member, ctx: ctx})
+		if hooked {
+			return true, ctxs, err
+		}
+	}
+	return false, ctxs, nil
+}
+
+// PostAllocate implements HookOnAllocate
+func (c HookChain) PostAllocate(realRetCode int32, prehookCtx HookContext) (bool, error) {
+	ctxs, _ := prehookCtx.(chainCtx)
+	var hooked bool
+	var err error
+	for _, mc := range ctxs {
+		hook, _ := mc.member.(HookOnAllocate)
+		mHooked, mErr := hook.PostAllocate(realRetCode, mc.ctx)
+		if mHooked && !hooked {
+			hooked = true
+			err = mErr
+		}
+	}
+	return hooked, err
+}
+
+// PreGetLk implements HookOnGetLk
+func (c HookChain) PreGetLk(path string, owner uint64, lk *fuse.FileLock, flags uint32, out *fuse.FileLock) (bool, HookContext, error) {
+	var ctxs chainCtx
+	for _, member := range c {
+		hook, ok := member.(HookOnGetLk)
+		if !ok {
+			continue
+		}
+		hooked, ctx, err := hook.PreGetLk(path, owner, lk, flags, out)
+		ctxs = append(ctxs, chainMemberCtx{member: member, ctx: ctx})
+		if hooked {
+			return true, ctxs, err
+		}
+	}
+	return false, ctxs, nil
+}
+
+// PostGetLk implements HookOnGetLk
+func (c HookChain) PostGetLk(realRetCode int32, prehookCtx HookContext) (bool, error) {
+	ctxs, _ := prehookCtx.(chainCtx)
+	var hooked bool
+	var err error
+	for _, mc := range ctxs {
+		hook, _ := mc.member.(HookOnGetLk)
+		mHooked, mErr := hook.PostGetLk(realRetCode, mc.ctx)
+		if mHooked && !hooked {
+			hooked = true
+			err = mErr
+		}
+	}
+	return hooked, err
+}
+
+// PreSetLk implements HookOnSetLk
+func (c HookChain) PreSetLk(path string, owner uint64, lk *fuse.FileLock, flags uint32) (bool, HookContext, error) {
+	var ctxs chainCtx
+	for _, member := range c {
+		hook, ok := member.(HookOnSetLk)
+		if !ok {
+			continue
+		}
+		hooked, ctx, err := hook.PreSetLk(path, owner, lk, flags)
+		ctxs = append(ctxs, chainMemberCtx{member: member, ctx: ctx})
+		if hooked {
+			return true, ctxs, err
+		}
+	}
+	return false, ctxs, nil
+}
+
+// PostSetLk implements HookOnSetLk
+func (c HookChain) PostSetLk(realRetCode int32, prehookCtx HookContext) (bool, error) {
+	ctxs, _ := prehookCtx.(chainCtx)
+	var hooked bool
+	var err error
+	for _, mc := range ctxs {
+		hook, _ := mc.member.(HookOnSetLk)
+		mHooked, mErr := hook.PostSetLk(realRetCode, mc.ctx)
+		if mHooked && !hooked {
+			hooked = true
+			err = mErr
+		}
+	}
+	return hooked, err
+}
+
+// PreSetLkw implements HookOnSetLkw
+func (c HookChain) PreSetLkw(path string, owner uint64, lk *fuse.FileLock, flags uint32) (bool, HookContext, error) {
+	var ctxs chainCtx
+	for _, member := range c {
+		hook, ok := member.(HookOnSetLkw)
+		if !ok {
+			continue
+		}
+		hooked, ctx, err := hook.PreSetLkw(path, owner, lk, flags)
+		ctxs = append(ctxs, chainMemberCtx{member: member, ctx: ctx})
+		if hooked {
+			return true, ctxs, err
+		}
+	}
+	return false, ctxs, nil
+}
+
+// PostSetLkw implements HookOnSetLkw
+func (c HookChain) PostSetLkw(realRetCode int32, prehookCtx HookContext) (bool, error) {
+	ctxs, _ := prehookCtx.(chainCtx)
+	var hooked bool
+	var err error
+	for _, mc := range ctxs {
+		hook, _ := mc.member.(HookOnSetLkw)
+		mHooked, mErr := hook.PostSetLkw(realRetCode, mc.ctx)
+		if mHooked && !hooked {
+			hooked = true
+			err = mErr
+		}
+	}
+	return hooked, err
+}
+
+// PreStatFsWithResult implements HookOnStatFsWithResult
+func (c HookChain) PreStatFsWithResult(path string) (*fuse.StatfsOut, bool, HookContext, error) {
+	var ctxs chainCtx
+	for _, member := range c {
+		hook, ok := statFsHook(member)
+		if !ok {
+			continue
+		}
+		out, hooked, ctx, err := hook.PreStatFsWithResult(path)
+		ctxs = append(ctxs, chainMemberCtx{member: member, ctx: ctx})
+		if hooked {
+			return out, true, ctxs, err
+		}
+	}
+	return nil, false, ctxs, nil
+}
+
+// PostStatFsWithResult implements HookOnStatFsWithResult
+func (c HookChain) PostStatFsWithResult(realOut *fuse.StatfsOut, prehookCtx HookContext) (*fuse.StatfsOut, bool, error) {
+	ctxs, _ := prehookCtx.(chainCtx)
+	var out *fuse.StatfsOut
+	var hooked bool
+	var err error
+	for _, mc := range ctxs {
+		hook, _ := statFsHook(mc.member)
+		mOut, mHooked, mErr := hook.PostStatFsWithResult(realOut, mc.ctx)
+		if mHooked && !hooked {
+			hooked = true
+			out = mOut
+			err = mErr
+		}
+	}
+	return out, hooked, err
+}
+
+// PreReadlinkWithContext implements HookOnReadlinkWithContext
+func (c HookChain) PreReadlinkWithContext(name string, context *fuse.Context) (bool, HookContext, error) {
+	var ctxs chainCtx
+	for _, member := range c {
+		hook, ok := readlinkHook(member)
+		if !ok {
+			continue
+		}
+		hooked, ctx, err := hook.PreReadlinkWithContext(name, context)
+		ctxs = append(ctxs, chainMemberCtx{member: member, ctx: ctx})
+		if hooked {
+			return true, ctxs, err
+		}
+	}
+	return false, ctxs, nil
+}
+
+// PostReadlink implements HookOnReadlinkWithContext
+func (c HookChain) PostReadlink(realRetCode int32, prehookCtx HookContext) (bool, error) {
+	ctxs, _ := prehookCtx.(chainCtx)
+	var hooked bool
+	var err error
+	for _, mc := range ctxs {
+		hook, _ := readlinkHook(mc.member)
+		mHooked, mErr := hook.PostReadlink(realRetCode, mc.ctx)
+		if mHooked && !hooked {
+			hooked = true
+			err = mErr
+		}
+	}
+	return hooked, err
+}
+
+// PreSymlinkWithContext implements HookOnSymlinkWithContext
+func (c HookChain) PreSymlinkWithContext(value string, linkName string, context *fuse.Context) (bool, HookContext, error) {
+	var ctxs chainCtx
+	for _, member := range c {
+		hook, ok := symlinkHook(member)
+		if !ok {
+			continue
+		}
+		hooked, ctx, err := hook.PreSymlinkWithContext(value, linkName, context)
+		ctxs = append(ctxs, chainMemberCtx{member: member, ctx: ctx})
+		if hooked {
+			return true, ctxs, err
+		}
+	}
+	return false, ctxs, nil
+}
+
+// PostSymlink implements HookOnSymlinkWithContext
+func (c HookChain) PostSymlink(realRetCode int32, prehookCtx HookContext) (bool, error) {
+	ctxs, _ := prehookCtx.(chainCtx)
+	var hooked bool
+	var err error
+	for _, mc := range ctxs {
+		hook, _ := symlinkHook(mc.member)
+		mHooked, mErr := hook.PostSymlink(realRetCode, mc.ctx)
+		if mHooked && !hooked {
+			hooked = true
+			err = mErr
+		}
+	}
+	return hooked, err
+}
+
+// PreCreateWithContext implements HookOnCreateWithContext
+func (c HookChain) PreCreateWithContext(name string, flags uint32, mode uint32, context *fuse.Context) (bool, HookContext, error) {
+	var ctxs chainCtx
+	for _, member := range c {
+		hook, ok := createHook(member)
+		if !ok {
+			continue
+		}
+		hooked, ctx, err := hook.PreCreateWithContext(name, flags, mode, context)
+		ctxs = append(ctxs, chainMemberCtx{member: member, ctx: ctx})
+		if hooked {
+			return true, ctxs, err
+		}
+	}
+	return false, ctxs, nil
+}
+
+// PostCreate implements HookOnCreateWithContext
+func (c HookChain) PostCreate(realRetCode int32, prehookCtx HookContext) (bool, error) {
+	ctxs, _ := prehookCtx.(chainCtx)
+	var hooked bool
+	var err error
+	for _, mc := range ctxs {
+		hook, _ := createHook(mc.member)
+		mHooked, mErr := hook.PostCreate(realRetCode, mc.ctx)
+		if mHooked && !hooked {
+			hooked = true
+			err = mErr
+		}
+	}
+	return hooked, err
+}
+
+// PreAccessWithContext implements HookOnAccessWithContext
+func (c HookChain) PreAccessWithContext(name string, mode uint32, context *fuse.Context) (bool, HookContext, error) {
+	var ctxs chainCtx
+	for _, member := range c {
+		hook, ok := accessHook(member)
+		if !ok {
+			continue
+		}
+		hooked, ctx, err := hook.PreAccessWithContext(name, mode, context)
+		ctxs = append(ctxs, chainMemberCtx{member: member, ctx: ctx})
+		if hooked {
+			return true, ctxs, err
+		}
+	}
+	return false, ctxs, nil
+}
+
+// PostAccess implements HookOnAccessWithContext
+func (c HookChain) PostAccess(realRetCode int32, prehookCtx HookContext) (bool, error) {
+	ctxs, _ := prehookCtx.(chainCtx)
+	var hooked bool
+	var err error
+	for _, mc := range ctxs {
+		hook, _ := accessHook(mc.member)
+		mHooked, mErr := hook.PostAccess(realRetCode, mc.ctx)
+		if mHooked && !hooked {
+			hooked = true
+			err = mErr
+		}
+	}
+	return hooked, err
+}
+
+// PreLinkWithContext implements HookOnLinkWithContext
+func (c HookChain) PreLinkWithContext(oldName string, newName string, context *fuse.Context) (bool, HookContext, error) {
+	var ctxs chainCtx
+	for _, member := range c {
+		hook, ok := linkHook(member)
+		if !ok {
+			continue
+		}
+		hooked, ctx, err := hook.PreLinkWithContext(oldName, newName, context)
+		ctxs = append(ctxs, chainMemberCtx{member: member, ctx: ctx})
+		if hooked {
+			return true, ctxs, err
+		}
+	}
+	return false, ctxs, nil
+}
+
+// PostLink implements HookOnLinkWithContext
+func (c HookChain) PostLink(realRetCode int32, prehookCtx HookContext) (bool, error) {
+	ctxs, _ := prehookCtx.(chainCtx)
+	var hooked bool
+	var err error
+	for _, mc := range ctxs {
+		hook, _ := linkHook(mc.member)
+		mHooked, mErr := hook.PostLink(realRetCode, mc.ctx)
+		if mHooked && !hooked {
+			hooked = true
+			err = mErr
+		}
+	}
+	return hooked, err
+}
+
+// PreMknodWithContext implements HookOnMknodWithContext
+func (c HookChain) PreMknodWithContext(name string, mode uint32, dev uint32, context *fuse.Context) (bool, HookContext, error) {
+	var ctxs chainCtx
+	for _, member := range c {
+		hook, ok := mknodHook(member)
+		if !ok {
+			continue
+		}
+		hooked, ctx, err := hook.PreMknodWithContext(name, mode, dev, context)
+		ctxs = append(ctxs, chainMemberCtx{member: member, ctx: ctx})
+		if hooked {
+			return true, ctxs, err
+		}
+	}
+	return false, ctxs, nil
+}
+
+// PostMknod implements HookOnMknodWithContext
+func (c HookChain) PostMknod(realRetCode int32, prehookCtx HookContext) (bool, error) {
+	ctxs, _ := prehookCtx.(chainCtx)
+	var hooked bool
+	var err error
+	for _, mc := range ctxs {
+		hook, _ := mknodHook(mc.member)
+		mHooked, mErr := hook.PostMknod(realRetCode, mc.ctx)
+		if mHooked && !hooked {
+			hooked = true
+			err = mErr
+		}
+	}
+	return hooked, err
+}
+
+// PreRenameWithContext implements HookOnRenameWithContext
+func (c HookChain) PreRenameWithContext(oldName string, newName string, context *fuse.Context) (bool, HookContext, error) {
+	var ctxs chainCtx
+	for _, member := range c {
+		hook, ok := renameHook(member)
+		if !ok {
+			continue
+		}
+		hooked, ctx, err := hook.PreRenameWithContext(oldName, newName, context)
+		ctxs = append(ctxs, chainMemberCtx{member: member, ctx: ctx})
+		if hooked {
+			return true, ctxs, err
+		}
+	}
+	return false, ctxs, nil
+}
+
+// PostRename implements HookOnRenameWithContext
+func (c HookChain) PostRename(realRetCode int32, prehookCtx HookContext) (bool, error) {
+	ctxs, _ := prehookCtx.(chainCtx)
+	var hooked bool
+	var err error
+	for _, mc := range ctxs {
+		hook, _ := renameHook(mc.member)
+		mHooked, mErr := hook.PostRename(realRetCode, mc.ctx)
+		if mHooked && !hooked {
+			hooked = true
+			err = mErr
+		}
+	}
+	return hooked, err
+}
+
+// PreUnlinkWithContext implements HookOnUnlinkWithContext
+func (c HookChain) PreUnlinkWithContext(name string, context *fuse.Context) (bool, HookContext, error) {
+	var ctxs chainCtx
+	for _, member := range c {
+		hook, ok := unlinkHook(member)
+		if !ok {
+			continue
+		}
+		hooked, ctx, err := hook.PreUnlinkWithContext(name, context)
+		ctxs = append(ctxs, chainMemberCtx{member: member, ctx: ctx})
+		if hooked {
+			return true, ctxs, err
+		}
+	}
+	return false, ctxs, nil
+}
+
+// PostUnlink implements HookOnUnlinkWithContext
+func (c HookChain) PostUnlink(realRetCode int32, prehookCtx HookContext) (bool, error) {
+	ctxs, _ := prehookCtx.(chainCtx)
+	var hooked bool
+	var err error
+	for _, mc := range ctxs {
+		hook, _ := unlinkHook(mc.member)
+		mHooked, mErr := hook.PostUnlink(realRetCode, mc.ctx)
+		if mHooked && !hooked {
+			hooked = true
+			err = mErr
+		}
+	}
+	return hooked, err
+}
+
+// PreGetXAttrWithContext implements HookOnGetXAttrWithContext
+func (c HookChain) PreGetXAttrWithContext(name string, attribute string, context *fuse.Context) (bool, HookContext, error) {
+	var ctxs chainCtx
+	for _, member := range c {
+		hook, ok := getXAttrHook(member)
+		if !ok {
+			continue
+		}
+		hooked, ctx, err := hook.PreGetXAttrWithContext(name, attribute, context)
+		ctxs = append(ctxs, chainMemberCtx{member: member, ctx: ctx})
+		if hooked {
+			return true, ctxs, err
+		}
+	}
+	return false, ctxs, nil
+}
+
+// PostGetXAttr implements HookOnGetXAttrWithContext
+func (c HookChain) PostGetXAttr(realRetCode int32, prehookCtx HookContext) (bool, error) {
+	ctxs, _ := prehookCtx.(chainCtx)
+	var hooked bool
+	var err error
+	for _, mc := range ctxs {
+		hook, _ := getXAttrHook(mc.member)
+		mHooked, mErr := hook.PostGetXAttr(realRetCode, mc.ctx)
+		if mHooked && !hooked {
+			hooked = true
+			err = mErr
+		}
+	}
+	return hooked, err
+}
+
+// PreListXAttrWithContext implements HookOnListXAttrWithContext
+func (c HookChain) PreListXAttrWithContext(name string, context *fuse.Context) (bool, HookContext, error) {
+	var ctxs chainCtx
+	for _, member := range c {
+		hook, ok := listXAttrHook(member)
+		if !ok {
+			continue
+		}
+		hooked, ctx, err := hook.PreListXAttrWithContext(name, context)
+		ctxs = append(ctxs, chainMemberCtx{member: member, ctx: ctx})
+		if hooked {
+			return true, ctxs, err
+		}
+	}
+	return false, ctxs, nil
+}
+
+// PostListXAttr implements HookOnListXAttrWithContext
+func (c HookChain) PostListXAttr(realRetCode int32, prehookCtx HookContext) (bool, error) {
+	ctxs, _ := prehookCtx.(chainCtx)
+	var hooked bool
+	var err error
+	for _, mc := range ctxs {
+		hook, _ := listXAttrHook(mc.member)
+		mHooked, mErr := hook.PostListXAttr(realRetCode, mc.ctx)
+		if mHooked && !hooked {
+			hooked = true
+			err = mErr
+		}
+	}
+	return hooked, err
+}
+
+// PreRemoveXAttrWithContext implements HookOnRemoveXAttrWithContext
+func (c HookChain) PreRemoveXAttrWithContext(name string, attr string, context *fuse.Context) (bool, HookContext, error) {
+	var ctxs chainCtx
+	for _, member := range c {
+		hook, ok := removeXAttrHook(member)
+		if !ok {
+			continue
+		}
+		hooked, ctx, err := hook.PreRemoveXAttrWithContext(name, attr, context)
+		ctxs = append(ctxs, chainMemberCtx{member: member, ctx: ctx})
+		if hooked {
+			return true, ctxs, err
+		}
+	}
+	return false, ctxs, nil
+}
+
+// PostRemoveXAttr implements HookOnRemoveXAttrWithContext
+func (c HookChain) PostRemoveXAttr(realRetCode int32, prehookCtx HookContext) (bool, error) {
+	ctxs, _ := prehookCtx.(chainCtx)
+	var hooked bool
+	var err error
+	for _, mc := range ctxs {
+		hook, _ := removeXAttrHook(mc.member)
+		mHooked, mErr := hook.PostRemoveXAttr(realRetCode, mc.ctx)
+		if mHooked && !hooked {
+			hooked = true
+			err = mErr
+		}
+	}
+	return hooked, err
+}
+
+// PreSetXAttrWithContext implements HookOnSetXAttrWithContext
+func (c HookChain) PreSetXAttrWithContext(name string, attr string, data []byte, flags int, context *fuse.Context) (bool, HookContext, error) {
+	var ctxs chainCtx
+	for _, member := range c {
+		hook, ok := setXAttrHook(member)
+		if !ok {
+			continue
+		}
+		hooked, ctx, err := hook.PreSetXAttrWithContext(name, attr, data, flags, context)
+		ctxs = append(ctxs, chainMemberCtx{member: member, ctx: ctx})
+		if hooked {
+			return true, ctxs, err
+		}
+	}
+	return false, ctxs, nil
+}
+
+// PostSetXAttr implements HookOnSetXAttrWithContext
+func (c HookChain) PostSetXAttr(realRetCode int32, prehookCtx HookContext) (bool, error) {
+	ctxs, _ := prehookCtx.(chainCtx)
+	var hooked bool
+	var err error
+	for _, mc := range ctxs {
+		hook, _ := setXAttrHook(mc.member)
+		mHooked, mErr := hook.PostSetXAttr(realRetCode, mc.ctx)
+		if mHooked && !hooked {
+			hooked = true
+			err = mErr
+		}
+	}
+	return hooked, err
+}
@@ -0,0 +1,285 @@
+package hookfs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/hanwen/go-fuse/fuse/nodefs"
+	"github.com/hanwen/go-fuse/fuse/pathfs"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxSymlinks is how many symlinks are followed in a row before giving up, as Linux does.
+const maxSymlinks = 40
+
+// containedFileSystem refuses the operations on fs which would leave root, for
+// Options.ContainPaths. Names are checked before every operation: those with a ".." component
+// are refused, and so are those resolving outside of root through symlinks, either in their
+// directory or, for the operations following them, in their last component.
+type containedFileSystem struct {
+	pathfs.FileSystem
+	// root is the resolved absolute path of the original directory, or "" when there is
+	// none, in which case only ".." is refused.
+	root string
+}
+
+func newContainedFileSystem(fs pathfs.FileSystem, root string) *containedFileSystem {
+	if root != "" {
+		if resolved, err := filepath.EvalSymlinks(root); err == nil {
+			root = resolved
+		}
+	}
+	return &containedFileSystem{FileSystem: fs, root: root}
+}
+
+// within tells whether the resolved path p is root or below it.
+func (c *containedFileSystem) within(p string) bool {
+	return c.root == "/" || p == c.root || strings.HasPrefix(p, c.root+"/")
+}
+
+// check returns fuse.OK if the operation on name stays within root. follow tells whether the
+// operation follows name if it is a symlink.
+func (c *containedFileSystem) check(name string, follow bool) fuse.Status {
+	for _, elem := range strings.Split(name, "/") {
+		if elem == ".." {
+			log.WithField("name", name).Warn("ContainPaths: refusing a name with ..")
+			return fuse.EACCES
+		}
+	}
+	rel := strings.Trim(filepath.Clean("/"+name), "/")
+	if c.root == "" || rel == "" {
+		return fuse.OK
+	}
+
+	p := filepath.Join(c.root, rel)
+	var resolved string
+	var err error
+	if follow {
+		resolved, err = resolveLast(p)
+	} else {
+		resolved, err = filepath.EvalSymlinks(filepath.Dir(p))
+		resolved = filepath.Join(resolved, filepath.Base(p))
+	}
+	if err != nil {
+		// the operation would fail the same way
+		return fuse.ToStatus(err)
+	}
+	if !c.within(resolved) {
+		log.WithFields(log.Fields{
+			"name":     name,
+			"resolved": resolved,
+			"root":     c.root,
+		}).Warn("ContainPaths: refusing a name resolving outside of the original directory")
+		return fuse.EACCES
+	}
+	return fuse.OK
+}
+
+// resolveLast returns p with all its symlinks resolved, the last one included even if what
+// it points to is missing, e.g. for a creation through it.
+func resolveLast(p string) (string, error) {
+	for i := 0; i < maxSymlinks; i++ {
+		dir, err := filepath.EvalSymlinks(filepath.Dir(p))
+		if err != nil {
+			return "", err
+		}
+		p = filepath.Join(dir, filepath.Base(p))
+		target, err := os.Readlink(p)
+		if err != nil {
+			// not a symlink, or missing
+			return p, nil
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(dir, target)
+		}
+		p = target
+	}
+	return "", syscall.ELOOP
+}
+
+// GetAttr implements hanwen/go-fuse/fuse/pathfs.FileSystem.
+func (c *containedFileSystem) GetAttr(name string, context *fuse.Context) (*fuse.Attr, fuse.Status) {
+	if code := c.check(name, false); !code.Ok() {
+		return nil, code
+	}
+	return c.FileSystem.GetAttr(name, context)
+}
+
+// Chmod implements hanwen/go-fuse/fuse/pathfs.FileSystem.
+func (c *containedFileSystem) Chmod(name string, mode uint32, context *fuse.Context) fuse.Status {
+	if code := c.check(name, true); !code.Ok() {
+		return code
+	}
+	return c.FileSystem.Chmod(name, mode, context)
+}
+
+// Chown implements hanwen/go-fuse/fuse/pathfs.FileSystem.
+func (c *containedFileSystem) Chown(name string, uid uint32, gid uint32, context *fuse.Context) fuse.Status {
+	if code := c.check(name, true); !code.Ok() {
+		return code
+	}
+	return c.FileSystem.Chown(name, uid, gid, context)
+}
+
+// Utimens implements hanwen/go-fuse/fuse/pathfs.FileSystem.
+func (c *containedFileSystem) Utimens(name string, atime *time.Time, mtime *time.Time, context *fuse.Context) fuse.Status {
+	if code := c.check(name, false); !code.Ok() {
+		return code
+	}
+	return c.FileSystem.Utimens(name, atime, mtime, context)
+}
+
+// Truncate implements hanwen/go-fuse/fuse/pathfs.FileSystem.
+func (c *containedFileSystem) Truncate(name string, size uint64, context *fuse.Context) fuse.Status {
+	if code := c.check(name, true); !code.Ok() {
+		return code
+	}
+	return c.FileSystem.Truncate(name, size, context)
+}
+
+// Access implements hanwen/go-fuse/fuse/pathfs.FileSystem.
+func (c *containedFileSystem) Access(name string, mode uint32, context *fuse.Context) fuse.Status {
+	if code := c.check(name, true); !code.Ok() {
+		return code
+	}
+	return c.FileSystem.Access(name, mode, context)
+}
+
+// Link implements hanwen/go-fuse/fuse/pathfs.FileSystem.
+func (c *containedFileSystem) Link(oldName string, newName string, context *fuse.Context) fuse.Status {
+	if code := c.check(oldName, false); !code.Ok() {
+		return code
+	}
+	if code := c.check(newName, false); !code.Ok() {
+		return code
+	}
+	return c.FileSystem.Link(oldName, newName, context)
+}
+
+// Mkdir implements hanwen/go-fuse/fuse/pathfs.FileSystem.
+func (c *containedFileSystem) Mkdir(name string, mode uint32, context *fuse.Context) fuse.Status {
+	if code := c.check(name, false); !code.Ok() {
+		return code
+	}
+	return c.FileSystem.Mkdir(name, mode, context)
+}
+
+// Mknod implements hanwen/go-fuse/fuse/pathfs.FileSystem.
+func (c *containedFileSystem) Mknod(name string, mode uint32, dev uint32, context *fuse.Context) fuse.Status {
+	if code := c.check(name, false); !code.Ok() {
+		return code
+	}
+	return c.FileSystem.Mknod(name, mode, dev, context)
+}
+
+// Rename implements hanwen/go-fuse/fuse/pathfs.FileSystem.
+func (c *containedFileSystem) Rename(oldName string, newName string, context *fuse.Context) fuse.Status {
+	if code := c.check(oldName, false); !code.Ok() {
+		return code
+	}
+	if code := c.check(newName, false); !code.Ok() {
+		return code
+	}
+	return c.FileSystem.Rename(oldName, newName, context)
+}
+
+// Rmdir implements hanwen/go-fuse/fuse/pathfs.FileSystem.
+func (c *containedFileSystem) Rmdir(name string, context *fuse.Context) fuse.Status {
+	if code := c.check(name, false); !code.Ok() {
+		return code
+	}
+	return c.FileSystem.Rmdir(name, context)
+}
+
+// Unlink implements hanwen/go-fuse/fuse/pathfs.FileSystem.
+func (c *containedFileSystem) Unlink(name string, context *fuse.Context) fuse.Status {
+	if code := c.check(name, false); !code.Ok() {
+		return code
+	}
+	return c.FileSystem.Unlink(name, context)
+}
+
+// GetXAttr implements hanwen/go-fuse/fuse/pathfs.FileSystem.
+func (c *containedFileSystem) GetXAttr(name string, attribute string, context *fuse.Context) ([]byte, fuse.Status) {
+	if code := c.check(name, true); !code.Ok() {
+		return nil, code
+	}
+	return c.FileSystem.GetXAttr(name, attribute, context)
+}
+
+// ListXAttr implements hanwen/go-fuse/fuse/pathfs.FileSystem.
+func (c *containedFileSystem) ListXAttr(name string, context *fuse.Context) ([]string, fuse.Status) {
+	if code := c.check(name, true); !code.Ok() {
+		return nil, code
+	}
+	return c.FileSystem.ListXAttr(name, context)
+}
+
+// RemoveXAttr implements hanwen/go-fuse/fuse/pathfs.FileSystem.
+func (c *containedFileSystem) RemoveXAttr(name string, attr string, context *fuse.Context) fuse.Status {
+	if code := c.check(name, true); !code.Ok() {
+		return code
+	}
+	return c.FileSystem.RemoveXAttr(name, attr, context)
+}
+
+// SetXAttr implements hanwen/go-fuse/fuse/pathfs.FileSystem.
+func (c *containedFileSystem) SetXAttr(name string, attr string, data []byte, flags int, context *fuse.Context) fuse.Status {
+	if code := c.check(name, true); !code.Ok() {
+		return code
+	}
+	return c.FileSystem.SetXAttr(name, attr, data, flags, context)
+}
+
+// Open implements hanwen/go-fuse/fuse/pathfs.FileSystem.
+func (c *containedFileSystem) Open(name string, flags uint32, context *fuse.Context) (nodefs.File, fuse.Status) {
+	if code := c.check(name, true); !code.Ok() {
+		return nil, code
+	}
+	return c.FileSystem.Open(name, flags, context)
+}
+
+// Create implements hanwen/go-fuse/fuse/pathfs.FileSystem.
+func (c *containedFileSystem) Create(name string, flags uint32, mode uint32, context *fuse.Context) (nodefs.File, fuse.Status) {
+	if code := c.check(name, true); !code.Ok() {
+		return nil, code
+	}
+	return c.FileSystem.Create(name, flags, mode, context)
+}
+
+// OpenDir implements hanwen/go-fuse/fuse/pathfs.FileSystem.
+func (c *containedFileSystem) OpenDir(name string, context *fuse.Context) ([]fuse.DirEntry, fuse.Status) {
+	if code := c.check(name, true); !code.Ok() {
+		return nil, code
+	}
+	return c.FileSystem.OpenDir(name, context)
+}
+
+// Symlink implements hanwen/go-fuse/fuse/pathfs.FileSystem. Where the symlink points is not
+// checked: it is followed by the callers, not by hookfs.
+func (c *containedFileSystem) Symlink(value string, linkName string, context *fuse.Context) fuse.Status {
+	if code := c.check(linkName, false); !code.Ok() {
+		return code
+	}
+	return c.FileSystem.Symlink(value, linkName, context)
+}
+
+// Readlink implements hanwen/go-fuse/fuse/pathfs.FileSystem.
+func (c *containedFileSystem) Readlink(name string, context *fuse.Context) (string, fuse.Status) {
+	if code := c.check(name, false); !code.Ok() {
+		return "", code
+	}
+	return c.FileSystem.Readlink(name, context)
+}
+
+// StatFs implements hanwen/go-fuse/fuse/pathfs.FileSystem.
+func (c *containedFileSystem) StatFs(name string) *fuse.StatfsOut {
+	if code := c.check(name, true); !code.Ok() {
+		return nil
+	}
+	return c.FileSystem.StatFs(name)
+}
@@ -0,0 +1,123 @@
+package hookfs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+// escapeFixture makes an original directory, and outside of it a secret file with links to
+// it and to its directory from within.
+func escapeFixture(t *testing.T) (original string, outside string) {
+	original = t.TempDir()
+	outside = t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for link, target := range map[string]string{
+		"outdir":      outside,
+		"outfile":     filepath.Join(outside, "secret"),
+		"outdangling": filepath.Join(outside, "new"),
+		"indir":       "sub",
+	} {
+		if err := os.Symlink(target, filepath.Join(original, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(original, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(original, "sub", "file"), []byte("file"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return original, outside
+}
+
+func TestContainPathsRefusesEscapes(t *testing.T) {
+	original, outside := escapeFixture(t)
+	h, err := NewHookFsWithOptions(original, t.TempDir(), nil, &Options{ContainPaths: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refused := map[string]func() fuse.Status{
+		"dotdot getattr": func() fuse.Status {
+			_, code := h.GetAttr("sub/../../"+filepath.Base(outside)+"/secret", nil)
+			return code
+		},
+		"open through a directory link": func() fuse.Status {
+			_, code := h.Open("outdir/secret", uint32(os.O_RDONLY), nil)
+			return code
+		},
+		"getattr through a directory link": func() fuse.Status {
+			_, code := h.GetAttr("outdir/secret", nil)
+			return code
+		},
+		"open a file link": func() fuse.Status {
+			_, code := h.Open("outfile", uint32(os.O_RDONLY), nil)
+			return code
+		},
+		"chmod a file link": func() fuse.Status {
+			return h.Chmod("outfile", 0777, nil)
+		},
+		"create through a dangling link": func() fuse.Status {
+			_, code := h.Create("outdangling", uint32(os.O_WRONLY), 0644, nil)
+			return code
+		},
+		"unlink through a directory link": func() fuse.Status {
+			return h.Unlink("outdir/secret", nil)
+		},
+	}
+	for name, op := range refused {
+		if code := op(); code != fuse.EACCES {
+			t.Errorf("%s: got %v, want EACCES", name, code)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(outside, "new")); !os.IsNotExist(err) {
+		t.Errorf("a file was created outside of the original directory: %v", err)
+	}
+	if fi, err := os.Stat(filepath.Join(outside, "secret")); err != nil || fi.Mode().Perm() != 0644 {
+		t.Errorf("the secret file was changed: %v, %v", fi.Mode(), err)
+	}
+
+	// the links themselves and the links within the original directory keep working
+	if attr, code := h.GetAttr("outfile", nil); !code.Ok() || attr.Mode&syscall.S_IFMT != syscall.S_IFLNK {
+		t.Errorf("getattr of a link: %v", code)
+	}
+	if target, code := h.Readlink("outdir", nil); !code.Ok() || target != outside {
+		t.Errorf("readlink = %q, %v", target, code)
+	}
+	f, code := h.Open("indir/file", uint32(os.O_RDONLY), nil)
+	if !code.Ok() {
+		t.Fatalf("open through a link within: %v", code)
+	}
+	f.Release()
+}
+
+func TestContainPathsRefusesRacedDirectory(t *testing.T) {
+	original, outside := escapeFixture(t)
+	// the kernel caches the entries of the mount, so it keeps taking d for a directory
+	_, _, mnt := mountOn(t, original, nil, &Options{ContainPaths: true, EntryTimeout: time.Hour, AttrTimeout: time.Hour})
+	if err := os.Mkdir(filepath.Join(original, "d"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(mnt, "d")); err != nil {
+		t.Fatal(err)
+	}
+
+	// d is replaced by a link to the outside, directly in the original directory
+	if err := os.Remove(filepath.Join(original, "d")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(original, "d")); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(mnt, "d", "secret")); !os.IsPermission(err) {
+		t.Errorf("read the secret through the mount: %q, %v", data, err)
+	}
+}
@@ -0,0 +1,517 @@
+package hookfs
+
+import (
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+// The adapters below let the fs dispatch to the XXXWithContext variant of a hook interface,
+// falling back to the plain interface for hooks that don't care about the caller.
+
+type openHookAdapter struct {
+	HookOnOpen
+}
+
+func (a openHookAdapter) PreOpenWithContext(path string, flags uint32, context *fuse.Context) (bool, HookContext, error) {
+	return a.PreOpen(path, flags)
+}
+
+func openHook(hook Hook) (HookOnOpenWithContext, bool) {
+	if h, ok := hook.(HookOnOpenWithContext); ok {
+		return h, true
+	}
+	if h, ok := hook.(HookOnOpen); ok {
+		return openHookAdapter{h}, true
+	}
+	return nil, false
+}
+
+type createHookAdapter struct {
+	HookOnCreate
+}
+
+func (a createHookAdapter) PreCreateWithContext(name string, flags uint32, mode uint32, context *fuse.Context) (bool, HookContext, error) {
+	return a.PreCreate(name, flags, mode)
+}
+
+func createHook(hook Hook) (HookOnCreateWithContext, bool) {
+	if h, ok := hook.(HookOnCreateWithContext); ok {
+		return h, true
+	}
+	if h, ok := hook.(HookOnCreate); ok {
+		return createHookAdapter{h}, true
+	}
+	return nil, false
+}
+
+type accessHookAdapter struct {
+	HookOnAccess
+}
+
+func (a accessHookAdapter) PreAccessWithContext(name string, mode uint32, context *fuse.Context) (bool, HookContext, error) {
+	return a.PreAccess(name, mode)
+}
+
+func accessHook(hook Hook) (HookOnAccessWithContext, bool) {
+	if h, ok := hook.(HookOnAccessWithContext); ok {
+		return h, true
+	}
+	if h, ok := hook.(HookOnAccess); ok {
+		return accessHookAdapter{h}, true
+	}
+	return nil, false
+}
+
+type openDirHookAdapter struct {
+	HookOnOpenDir
+}
+
+func (a openDirHookAdapter) PostOpenDirWithEntries(realRetCode int32, realEntries []fuse.DirEntry, prehookCtx HookContext) ([]fuse.DirEntry, bool, error) {
+	hooked, err := a.PostOpenDir(realRetCode, prehookCtx)
+	return realEntries, hooked, err
+}
+
+func openDirHook(hook Hook) (HookOnOpenDirWithEntries, bool) {
+	if h, ok := hook.(HookOnOpenDirWithEntries); ok {
+		return h, true
+	}
+	if h, ok := hook.(HookOnOpenDir); ok {
+		return openDirHookAdapter{h}, true
+	}
+	return nil, false
+}
+
+type getAttrHookAdapter struct {
+	HookOnGetAttr
+}
+
+func (a getAttrHookAdapter) PreGetAttrWithContext(path string, context *fuse.Context) (bool, HookContext, error) {
+	return a.PreGetAttr(path)
+}
+
+func getAttrHook(hook Hook) (HookOnGetAttrWithContext, bool) {
+	if h, ok := hook.(HookOnGetAttrWithContext); ok {
+		return h, true
+	}
+	if h, ok := hook.(HookOnGetAttr); ok {
+		return getAttrHookAdapter{h}, true
+	}
+	return nil, false
+}
+
+type readHookAdapter struct {
+	HookOnRead
+}
+
+func (a readHookAdapter) PreReadWithHandle(path string, length int64, offset int64, handle uint64) ([]byte, bool, HookContext, error) {
+	return a.PreRead(path, length, offset)
+}
+
+type readIntoHookAdapter struct {
+	HookOnReadInto
+}
+
+func (a readIntoHookAdapter) PreReadIntoWithHandle(path string, dest []byte, offset int64, handle uint64) (int, bool, HookContext, error) {
+	return a.PreReadInto(path, dest, offset)
+}
+
+// readIntoHook returns the hooks filling the buffer of the read in place.
+func readIntoHook(hook Hook) (HookOnReadIntoWithHandle, bool) {
+	if h, ok := hook.(HookOnReadIntoWithHandle); ok {
+		return h, true
+	}
+	if h, ok := hook.(HookOnReadInto); ok {
+		return readIntoHookAdapter{h}, true
+	}
+	return nil, false
+}
+
+// readIntoBufHookAdapter serves a HookOnReadIntoWithHandle through a buffer of its own.
+// hookFile.Read calls PreReadIntoWithHandle with the buffer of the read instead.
+type readIntoBufHookAdapter struct {
+	HookOnReadIntoWithHandle
+}
+
+func (a readIntoBufHookAdapter) PreReadWithHandle(path string, length int64, offset int64, handle uint64) ([]byte, bool, HookContext, error) {
+	buf := make([]byte, length)
+	n, hooked, ctx, err := a.PreReadIntoWithHandle(path, buf, offset, handle)
+	return buf[:clampReadLen(n, len(buf))], hooked, ctx, err
+}
+
+// clampReadLen returns the number of bytes a HookOnReadInto wrote, n, within a buffer of size.
+func clampReadLen(n int, size int) int {
+	if n < 0 {
+		return 0
+	}
+	if n > size {
+		return size
+	}
+	return n
+}
+
+func readHook(hook Hook) (HookOnReadWithHandle, bool) {
+	if h, ok := readIntoHook(hook); ok {
+		return readIntoBufHookAdapter{h}, true
+	}
+	if h, ok := hook.(HookOnReadWithHandle); ok {
+		return h, true
+	}
+	if h, ok := hook.(HookOnRead); ok {
+		return readHookAdapter{h}, true
+	}
+	return nil, false
+}
+
+type releaseHookAdapter struct {
+	HookOnRelease
+}
+
+func (a releaseHookAdapter) PreReleaseWithHandle(path string, flags uint32, handle uint64) (bool, HookContext) {
+	return a.PreRelease(path)
+}
+
+type releaseWithFlagsHookAdapter struct {
+	HookOnReleaseWithFlags
+}
+
+func (a releaseWithFlagsHookAdapter) PreReleaseWithHandle(path string, flags uint32, handle uint64) (bool, HookContext) {
+	return a.PreReleaseWithFlags(path, flags)
+}
+
+func releaseHook(hook Hook) (HookOnReleaseWithHandle, bool) {
+	if h, ok := hook.(HookOnReleaseWithHandle); ok {
+		return h, true
+	}
+	if h, ok := hook.(HookOnReleaseWithFlags); ok {
+		return releaseWithFlagsHookAdapter{h}, true
+	}
+	if h, ok := hook.(HookOnRelease); ok {
+		return releaseHookAdapter{h}, true
+	}
+	return nil, false
+}
+
+type chmodHookAdapter struct {
+	HookOnChmod
+}
+
+func (a chmodHookAdapter) PreChmodWithContext(path string, perms uint32, context *fuse.Context) (bool, HookContext, error) {
+	return a.PreChmod(path, perms)
+}
+
+func chmodHook(hook Hook) (HookOnChmodWithContext, bool) {
+	if h, ok := hook.(HookOnChmodWithContext); ok {
+		return h, true
+	}
+	if h, ok := hook.(HookOnChmod); ok {
+		return chmodHookAdapter{h}, true
+	}
+	return nil, false
+}
+
+type chownHookAdapter struct {
+	HookOnChown
+}
+
+func (a chownHookAdapter) PreChownWithContext(path string, uid uint32, gid uint32, context *fuse.Context) (bool, HookContext, error) {
+	return a.PreChown(path, uid, gid)
+}
+
+func chownHook(hook Hook) (HookOnChownWithContext, bool) {
+	if h, ok := hook.(HookOnChownWithContext); ok {
+		return h, true
+	}
+	if h, ok := hook.(HookOnChown); ok {
+		return chownHookAdapter{h}, true
+	}
+	return nil, false
+}
+
+type utimensHookAdapter struct {
+	HookOnUtimens
+}
+
+func (a utimensHookAdapter) PreUtimensWithContext(path string, atime *time.Time, mtime *time.Time, context *fuse.Context) (bool, HookContext, error) {
+	return a.PreUtimens(path, atime, mtime)
+}
+
+func utimensHook(hook Hook) (HookOnUtimensWithContext, bool) {
+	if h, ok := hook.(HookOnUtimensWithContext); ok {
+		return h, true
+	}
+	if h, ok := hook.(HookOnUtimens); ok {
+		return utimensHookAdapter{h}, true
+	}
+	return nil, false
+}
+
+type truncateHookAdapter struct {
+	HookOnTruncate
+}
+
+func (a truncateHookAdapter) PreTruncateWithContext(path string, size uint64, context *fuse.Context) (bool, HookContext, error) {
+	return a.PreTruncate(path, size)
+}
+
+func truncateHook(hook Hook) (HookOnTruncateWithContext, bool) {
+	if h, ok := hook.(HookOnTruncateWithContext); ok {
+		return h, true
+	}
+	if h, ok := hook.(HookOnTruncate); ok {
+		return truncateHookAdapter{h}, true
+	}
+	return nil, false
+}
+
+type linkHookAdapter struct {
+	HookOnLink
+}
+
+func (a linkHookAdapter) PreLinkWithContext(oldName string, newName string, context *fuse.Context) (bool, HookContext, error) {
+	return a.PreLink(oldName, newName)
+}
+
+func linkHook(hook Hook) (HookOnLinkWithContext, bool) {
+	if h, ok := hook.(HookOnLinkWithContext); ok {
+		return h, true
+	}
+	if h, ok := hook.(HookOnLink); ok {
+		return linkHookAdapter{h}, true
+	}
+	return nil, false
+}
+
+type mkdirHookAdapter struct {
+	HookOnMkdir
+}
+
+func (a mkdirHookAdapter) PreMkdirWithContext(path string, mode uint32, context *fuse.Context) (bool, HookContext, error) {
+	return a.PreMkdir(path, mode)
+}
+
+func mkdirHook(hook Hook) (HookOnMkdirWithContext, bool) {
+	if h, ok := hook.(HookOnMkdirWithContext); ok {
+		return h, true
+	}
+	if h, ok := hook.(HookOnMkdir); ok {
+		return mkdirHookAdapter{h}, true
+	}
+	return nil, false
+}
+
+type mknodHookAdapter struct {
+	HookOnMknod
+}
+
+func (a mknodHookAdapter) PreMknodWithContext(name string, mode uint32, dev uint32, context *fuse.Context) (bool, HookContext, error) {
+	return a.PreMknod(name, mode, dev)
+}
+
+func mknodHook(hook Hook) (HookOnMknodWithContext, bool) {
+	if h, ok := hook.(HookOnMknodWithContext); ok {
+		return h, true
+	}
+	if h, ok := hook.(HookOnMknod); ok {
+		return mknodHookAdapter{h}, true
+	}
+	return nil, false
+}
+
+type renameHookAdapter struct {
+	HookOnRename
+}
+
+func (a renameHookAdapter) PreRenameWithContext(oldName string, newName string, context *fuse.Context) (bool, HookContext, error) {
+	return a.PreRename(oldName, newName)
+}
+
+type rename2HookAdapter struct {
+	HookOnRename2
+}
+
+func (a rename2HookAdapter) PreRenameWithContext(oldName string, newName string, context *fuse.Context) (bool, HookContext, error) {
+	// pathfs does not get the flags of renameat2
+	return a.PreRename2(oldName, newName, 0)
+}
+
+func renameHook(hook Hook) (HookOnRenameWithContext, bool) {
+	if h, ok := hook.(HookOnRenameWithContext); ok {
+		return h, true
+	}
+	if h, ok := hook.(HookOnRename2); ok {
+		return rename2HookAdapter{h}, true
+	}
+	if h, ok := hook.(HookOnRename); ok {
+		return renameHookAdapter{h}, true
+	}
+	return nil, false
+}
+
+type rmdirHookAdapter struct {
+	HookOnRmdir
+}
+
+func (a rmdirHookAdapter) PreRmdirWithContext(path string, context *fuse.Context) (bool, HookContext, error) {
+	return a.PreRmdir(path)
+}
+
+func rmdirHook(hook Hook) (HookOnRmdirWithContext, bool) {
+	if h, ok := hook.(HookOnRmdirWithContext); ok {
+		return h, true
+	}
+	if h, ok := hook.(HookOnRmdir); ok {
+		return rmdirHookAdapter{h}, true
+	}
+	return nil, false
+}
+
+type unlinkHookAdapter struct {
+	HookOnUnlink
+}
+
+func (a unlinkHookAdapter) PreUnlinkWithContext(name string, context *fuse.Context) (bool, HookContext, error) {
+	return a.PreUnlink(name)
+}
+
+func unlinkHook(hook Hook) (HookOnUnlinkWithContext, bool) {
+	if h, ok := hook.(HookOnUnlinkWithContext); ok {
+		return h, true
+	}
+	if h, ok := hook.(HookOnUnlink); ok {
+		return unlinkHookAdapter{h}, true
+	}
+	return nil, false
+}
+
+type getXAttrHookAdapter struct {
+	HookOnGetXAttr
+}
+
+func (a getXAttrHookAdapter) PreGetXAttrWithContext(name string, attribute string, context *fuse.Context) (bool, HookContext, error) {
+	return a.PreGetXAttr(name, attribute)
+}
+
+func getXAttrHook(hook Hook) (HookOnGetXAttrWithContext, bool) {
+	if h, ok := hook.(HookOnGetXAttrWithContext); ok {
+		return h, true
+	}
+	if h, ok := hook.(HookOnGetXAttr); ok {
+		return getXAttrHookAdapter{h}, true
+	}
+	return nil, false
+}
+
+type listXAttrHookAdapter struct {
+	HookOnListXAttr
+}
+
+func (a listXAttrHookAdapter) PreListXAttrWithContext(name string, context *fuse.Context) (bool, HookContext, error) {
+	return a.PreListXAttr(name)
+}
+
+func listXAttrHook(hook Hook) (HookOnListXAttrWithContext, bool) {
+	if h, ok := hook.(HookOnListXAttrWithContext); ok {
+		return h, true
+	}
+	if h, ok := hook.(HookOnListXAttr); ok {
+		return listXAttrHookAdapter{h}, true
+	}
+	return nil, false
+}
+
+type removeXAttrHookAdapter struct {
+	HookOnRemoveXAttr
+}
+
+func (a removeXAttrHookAdapter) PreRemoveXAttrWithContext(name string, attr string, context *fuse.Context) (bool, HookContext, error) {
+	return a.PreRemoveXAttr(name, attr)
+}
+
+func removeXAttrHook(hook Hook) (HookOnRemoveXAttrWithContext, bool) {
+	if h, ok := hook.(HookOnRemoveXAttrWithContext); ok {
+		return h, true
+	}
+	if h, ok := hook.(HookOnRemoveXAttr); ok {
+		return removeXAttrHookAdapter{h}, true
+	}
+	return nil, false
+}
+
+type setXAttrHookAdapter struct {
+	HookOnSetXAttr
+}
+
+func (a setXAttrHookAdapter) PreSetXAttrWithContext(name string, attr string, data []byte, flags int, context *fuse.Context) (bool, HookContext, error) {
+	return a.PreSetXAttr(name, attr, data, flags)
+}
+
+func setXAttrHook(hook Hook) (HookOnSetXAttrWithContext, bool) {
+	if h, ok := hook.(HookOnSetXAttrWithContext); ok {
+		return h, true
+	}
+	if h, ok := hook.(HookOnSetXAttr); ok {
+		return setXAttrHookAdapter{h}, true
+	}
+	return nil, false
+}
+
+type symlinkHookAdapter struct {
+	HookOnSymlink
+}
+
+func (a symlinkHookAdapter) PreSymlinkWithContext(value string, linkName string, context *fuse.Context) (bool, HookContext, error) {
+	return a.PreSymlink(value, linkName)
+}
+
+func symlinkHook(hook Hook) (HookOnSymlinkWithContext, bool) {
+	if h, ok := hook.(HookOnSymlinkWithContext); ok {
+		return h, true
+	}
+	if h, ok := hook.(HookOnSymlink); ok {
+		return symlinkHookAdapter{h}, true
+	}
+	return nil, false
+}
+
+type readlinkHookAdapter struct {
+	HookOnReadlink
+}
+
+func (a readlinkHookAdapter) PreReadlinkWithContext(name string, context *fuse.Context) (bool, HookContext, error) {
+	return a.PreReadlink(name)
+}
+
+func readlinkHook(hook Hook) (HookOnReadlinkWithContext, bool) {
+	if h, ok := hook.(HookOnReadlinkWithContext); ok {
+		return h, true
+	}
+	if h, ok := hook.(HookOnReadlink); ok {
+		return readlinkHookAdapter{h}, true
+	}
+	return nil, false
+}
+
+type statFsHookAdapter struct {
+	HookOnStatFs
+}
+
+func (a statFsHookAdapter) PreStatFsWithResult(path string) (*fuse.StatfsOut, bool, HookContext, error) {
+	hooked, ctx, err := a.PreStatFs(path)
+	return nil, hooked, ctx, err
+}
+
+func (a statFsHookAdapter) PostStatFsWithResult(realOut *fuse.StatfsOut, prehookCtx HookContext) (*fuse.StatfsOut, bool, error) {
+	hooked, err := a.PostStatFs(prehookCtx)
+	return realOut, hooked, err
+}
+
+func statFsHook(hook Hook) (HookOnStatFsWithResult, bool) {
+	if h, ok := hook.(HookOnStatFsWithResult); ok {
+		return h, true
+	}
+	if h, ok := hook.(HookOnStatFs); ok {
+		return statFsHookAdapter{h}, true
+	}
+	return nil, false
+}
@@ -0,0 +1,117 @@
+package hookfs
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// hookedOps maps every operation to whether a hook handles it.
+var hookedOps = []struct {
+	op     string
+	hooked func(hook Hook) bool
+}{
+	{OpOpen, func(hook Hook) bool { _, ok := openHook(hook); return ok }},
+	{OpRead, func(hook Hook) bool {
+		_, ok := readHook(hook)
+		_, okMetadata := hook.(HookOnReadMetadata)
+		return ok || okMetadata
+	}},
+	{OpWrite, func(hook Hook) bool { _, ok := hook.(HookOnWrite); return ok }},
+	{OpMkdir, func(hook Hook) bool { _, ok := mkdirHook(hook); return ok }},
+	{OpRmdir, func(hook Hook) bool { _, ok := rmdirHook(hook); return ok }},
+	{OpOpenDir, func(hook Hook) bool { _, ok := openDirHook(hook); return ok }},
+	{OpFsync, func(hook Hook) bool { _, ok := hook.(HookOnFsync); return ok }},
+	{OpFlush, func(hook Hook) bool { _, ok := hook.(HookOnFlush); return ok }},
+	{OpRelease, func(hook Hook) bool { _, ok := releaseHook(hook); return ok }},
+	{OpTruncate, func(hook Hook) bool { _, ok := truncateHook(hook); return ok }},
+	{OpGetAttr, func(hook Hook) bool { _, ok := getAttrHook(hook); return ok }},
+	{OpChown, func(hook Hook) bool { _, ok := chownHook(hook); return ok }},
+	{OpChmod, func(hook Hook) bool { _, ok := chmodHook(hook); return ok }},
+	{OpUtimens, func(hook Hook) bool { _, ok := utimensHook(hook); return ok }},
+	{OpAllocate, func(hook Hook) bool { _, ok := hook.(HookOnAllocate); return ok }},
+	{OpGetLk, func(hook Hook) bool { _, ok := hook.(HookOnGetLk); return ok }},
+	{OpSetLk, func(hook Hook) bool { _, ok := hook.(HookOnSetLk); return ok }},
+	{OpSetLkw, func(hook Hook) bool { _, ok := hook.(HookOnSetLkw); return ok }},
+	{OpStatFs, func(hook Hook) bool { _, ok := statFsHook(hook); return ok }},
+	{OpReadlink, func(hook Hook) bool { _, ok := readlinkHook(hook); return ok }},
+	{OpSymlink, func(hook Hook) bool { _, ok := symlinkHook(hook); return ok }},
+	{OpCreate, func(hook Hook) bool { _, ok := createHook(hook); return ok }},
+	{OpAccess, func(hook Hook) bool { _, ok := accessHook(hook); return ok }},
+	{OpLink, func(hook Hook) bool { _, ok := linkHook(hook); return ok }},
+	{OpMknod, func(hook Hook) bool { _, ok := mknodHook(hook); return ok }},
+	{OpRename, func(hook Hook) bool { _, ok := renameHook(hook); return ok }},
+	{OpUnlink, func(hook Hook) bool { _, ok := unlinkHook(hook); return ok }},
+	{OpGetXAttr, func(hook Hook) bool { _, ok := getXAttrHook(hook); return ok }},
+	{OpListXAttr, func(hook Hook) bool { _, ok := listXAttrHook(hook); return ok }},
+	{OpRemoveXAttr, func(hook Hook) bool { _, ok := removeXAttrHook(hook); return ok }},
+	{OpSetXAttr, func(hook Hook) bool { _, ok := setXAttrHook(hook); return ok }},
+}
+
+// DescribeConfig returns a human-readable description of the effective configuration of h:
+// the directories, the options, the type of the hook, and the operations it handles.
+// This is meant for debugging; the format may change.
+//
+// A hook whose Init failed on mount is disabled, and reported as none.
+func (h *HookFs) DescribeConfig() string {
+	h.backendMu.RLock()
+	original, originalAbs := h.Original, h.originalAbs
+	h.backendMu.RUnlock()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "original: %s (%s)\n", original, originalAbs)
+	fmt.Fprintf(&b, "mountpoint: %s (%s)\n", h.Mountpoint, h.mountpointAbs)
+	fmt.Fprintf(&b, "fsname: %s\n", h.FsName)
+	fmt.Fprintf(&b, "options: %+v\n", h.opts)
+
+	hook := h.currentHook()
+	if hook == nil {
+		b.WriteString("hook: none\n")
+		return b.String()
+	}
+	var extras []string
+	if _, ok := hook.(HookWithInit); ok {
+		extras = append(extras, "init")
+	}
+	if _, ok := hook.(HookWithStop); ok {
+		extras = append(extras, "stop")
+	}
+	if _, ok := hook.(HookWithMetadata); ok {
+		extras = append(extras, "metadata")
+	}
+	if _, ok := hook.(HookWithBackend); ok {
+		extras = append(extras, "backend")
+	}
+	if _, ok := hook.(GlobalHook); ok {
+		extras = append(extras, "global")
+	}
+	if _, ok := hook.(HookWithVirtualDirs); ok {
+		extras = append(extras, "virtual dirs")
+	}
+	fmt.Fprintf(&b, "hook: %T", hook)
+	if len(extras) > 0 {
+		fmt.Fprintf(&b, " (%s)", strings.Join(extras, ", "))
+	}
+	b.WriteString("\n")
+
+	var ops []string
+	for _, o := range hookedOps {
+		if o.hooked(hook) {
+			ops = append(ops, o.op)
+		}
+	}
+	fmt.Fprintf(&b, "hooked operations: %s\n", strings.Join(ops, ", "))
+	return b.String()
+}
+
+// DescribeHandler returns an http.Handler serving DescribeConfig as plain text, to be
+// registered next to the /debug/vars of expvar, e.g.
+//
+//	http.Handle("/debug/hookfs", h.DescribeHandler())
+func (h *HookFs) DescribeHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		io.WriteString(w, h.DescribeConfig())
+	})
+}
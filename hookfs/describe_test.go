@@ -0,0 +1,48 @@
+package hookfs
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDescribeConfig(t *testing.T) {
+	h, err := NewHookFsWithOptions(t.TempDir(), t.TempDir(), &writeRecorder{}, &Options{ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(h.DescribeHandler())
+	defer server.Close()
+	resp, err := server.Client().Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	served, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	desc := h.DescribeConfig()
+	if string(served) != desc {
+		t.Errorf("DescribeHandler served %q, want %q", served, desc)
+	}
+	for _, want := range []string{
+		"ReadOnly:true",
+		"hook: *hookfs.writeRecorder\n",
+		"hooked operations: write\n",
+	} {
+		if !strings.Contains(desc, want) {
+			t.Errorf("DescribeConfig() = %q, missing %q", desc, want)
+		}
+	}
+
+	h, err = NewHookFs(t.TempDir(), t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if desc := h.DescribeConfig(); !strings.Contains(desc, "hook: none\n") {
+		t.Errorf("DescribeConfig() without a hook = %q, missing %q", desc, "hook: none")
+	}
+}
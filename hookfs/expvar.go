@@ -0,0 +1,115 @@
+package hookfs
+
+import (
+	"expvar"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+// expvarBuckets are the upper bounds of the latency histogram buckets.
+var expvarBuckets = []time.Duration{
+	100 * time.Microsecond,
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+}
+
+// expvarMetrics publishes per-operation counters and latency histograms with expvar (Options.ExpvarName).
+//
+// The published map looks like
+//
+//	{"read": {"calls": 10, "errors": 1, "latency": {"100us": 7, "1ms": 2, "10ms": 1, "100ms": 0, "1s": 0, "inf": 0}}, ...}
+type expvarMetrics struct {
+	root *expvar.Map
+	mu   sync.Mutex
+	ops  map[string]*expvarOp
+}
+
+type expvarOp struct {
+	calls   *expvar.Int
+	errors  *expvar.Int
+	buckets []*expvar.Int
+}
+
+func newExpvarMetrics(name string) (*expvarMetrics, error) {
+	var root *expvar.Map
+	switch v := expvar.Get(name).(type) {
+	case nil:
+		root = expvar.NewMap(name)
+	case *expvar.Map:
+		// shared with another HookFs using the same name
+		root = v
+	default:
+		return nil, fmt.Errorf("expvar %q is already published and is not a map", name)
+	}
+	return &expvarMetrics{root: root, ops: make(map[string]*expvarOp)}, nil
+}
+
+func (m *expvarMetrics) op(name string) *expvarOp {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if o, ok := m.ops[name]; ok {
+		return o
+	}
+
+	// another HookFs sharing the root may have published the op already
+	opMap, ok := m.root.Get(name).(*expvar.Map)
+	if !ok {
+		opMap = new(expvar.Map).Init()
+		m.root.Set(name, opMap)
+	}
+	latency, ok := opMap.Get("latency").(*expvar.Map)
+	if !ok {
+		latency = new(expvar.Map).Init()
+		opMap.Set("latency", latency)
+	}
+
+	o := &expvarOp{
+		calls:  expvarInt(opMap, "calls"),
+		errors: expvarInt(opMap, "errors"),
+	}
+	for _, b := range expvarBuckets {
+		o.buckets = append(o.buckets, expvarInt(latency, fmtBucket(b)))
+	}
+	o.buckets = append(o.buckets, expvarInt(latency, "inf"))
+	m.ops[name] = o
+	return o
+}
+
+// expvarInt returns the *expvar.Int for key in m, adding it if it is missing.
+func expvarInt(m *expvar.Map, key string) *expvar.Int {
+	if v, ok := m.Get(key).(*expvar.Int); ok {
+		return v
+	}
+	v := new(expvar.Int)
+	m.Set(key, v)
+	return v
+}
+
+func (m *expvarMetrics) observe(op string, code fuse.Status, took time.Duration) {
+	o := m.op(op)
+	o.calls.Add(1)
+	if !code.Ok() {
+		o.errors.Add(1)
+	}
+	i := 0
+	for i < len(expvarBuckets) && took > expvarBuckets[i] {
+		i++
+	}
+	o.buckets[i].Add(1)
+}
+
+func fmtBucket(d time.Duration) string {
+	switch {
+	case d < time.Millisecond:
+		return fmt.Sprintf("%dus", d/time.Microsecond)
+	case d < time.Second:
+		return fmt.Sprintf("%dms", d/time.Millisecond)
+	default:
+		return fmt.Sprintf("%ds", d/time.Second)
+	}
+}
@@ -0,0 +1,44 @@
+package hookfs
+
+import (
+	"encoding/json"
+	"expvar"
+	"testing"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+func TestExpvarCounts(t *testing.T) {
+	h, err := NewHookFsWithOptions(t.TempDir(), t.TempDir(), nil, &Options{ExpvarName: "hookfs_test_expvar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := &fuse.Context{}
+	for i := 0; i < 3; i++ {
+		// the second and third fail with EEXIST
+		h.Mkdir("dir", 0755, ctx)
+	}
+	h.GetAttr("dir", ctx)
+
+	var published map[string]struct {
+		Calls   int64
+		Errors  int64
+		Latency map[string]int64
+	}
+	if err := json.Unmarshal([]byte(expvar.Get("hookfs_test_expvar").String()), &published); err != nil {
+		t.Fatal(err)
+	}
+	for op, want := range map[string][2]int64{OpMkdir: {3, 2}, OpGetAttr: {1, 0}} {
+		got := published[op]
+		if got.Calls != want[0] || got.Errors != want[1] {
+			t.Errorf("%s: %d calls and %d errors, want %d and %d", op, got.Calls, got.Errors, want[0], want[1])
+		}
+		var observed int64
+		for _, n := range got.Latency {
+			observed += n
+		}
+		if observed != want[0] {
+			t.Errorf("%s: %d calls in the latency histogram, want %d", op, observed, want[0])
+		}
+	}
+}
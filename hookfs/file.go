@@ -2,6 +2,7 @@ package hookfs
 
 import (
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"github.com/hanwen/go-fuse/fuse"
@@ -10,21 +11,33 @@ import (
 )
 
 type hookFile struct {
-	file nodefs.File
-	name string
-	hook Hook
+	file   nodefs.File
+	name   string
+	flags  uint32 // as passed to Open or Create
+	handle uint64
+	hook   Hook
+	fs     *HookFs
+	fsync  *fsyncCoalescer
+	// writeback is nil unless Options.WritebackCache is set
+	writeback *writebackCache
 }
 
-func newHookFile(file nodefs.File, name string, hook Hook) (*hookFile, error) {
+func newHookFile(file nodefs.File, name string, flags uint32, fs *HookFs) (*hookFile, error) {
 	log.WithFields(log.Fields{
-		"file": file,
-		"name": name,
+		"file":  file,
+		"name":  name,
+		"flags": flags,
 	}).Debug("Hooking a file")
 
 	hookfile := &hookFile{
-		file: file,
-		name: name,
-		hook: hook,
+		file:      file,
+		name:      name,
+		flags:     flags,
+		handle:    atomic.AddUint64(&fs.lastHandle, 1),
+		hook:      fs.currentHook(),
+		fs:        fs,
+		fsync:     newFsyncCoalescer(fs.opts.FsyncCoalesceWindow),
+		writeback: newWritebackCache(fs.opts.WritebackCache),
 	}
 	return hookfile, nil
 }
@@ -45,8 +58,32 @@ func (h *hookFile) InnerFile() nodefs.File {
 }
 
 // implements nodefs.File
-func (h *hookFile) Read(dest []byte, off int64) (fuse.ReadResult, fuse.Status) {
-	hook, hookEnabled := h.hook.(HookOnRead)
+func (h *hookFile) Read(dest []byte, off int64) (rr fuse.ReadResult, code fuse.Status) {
+	span := h.fs.begin(OpRead, h.name)
+	defer h.fs.observe(span, &code)
+	h.syncWriteback()
+	// passedThrough is whether rr comes from h.file as is
+	passedThrough := false
+	defer func() {
+		if code.Ok() && rr != nil && (h.fs.throughput != nil || h.fs.onResult.Load() != nil) {
+			span.bytes = rr.Size()
+			if passedThrough {
+				span.bytes = h.readSize(rr, off)
+			}
+			h.fs.throughput.add(h.name, span.bytes, 0)
+		}
+	}()
+	if h.hook == nil {
+		passedThrough = true
+		return h.file.Read(dest, off)
+	}
+	hook, hookEnabled := readHook(h.hook)
+	if !hookEnabled {
+		if hook, ok := h.hook.(HookOnReadMetadata); ok {
+			passedThrough = true
+			return h.readMetadata(span, hook, dest, off)
+		}
+	}
 	var prehookBuf, posthookBuf []byte
 	var prehookErr, posthookErr error
 	var prehooked, posthooked bool
@@ -59,7 +96,22 @@ func (h *hookFile) Read(dest []byte, off int64) (fuse.ReadResult, fuse.Status) {
 	}).Trace("f.Read")
 
 	if hookEnabled {
-		prehookBuf, prehooked, prehookCtx, prehookErr = hook.PreRead(h.name, int64(len(dest)), off)
+		if into, ok := readIntoHook(h.hook); ok {
+			var n int
+			n, prehooked, prehookCtx, prehookErr = into.PreReadIntoWithHandle(h.name, dest, off, h.handle)
+			if prehooked {
+				if n < 0 || n > len(dest) {
+					log.WithFields(log.Fields{
+						"h":       h,
+						"n":       n,
+						"destLen": len(dest),
+					}).Warn("Read: Prehooked, but n is out of dest. Clamping it.")
+				}
+				prehookBuf = dest[:clampReadLen(n, len(dest))]
+			}
+		} else {
+			prehookBuf, prehooked, prehookCtx, prehookErr = hook.PreReadWithHandle(h.name, int64(len(dest)), off, h.handle)
+		}
 		if prehooked {
 			log.WithFields(log.Fields{
 				"h": h,
@@ -67,6 +119,15 @@ func (h *hookFile) Read(dest []byte, off int64) (fuse.ReadResult, fuse.Status) {
 				"prehookErr": prehookErr,
 				"prehookCtx": prehookCtx,
 			}).Debug("Read: Prehooked")
+			span.disposition = DispositionPrehooked
+			if len(prehookBuf) > len(dest) {
+				log.WithFields(log.Fields{
+					"h":             h,
+					"prehookBufLen": len(prehookBuf),
+					"destLen":       len(dest),
+				}).Warn("Read: Prehooked, but prehookBuf is longer than requested. Clamping it.")
+				prehookBuf = prehookBuf[:len(dest)]
+			}
 			return fuse.ReadResultData(prehookBuf), fuse.ToStatus(prehookErr)
 		}
 	}
@@ -79,7 +140,7 @@ func (h *hookFile) Read(dest []byte, off int64) (fuse.ReadResult, fuse.Status) {
 		}
 		posthookBuf, posthooked, posthookErr = hook.PostRead(int32(lowerCode), lowerRRBuf, prehookCtx)
 		if posthooked {
-			if len(posthookBuf) != len(lowerRRBuf) {
+			if len(posthookBuf) > len(dest) {
 				log.WithFields(log.Fields{
 					"h": h,
 					// "posthookBuf": posthookBuf,
@@ -87,7 +148,8 @@ func (h *hookFile) Read(dest []byte, off int64) (fuse.ReadResult, fuse.Status) {
 					"posthookBufLen": len(posthookBuf),
 					"lowerRRBufLen":  len(lowerRRBuf),
 					"destLen":        len(dest),
-				}).Warn("Read: Posthooked, but posthookBuf length != lowerrRRBuf length. You may get a strange behavior.")
+				}).Warn("Read: Posthooked, but posthookBuf is longer than requested. Clamping it.")
+				posthookBuf = posthookBuf[:len(dest)]
 			}
 
 			log.WithFields(log.Fields{
@@ -95,16 +157,109 @@ func (h *hookFile) Read(dest []byte, off int64) (fuse.ReadResult, fuse.Status) {
 				// "posthookBuf": posthookBuf,
 				"posthookErr": posthookErr,
 			}).Debug("Read: Posthooked")
+			span.disposition = DispositionPosthooked
 			return fuse.ReadResultData(posthookBuf), fuse.ToStatus(posthookErr)
 		}
+		// already read
+		return fuse.ReadResultData(lowerRRBuf), lowerCode
+	}
+
+	passedThrough = true
+	return lowerRR, lowerCode
+}
+
+// readSize returns the number of bytes of rr, the result of h.file.Read at off. A result passed
+// as a file descriptor has the size asked for, as it is only read when sent to the kernel, so
+// it is clamped to the end of the file.
+func (h *hookFile) readSize(rr fuse.ReadResult, off int64) int {
+	var attr fuse.Attr
+	if !h.file.GetAttr(&attr).Ok() {
+		return rr.Size()
+	}
+	left := int64(attr.Size) - off
+	if left < 0 {
+		left = 0
+	}
+	return clampReadLen(rr.Size(), int(left))
+}
+
+// readMetadata is Read for hooks that don't need the data, so the result of h.file is passed
+// through as is (typically a fuse.ReadResultFd).
+func (h *hookFile) readMetadata(span *opSpan, hook HookOnReadMetadata, dest []byte, off int64) (fuse.ReadResult, fuse.Status) {
+	log.WithFields(log.Fields{
+		"off": off,
+		"h":   h,
+	}).Trace("f.Read")
+
+	prehooked, prehookCtx, prehookErr := hook.PreReadMetadata(h.name, int64(len(dest)), off)
+	if prehooked {
+		log.WithFields(log.Fields{
+			"h":          h,
+			"prehookErr": prehookErr,
+			"prehookCtx": prehookCtx,
+		}).Debug("Read: Prehooked")
+		span.disposition = DispositionPrehooked
+		return fuse.ReadResultData(nil), fuse.ToStatus(prehookErr)
+	}
+
+	lowerRR, lowerCode := h.file.Read(dest, off)
+	size := 0
+	if lowerRR != nil && lowerCode.Ok() {
+		size = h.readSize(lowerRR, off)
+	}
+	posthooked, posthookErr := hook.PostReadMetadata(int32(lowerCode), size, prehookCtx)
+	if posthooked {
+		log.WithFields(log.Fields{
+			"h":           h,
+			"posthookErr": posthookErr,
+		}).Debug("Read: Posthooked")
+		span.disposition = DispositionPosthooked
+		return lowerRR, fuse.ToStatus(posthookErr)
 	}
 
 	return lowerRR, lowerCode
 }
 
 // implements nodefs.File
-func (h *hookFile) Write(data []byte, off int64) (uint32, fuse.Status) {
+func (h *hookFile) Write(data []byte, off int64) (written uint32, code fuse.Status) {
+	span := h.fs.begin(OpWrite, h.name)
+	defer h.fs.observe(span, &code)
+	if h.fs.opts.ReadOnly {
+		return 0, readOnly
+	}
+	defer func() {
+		if code.Ok() {
+			span.bytes = int(written)
+			h.fs.throughput.add(h.name, 0, span.bytes)
+		}
+	}()
+	if h.writeback != nil {
+		h.writeback.add(data, off, h.writeBack)
+		return uint32(len(data)), fuse.OK
+	}
+	return h.write(span, data, off)
+}
+
+// writeBack writes data held back by Options.WritebackCache. The writes of the application
+// have already been observed as they were held back.
+func (h *hookFile) writeBack(data []byte, off int64) (uint32, fuse.Status) {
+	return h.write(&opSpan{op: OpWrite, path: h.name}, data, off)
+}
+
+// syncWriteback writes what Options.WritebackCache holds back, before an operation
+// depending on it.
+func (h *hookFile) syncWriteback() {
+	if h.writeback != nil {
+		h.writeback.sync(h.writeBack)
+	}
+}
+
+func (h *hookFile) write(span *opSpan, data []byte, off int64) (uint32, fuse.Status) {
+	if h.hook == nil {
+		return h.file.Write(data, off)
+	}
 	hook, hookEnabled := h.hook.(HookOnWrite)
+	var posthookWritten uint32
 	var prehookErr, posthookErr error
 	var prehooked, posthooked bool
 	var prehookCtx HookContext
@@ -123,19 +278,44 @@ func (h *hookFile) Write(data []byte, off int64) (uint32, fuse.Status) {
 				"prehookErr": prehookErr,
 				"prehookCtx": prehookCtx,
 			}).Debug("Write: Prehooked")
+			span.disposition = DispositionPrehooked
+			if prehookErr == nil {
+				// the hook has taken care of the data itself
+				return uint32(len(data)), fuse.OK
+			}
 			return 0, fuse.ToStatus(prehookErr)
 		}
 	}
 
 	lowerWritten, lowerCode := h.file.Write(data, off)
 	if hookEnabled {
-		posthooked, posthookErr = hook.PostWrite(int32(lowerCode), prehookCtx)
+		posthookWritten, posthooked, posthookErr = hook.PostWrite(int32(lowerCode), prehookCtx)
 		if posthooked {
 			log.WithFields(log.Fields{
-				"h":           h,
-				"posthookErr": posthookErr,
+				"h":               h,
+				"posthookWritten": posthookWritten,
+				"posthookErr":     posthookErr,
 			}).Debug("Write: Posthooked")
-			return 0, fuse.ToStatus(posthookErr)
+			span.disposition = DispositionPosthooked
+			if posthookErr != nil {
+				return 0, fuse.ToStatus(posthookErr)
+			}
+			if posthookWritten > uint32(len(data)) {
+				log.WithFields(log.Fields{
+					"h":               h,
+					"posthookWritten": posthookWritten,
+					"dataLen":         len(data),
+				}).Warn("Write: Posthooked, but posthookWritten is more than was written. Clamping it.")
+				posthookWritten = uint32(len(data))
+			}
+			if posthookWritten == 0 && len(data) > 0 {
+				log.WithFields(log.Fields{
+					"h":            h,
+					"lowerWritten": lowerWritten,
+				}).Warn("Write: Posthooked, but posthookWritten is 0. Reporting the real write instead.")
+				posthookWritten = lowerWritten
+			}
+			return posthookWritten, fuse.OK
 		}
 	}
 
@@ -143,7 +323,17 @@ func (h *hookFile) Write(data []byte, off int64) (uint32, fuse.Status) {
 }
 
 // implements nodefs.File
-func (h *hookFile) Flush() fuse.Status {
+func (h *hookFile) Flush() (code fuse.Status) {
+	span := h.fs.begin(OpFlush, h.name)
+	defer h.fs.observe(span, &code)
+	if h.writeback != nil {
+		if held := h.writeback.flush(h.writeBack); !held.Ok() {
+			return held
+		}
+	}
+	if h.hook == nil {
+		return h.file.Flush()
+	}
 	hook, hookEnabled := h.hook.(HookOnFlush)
 	var prehookErr, posthookErr error
 	var prehooked, posthooked bool
@@ -159,6 +349,7 @@ func (h *hookFile) Flush() fuse.Status {
 				"prehookErr": prehookErr,
 				"prehookCtx": prehookCtx,
 			}).Debug("Flush: Prehooked")
+			span.disposition = DispositionPrehooked
 			return fuse.ToStatus(prehookErr)
 		}
 	}
@@ -171,6 +362,7 @@ func (h *hookFile) Flush() fuse.Status {
 				"h":           h,
 				"posthookErr": posthookErr,
 			}).Debug("Flush: Posthooked")
+			span.disposition = DispositionPosthooked
 			return fuse.ToStatus(posthookErr)
 		}
 	}
@@ -180,19 +372,34 @@ func (h *hookFile) Flush() fuse.Status {
 
 // implements nodefs.File
 func (h *hookFile) Release() {
-	hook, hookEnabled := h.hook.(HookOnRelease)
+	span := h.fs.begin(OpRelease, h.name)
+	defer h.fs.observe(span, nil)
+	if h.writeback != nil {
+		if held := h.writeback.flush(h.writeBack); !held.Ok() {
+			log.WithFields(log.Fields{
+				"h":    h,
+				"code": held,
+			}).Warn("Release: a write held back failed after the last flush")
+		}
+	}
+	if h.hook == nil {
+		h.file.Release()
+		return
+	}
+	hook, hookEnabled := releaseHook(h.hook)
 	var prehooked, posthooked bool
 	var prehookCtx HookContext
 
 	log.WithFields(log.Fields{"h": h}).Trace("f.Release")
 
 	if hookEnabled {
-		prehooked, prehookCtx = hook.PreRelease(h.name)
+		prehooked, prehookCtx = hook.PreReleaseWithHandle(h.name, h.flags, h.handle)
 		if prehooked {
 			log.WithFields(log.Fields{
 				"h":          h,
 				"prehookCtx": prehookCtx,
 			}).Debug("Release: Prehooked")
+			span.disposition = DispositionPrehooked
 		}
 	}
 
@@ -203,12 +410,23 @@ func (h *hookFile) Release() {
 			log.WithFields(log.Fields{
 				"h": h,
 			}).Debug("Release: Posthooked")
+			span.disposition = DispositionPosthooked
 		}
 	}
 }
 
 // implements nodefs.File
-func (h *hookFile) Fsync(flags int) fuse.Status {
+func (h *hookFile) Fsync(flags int) (code fuse.Status) {
+	span := h.fs.begin(OpFsync, h.name)
+	defer h.fs.observe(span, &code)
+	if h.writeback != nil {
+		if held := h.writeback.flush(h.writeBack); !held.Ok() {
+			return held
+		}
+	}
+	if h.hook == nil {
+		return h.lowerFsync(flags)
+	}
 	hook, hookEnabled := h.hook.(HookOnFsync)
 	var prehookErr, posthookErr error
 	var prehooked, posthooked bool
@@ -227,11 +445,12 @@ func (h *hookFile) Fsync(flags int) fuse.Status {
 				"prehookErr": prehookErr,
 				"prehookCtx": prehookCtx,
 			}).Debug("Fsync: Prehooked")
+			span.disposition = DispositionPrehooked
 			return fuse.ToStatus(prehookErr)
 		}
 	}
 
-	lowerCode := h.file.Fsync(flags)
+	lowerCode := h.lowerFsync(flags)
 	if hookEnabled {
 		posthooked, posthookErr = hook.PostFsync(int32(lowerCode), prehookCtx)
 		if posthooked {
@@ -239,6 +458,7 @@ func (h *hookFile) Fsync(flags int) fuse.Status {
 				"h":           h,
 				"posthookErr": posthookErr,
 			}).Debug("Fsync: Posthooked")
+			span.disposition = DispositionPosthooked
 			return fuse.ToStatus(posthookErr)
 		}
 	}
@@ -246,9 +466,25 @@ func (h *hookFile) Fsync(flags int) fuse.Status {
 	return lowerCode
 }
 
+func (h *hookFile) lowerFsync(flags int) fuse.Status {
+	if h.fsync != nil {
+		return h.fsync.fsync(h.file, flags)
+	}
+	return h.file.Fsync(flags)
+}
+
 // implements nodefs.File
-func (h *hookFile) Truncate(size uint64) fuse.Status {
-	hook, hookEnabled := h.hook.(HookOnTruncate)
+func (h *hookFile) Truncate(size uint64) (code fuse.Status) {
+	span := h.fs.begin(OpTruncate, h.name)
+	defer h.fs.observe(span, &code)
+	h.syncWriteback()
+	if h.fs.opts.ReadOnly {
+		return readOnly
+	}
+	if h.hook == nil {
+		return h.file.Truncate(size)
+	}
+	hook, hookEnabled := truncateHook(h.hook)
 	var prehookErr, posthookErr error
 	var prehooked, posthooked bool
 	var prehookCtx HookContext
@@ -259,13 +495,14 @@ func (h *hookFile) Truncate(size uint64) fuse.Status {
 	}).Trace("f.Truncate")
 
 	if hookEnabled {
-		prehooked, prehookCtx, prehookErr = hook.PreTruncate(h.name, size)
+		prehooked, prehookCtx, prehookErr = hook.PreTruncateWithContext(h.name, size, nil)
 		if prehooked {
 			log.WithFields(log.Fields{
 				"h":          h,
 				"prehookErr": prehookErr,
 				"prehookCtx": prehookCtx,
 			}).Debug("Truncate: Prehooked")
+			span.disposition = DispositionPrehooked
 			return fuse.ToStatus(prehookErr)
 		}
 	}
@@ -278,6 +515,7 @@ func (h *hookFile) Truncate(size uint64) fuse.Status {
 				"h":           h,
 				"posthookErr": posthookErr,
 			}).Debug("Truncate: Posthooked")
+			span.disposition = DispositionPosthooked
 			return fuse.ToStatus(posthookErr)
 		}
 	}
@@ -286,8 +524,15 @@ func (h *hookFile) Truncate(size uint64) fuse.Status {
 }
 
 // implements nodefs.File
-func (h *hookFile) GetAttr(out *fuse.Attr) fuse.Status {
-	hook, hookEnabled := h.hook.(HookOnGetAttr)
+func (h *hookFile) GetAttr(out *fuse.Attr) (code fuse.Status) {
+	span := h.fs.begin(OpGetAttr, h.name)
+	defer h.fs.observe(span, &code)
+	h.syncWriteback()
+	if h.hook == nil {
+		return h.file.GetAttr(out)
+	}
+	hook, hookEnabled := getAttrHook(h.hook)
+	var posthookAttr *fuse.Attr
 	var prehookErr, posthookErr error
 	var prehooked, posthooked bool
 	var prehookCtx HookContext
@@ -298,25 +543,39 @@ func (h *hookFile) GetAttr(out *fuse.Attr) fuse.Status {
 	}).Trace("f.GetAttr")
 
 	if hookEnabled {
-		prehooked, prehookCtx, prehookErr = hook.PreGetAttr(h.name)
+		prehooked, prehookCtx, prehookErr = hook.PreGetAttrWithContext(h.name, nil)
 		if prehooked {
 			log.WithFields(log.Fields{
 				"h":          h,
 				"prehookErr": prehookErr,
 				"prehookCtx": prehookCtx,
 			}).Debug("GetAttr: Prehooked")
+			span.disposition = DispositionPrehooked
 			return fuse.ToStatus(prehookErr)
 		}
 	}
 
 	lowerCode := h.file.GetAttr(out)
 	if hookEnabled {
-		posthooked, posthookErr = hook.PostGetAttr(int32(lowerCode), prehookCtx)
+		var realAttr *fuse.Attr
+		if lowerCode.Ok() {
+			attr := *out
+			realAttr = &attr
+		}
+		posthookAttr, posthooked, posthookErr = hook.PostGetAttr(int32(lowerCode), realAttr, prehookCtx)
 		if posthooked {
 			log.WithFields(log.Fields{
-				"h":           h,
-				"posthookErr": posthookErr,
+				"h":            h,
+				"posthookAttr": posthookAttr,
+				"posthookErr":  posthookErr,
 			}).Debug("GetAttr: Posthooked")
+			span.disposition = DispositionPosthooked
+			if posthookErr == nil && posthookAttr == nil {
+				return lowerCode
+			}
+			if posthookAttr != nil {
+				*out = *posthookAttr
+			}
 			return fuse.ToStatus(posthookErr)
 		}
 	}
@@ -325,8 +584,16 @@ func (h *hookFile) GetAttr(out *fuse.Attr) fuse.Status {
 }
 
 // implements nodefs.File
-func (h *hookFile) Chown(uid uint32, gid uint32) fuse.Status {
-	hook, hookEnabled := h.hook.(HookOnChown)
+func (h *hookFile) Chown(uid uint32, gid uint32) (code fuse.Status) {
+	span := h.fs.begin(OpChown, h.name)
+	defer h.fs.observe(span, &code)
+	if h.fs.opts.ReadOnly {
+		return readOnly
+	}
+	if h.hook == nil {
+		return h.file.Chown(uid, gid)
+	}
+	hook, hookEnabled := chownHook(h.hook)
 	var prehookErr, posthookErr error
 	var prehooked, posthooked bool
 	var prehookCtx HookContext
@@ -338,13 +605,14 @@ func (h *hookFile) Chown(uid uint32, gid uint32) fuse.Status {
 	}).Trace("f.Chown")
 
 	if hookEnabled {
-		prehooked, prehookCtx, prehookErr = hook.PreChown(h.name, uid, gid)
+		prehooked, prehookCtx, prehookErr = hook.PreChownWithContext(h.name, uid, gid, nil)
 		if prehooked {
 			log.WithFields(log.Fields{
 				"h":          h,
 				"prehookErr": prehookErr,
 				"prehookCtx": prehookCtx,
 			}).Debug("Chown: Prehooked")
+			span.disposition = DispositionPrehooked
 			return fuse.ToStatus(prehookErr)
 		}
 	}
@@ -357,6 +625,7 @@ func (h *hookFile) Chown(uid uint32, gid uint32) fuse.Status {
 				"h":           h,
 				"posthookErr": posthookErr,
 			}).Debug("Chown: Posthooked")
+			span.disposition = DispositionPosthooked
 			return fuse.ToStatus(posthookErr)
 		}
 	}
@@ -365,8 +634,16 @@ func (h *hookFile) Chown(uid uint32, gid uint32) fuse.Status {
 }
 
 // implements nodefs.File
-func (h *hookFile) Chmod(perms uint32) fuse.Status {
-	hook, hookEnabled := h.hook.(HookOnChmod)
+func (h *hookFile) Chmod(perms uint32) (code fuse.Status) {
+	span := h.fs.begin(OpChmod, h.name)
+	defer h.fs.observe(span, &code)
+	if h.fs.opts.ReadOnly {
+		return readOnly
+	}
+	if h.hook == nil {
+		return h.file.Chmod(perms)
+	}
+	hook, hookEnabled := chmodHook(h.hook)
 	var prehookErr, posthookErr error
 	var prehooked, posthooked bool
 	var prehookCtx HookContext
@@ -377,13 +654,14 @@ func (h *hookFile) Chmod(perms uint32) fuse.Status {
 	}).Trace("f.Chmod")
 
 	if hookEnabled {
-		prehooked, prehookCtx, prehookErr = hook.PreChmod(h.name, perms)
+		prehooked, prehookCtx, prehookErr = hook.PreChmodWithContext(h.name, perms, nil)
 		if prehooked {
 			log.WithFields(log.Fields{
 				"h":          h,
 				"prehookErr": prehookErr,
 				"prehookCtx": prehookCtx,
 			}).Debug("Chmod: Prehooked")
+			span.disposition = DispositionPrehooked
 			return fuse.ToStatus(prehookErr)
 		}
 	}
@@ -396,6 +674,7 @@ func (h *hookFile) Chmod(perms uint32) fuse.Status {
 				"h":           h,
 				"posthookErr": posthookErr,
 			}).Debug("Chmod: Posthooked")
+			span.disposition = DispositionPosthooked
 			return fuse.ToStatus(posthookErr)
 		}
 	}
@@ -404,8 +683,17 @@ func (h *hookFile) Chmod(perms uint32) fuse.Status {
 }
 
 // implements nodefs.File
-func (h *hookFile) Utimens(atime *time.Time, mtime *time.Time) fuse.Status {
-	hook, hookEnabled := h.hook.(HookOnUtimens)
+func (h *hookFile) Utimens(atime *time.Time, mtime *time.Time) (code fuse.Status) {
+	span := h.fs.begin(OpUtimens, h.name)
+	defer h.fs.observe(span, &code)
+	h.syncWriteback()
+	if h.fs.opts.ReadOnly {
+		return readOnly
+	}
+	if h.hook == nil {
+		return h.file.Utimens(atime, mtime)
+	}
+	hook, hookEnabled := utimensHook(h.hook)
 	var prehookErr, posthookErr error
 	var prehooked, posthooked bool
 	var prehookCtx HookContext
@@ -417,13 +705,14 @@ func (h *hookFile) Utimens(atime *time.Time, mtime *time.Time) fuse.Status {
 	}).Trace("f.Utimens")
 
 	if hookEnabled {
-		prehooked, prehookCtx, prehookErr = hook.PreUtimens(h.name, atime, mtime)
+		prehooked, prehookCtx, prehookErr = hook.PreUtimensWithContext(h.name, atime, mtime, nil)
 		if prehooked {
 			log.WithFields(log.Fields{
 				"h":          h,
 				"prehookErr": prehookErr,
 				"prehookCtx": prehookCtx,
 			}).Debug("Utimens: Prehooked")
+			span.disposition = DispositionPrehooked
 			return fuse.ToStatus(prehookErr)
 		}
 	}
@@ -436,6 +725,7 @@ func (h *hookFile) Utimens(atime *time.Time, mtime *time.Time) fuse.Status {
 				"h":           h,
 				"posthookErr": posthookErr,
 			}).Debug("Utimens: Posthooked")
+			span.disposition = DispositionPosthooked
 			return fuse.ToStatus(posthookErr)
 		}
 	}
@@ -444,7 +734,16 @@ func (h *hookFile) Utimens(atime *time.Time, mtime *time.Time) fuse.Status {
 }
 
 // implements nodefs.File
-func (h *hookFile) Allocate(off uint64, size uint64, mode uint32) fuse.Status {
+func (h *hookFile) Allocate(off uint64, size uint64, mode uint32) (code fuse.Status) {
+	span := h.fs.begin(OpAllocate, h.name)
+	defer h.fs.observe(span, &code)
+	h.syncWriteback()
+	if h.fs.opts.ReadOnly {
+		return readOnly
+	}
+	if h.hook == nil {
+		return h.file.Allocate(off, size, mode)
+	}
 	hook, hookEnabled := h.hook.(HookOnAllocate)
 	var prehookErr, posthookErr error
 	var prehooked, posthooked bool
@@ -465,6 +764,7 @@ func (h *hookFile) Allocate(off uint64, size uint64, mode uint32) fuse.Status {
 				"prehookErr": prehookErr,
 				"prehookCtx": prehookCtx,
 			}).Debug("Allocate: Prehooked")
+			span.disposition = DispositionPrehooked
 			return fuse.ToStatus(prehookErr)
 		}
 	}
@@ -477,6 +777,7 @@ func (h *hookFile) Allocate(off uint64, size uint64, mode uint32) fuse.Status {
 				"h":           h,
 				"posthookErr": posthookErr,
 			}).Debug("Allocate: Posthooked")
+			span.disposition = DispositionPosthooked
 			return fuse.ToStatus(posthookErr)
 		}
 	}
@@ -485,7 +786,12 @@ func (h *hookFile) Allocate(off uint64, size uint64, mode uint32) fuse.Status {
 }
 
 // implements nodefs.File
-func (h *hookFile) GetLk(owner uint64, lk *fuse.FileLock, flags uint32, out *fuse.FileLock) fuse.Status {
+func (h *hookFile) GetLk(owner uint64, lk *fuse.FileLock, flags uint32, out *fuse.FileLock) (code fuse.Status) {
+	span := h.fs.begin(OpGetLk, h.name)
+	defer h.fs.observe(span, &code)
+	if h.hook == nil {
+		return h.file.GetLk(owner, lk, flags, out)
+	}
 	hook, hookEnabled := h.hook.(HookOnGetLk)
 	var prehookErr, posthookErr error
 	var prehooked, posthooked bool
@@ -507,6 +813,7 @@ func (h *hookFile) GetLk(owner uint64, lk *fuse.FileLock, flags uint32, out *fus
 				"prehookErr": prehookErr,
 				"prehookCtx": prehookCtx,
 			}).Debug("GetLk: Prehooked")
+			span.disposition = DispositionPrehooked
 			return fuse.ToStatus(prehookErr)
 		}
 	}
@@ -519,6 +826,7 @@ func (h *hookFile) GetLk(owner uint64, lk *fuse.FileLock, flags uint32, out *fus
 				"h":           h,
 				"posthookErr": posthookErr,
 			}).Debug("GetLk: Posthooked")
+			span.disposition = DispositionPosthooked
 			return fuse.ToStatus(posthookErr)
 		}
 	}
@@ -527,7 +835,12 @@ func (h *hookFile) GetLk(owner uint64, lk *fuse.FileLock, flags uint32, out *fus
 }
 
 // implements nodefs.File
-func (h *hookFile) SetLk(owner uint64, lk *fuse.FileLock, flags uint32) fuse.Status {
+func (h *hookFile) SetLk(owner uint64, lk *fuse.FileLock, flags uint32) (code fuse.Status) {
+	span := h.fs.begin(OpSetLk, h.name)
+	defer h.fs.observe(span, &code)
+	if h.hook == nil {
+		return h.file.SetLk(owner, lk, flags)
+	}
 	hook, hookEnabled := h.hook.(HookOnSetLk)
 	var prehookErr, posthookErr error
 	var prehooked, posthooked bool
@@ -548,6 +861,7 @@ func (h *hookFile) SetLk(owner uint64, lk *fuse.FileLock, flags uint32) fuse.Sta
 				"prehookErr": prehookErr,
 				"prehookCtx": prehookCtx,
 			}).Debug("SetLk: Prehooked")
+			span.disposition = DispositionPrehooked
 			return fuse.ToStatus(prehookErr)
 		}
 	}
@@ -560,6 +874,7 @@ func (h *hookFile) SetLk(owner uint64, lk *fuse.FileLock, flags uint32) fuse.Sta
 				"h":           h,
 				"posthookErr": posthookErr,
 			}).Debug("SetLk: Posthooked")
+			span.disposition = DispositionPosthooked
 			return fuse.ToStatus(posthookErr)
 		}
 	}
@@ -568,7 +883,12 @@ func (h *hookFile) SetLk(owner uint64, lk *fuse.FileLock, flags uint32) fuse.Sta
 }
 
 // implements nodefs.File
-func (h *hookFile) SetLkw(owner uint64, lk *fuse.FileLock, flags uint32) fuse.Status {
+func (h *hookFile) SetLkw(owner uint64, lk *fuse.FileLock, flags uint32) (code fuse.Status) {
+	span := h.fs.begin(OpSetLkw, h.name)
+	defer h.fs.observe(span, &code)
+	if h.hook == nil {
+		return h.file.SetLkw(owner, lk, flags)
+	}
 	hook, hookEnabled := h.hook.(HookOnSetLkw)
 	var prehookErr, posthookErr error
 	var prehooked, posthooked bool
@@ -589,6 +909,7 @@ func (h *hookFile) SetLkw(owner uint64, lk *fuse.FileLock, flags uint32) fuse.St
 				"prehookErr": prehookErr,
 				"prehookCtx": prehookCtx,
 			}).Debug("SetLkw: Prehooked")
+			span.disposition = DispositionPrehooked
 			return fuse.ToStatus(prehookErr)
 		}
 	}
@@ -601,6 +922,7 @@ func (h *hookFile) SetLkw(owner uint64, lk *fuse.FileLock, flags uint32) fuse.St
 				"h":           h,
 				"posthookErr": posthookErr,
 			}).Debug("SetLkw: Posthooked")
+			span.disposition = DispositionPosthooked
 			return fuse.ToStatus(posthookErr)
 		}
 	}
@@ -1,7 +1,13 @@
 package hookfs
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/hanwen/go-fuse/fuse"
@@ -11,46 +17,274 @@ import (
 )
 
 // HookFs is the object hooking the fs.
+//
+// Operations are done on Original by path, with the privileges of the hookfs process.
+// Names coming from the kernel have been resolved through the mount, so symlinks in Original
+// are generally returned to the kernel rather than followed by hookfs. The exceptions are
+// changes of the attributes of a symlink itself (e.g. lchown(2)), which the loopback applies
+// to its target, wherever that is. hookfs does not chroot or use *at syscalls either: whoever
+// can replace a directory of Original with a symlink, directly rather than through the mount,
+// can make operations follow it; see Options.ContainPaths. Don't let untrusted users write to
+// Original directly.
 type HookFs struct {
-	Original   string
-	Mountpoint string
-	FsName     string
-	fs         pathfs.FileSystem
-	hook       Hook
+	Original      string
+	Mountpoint    string
+	FsName        string
+	originalAbs   string
+	mountpointAbs string
+	opts          Options
+	expvar        *expvarMetrics
+	throughput    *throughputCounters
+	stats         opStats
+	trace         *traceWriter
+	backendMu     sync.RWMutex // guards Original, originalAbs, fs and nodeFs
+	fs            pathfs.FileSystem
+	nodeFs        *pathfs.PathNodeFs
+	createLocks   pathLocks
+	lastHandle    uint64       // accessed atomically
+	onResult      atomic.Value // func(OpResult)
+	initErr       error        // set by OnMount with Options.FailOnInitError
+	serverMu      sync.Mutex   // guards server
+	server        *fuse.Server // set while Serve runs
+	hook          atomic.Value // hookBox, emptied by OnMount if Init fails
 }
 
-// NewHookFs creates a new HookFs object
+// hookBox holds the hook of a HookFs, as atomic.Value can't store a nil interface.
+type hookBox struct {
+	hook Hook
+}
+
+// readOnly is the status of the operations modifying the mount with Options.ReadOnly.
+const readOnly = fuse.Status(syscall.EROFS)
+
+// accessWrite is W_OK of access(2).
+const accessWrite = 2
+
+// NewHookFs creates a new HookFs object.
+// hook may be nil, in which case operations go straight to the original directory.
 func NewHookFs(original string, mountpoint string, hook Hook) (*HookFs, error) {
+	return NewHookFsWithOptions(original, mountpoint, hook, nil)
+}
+
+// NewHookFsWithOptions creates a new HookFs object configured by opts.
+// A nil opts is the same as a zero Options.
+func NewHookFsWithOptions(original string, mountpoint string, hook Hook, opts *Options) (*HookFs, error) {
 	log.WithFields(log.Fields{
 		"original":   original,
 		"mountpoint": mountpoint,
+		"opts":       opts,
+	}).Debug("Hooking a fs")
+
+	originalAbs, err := filepath.Abs(original)
+	if err != nil {
+		return nil, err
+	}
+	mountpointAbs, err := filepath.Abs(mountpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	hookfs, err := newHookFs(pathfs.NewLoopbackFileSystem(original), originalAbs, hook, opts)
+	if err != nil {
+		return nil, err
+	}
+	hookfs.Original = original
+	hookfs.Mountpoint = mountpoint
+	hookfs.originalAbs = originalAbs
+	hookfs.mountpointAbs = mountpointAbs
+	return hookfs, nil
+}
+
+// WrapFileSystem creates a HookFs applying hook to the operations on fs, configured by opts,
+// to be served by a go-fuse server set up by the caller rather than by Serve, e.g.
+//
+//	hfs, err := hookfs.WrapFileSystem(pathfs.NewLoopbackFileSystem("/original"), hook, nil)
+//	...
+//	nodeFs := pathfs.NewPathNodeFs(hfs, nil)
+//	server, _, err := nodefs.MountRoot("/mnt/hookfs", nodeFs.Root(), nil)
+//	...
+//	server.Serve()
+//
+// A HookFs is a pathfs.FileSystem, so it may also be wrapped further before being served.
+// The HookFs has neither Original nor Mountpoint: paths are relative to the root of fs,
+// BackendPath and MountPath return them as they are, and Serve fails. SetOriginal replaces fs
+// with a loopback of the directory given. Serving a HookFs more than once is not supported.
+func WrapFileSystem(fs pathfs.FileSystem, hook Hook, opts *Options) (*HookFs, error) {
+	log.WithFields(log.Fields{
+		"fs":   fs,
+		"opts": opts,
 	}).Debug("Hooking a fs")
 
-	loopbackfs := pathfs.NewLoopbackFileSystem(original)
+	return newHookFs(fs, "", hook, opts)
+}
+
+// newHookFs creates a HookFs over fs, the file system of the original directory root, without
+// Original nor Mountpoint. root is "" if there is no original directory.
+func newHookFs(fs pathfs.FileSystem, root string, hook Hook, opts *Options) (*HookFs, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	var err error
+	var expvarMetrics *expvarMetrics
+	if opts.ExpvarName != "" {
+		expvarMetrics, err = newExpvarMetrics(opts.ExpvarName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var trace *traceWriter
+	if opts.TraceFile != "" {
+		trace, err = newTraceWriter(opts.TraceFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	hookfs := &HookFs{
-		Original:   original,
-		Mountpoint: mountpoint,
-		FsName:     "hookfs",
-		fs:         loopbackfs,
-		hook:       hook,
+		FsName: "hookfs",
+		opts:   *opts,
+		expvar: expvarMetrics,
+		trace:  trace,
+		stats:  newOpStats(),
+	}
+	hookfs.fs = hookfs.backend(fs, root)
+	hookfs.hook.Store(hookBox{hook})
+	if opts.ThroughputPaths > 0 {
+		hookfs.throughput = newThroughputCounters(opts.ThroughputPaths)
+	}
+	if opts.Metadata != nil {
+		// copied so that the caller can't change it under the hooks
+		hookfs.opts.Metadata = make(map[string]string, len(opts.Metadata))
+		for k, v := range opts.Metadata {
+			hookfs.opts.Metadata[k] = v
+		}
+	}
+	if hook, ok := hook.(HookWithMetadata); ok {
+		hook.SetMetadata(hookfs.opts.Metadata)
+	}
+	if hook, ok := hook.(HookWithBackend); ok {
+		hook.SetBackend(hookfs.fs)
 	}
 	return hookfs, nil
 }
 
+// backend returns fs, the file system of the original directory root, as configured by the
+// options of h. root is "" if there is no original directory.
+func (h *HookFs) backend(fs pathfs.FileSystem, root string) pathfs.FileSystem {
+	if h.opts.ContainPaths {
+		fs = newContainedFileSystem(fs, root)
+	}
+	if h.opts.NameMapper != nil {
+		fs = &mappedFileSystem{FileSystem: fs, mapper: h.opts.NameMapper}
+	}
+	return fs
+}
+
+// currentHook returns the hook of h, or nil if there is none or it was disabled.
+func (h *HookFs) currentHook() Hook {
+	box, _ := h.hook.Load().(hookBox)
+	return box.hook
+}
+
+// BackendPath returns the absolute path in Original for name, as passed to hooks, mapped by
+// Options.NameMapper if set.
+// The root of the mount is represented by an empty name.
+func (h *HookFs) BackendPath(name string) string {
+	h.backendMu.RLock()
+	defer h.backendMu.RUnlock()
+	if h.opts.NameMapper != nil {
+		name = mapPath(name, h.opts.NameMapper.ToBackend)
+	}
+	return filepath.Join(h.originalAbs, name)
+}
+
+// Metadata returns Options.Metadata. The map must not be modified.
+func (h *HookFs) Metadata() map[string]string {
+	return h.opts.Metadata
+}
+
+// MountPath returns the absolute path under Mountpoint for name, as passed to hooks.
+// The root of the mount is represented by an empty name.
+func (h *HookFs) MountPath(name string) string {
+	return filepath.Join(h.mountpointAbs, name)
+}
+
+// SetOriginal redirects h to the directory at original without remounting.
+//
+// Every operation goes to a single backend: operations already in flight complete
+// against the previous one, later operations see the new one.
+// Files opened before the switch keep their descriptors, so reads and writes through them
+// still reach the previous directory until they are closed.
+// The kernel may serve cached attributes and entries of the previous directory
+// until their timeouts expire; see InvalidateAttr and InvalidateEntry.
+func (h *HookFs) SetOriginal(original string) error {
+	originalAbs, err := filepath.Abs(original)
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(originalAbs)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return &os.PathError{Op: "SetOriginal", Path: original, Err: syscall.ENOTDIR}
+	}
+
+	log.WithFields(log.Fields{
+		"original": original,
+		"h":        h,
+	}).Debug("Switching the original directory")
+
+	loopbackfs := h.backend(pathfs.NewLoopbackFileSystem(original), originalAbs)
+	h.backendMu.Lock()
+	defer h.backendMu.Unlock()
+	if h.nodeFs != nil {
+		loopbackfs.OnMount(h.nodeFs)
+	}
+	h.Original = original
+	h.originalAbs = originalAbs
+	h.fs = loopbackfs
+	if hook, ok := h.currentHook().(HookWithBackend); ok {
+		hook.SetBackend(loopbackfs)
+	}
+	return nil
+}
+
+// lowerFs returns the file system of the current Original.
+func (h *HookFs) lowerFs() pathfs.FileSystem {
+	h.backendMu.RLock()
+	defer h.backendMu.RUnlock()
+	return h.fs
+}
+
 // String implements hanwen/go-fuse/fuse/pathfs.FileSystem. You are not expected to call h manually.
 func (h *HookFs) String() string {
+	h.backendMu.RLock()
+	defer h.backendMu.RUnlock()
 	return fmt.Sprintf("HookFs{Original=%s, Mountpoint=%s, FsName=%s, Underlying fs=%s, hook=%s}",
-		h.Original, h.Mountpoint, h.FsName, h.fs.String(), h.hook)
+		h.Original, h.Mountpoint, h.FsName, h.fs.String(), h.currentHook())
 }
 
 // SetDebug implements hanwen/go-fuse/fuse/pathfs.FileSystem. You are not expected to call h manually.
 func (h *HookFs) SetDebug(debug bool) {
-	h.fs.SetDebug(debug)
+	h.lowerFs().SetDebug(debug)
 }
 
 // GetAttr implements hanwen/go-fuse/fuse/pathfs.FileSystem. You are not expected to call h manually.
-func (h *HookFs) GetAttr(name string, context *fuse.Context) (*fuse.Attr, fuse.Status) {
-	hook, hookEnabled := h.hook.(HookOnGetAttr)
+func (h *HookFs) GetAttr(name string, context *fuse.Context) (attr *fuse.Attr, code fuse.Status) {
+	span := h.begin(OpGetAttr, name)
+	defer h.observe(span, &code)
+	if h.currentHook() == nil {
+		return h.lowerFs().GetAttr(name, context)
+	}
+	if attr, hooked, err := h.virtualGetAttr(name); hooked {
+		span.disposition = DispositionPrehooked
+		return attr, fuse.ToStatus(err)
+	}
+	hook, hookEnabled := getAttrHook(h.currentHook())
+	var posthookAttr *fuse.Attr
 	var prehookErr, posthookErr error
 	var prehooked, posthooked bool
 	var prehookCtx HookContext
@@ -61,35 +295,66 @@ func (h *HookFs) GetAttr(name string, context *fuse.Context) (*fuse.Attr, fuse.S
 	}).Trace("fs.GetAttr")
 
 	if hookEnabled {
-		prehooked, prehookCtx, prehookErr = hook.PreGetAttr(name)
+		prehooked, prehookCtx, prehookErr = hook.PreGetAttrWithContext(name, context)
 		if prehooked {
 			log.WithFields(log.Fields{
 				"h":          h,
 				"prehookErr": prehookErr,
 				"prehookCtx": prehookCtx,
 			}).Debug("GetAttr: Prehooked")
+			span.disposition = DispositionPrehooked
 			return nil, fuse.ToStatus(prehookErr)
 		}
 	}
 
-	attr, lowerCode := h.fs.GetAttr(name, context)
+	attr, lowerCode := h.lowerFs().GetAttr(name, context)
 	if hookEnabled {
-		posthooked, posthookErr = hook.PostGetAttr(int32(lowerCode), prehookCtx)
+		posthookAttr, posthooked, posthookErr = hook.PostGetAttr(int32(lowerCode), attr, prehookCtx)
 		if posthooked {
 			log.WithFields(log.Fields{
-				"h":           h,
-				"posthookErr": posthookErr,
+				"h":            h,
+				"posthookAttr": posthookAttr,
+				"posthookErr":  posthookErr,
 			}).Debug("GetAttr: Posthooked")
-			return attr, fuse.ToStatus(posthookErr)
+			span.disposition = DispositionPosthooked
+			if posthookErr == nil && posthookAttr == nil {
+				return attr, lowerCode
+			}
+			return posthookAttr, fuse.ToStatus(posthookErr)
 		}
 	}
 
 	return attr, lowerCode
 }
 
+// virtualGetAttr returns the attributes of name if it is served by a HookWithVirtualDirs.
+func (h *HookFs) virtualGetAttr(name string) (*fuse.Attr, bool, error) {
+	hook, ok := h.currentHook().(HookWithVirtualDirs)
+	if !ok {
+		return nil, false, nil
+	}
+	attr, hooked, err := hook.VirtualGetAttr(name)
+	if hooked {
+		log.WithFields(log.Fields{
+			"h":    h,
+			"name": name,
+			"err":  err,
+		}).Debug("GetAttr: Virtual")
+	}
+	return attr, hooked, err
+}
+
 // Chmod implements hanwen/go-fuse/fuse/pathfs.FileSystem. You are not expected to call h manually.
-func (h *HookFs) Chmod(name string, mode uint32, context *fuse.Context) fuse.Status {
-	hook, hookEnabled := h.hook.(HookOnChmod)
+func (h *HookFs) Chmod(name string, mode uint32, context *fuse.Context) (code fuse.Status) {
+	span := h.begin(OpChmod, name)
+	defer h.observe(span, &code)
+	if h.opts.ReadOnly {
+		return readOnly
+	}
+	if h.currentHook() == nil {
+		return h.lowerFs().Chmod(name, mode, context)
+	}
+	hook, hookEnabled := chmodHook(h.currentHook())
 	var prehookErr, posthookErr error
 	var prehooked, posthooked bool
 	var prehookCtx HookContext
@@ -101,18 +366,19 @@ func (h *HookFs) Chmod(name string, mode uint32, context *fuse.Context) fuse.Sta
 	}).Trace("fs.Chmod")
 
 	if hookEnabled {
-		prehooked, prehookCtx, prehookErr = hook.PreChmod(name, mode)
+		prehooked, prehookCtx, prehookErr = hook.PreChmodWithContext(name, mode, context)
 		if prehooked {
 			log.WithFields(log.Fields{
 				"h":          h,
 				"prehookErr": prehookErr,
 				"prehookCtx": prehookCtx,
 			}).Debug("Chmod: Prehooked")
+			span.disposition = DispositionPrehooked
 			return fuse.ToStatus(prehookErr)
 		}
 	}
 
-	lowerCode := h.fs.Chmod(name, mode, context)
+	lowerCode := h.lowerFs().Chmod(name, mode, context)
 	if hookEnabled {
 		posthooked, posthookErr = hook.PostChmod(int32(lowerCode), prehookCtx)
 		if posthooked {
@@ -120,6 +386,7 @@ func (h *HookFs) Chmod(name string, mode uint32, context *fuse.Context) fuse.Sta
 				"h":           h,
 				"posthookErr": posthookErr,
 			}).Debug("Chmod: Posthooked")
+			span.disposition = DispositionPosthooked
 			return fuse.ToStatus(posthookErr)
 		}
 	}
@@ -128,8 +395,16 @@ func (h *HookFs) Chmod(name string, mode uint32, context *fuse.Context) fuse.Sta
 }
 
 // Chown implements hanwen/go-fuse/fuse/pathfs.FileSystem. You are not expected to call h manually.
-func (h *HookFs) Chown(name string, uid uint32, gid uint32, context *fuse.Context) fuse.Status {
-	hook, hookEnabled := h.hook.(HookOnChown)
+func (h *HookFs) Chown(name string, uid uint32, gid uint32, context *fuse.Context) (code fuse.Status) {
+	span := h.begin(OpChown, name)
+	defer h.observe(span, &code)
+	if h.opts.ReadOnly {
+		return readOnly
+	}
+	if h.currentHook() == nil {
+		return h.lowerFs().Chown(name, uid, gid, context)
+	}
+	hook, hookEnabled := chownHook(h.currentHook())
 	var prehookErr, posthookErr error
 	var prehooked, posthooked bool
 	var prehookCtx HookContext
@@ -142,18 +417,19 @@ func (h *HookFs) Chown(name string, uid uint32, gid uint32, context *fuse.Contex
 	}).Trace("fs.Chown")
 
 	if hookEnabled {
-		prehooked, prehookCtx, prehookErr = hook.PreChown(name, uid, gid)
+		prehooked, prehookCtx, prehookErr = hook.PreChownWithContext(name, uid, gid, context)
 		if prehooked {
 			log.WithFields(log.Fields{
 				"h":          h,
 				"prehookErr": prehookErr,
 				"prehookCtx": prehookCtx,
 			}).Debug("Chown: Prehooked")
+			span.disposition = DispositionPrehooked
 			return fuse.ToStatus(prehookErr)
 		}
 	}
 
-	lowerCode := h.fs.Chown(name, uid, gid, context)
+	lowerCode := h.lowerFs().Chown(name, uid, gid, context)
 	if hookEnabled {
 		posthooked, posthookErr = hook.PostChown(int32(lowerCode), prehookCtx)
 		if posthooked {
@@ -161,6 +437,7 @@ func (h *HookFs) Chown(name string, uid uint32, gid uint32, context *fuse.Contex
 				"h":           h,
 				"posthookErr": posthookErr,
 			}).Debug("Chown: Posthooked")
+			span.disposition = DispositionPosthooked
 			return fuse.ToStatus(posthookErr)
 		}
 	}
@@ -169,8 +446,16 @@ func (h *HookFs) Chown(name string, uid uint32, gid uint32, context *fuse.Contex
 }
 
 // Utimens implements hanwen/go-fuse/fuse/pathfs.FileSystem. You are not expected to call h manually.
-func (h *HookFs) Utimens(name string, Atime *time.Time, Mtime *time.Time, context *fuse.Context) fuse.Status {
-	hook, hookEnabled := h.hook.(HookOnUtimens)
+func (h *HookFs) Utimens(name string, Atime *time.Time, Mtime *time.Time, context *fuse.Context) (code fuse.Status) {
+	span := h.begin(OpUtimens, name)
+	defer h.observe(span, &code)
+	if h.opts.ReadOnly {
+		return readOnly
+	}
+	if h.currentHook() == nil {
+		return h.lowerFs().Utimens(name, Atime, Mtime, context)
+	}
+	hook, hookEnabled := utimensHook(h.currentHook())
 	var prehookErr, posthookErr error
 	var prehooked, posthooked bool
 	var prehookCtx HookContext
@@ -183,18 +468,19 @@ func (h *HookFs) Utimens(name string, Atime *time.Time, Mtime *time.Time, contex
 	}).Trace("fs.Utimens")
 
 	if hookEnabled {
-		prehooked, prehookCtx, prehookErr = hook.PreUtimens(name, Atime, Mtime)
+		prehooked, prehookCtx, prehookErr = hook.PreUtimensWithContext(name, Atime, Mtime, context)
 		if prehooked {
 			log.WithFields(log.Fields{
 				"h":          h,
 				"prehookErr": prehookErr,
 				"prehookCtx": prehookCtx,
 			}).Debug("Utimens: Prehooked")
+			span.disposition = DispositionPrehooked
 			return fuse.ToStatus(prehookErr)
 		}
 	}
 
-	lowerCode := h.fs.Utimens(name, Atime, Mtime, context)
+	lowerCode := h.lowerFs().Utimens(name, Atime, Mtime, context)
 	if hookEnabled {
 		posthooked, posthookErr = hook.PostUtimens(int32(lowerCode), prehookCtx)
 		if posthooked {
@@ -202,6 +488,7 @@ func (h *HookFs) Utimens(name string, Atime *time.Time, Mtime *time.Time, contex
 				"h":           h,
 				"posthookErr": posthookErr,
 			}).Debug("Utimens: Posthooked")
+			span.disposition = DispositionPosthooked
 			return fuse.ToStatus(posthookErr)
 		}
 	}
@@ -210,8 +497,16 @@ func (h *HookFs) Utimens(name string, Atime *time.Time, Mtime *time.Time, contex
 }
 
 // Truncate implements hanwen/go-fuse/fuse/pathfs.FileSystem. You are not expected to call h manually.
-func (h *HookFs) Truncate(name string, size uint64, context *fuse.Context) fuse.Status {
-	hook, hookEnabled := h.hook.(HookOnTruncate)
+func (h *HookFs) Truncate(name string, size uint64, context *fuse.Context) (code fuse.Status) {
+	span := h.begin(OpTruncate, name)
+	defer h.observe(span, &code)
+	if h.opts.ReadOnly {
+		return readOnly
+	}
+	if h.currentHook() == nil {
+		return h.lowerFs().Truncate(name, size, context)
+	}
+	hook, hookEnabled := truncateHook(h.currentHook())
 	var prehookErr, posthookErr error
 	var prehooked, posthooked bool
 	var prehookCtx HookContext
@@ -223,18 +518,19 @@ func (h *HookFs) Truncate(name string, size uint64, context *fuse.Context) fuse.
 	}).Trace("fs.Truncate")
 
 	if hookEnabled {
-		prehooked, prehookCtx, prehookErr = hook.PreTruncate(name, size)
+		prehooked, prehookCtx, prehookErr = hook.PreTruncateWithContext(name, size, context)
 		if prehooked {
 			log.WithFields(log.Fields{
 				"h":          h,
 				"prehookErr": prehookErr,
 				"prehookCtx": prehookCtx,
 			}).Debug("Truncate: Prehooked")
+			span.disposition = DispositionPrehooked
 			return fuse.ToStatus(prehookErr)
 		}
 	}
 
-	lowerCode := h.fs.Truncate(name, size, context)
+	lowerCode := h.lowerFs().Truncate(name, size, context)
 	if hookEnabled {
 		posthooked, posthookErr = hook.PostTruncate(int32(lowerCode), prehookCtx)
 		if posthooked {
@@ -242,6 +538,7 @@ func (h *HookFs) Truncate(name string, size uint64, context *fuse.Context) fuse.
 				"h":           h,
 				"posthookErr": posthookErr,
 			}).Debug("Truncate: Posthooked")
+			span.disposition = DispositionPosthooked
 			return fuse.ToStatus(posthookErr)
 		}
 	}
@@ -250,8 +547,20 @@ func (h *HookFs) Truncate(name string, size uint64, context *fuse.Context) fuse.
 }
 
 // Access implements hanwen/go-fuse/fuse/pathfs.FileSystem. You are not expected to call h manually.
-func (h *HookFs) Access(name string, mode uint32, context *fuse.Context) fuse.Status {
-	hook, hookEnabled := h.hook.(HookOnAccess)
+func (h *HookFs) Access(name string, mode uint32, context *fuse.Context) (code fuse.Status) {
+	span := h.begin(OpAccess, name)
+	defer h.observe(span, &code)
+	if h.opts.ReadOnly && mode&accessWrite != 0 {
+		return readOnly
+	}
+	if h.currentHook() == nil {
+		return h.lowerFs().Access(name, mode, context)
+	}
+	if _, hooked, err := h.virtualGetAttr(name); hooked && err == nil {
+		span.disposition = DispositionPrehooked
+		return fuse.OK
+	}
+	hook, hookEnabled := accessHook(h.currentHook())
 	var prehookErr, posthookErr error
 	var prehooked, posthooked bool
 	var prehookCtx HookContext
@@ -263,18 +572,19 @@ func (h *HookFs) Access(name string, mode uint32, context *fuse.Context) fuse.St
 	}).Trace("fs.Access")
 
 	if hookEnabled {
-		prehooked, prehookCtx, prehookErr = hook.PreAccess(name, mode)
+		prehooked, prehookCtx, prehookErr = hook.PreAccessWithContext(name, mode, context)
 		if prehooked {
 			log.WithFields(log.Fields{
 				"h":          h,
 				"prehookErr": prehookErr,
 				"prehookCtx": prehookCtx,
 			}).Debug("Access: Prehooked")
+			span.disposition = DispositionPrehooked
 			return fuse.ToStatus(prehookErr)
 		}
 	}
 
-	lowerCode := h.fs.Access(name, mode, context)
+	lowerCode := h.lowerFs().Access(name, mode, context)
 	if hookEnabled {
 		posthooked, posthookErr = hook.PostAccess(int32(lowerCode), prehookCtx)
 		if posthooked {
@@ -282,6 +592,7 @@ func (h *HookFs) Access(name string, mode uint32, context *fuse.Context) fuse.St
 				"h":           h,
 				"posthookErr": posthookErr,
 			}).Debug("Access: Posthooked")
+			span.disposition = DispositionPosthooked
 			return fuse.ToStatus(posthookErr)
 		}
 	}
@@ -290,8 +601,16 @@ func (h *HookFs) Access(name string, mode uint32, context *fuse.Context) fuse.St
 }
 
 // Link implements hanwen/go-fuse/fuse/pathfs.FileSystem. You are not expected to call h manually.
-func (h *HookFs) Link(oldName string, newName string, context *fuse.Context) fuse.Status {
-	hook, hookEnabled := h.hook.(HookOnLink)
+func (h *HookFs) Link(oldName string, newName string, context *fuse.Context) (code fuse.Status) {
+	span := h.begin(OpLink, oldName)
+	defer h.observe(span, &code)
+	if h.opts.ReadOnly {
+		return readOnly
+	}
+	if h.currentHook() == nil {
+		return h.lowerFs().Link(oldName, newName, context)
+	}
+	hook, hookEnabled := linkHook(h.currentHook())
 	var prehookErr, posthookErr error
 	var prehooked, posthooked bool
 	var prehookCtx HookContext
@@ -303,18 +622,19 @@ func (h *HookFs) Link(oldName string, newName string, context *fuse.Context) fus
 	}).Trace("fs.Link")
 
 	if hookEnabled {
-		prehooked, prehookCtx, prehookErr = hook.PreLink(oldName, newName)
+		prehooked, prehookCtx, prehookErr = hook.PreLinkWithContext(oldName, newName, context)
 		if prehooked {
 			log.WithFields(log.Fields{
 				"h":          h,
 				"prehookErr": prehookErr,
 				"prehookCtx": prehookCtx,
 			}).Debug("Link: Prehooked")
+			span.disposition = DispositionPrehooked
 			return fuse.ToStatus(prehookErr)
 		}
 	}
 
-	lowerCode := h.fs.Link(oldName, newName, context)
+	lowerCode := h.lowerFs().Link(oldName, newName, context)
 	if hookEnabled {
 		posthooked, posthookErr = hook.PostLink(int32(lowerCode), prehookCtx)
 		if posthooked {
@@ -322,6 +642,7 @@ func (h *HookFs) Link(oldName string, newName string, context *fuse.Context) fus
 				"h":           h,
 				"posthookErr": posthookErr,
 			}).Debug("Link: Posthooked")
+			span.disposition = DispositionPosthooked
 			return fuse.ToStatus(posthookErr)
 		}
 	}
@@ -330,8 +651,16 @@ func (h *HookFs) Link(oldName string, newName string, context *fuse.Context) fus
 }
 
 // Mkdir implements hanwen/go-fuse/fuse/pathfs.FileSystem. You are not expected to call h manually.
-func (h *HookFs) Mkdir(name string, mode uint32, context *fuse.Context) fuse.Status {
-	hook, hookEnabled := h.hook.(HookOnMkdir)
+func (h *HookFs) Mkdir(name string, mode uint32, context *fuse.Context) (code fuse.Status) {
+	span := h.begin(OpMkdir, name)
+	defer h.observe(span, &code)
+	if h.opts.ReadOnly {
+		return readOnly
+	}
+	if h.currentHook() == nil {
+		return h.lowerFs().Mkdir(name, mode, context)
+	}
+	hook, hookEnabled := mkdirHook(h.currentHook())
 	var prehookErr, posthookErr error
 	var prehooked, posthooked bool
 	var prehookCtx HookContext
@@ -343,25 +672,27 @@ func (h *HookFs) Mkdir(name string, mode uint32, context *fuse.Context) fuse.Sta
 	}).Trace("fs.Mkdir")
 
 	if hookEnabled {
-		prehooked, prehookCtx, prehookErr = hook.PreMkdir(name, mode)
+		prehooked, prehookCtx, prehookErr = hook.PreMkdirWithContext(name, mode, context)
 		if prehooked {
 			log.WithFields(log.Fields{
 				"h":          h,
 				"prehookErr": prehookErr,
 				"prehookCtx": prehookCtx,
 			}).Debug("Mkdir: Prehooked")
+			span.disposition = DispositionPrehooked
 			if prehookErr == nil {
 				log.WithFields(log.Fields{
 					"h":          h,
 					"prehookErr": prehookErr,
 					"prehookCtx": prehookCtx,
-				}).Fatal("Mkdir is prehooked, but did not returned an error. h is very strange.")
+				}).Error("Mkdir is prehooked, but did not return an error. Failing it with EIO.")
+				return fuse.EIO
 			}
 			return fuse.ToStatus(prehookErr)
 		}
 	}
 
-	lowerCode := h.fs.Mkdir(name, mode, context)
+	lowerCode := h.lowerFs().Mkdir(name, mode, context)
 	if hookEnabled {
 		posthooked, posthookErr = hook.PostMkdir(int32(lowerCode), prehookCtx)
 		if posthooked {
@@ -369,6 +700,7 @@ func (h *HookFs) Mkdir(name string, mode uint32, context *fuse.Context) fuse.Sta
 				"h":           h,
 				"posthookErr": posthookErr,
 			}).Debug("Mkdir: Posthooked")
+			span.disposition = DispositionPosthooked
 			return fuse.ToStatus(posthookErr)
 		}
 	}
@@ -377,8 +709,16 @@ func (h *HookFs) Mkdir(name string, mode uint32, context *fuse.Context) fuse.Sta
 }
 
 // Mknod implements hanwen/go-fuse/fuse/pathfs.FileSystem. You are not expected to call h manually.
-func (h *HookFs) Mknod(name string, mode uint32, dev uint32, context *fuse.Context) fuse.Status {
-	hook, hookEnabled := h.hook.(HookOnMknod)
+func (h *HookFs) Mknod(name string, mode uint32, dev uint32, context *fuse.Context) (code fuse.Status) {
+	span := h.begin(OpMknod, name)
+	defer h.observe(span, &code)
+	if h.opts.ReadOnly {
+		return readOnly
+	}
+	if h.currentHook() == nil {
+		return h.lowerFs().Mknod(name, mode, dev, context)
+	}
+	hook, hookEnabled := mknodHook(h.currentHook())
 	var prehookErr, posthookErr error
 	var prehooked, posthooked bool
 	var prehookCtx HookContext
@@ -391,18 +731,19 @@ func (h *HookFs) Mknod(name string, mode uint32, dev uint32, context *fuse.Conte
 	}).Trace("fs.Mknod")
 
 	if hookEnabled {
-		prehooked, prehookCtx, prehookErr = hook.PreMknod(name, mode, dev)
+		prehooked, prehookCtx, prehookErr = hook.PreMknodWithContext(name, mode, dev, context)
 		if prehooked {
 			log.WithFields(log.Fields{
 				"h":          h,
 				"prehookErr": prehookErr,
 				"prehookCtx": prehookCtx,
 			}).Debug("Mknod: Prehooked")
+			span.disposition = DispositionPrehooked
 			return fuse.ToStatus(prehookErr)
 		}
 	}
 
-	lowerCode := h.fs.Mknod(name, mode, dev, context)
+	lowerCode := h.lowerFs().Mknod(name, mode, dev, context)
 	if hookEnabled {
 		posthooked, posthookErr = hook.PostMknod(int32(lowerCode), prehookCtx)
 		if posthooked {
@@ -410,6 +751,7 @@ func (h *HookFs) Mknod(name string, mode uint32, dev uint32, context *fuse.Conte
 				"h":           h,
 				"posthookErr": posthookErr,
 			}).Debug("Mknod: Posthooked")
+			span.disposition = DispositionPosthooked
 			return fuse.ToStatus(posthookErr)
 		}
 	}
@@ -418,8 +760,16 @@ func (h *HookFs) Mknod(name string, mode uint32, dev uint32, context *fuse.Conte
 }
 
 // Rename implements hanwen/go-fuse/fuse/pathfs.FileSystem. You are not expected to call h manually.
-func (h *HookFs) Rename(oldName string, newName string, context *fuse.Context) fuse.Status {
-	hook, hookEnabled := h.hook.(HookOnRename)
+func (h *HookFs) Rename(oldName string, newName string, context *fuse.Context) (code fuse.Status) {
+	span := h.begin(OpRename, oldName)
+	defer h.observe(span, &code)
+	if h.opts.ReadOnly {
+		return readOnly
+	}
+	if h.currentHook() == nil {
+		return h.lowerFs().Rename(oldName, newName, context)
+	}
+	hook, hookEnabled := renameHook(h.currentHook())
 	var prehookErr, posthookErr error
 	var prehooked, posthooked bool
 	var prehookCtx HookContext
@@ -431,18 +781,19 @@ func (h *HookFs) Rename(oldName string, newName string, context *fuse.Context) f
 	}).Trace("fs.Rename")
 
 	if hookEnabled {
-		prehooked, prehookCtx, prehookErr = hook.PreRename(oldName, newName)
+		prehooked, prehookCtx, prehookErr = hook.PreRenameWithContext(oldName, newName, context)
 		if prehooked {
 			log.WithFields(log.Fields{
 				"h":          h,
 				"prehookErr": prehookErr,
 				"prehookCtx": prehookCtx,
 			}).Debug("Rename: Prehooked")
+			span.disposition = DispositionPrehooked
 			return fuse.ToStatus(prehookErr)
 		}
 	}
 
-	lowerCode := h.fs.Rename(oldName, newName, context)
+	lowerCode := h.lowerFs().Rename(oldName, newName, context)
 	if hookEnabled {
 		posthooked, posthookErr = hook.PostRename(int32(lowerCode), prehookCtx)
 		if posthooked {
@@ -450,6 +801,7 @@ func (h *HookFs) Rename(oldName string, newName string, context *fuse.Context) f
 				"h":           h,
 				"posthookErr": posthookErr,
 			}).Debug("Rename: Posthooked")
+			span.disposition = DispositionPosthooked
 			return fuse.ToStatus(posthookErr)
 		}
 	}
@@ -458,8 +810,16 @@ func (h *HookFs) Rename(oldName string, newName string, context *fuse.Context) f
 }
 
 // Rmdir implements hanwen/go-fuse/fuse/pathfs.FileSystem. You are not expected to call h manually.
-func (h *HookFs) Rmdir(name string, context *fuse.Context) fuse.Status {
-	hook, hookEnabled := h.hook.(HookOnRmdir)
+func (h *HookFs) Rmdir(name string, context *fuse.Context) (code fuse.Status) {
+	span := h.begin(OpRmdir, name)
+	defer h.observe(span, &code)
+	if h.opts.ReadOnly {
+		return readOnly
+	}
+	if h.currentHook() == nil {
+		return h.lowerFs().Rmdir(name, context)
+	}
+	hook, hookEnabled := rmdirHook(h.currentHook())
 	var prehookErr, posthookErr error
 	var prehooked, posthooked bool
 	var prehookCtx HookContext
@@ -470,25 +830,27 @@ func (h *HookFs) Rmdir(name string, context *fuse.Context) fuse.Status {
 	}).Trace("fs.Rmdir")
 
 	if hookEnabled {
-		prehooked, prehookCtx, prehookErr = hook.PreRmdir(name)
+		prehooked, prehookCtx, prehookErr = hook.PreRmdirWithContext(name, context)
 		if prehooked {
 			log.WithFields(log.Fields{
 				"h":          h,
 				"prehookErr": prehookErr,
 				"prehookCtx": prehookCtx,
 			}).Debug("Rmdir: Prehooked")
+			span.disposition = DispositionPrehooked
 			if prehookErr == nil {
 				log.WithFields(log.Fields{
 					"h":          h,
 					"prehookErr": prehookErr,
 					"prehookCtx": prehookCtx,
-				}).Fatal("Rmdir is prehooked, but did not returned an error. h is very strange.")
+				}).Error("Rmdir is prehooked, but did not return an error. Failing it with EIO.")
+				return fuse.EIO
 			}
 			return fuse.ToStatus(prehookErr)
 		}
 	}
 
-	lowerCode := h.fs.Rmdir(name, context)
+	lowerCode := h.lowerFs().Rmdir(name, context)
 	if hookEnabled {
 		posthooked, posthookErr = hook.PostRmdir(int32(lowerCode), prehookCtx)
 		if posthooked {
@@ -496,6 +858,7 @@ func (h *HookFs) Rmdir(name string, context *fuse.Context) fuse.Status {
 				"h":           h,
 				"posthookErr": posthookErr,
 			}).Debug("Rmdir: Posthooked")
+			span.disposition = DispositionPosthooked
 			return fuse.ToStatus(posthookErr)
 		}
 	}
@@ -504,8 +867,16 @@ func (h *HookFs) Rmdir(name string, context *fuse.Context) fuse.Status {
 }
 
 // Unlink implements hanwen/go-fuse/fuse/pathfs.FileSystem. You are not expected to call h manually.
-func (h *HookFs) Unlink(name string, context *fuse.Context) fuse.Status {
-	hook, hookEnabled := h.hook.(HookOnUnlink)
+func (h *HookFs) Unlink(name string, context *fuse.Context) (code fuse.Status) {
+	span := h.begin(OpUnlink, name)
+	defer h.observe(span, &code)
+	if h.opts.ReadOnly {
+		return readOnly
+	}
+	if h.currentHook() == nil {
+		return h.lowerFs().Unlink(name, context)
+	}
+	hook, hookEnabled := unlinkHook(h.currentHook())
 	var prehookErr, posthookErr error
 	var prehooked, posthooked bool
 	var prehookCtx HookContext
@@ -516,18 +887,19 @@ func (h *HookFs) Unlink(name string, context *fuse.Context) fuse.Status {
 	}).Trace("fs.Unlink")
 
 	if hookEnabled {
-		prehooked, prehookCtx, prehookErr = hook.PreUnlink(name)
+		prehooked, prehookCtx, prehookErr = hook.PreUnlinkWithContext(name, context)
 		if prehooked {
 			log.WithFields(log.Fields{
 				"h":          h,
 				"prehookErr": prehookErr,
 				"prehookCtx": prehookCtx,
 			}).Debug("Unlink: Prehooked")
+			span.disposition = DispositionPrehooked
 			return fuse.ToStatus(prehookErr)
 		}
 	}
 
-	lowerCode := h.fs.Unlink(name, context)
+	lowerCode := h.lowerFs().Unlink(name, context)
 	if hookEnabled {
 		posthooked, posthookErr = hook.PostUnlink(int32(lowerCode), prehookCtx)
 		if posthooked {
@@ -535,6 +907,7 @@ func (h *HookFs) Unlink(name string, context *fuse.Context) fuse.Status {
 				"h":           h,
 				"posthookErr": posthookErr,
 			}).Debug("Unlink: Posthooked")
+			span.disposition = DispositionPosthooked
 			return fuse.ToStatus(posthookErr)
 		}
 	}
@@ -543,8 +916,13 @@ func (h *HookFs) Unlink(name string, context *fuse.Context) fuse.Status {
 }
 
 // GetXAttr implements hanwen/go-fuse/fuse/pathfs.FileSystem. You are not expected to call h manually.
-func (h *HookFs) GetXAttr(name string, attribute string, context *fuse.Context) ([]byte, fuse.Status) {
-	hook, hookEnabled := h.hook.(HookOnGetXAttr)
+func (h *HookFs) GetXAttr(name string, attribute string, context *fuse.Context) (data []byte, code fuse.Status) {
+	span := h.begin(OpGetXAttr, name)
+	defer h.observe(span, &code)
+	if h.currentHook() == nil {
+		return h.lowerFs().GetXAttr(name, attribute, context)
+	}
+	hook, hookEnabled := getXAttrHook(h.currentHook())
 	var prehookErr, posthookErr error
 	var prehooked, posthooked bool
 	var prehookCtx HookContext
@@ -556,18 +934,19 @@ func (h *HookFs) GetXAttr(name string, attribute string, context *fuse.Context)
 	}).Trace("fs.CetXAttr")
 
 	if hookEnabled {
-		prehooked, prehookCtx, prehookErr = hook.PreGetXAttr(name, attribute)
+		prehooked, prehookCtx, prehookErr = hook.PreGetXAttrWithContext(name, attribute, context)
 		if prehooked {
 			log.WithFields(log.Fields{
 				"h":          h,
 				"prehookErr": prehookErr,
 				"prehookCtx": prehookCtx,
 			}).Debug("GetXAttr: Prehooked")
+			span.disposition = DispositionPrehooked
 			return nil, fuse.ToStatus(prehookErr)
 		}
 	}
 
-	attr, lowerCode := h.fs.GetXAttr(name, attribute, context)
+	attr, lowerCode := h.lowerFs().GetXAttr(name, attribute, context)
 	if hookEnabled {
 		posthooked, posthookErr = hook.PostGetXAttr(int32(lowerCode), prehookCtx)
 		if posthooked {
@@ -575,6 +954,7 @@ func (h *HookFs) GetXAttr(name string, attribute string, context *fuse.Context)
 				"h":           h,
 				"posthookErr": posthookErr,
 			}).Debug("GetXAttr: Posthooked")
+			span.disposition = DispositionPosthooked
 			return attr, fuse.ToStatus(posthookErr)
 		}
 	}
@@ -583,8 +963,13 @@ func (h *HookFs) GetXAttr(name string, attribute string, context *fuse.Context)
 }
 
 // ListXAttr implements hanwen/go-fuse/fuse/pathfs.FileSystem. You are not expected to call h manually.
-func (h *HookFs) ListXAttr(name string, context *fuse.Context) ([]string, fuse.Status) {
-	hook, hookEnabled := h.hook.(HookOnListXAttr)
+func (h *HookFs) ListXAttr(name string, context *fuse.Context) (attrs []string, code fuse.Status) {
+	span := h.begin(OpListXAttr, name)
+	defer h.observe(span, &code)
+	if h.currentHook() == nil {
+		return h.lowerFs().ListXAttr(name, context)
+	}
+	hook, hookEnabled := listXAttrHook(h.currentHook())
 	var prehookErr, posthookErr error
 	var prehooked, posthooked bool
 	var prehookCtx HookContext
@@ -595,18 +980,19 @@ func (h *HookFs) ListXAttr(name string, context *fuse.Context) ([]string, fuse.S
 	}).Trace("fs.ListXAttr")
 
 	if hookEnabled {
-		prehooked, prehookCtx, prehookErr = hook.PreListXAttr(name)
+		prehooked, prehookCtx, prehookErr = hook.PreListXAttrWithContext(name, context)
 		if prehooked {
 			log.WithFields(log.Fields{
 				"h":          h,
 				"prehookErr": prehookErr,
 				"prehookCtx": prehookCtx,
 			}).Debug("ListXAttr: Prehooked")
+			span.disposition = DispositionPrehooked
 			return nil, fuse.ToStatus(prehookErr)
 		}
 	}
 
-	attr, lowerCode := h.fs.ListXAttr(name, context)
+	attr, lowerCode := h.lowerFs().ListXAttr(name, context)
 	if hookEnabled {
 		posthooked, posthookErr = hook.PostListXAttr(int32(lowerCode), prehookCtx)
 		if posthooked {
@@ -614,6 +1000,7 @@ func (h *HookFs) ListXAttr(name string, context *fuse.Context) ([]string, fuse.S
 				"h":           h,
 				"posthookErr": posthookErr,
 			}).Debug("ListXAttr: Posthooked")
+			span.disposition = DispositionPosthooked
 			return attr, fuse.ToStatus(posthookErr)
 		}
 	}
@@ -622,8 +1009,16 @@ func (h *HookFs) ListXAttr(name string, context *fuse.Context) ([]string, fuse.S
 }
 
 // RemoveXAttr implements hanwen/go-fuse/fuse/pathfs.FileSystem. You are not expected to call h manually.
-func (h *HookFs) RemoveXAttr(name string, attr string, context *fuse.Context) fuse.Status {
-	hook, hookEnabled := h.hook.(HookOnRemoveXAttr)
+func (h *HookFs) RemoveXAttr(name string, attr string, context *fuse.Context) (code fuse.Status) {
+	span := h.begin(OpRemoveXAttr, name)
+	defer h.observe(span, &code)
+	if h.opts.ReadOnly {
+		return readOnly
+	}
+	if h.currentHook() == nil {
+		return h.lowerFs().RemoveXAttr(name, attr, context)
+	}
+	hook, hookEnabled := removeXAttrHook(h.currentHook())
 	var prehookErr, posthookErr error
 	var prehooked, posthooked bool
 	var prehookCtx HookContext
@@ -635,18 +1030,19 @@ func (h *HookFs) RemoveXAttr(name string, attr string, context *fuse.Context) fu
 	}).Trace("fs.RemoveXAttr")
 
 	if hookEnabled {
-		prehooked, prehookCtx, prehookErr = hook.PreRemoveXAttr(name, attr)
+		prehooked, prehookCtx, prehookErr = hook.PreRemoveXAttrWithContext(name, attr, context)
 		if prehooked {
 			log.WithFields(log.Fields{
 				"h":          h,
 				"prehookErr": prehookErr,
 				"prehookCtx": prehookCtx,
 			}).Debug("RemoveXAttr: Prehooked")
+			span.disposition = DispositionPrehooked
 			return fuse.ToStatus(prehookErr)
 		}
 	}
 
-	lowerCode := h.fs.RemoveXAttr(name, attr, context)
+	lowerCode := h.lowerFs().RemoveXAttr(name, attr, context)
 	if hookEnabled {
 		posthooked, posthookErr = hook.PostRemoveXAttr(int32(lowerCode), prehookCtx)
 		if posthooked {
@@ -654,6 +1050,7 @@ func (h *HookFs) RemoveXAttr(name string, attr string, context *fuse.Context) fu
 				"h":           h,
 				"posthookErr": posthookErr,
 			}).Debug("RemoveXAttr: Posthooked")
+			span.disposition = DispositionPosthooked
 			return fuse.ToStatus(posthookErr)
 		}
 	}
@@ -662,8 +1059,16 @@ func (h *HookFs) RemoveXAttr(name string, attr string, context *fuse.Context) fu
 }
 
 // SetXAttr implements hanwen/go-fuse/fuse/pathfs.FileSystem. You are not expected to call h manually.
-func (h *HookFs) SetXAttr(name string, attr string, data []byte, flags int, context *fuse.Context) fuse.Status {
-	hook, hookEnabled := h.hook.(HookOnSetXAttr)
+func (h *HookFs) SetXAttr(name string, attr string, data []byte, flags int, context *fuse.Context) (code fuse.Status) {
+	span := h.begin(OpSetXAttr, name)
+	defer h.observe(span, &code)
+	if h.opts.ReadOnly {
+		return readOnly
+	}
+	if h.currentHook() == nil {
+		return h.lowerFs().SetXAttr(name, attr, data, flags, context)
+	}
+	hook, hookEnabled := setXAttrHook(h.currentHook())
 	var prehookErr, posthookErr error
 	var prehooked, posthooked bool
 	var prehookCtx HookContext
@@ -677,18 +1082,19 @@ func (h *HookFs) SetXAttr(name string, attr string, data []byte, flags int, cont
 	}).Trace("fs.SetXAttr")
 
 	if hookEnabled {
-		prehooked, prehookCtx, prehookErr = hook.PreSetXAttr(name, attr, data, flags)
+		prehooked, prehookCtx, prehookErr = hook.PreSetXAttrWithContext(name, attr, data, flags, context)
 		if prehooked {
 			log.WithFields(log.Fields{
 				"h":          h,
 				"prehookErr": prehookErr,
 				"prehookCtx": prehookCtx,
 			}).Debug("SetXAttr: Prehooked")
+			span.disposition = DispositionPrehooked
 			return fuse.ToStatus(prehookErr)
 		}
 	}
 
-	lowerCode := h.fs.SetXAttr(name, attr, data, flags, context)
+	lowerCode := h.lowerFs().SetXAttr(name, attr, data, flags, context)
 	if hookEnabled {
 		posthooked, posthookErr = hook.PostSetXAttr(int32(lowerCode), prehookCtx)
 		if posthooked {
@@ -696,6 +1102,7 @@ func (h *HookFs) SetXAttr(name string, attr string, data []byte, flags int, cont
 				"h":           h,
 				"posthookErr": posthookErr,
 			}).Debug("SetXAttr: Posthooked")
+			span.disposition = DispositionPosthooked
 			return fuse.ToStatus(posthookErr)
 		}
 	}
@@ -709,14 +1116,22 @@ func (h *HookFs) OnMount(nodeFs *pathfs.PathNodeFs) {
 		"h": h,
 	}).Trace("fs.OnMount")
 
+	h.backendMu.Lock()
+	h.nodeFs = nodeFs
 	h.fs.OnMount(nodeFs)
-	hook, hookEnabled := h.hook.(HookWithInit)
+	h.backendMu.Unlock()
+	hook, hookEnabled := h.currentHook().(HookWithInit)
 	if hookEnabled {
 		err := hook.Init()
+		h.initErr = nil
 		if err != nil {
 			log.Error(err)
+			if h.opts.FailOnInitError {
+				h.initErr = err
+				return
+			}
 			log.Warn("Disabling hook")
-			h.hook = nil
+			h.hook.Store(hookBox{})
 		}
 	}
 }
@@ -727,12 +1142,25 @@ func (h *HookFs) OnUnmount() {
 		"h": h,
 	}).Trace("fs.OnUnmount")
 
-	h.fs.OnUnmount()
+	h.lowerFs().OnUnmount()
 }
 
 // Open implements hanwen/go-fuse/fuse/pathfs.FileSystem. You are not expected to call h manually.
-func (h *HookFs) Open(name string, flags uint32, context *fuse.Context) (nodefs.File, fuse.Status) {
-	hook, hookEnabled := h.hook.(HookOnOpen)
+func (h *HookFs) Open(name string, flags uint32, context *fuse.Context) (file nodefs.File, code fuse.Status) {
+	span := h.begin(OpOpen, name)
+	defer h.observe(span, &code)
+	if h.opts.ReadOnly && (flags&syscall.O_ACCMODE != syscall.O_RDONLY || flags&syscall.O_TRUNC != 0) {
+		return nil, readOnly
+	}
+	if h.currentHook() == nil {
+		lowerFile, lowerCode := h.lowerFs().Open(name, h.lowerOpenFlags(flags), context)
+		if lowerFile == nil {
+			return nil, lowerCode
+		}
+		hFile, _ := newHookFile(lowerFile, name, flags, h)
+		return h.withOpenFlags(hFile), lowerCode
+	}
+	hook, hookEnabled := openHook(h.currentHook())
 	var prehookErr, posthookErr error
 	var prehooked, posthooked bool
 	var prehookCtx HookContext
@@ -744,26 +1172,28 @@ func (h *HookFs) Open(name string, flags uint32, context *fuse.Context) (nodefs.
 	}).Trace("fs.Open")
 
 	if hookEnabled {
-		prehooked, prehookCtx, prehookErr = hook.PreOpen(name, flags)
+		prehooked, prehookCtx, prehookErr = hook.PreOpenWithContext(name, flags, context)
 		if prehooked {
 			log.WithFields(log.Fields{
 				"h":          h,
 				"prehookErr": prehookErr,
 				"prehookCtx": prehookCtx,
 			}).Debug("Open: Prehooked")
+			span.disposition = DispositionPrehooked
 			if prehookErr == nil {
 				log.WithFields(log.Fields{
 					"h":          h,
 					"prehookErr": prehookErr,
 					"prehookCtx": prehookCtx,
-				}).Fatal("Open is prehooked, but did not returned an error. h is very strange.")
+				}).Error("Open is prehooked, but did not return an error. Failing it with EIO.")
+				return nil, fuse.EIO
 			}
 			return nil, fuse.ToStatus(prehookErr)
 		}
 	}
 
-	lowerFile, lowerCode := h.fs.Open(name, flags, context)
-	hFile, hErr := newHookFile(lowerFile, name, h.hook)
+	lowerFile, lowerCode := h.lowerFs().Open(name, h.lowerOpenFlags(flags), context)
+	hFile, hErr := newHookFile(lowerFile, name, flags, h)
 	if hErr != nil {
 		log.WithField("error", hErr).Panic("NewHookFile() should not cause an error")
 	}
@@ -775,16 +1205,45 @@ func (h *HookFs) Open(name string, flags uint32, context *fuse.Context) (nodefs.
 				"h":           h,
 				"posthookErr": posthookErr,
 			}).Debug("Open: Posthooked")
-			return hFile, fuse.ToStatus(posthookErr)
+			span.disposition = DispositionPosthooked
+			return h.withOpenFlags(hFile), fuse.ToStatus(posthookErr)
 		}
 	}
 
-	return hFile, lowerCode
+	return h.withOpenFlags(hFile), lowerCode
+}
+
+// withOpenFlags returns f with the FUSE open flags called for by h.opts.
+func (h *HookFs) withOpenFlags(f *hookFile) nodefs.File {
+	if !h.opts.DirectIO {
+		return f
+	}
+	return &nodefs.WithFlags{
+		File:      f,
+		FuseFlags: fuse.FOPEN_DIRECT_IO,
+	}
 }
 
 // Create implements hanwen/go-fuse/fuse/pathfs.FileSystem. You are not expected to call h manually.
-func (h *HookFs) Create(name string, flags uint32, mode uint32, context *fuse.Context) (nodefs.File, fuse.Status) {
-	hook, hookEnabled := h.hook.(HookOnCreate)
+func (h *HookFs) Create(name string, flags uint32, mode uint32, context *fuse.Context) (file nodefs.File, code fuse.Status) {
+	span := h.begin(OpCreate, name)
+	defer h.observe(span, &code)
+	if h.opts.ReadOnly {
+		return nil, readOnly
+	}
+	if flags&syscall.O_EXCL != 0 {
+		// serialize exclusive creates of a path, hooks included, so that exactly one wins
+		defer h.createLocks.lock(name)()
+	}
+	if h.currentHook() == nil {
+		lowerFile, lowerCode := h.lowerFs().Create(name, h.lowerOpenFlags(flags), mode, context)
+		if lowerFile == nil {
+			return nil, lowerCode
+		}
+		hFile, _ := newHookFile(lowerFile, name, flags, h)
+		return h.withOpenFlags(hFile), lowerCode
+	}
+	hook, hookEnabled := createHook(h.currentHook())
 	var prehookErr, posthookErr error
 	var prehooked, posthooked bool
 	var prehookCtx HookContext
@@ -797,19 +1256,28 @@ func (h *HookFs) Create(name string, flags uint32, mode uint32, context *fuse.Co
 	}).Trace("fs.Create")
 
 	if hookEnabled {
-		prehooked, prehookCtx, prehookErr = hook.PreCreate(name, flags, mode)
+		prehooked, prehookCtx, prehookErr = hook.PreCreateWithContext(name, flags, mode, context)
 		if prehooked {
 			log.WithFields(log.Fields{
 				"h":          h,
 				"prehookErr": prehookErr,
 				"prehookCtx": prehookCtx,
 			}).Debug("Create: Prehooked")
+			span.disposition = DispositionPrehooked
+			if prehookErr == nil {
+				log.WithFields(log.Fields{
+					"h":          h,
+					"prehookErr": prehookErr,
+					"prehookCtx": prehookCtx,
+				}).Error("Create is prehooked, but did not return an error. Failing it with EIO.")
+				return nil, fuse.EIO
+			}
 			return nil, fuse.ToStatus(prehookErr)
 		}
 	}
 
-	lowerFile, lowerCode := h.fs.Create(name, flags, mode, context)
-	hFile, hErr := newHookFile(lowerFile, name, h.hook)
+	lowerFile, lowerCode := h.lowerFs().Create(name, h.lowerOpenFlags(flags), mode, context)
+	hFile, hErr := newHookFile(lowerFile, name, flags, h)
 	if hErr != nil {
 		log.WithField("error", hErr).Panic("NewHookFile() should not cause an error")
 	}
@@ -821,16 +1289,42 @@ func (h *HookFs) Create(name string, flags uint32, mode uint32, context *fuse.Co
 				"h":           h,
 				"posthookErr": posthookErr,
 			}).Debug("Create: Posthooked")
-			return hFile, fuse.ToStatus(posthookErr)
+			span.disposition = DispositionPosthooked
+			return h.withOpenFlags(hFile), fuse.ToStatus(posthookErr)
 		}
 	}
 
-	return hFile, lowerCode
+	return h.withOpenFlags(hFile), lowerCode
+}
+
+// lowerOpenFlags returns the flags to open a file in Original with.
+func (h *HookFs) lowerOpenFlags(flags uint32) uint32 {
+	if h.opts.SyncWrites && flags&syscall.O_ACCMODE != syscall.O_RDONLY {
+		flags |= syscall.O_SYNC
+	}
+	return flags
 }
 
 // OpenDir implements hanwen/go-fuse/fuse/pathfs.FileSystem. You are not expected to call h manually.
-func (h *HookFs) OpenDir(name string, context *fuse.Context) ([]fuse.DirEntry, fuse.Status) {
-	hook, hookEnabled := h.hook.(HookOnOpenDir)
+func (h *HookFs) OpenDir(name string, context *fuse.Context) (entries []fuse.DirEntry, code fuse.Status) {
+	span := h.begin(OpOpenDir, name)
+	defer h.observe(span, &code)
+	if h.currentHook() == nil {
+		return h.lowerFs().OpenDir(name, context)
+	}
+	if hook, ok := h.currentHook().(HookWithVirtualDirs); ok {
+		if entries, hooked, err := hook.VirtualOpenDir(name); hooked {
+			log.WithFields(log.Fields{
+				"h":       h,
+				"err":     err,
+				"entries": len(entries),
+			}).Debug("OpenDir: Virtual")
+			span.disposition = DispositionPrehooked
+			return entries, fuse.ToStatus(err)
+		}
+	}
+	hook, hookEnabled := openDirHook(h.currentHook())
+	var posthookEnts []fuse.DirEntry
 	var prehookErr, posthookErr error
 	var prehooked, posthooked bool
 	var prehookCtx HookContext
@@ -848,26 +1342,29 @@ func (h *HookFs) OpenDir(name string, context *fuse.Context) ([]fuse.DirEntry, f
 				"prehookErr": prehookErr,
 				"prehookCtx": prehookCtx,
 			}).Debug("OpenDir: Prehooked")
+			span.disposition = DispositionPrehooked
 			if prehookErr == nil {
 				log.WithFields(log.Fields{
 					"h":          h,
 					"prehookErr": prehookErr,
 					"prehookCtx": prehookCtx,
-				}).Fatal("OpenDir is prehooked, but did not returned an error. h is very strange.")
+				}).Error("OpenDir is prehooked, but did not return an error. Failing it with EIO.")
+				return nil, fuse.EIO
 			}
 			return nil, fuse.ToStatus(prehookErr)
 		}
 	}
 
-	lowerEnts, lowerCode := h.fs.OpenDir(name, context)
+	lowerEnts, lowerCode := h.lowerFs().OpenDir(name, context)
 	if hookEnabled {
-		posthooked, posthookErr = hook.PostOpenDir(int32(lowerCode), prehookCtx)
+		posthookEnts, posthooked, posthookErr = hook.PostOpenDirWithEntries(int32(lowerCode), lowerEnts, prehookCtx)
 		if posthooked {
 			log.WithFields(log.Fields{
 				"h":           h,
 				"posthookErr": posthookErr,
 			}).Debug("OpenDir: Posthooked")
-			return lowerEnts, fuse.ToStatus(posthookErr)
+			span.disposition = DispositionPosthooked
+			return posthookEnts, fuse.ToStatus(posthookErr)
 		}
 	}
 
@@ -875,8 +1372,16 @@ func (h *HookFs) OpenDir(name string, context *fuse.Context) ([]fuse.DirEntry, f
 }
 
 // Symlink implements hanwen/go-fuse/fuse/pathfs.FileSystem. You are not expected to call h manually.
-func (h *HookFs) Symlink(value string, linkName string, context *fuse.Context) fuse.Status {
-	hook, hookEnabled := h.hook.(HookOnSymlink)
+func (h *HookFs) Symlink(value string, linkName string, context *fuse.Context) (code fuse.Status) {
+	span := h.begin(OpSymlink, linkName)
+	defer h.observe(span, &code)
+	if h.opts.ReadOnly {
+		return readOnly
+	}
+	if h.currentHook() == nil {
+		return h.lowerFs().Symlink(value, linkName, context)
+	}
+	hook, hookEnabled := symlinkHook(h.currentHook())
 	var prehookErr, posthookErr error
 	var prehooked, posthooked bool
 	var prehookCtx HookContext
@@ -888,18 +1393,19 @@ func (h *HookFs) Symlink(value string, linkName string, context *fuse.Context) f
 	}).Trace("fs.Symlink")
 
 	if hookEnabled {
-		prehooked, prehookCtx, prehookErr = hook.PreSymlink(value, linkName)
+		prehooked, prehookCtx, prehookErr = hook.PreSymlinkWithContext(value, linkName, context)
 		if prehooked {
 			log.WithFields(log.Fields{
 				"h":          h,
 				"prehookErr": prehookErr,
 				"prehookCtx": prehookCtx,
 			}).Debug("Symlink: Prehooked")
+			span.disposition = DispositionPrehooked
 			return fuse.ToStatus(prehookErr)
 		}
 	}
 
-	lowerCode := h.fs.Symlink(value, linkName, context)
+	lowerCode := h.lowerFs().Symlink(value, linkName, context)
 	if hookEnabled {
 		posthooked, posthookErr = hook.PostSymlink(int32(lowerCode), prehookCtx)
 		if posthooked {
@@ -907,6 +1413,7 @@ func (h *HookFs) Symlink(value string, linkName string, context *fuse.Context) f
 				"h":           h,
 				"posthookErr": posthookErr,
 			}).Debug("Symlink: Posthooked")
+			span.disposition = DispositionPosthooked
 			return fuse.ToStatus(posthookErr)
 		}
 	}
@@ -915,8 +1422,13 @@ func (h *HookFs) Symlink(value string, linkName string, context *fuse.Context) f
 }
 
 // Readlink implements hanwen/go-fuse/fuse/pathfs.FileSystem. You are not expected to call h manually.
-func (h *HookFs) Readlink(name string, context *fuse.Context) (string, fuse.Status) {
-	hook, hookEnabled := h.hook.(HookOnReadlink)
+func (h *HookFs) Readlink(name string, context *fuse.Context) (link string, code fuse.Status) {
+	span := h.begin(OpReadlink, name)
+	defer h.observe(span, &code)
+	if h.currentHook() == nil {
+		return h.lowerFs().Readlink(name, context)
+	}
+	hook, hookEnabled := readlinkHook(h.currentHook())
 	var prehookErr, posthookErr error
 	var prehooked, posthooked bool
 	var prehookCtx HookContext
@@ -927,18 +1439,19 @@ func (h *HookFs) Readlink(name string, context *fuse.Context) (string, fuse.Stat
 	}).Trace("fs.Readlink")
 
 	if hookEnabled {
-		prehooked, prehookCtx, prehookErr = hook.PreReadlink(name)
+		prehooked, prehookCtx, prehookErr = hook.PreReadlinkWithContext(name, context)
 		if prehooked {
 			log.WithFields(log.Fields{
 				"h":          h,
 				"prehookErr": prehookErr,
 				"prehookCtx": prehookCtx,
 			}).Debug("Readlink: Prehooked")
+			span.disposition = DispositionPrehooked
 			return "", fuse.ToStatus(prehookErr)
 		}
 	}
 
-	link, lowerCode := h.fs.Readlink(name, context)
+	link, lowerCode := h.lowerFs().Readlink(name, context)
 	if hookEnabled {
 		posthooked, posthookErr = hook.PostReadlink(int32(lowerCode), prehookCtx)
 		if posthooked {
@@ -946,6 +1459,7 @@ func (h *HookFs) Readlink(name string, context *fuse.Context) (string, fuse.Stat
 				"h":           h,
 				"posthookErr": posthookErr,
 			}).Debug("Readlink: Posthooked")
+			span.disposition = DispositionPosthooked
 			return link, fuse.ToStatus(posthookErr)
 		}
 	}
@@ -954,8 +1468,20 @@ func (h *HookFs) Readlink(name string, context *fuse.Context) (string, fuse.Stat
 }
 
 // StatFs implements hanwen/go-fuse/fuse/pathfs.FileSystem. You are not expected to call h manually.
-func (h *HookFs) StatFs(name string) *fuse.StatfsOut {
-	hook, hookEnabled := h.hook.(HookOnStatFs)
+func (h *HookFs) StatFs(name string) (out *fuse.StatfsOut) {
+	span := h.begin(OpStatFs, name)
+	defer func() {
+		code := fuse.OK
+		if out == nil {
+			code = fuse.ENOSYS
+		}
+		h.observe(span, &code)
+	}()
+	if h.currentHook() == nil {
+		return h.lowerFs().StatFs(name)
+	}
+	hook, hookEnabled := statFsHook(h.currentHook())
+	var prehookOut, posthookOut *fuse.StatfsOut
 	var prehookErr, posthookErr error
 	var prehooked, posthooked bool
 	var prehookCtx HookContext
@@ -966,38 +1492,91 @@ func (h *HookFs) StatFs(name string) *fuse.StatfsOut {
 	}).Trace("fs.StatFs")
 
 	if hookEnabled {
-		prehooked, prehookCtx, prehookErr = hook.PreStatFs(name)
+		prehookOut, prehooked, prehookCtx, prehookErr = hook.PreStatFsWithResult(name)
 		if prehooked {
 			log.WithFields(log.Fields{
 				"h":          h,
+				"prehookOut": prehookOut,
 				"prehookErr": prehookErr,
 				"prehookCtx": prehookCtx,
 			}).Debug("StatFs: Prehooked")
-			return nil
+			span.disposition = DispositionPrehooked
+			if prehookErr != nil {
+				return nil
+			}
+			return prehookOut
 		}
 	}
 
-	out := h.fs.StatFs(name)
+	out = h.lowerFs().StatFs(name)
 	if hookEnabled {
-		posthooked, posthookErr = hook.PostStatFs(prehookCtx)
+		posthookOut, posthooked, posthookErr = hook.PostStatFsWithResult(out, prehookCtx)
 		if posthooked {
 			log.WithFields(log.Fields{
 				"h":           h,
+				"posthookOut": posthookOut,
 				"posthookErr": posthookErr,
 			}).Debug("StatFs: Posthooked")
-			return out
+			span.disposition = DispositionPosthooked
+			if posthookErr != nil {
+				return nil
+			}
+			if posthookOut == nil {
+				return out
+			}
+			return posthookOut
 		}
 	}
 
 	return out
 }
 
-// Serve starts the server (blocking).
+var (
+	errNoMountpoint = errors.New("hookfs has no mountpoint, serve it with a server of your own")
+	errNotServing   = errors.New("hookfs is not being served")
+)
+
+// Serve starts the server (blocking), and returns nil once the filesystem is unmounted.
+// It fails for a HookFs created by WrapFileSystem, which has no mountpoint.
 func (h *HookFs) Serve() error {
+	if h.Mountpoint == "" {
+		return errNoMountpoint
+	}
 	server, err := newHookServer(h)
 	if err != nil {
 		return err
 	}
+	h.serverMu.Lock()
+	h.server = server
+	h.serverMu.Unlock()
+	defer func() {
+		h.serverMu.Lock()
+		h.server = nil
+		h.serverMu.Unlock()
+		h.stopHook()
+	}()
+
 	server.Serve()
 	return nil
 }
+
+// Unmount unmounts the filesystem served by Serve, which then returns. It is safe to call
+// from another goroutine. Unmounting fails with EBUSY while files of the mount are open.
+// A HookWithStop is stopped first, as unmounting waits for the operations being served.
+func (h *HookFs) Unmount() error {
+	h.serverMu.Lock()
+	server := h.server
+	h.serverMu.Unlock()
+	if server == nil {
+		return errNotServing
+	}
+	h.stopHook()
+	return server.Unmount()
+}
+
+// stopHook stops the hook if it is a HookWithStop.
+func (h *HookFs) stopHook() {
+	if hook, ok := h.currentHook().(HookWithStop); ok {
+		hook.Stop()
+	}
+}
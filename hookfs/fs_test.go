@@ -0,0 +1,275 @@
+package hookfs
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/hanwen/go-fuse/fuse/nodefs"
+	"github.com/hanwen/go-fuse/fuse/pathfs"
+)
+
+// fakeAttrHook makes fake appear as a regular file of size bytes.
+type fakeAttrHook struct {
+	fake string
+	size uint64
+}
+
+func (h *fakeAttrHook) PreGetAttr(path string) (bool, HookContext, error) {
+	return false, path, nil
+}
+
+func (h *fakeAttrHook) PostGetAttr(realRetCode int32, realAttr *fuse.Attr, prehookCtx HookContext) (*fuse.Attr, bool, error) {
+	if prehookCtx != h.fake || syscall.Errno(realRetCode) != syscall.ENOENT {
+		return nil, false, nil
+	}
+	return &fuse.Attr{Mode: syscall.S_IFREG | 0644, Size: h.size, Nlink: 1}, true, nil
+}
+
+func TestGetAttrPosthookFakesMissingPath(t *testing.T) {
+	for name, hook := range map[string]Hook{
+		"hook":  &fakeAttrHook{fake: "fake", size: 42},
+		"chain": NewHookChain(&fakeAttrHook{fake: "fake", size: 42}),
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, _, mnt := mount(t, hook, nil)
+			fi, err := os.Stat(filepath.Join(mnt, "fake"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fi.Size() != 42 || !fi.Mode().IsRegular() {
+				t.Errorf("fake is %v of %d bytes, want a regular file of 42 bytes", fi.Mode(), fi.Size())
+			}
+			if _, err := os.Stat(filepath.Join(mnt, "missing")); !os.IsNotExist(err) {
+				t.Errorf("stat missing = %v, want ENOENT", err)
+			}
+		})
+	}
+}
+
+// getAttrRecorder records the paths of the GetAttr calls it sees.
+type getAttrRecorder struct {
+	mu    sync.Mutex
+	paths []string
+}
+
+func (h *getAttrRecorder) PreGetAttr(path string) (bool, HookContext, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.paths = append(h.paths, path)
+	return false, nil, nil
+}
+
+func (h *getAttrRecorder) PostGetAttr(realRetCode int32, realAttr *fuse.Attr, prehookCtx HookContext) (*fuse.Attr, bool, error) {
+	return nil, false, nil
+}
+
+func (h *getAttrRecorder) seen(path string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, p := range h.paths {
+		if p == path {
+			return true
+		}
+	}
+	return false
+}
+
+func TestBackendAndMountPaths(t *testing.T) {
+	hook := &getAttrRecorder{}
+	h, original, mnt := mount(t, hook, &Options{AttrTimeout: -1, EntryTimeout: -1})
+	if err := os.MkdirAll(filepath.Join(original, "dir", "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(original, "dir", "sub", "file"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"", "dir", "dir/sub/file"} {
+		if _, err := os.Stat(filepath.Join(mnt, name)); err != nil {
+			t.Fatal(err)
+		}
+		if !hook.seen(name) {
+			t.Errorf("stat of %q did not reach the hook with that path", name)
+		}
+		if got, want := h.BackendPath(name), filepath.Join(original, name); got != want {
+			t.Errorf("BackendPath(%q) = %q, want %q", name, got, want)
+		}
+		if got, want := h.MountPath(name), filepath.Join(mnt, name); got != want {
+			t.Errorf("MountPath(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestWrapFileSystemWithOwnServer(t *testing.T) {
+	if _, err := exec.LookPath("fusermount"); err != nil {
+		t.Skip("fusermount is needed to mount")
+	}
+	serveFromTest(t)
+	original, mnt := t.TempDir(), t.TempDir()
+	hook := &getAttrRecorder{}
+	h, err := WrapFileSystem(pathfs.NewLoopbackFileSystem(original), hook, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Serve(); err != errNoMountpoint {
+		t.Errorf("Serve = %v, want %v", err, errNoMountpoint)
+	}
+
+	nodeFs := pathfs.NewPathNodeFs(h, nil)
+	opts := nodefs.NewOptions()
+	opts.AttrTimeout = 0
+	opts.EntryTimeout = 0
+	server, _, err := nodefs.MountRoot(mnt, nodeFs.Root(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve()
+	if err := server.WaitMount(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		for i := 0; server.Unmount() != nil && i < 100; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+
+	if err := ioutil.WriteFile(filepath.Join(mnt, "file"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(original, "file")); err != nil || string(data) != "data" {
+		t.Errorf("original file holds %q, %v, want data", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(mnt, "file")); err != nil {
+		t.Fatal(err)
+	}
+	if !hook.seen("file") {
+		t.Error("stat through the mount did not reach the hook")
+	}
+}
+
+// hookedWithoutError prehooks mkdir, rmdir, open, opendir and create without returning an error.
+type hookedWithoutError struct{}
+
+func (hookedWithoutError) PreMkdir(path string, mode uint32) (bool, HookContext, error) {
+	return true, nil, nil
+}
+
+func (hookedWithoutError) PostMkdir(realRetCode int32, prehookCtx HookContext) (bool, error) {
+	return false, nil
+}
+
+func (hookedWithoutError) PreRmdir(path string) (bool, HookContext, error) {
+	return true, nil, nil
+}
+
+func (hookedWithoutError) PostRmdir(realRetCode int32, prehookCtx HookContext) (bool, error) {
+	return false, nil
+}
+
+func (hookedWithoutError) PreOpen(path string, flags uint32) (bool, HookContext, error) {
+	return true, nil, nil
+}
+
+func (hookedWithoutError) PostOpen(realRetCode int32, prehookCtx HookContext) (bool, error) {
+	return false, nil
+}
+
+func (hookedWithoutError) PreOpenDir(path string) (bool, HookContext, error) {
+	return true, nil, nil
+}
+
+func (hookedWithoutError) PostOpenDir(realRetCode int32, prehookCtx HookContext) (bool, error) {
+	return false, nil
+}
+
+func (hookedWithoutError) PreCreate(name string, flags uint32, mode uint32) (bool, HookContext, error) {
+	return true, nil, nil
+}
+
+func (hookedWithoutError) PostCreate(realRetCode int32, prehookCtx HookContext) (bool, error) {
+	return false, nil
+}
+
+func TestPrehookedWithoutErrorFailsWithEIO(t *testing.T) {
+	original := t.TempDir()
+	for _, dir := range []string{"dir", "empty"} {
+		if err := os.Mkdir(filepath.Join(original, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(original, "file"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	h, err := NewHookFs(original, t.TempDir(), hookedWithoutError{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := &fuse.Context{}
+	if code := h.Mkdir("new", 0755, ctx); code != fuse.EIO {
+		t.Errorf("mkdir: %v, want EIO", code)
+	}
+	if code := h.Rmdir("empty", ctx); code != fuse.EIO {
+		t.Errorf("rmdir: %v, want EIO", code)
+	}
+	if _, code := h.Open("file", syscall.O_RDONLY, ctx); code != fuse.EIO {
+		t.Errorf("open: %v, want EIO", code)
+	}
+	if _, code := h.OpenDir("dir", ctx); code != fuse.EIO {
+		t.Errorf("opendir: %v, want EIO", code)
+	}
+	if _, code := h.Create("created", syscall.O_WRONLY, 0644, ctx); code != fuse.EIO {
+		t.Errorf("create: %v, want EIO", code)
+	}
+	// nothing was done
+	if _, err := os.Stat(filepath.Join(original, "new")); !os.IsNotExist(err) {
+		t.Errorf("new was created: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(original, "empty")); err != nil {
+		t.Errorf("empty was removed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(original, "created")); !os.IsNotExist(err) {
+		t.Errorf("created was created: %v", err)
+	}
+}
+
+// statFsPosthook posthooks statfs with out and err.
+type statFsPosthook struct {
+	out *fuse.StatfsOut
+	err error
+}
+
+func (h statFsPosthook) PreStatFsWithResult(path string) (*fuse.StatfsOut, bool, HookContext, error) {
+	return nil, false, nil, nil
+}
+
+func (h statFsPosthook) PostStatFsWithResult(realOut *fuse.StatfsOut, prehookCtx HookContext) (*fuse.StatfsOut, bool, error) {
+	return h.out, true, h.err
+}
+
+func TestStatFsPosthook(t *testing.T) {
+	fake := &fuse.StatfsOut{Blocks: 42}
+	for _, tc := range []struct {
+		name string
+		hook statFsPosthook
+		want func(out *fuse.StatfsOut) bool
+	}{
+		{"result", statFsPosthook{out: fake}, func(out *fuse.StatfsOut) bool { return out == fake }},
+		{"no result", statFsPosthook{}, func(out *fuse.StatfsOut) bool { return out != nil && out != fake }},
+		{"error", statFsPosthook{err: syscall.EIO}, func(out *fuse.StatfsOut) bool { return out == nil }},
+	} {
+		h, err := NewHookFs(t.TempDir(), t.TempDir(), tc.hook)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out := h.StatFs(""); !tc.want(out) {
+			t.Errorf("%s: statfs returned %+v", tc.name, out)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package hookfs
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/hanwen/go-fuse/fuse/nodefs"
+)
+
+// fsyncCoalescer implements Options.FsyncCoalesceWindow for a single file handle.
+type fsyncCoalescer struct {
+	window  time.Duration
+	mu      sync.Mutex
+	pending *fsyncBatch
+}
+
+// fsyncBatch is a group of fsyncs served by one real fsync.
+type fsyncBatch struct {
+	datasync bool
+	done     chan struct{}
+	code     fuse.Status
+}
+
+func newFsyncCoalescer(window time.Duration) *fsyncCoalescer {
+	if window <= 0 {
+		return nil
+	}
+	return &fsyncCoalescer{window: window}
+}
+
+// fsync joins the pending batch, or starts a new one and issues the real fsync
+// after the window has passed. A batch stops accepting fsyncs before the real fsync starts.
+func (c *fsyncCoalescer) fsync(file nodefs.File, flags int) fuse.Status {
+	datasync := flags&1 != 0
+
+	c.mu.Lock()
+	if b := c.pending; b != nil {
+		// a full sync in the batch covers a datasync, but not the other way around
+		b.datasync = b.datasync && datasync
+		c.mu.Unlock()
+		<-b.done
+		return b.code
+	}
+	b := &fsyncBatch{datasync: datasync, done: make(chan struct{})}
+	c.pending = b
+	c.mu.Unlock()
+
+	time.Sleep(c.window)
+
+	c.mu.Lock()
+	c.pending = nil
+	flags = 0
+	if b.datasync {
+		flags = 1
+	}
+	c.mu.Unlock()
+
+	b.code = file.Fsync(flags)
+	close(b.done)
+	return b.code
+}
@@ -0,0 +1,43 @@
+package hookfs
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/hanwen/go-fuse/fuse/nodefs"
+)
+
+// fsyncCounter counts its fsyncs.
+type fsyncCounter struct {
+	nodefs.File
+	fsyncs int32
+}
+
+func (f *fsyncCounter) Fsync(flags int) fuse.Status {
+	atomic.AddInt32(&f.fsyncs, 1)
+	return fuse.OK
+}
+
+func TestFsyncCoalescing(t *testing.T) {
+	const n = 20
+	file := &fsyncCounter{File: nodefs.NewDefaultFile()}
+	c := newFsyncCoalescer(50 * time.Millisecond)
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if code := c.fsync(file, 0); !code.Ok() {
+				t.Errorf("fsync = %v", code)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := atomic.LoadInt32(&file.fsyncs); got < 1 || got >= n {
+		t.Errorf("%d fsyncs issued %d real fsyncs, want fewer", n, got)
+	}
+}
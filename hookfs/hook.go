@@ -4,40 +4,199 @@ import (
 	"time"
 
 	"github.com/hanwen/go-fuse/fuse"
+	"github.com/hanwen/go-fuse/fuse/pathfs"
 )
 
 // Hook is the base interface for user-written hooks.
 //
 // You have to implement HookXXX (e.g. HookOnOpen, HookOnRead, HookOnWrite, ..) interfaces.
+//
+// Paths passed to hooks are relative to the original directory ("" for the root).
+// Use HookFs.BackendPath and HookFs.MountPath to get the absolute forms.
+// Hooks can't change the path an operation applies to in the original directory; names are
+// translated by Options.NameMapper instead, e.g. for Samba.
+//
+// Not every operation reaches hookfs. The version of go-fuse hookfs builds on has no
+// FUSE_LSEEK handler and nodefs.File has no Lseek method, so the kernel handles lseek(2) by
+// itself: SEEK_DATA and SEEK_HOLE report every file as data with no holes, whatever the
+// original directory says, and no hook can intercept or change that.
 type Hook interface{}
 
 // HookContext is the context objects for interaction between prehooks and posthooks.
 type HookContext interface{}
 
 // HookWithInit is called on mount. This also implements Hook.
+//
+// If Init fails, the hook is disabled and the mount goes on without it,
+// unless Options.FailOnInitError is set.
 type HookWithInit interface {
 	Init() (err error)
 }
 
+// HookWithStop is told when the HookFs stops serving. This also implements Hook.
+//
+// Unmounting waits for the operations being served, so hooks holding operations back, e.g. to
+// delay them, should release them when Stop is called. HookFs.Unmount calls it before
+// unmounting, and Serve once it returns, so it may be called more than once, and also when
+// unmounting fails with EBUSY. Init is called again if the HookFs is mounted again.
+type HookWithStop interface {
+	Stop()
+}
+
+// GlobalHook is called around every operation, whatever its type. This also implements Hook.
+//
+// It is meant for tracing and metrics that don't care about the details of each operation.
+// BeforeOp is called first thing, AfterOp last thing with the status returned to the kernel
+// and the time taken, per-operation hooks included. Both are called from the goroutine serving
+// the operation, so they should be quick and safe for concurrent use.
+type GlobalHook interface {
+	BeforeOp(op string, path string)
+	AfterOp(op string, path string, status fuse.Status, took time.Duration)
+}
+
+// HookWithMetadata is given Options.Metadata when the HookFs is created. This also implements Hook.
+// The map must not be modified.
+type HookWithMetadata interface {
+	SetMetadata(metadata map[string]string)
+}
+
+// HookWithBackend is given the file system hookfs does the real operations on, when the
+// HookFs is created and whenever SetOriginal replaces it. This also implements Hook.
+//
+// It is for hooks doing I/O of their own, e.g. to apply writes they held back, so that it goes
+// where the real operations go, Options.NameMapper and Options.ContainPaths included, rather
+// than to Original directly. Names are those passed to hooks. The operations are done with
+// the privileges of the hookfs process, not those of the caller, and a nil *fuse.Context
+// may be passed.
+type HookWithBackend interface {
+	SetBackend(fs pathfs.FileSystem)
+}
+
+// HookWithVirtualDirs presents directories that don't exist in the original directory
+// (virtual directories), listed and stat'ed by the hook. This also implements Hook.
+//
+// VirtualOpenDir and VirtualGetAttr are called first on opendir and getattr. If they return
+// hooked, what they return goes to the caller as is, and neither the original directory nor
+// the other hooks are called. A hook listing a virtual directory should report the attributes
+// of its children too, or the kernel won't be able to look them up. Access checks on paths
+// VirtualGetAttr reports succeed. Only listing and stat'ing are virtual: opening or modifying
+// a virtual entry goes to the original directory, which will most likely fail with ENOENT.
+type HookWithVirtualDirs interface {
+	// if hooked is true, entries is the listing of path, unless err is not nil
+	VirtualOpenDir(path string) (entries []fuse.DirEntry, hooked bool, err error)
+	// if hooked is true, attr are the attributes of path, unless err is not nil
+	VirtualGetAttr(path string) (attr *fuse.Attr, hooked bool, err error)
+}
+
 // HookOnOpen is called on open. This also implements Hook.
+//
+// flags are the open(2) flags as forwarded by the kernel, which strips O_CREAT, O_EXCL and O_NOCTTY
+// (see HookOnCreate for creation). hookfs passes all the other flags, including O_SYNC, O_DSYNC,
+// O_DIRECT, O_NOATIME and O_APPEND, to open(2) on the file in the original directory, so they are
+// honored by the backing filesystem with the privileges of the hookfs process.
+// Options.SyncWrites adds O_SYNC for writers regardless of the flags of the caller.
+//
+// O_CLOEXEC never reaches the filesystem: it applies to the file descriptor, not to the open
+// file, and the kernel drops it before the open is forwarded, as it does fcntl(2) F_SETFD.
+// Whether a descriptor leaks to child processes can't be checked by a hook.
 type HookOnOpen interface {
 	// if hooked is true, the real open() would not be called
 	PreOpen(path string, flags uint32) (hooked bool, ctx HookContext, err error)
 	PostOpen(realRetCode int32, prehookCtx HookContext) (hooked bool, err error)
 }
 
+// HookOnOpenWithContext is HookOnOpen with the caller's context. This also implements Hook.
+//
+// If a hook implements both, HookOnOpenWithContext is used.
+type HookOnOpenWithContext interface {
+	// if hooked is true, the real open() would not be called
+	PreOpenWithContext(path string, flags uint32, context *fuse.Context) (hooked bool, ctx HookContext, err error)
+	PostOpen(realRetCode int32, prehookCtx HookContext) (hooked bool, err error)
+}
+
 // HookOnRead is called on read. This also implements Hook.
+//
+// Reads of mmap(2)ed files go through the same path when a page fault has to fill a page:
+// an error returned for such a read fails the fault, and the process gets SIGBUS rather than
+// an error code. Pages already in the page cache, including those brought in by readahead,
+// are served by the kernel without a read, so fail reads before the file is first read or
+// mapped to be sure that a fault hits the hook. Map the files from a process other than the
+// one serving the mount: a goroutine waiting for a fault keeps its processor, which may leave
+// none to the server.
+//
+// A buf returned with hooked is what the read returns: shorter than length, it is a short read,
+// and longer, it is clamped to length.
 type HookOnRead interface {
 	// if hooked is true, the real read() would not be called
 	PreRead(path string, length int64, offset int64) (buf []byte, hooked bool, ctx HookContext, err error)
 	PostRead(realRetCode int32, realBuf []byte, prehookCtx HookContext) (buf []byte, hooked bool, err error)
 }
 
+// HookOnReadMetadata is called on read, for hooks that don't need the data. This also implements Hook.
+//
+// As the data is not handed to the hook, hookfs passes the result of the original file through,
+// which lets the kernel splice it from the file descriptor instead of copying it.
+// If a hook implements both, HookOnRead is used.
+type HookOnReadMetadata interface {
+	// if hooked is true, the real read() would not be called, and the read returns no data
+	PreReadMetadata(path string, length int64, offset int64) (hooked bool, ctx HookContext, err error)
+	PostReadMetadata(realRetCode int32, realSize int, prehookCtx HookContext) (hooked bool, err error)
+}
+
+// HookOnReadWithHandle is HookOnRead with the handle read through, e.g. to keep per-handle
+// state. This also implements Hook.
+//
+// Handles are numbered from 1 in the order they are opened or created, and numbers are not
+// reused; HookOnReleaseWithHandle tells when a handle goes away. If a hook implements both,
+// HookOnReadWithHandle is used.
+type HookOnReadWithHandle interface {
+	// if hooked is true, the real read() would not be called
+	PreReadWithHandle(path string, length int64, offset int64, handle uint64) (buf []byte, hooked bool, ctx HookContext, err error)
+	PostRead(realRetCode int32, realBuf []byte, prehookCtx HookContext) (buf []byte, hooked bool, err error)
+}
+
+// HookOnReadInto is HookOnRead filling the buffer of the read in place, which saves an
+// allocation and a copy per read, e.g. for hooks serving large synthetic files. This also
+// implements Hook.
+//
+// PreReadInto writes the data to dest, whose length is that of the read, and returns the
+// number of bytes it wrote: fewer than len(dest) is a short read. dest belongs to hookfs and
+// must not be kept after PreReadInto returns. If a hook implements HookOnReadInto, it is used
+// rather than HookOnRead and HookOnReadWithHandle.
+type HookOnReadInto interface {
+	// if hooked is true, the real read() would not be called, and the read returns dest[:n]
+	PreReadInto(path string, dest []byte, offset int64) (n int, hooked bool, ctx HookContext, err error)
+	PostRead(realRetCode int32, realBuf []byte, prehookCtx HookContext) (buf []byte, hooked bool, err error)
+}
+
+// HookOnReadIntoWithHandle is HookOnReadInto with the handle read through, as in
+// HookOnReadWithHandle. This also implements Hook.
+//
+// If a hook implements it, it is used rather than all the other read interfaces.
+type HookOnReadIntoWithHandle interface {
+	// if hooked is true, the real read() would not be called, and the read returns dest[:n]
+	PreReadIntoWithHandle(path string, dest []byte, offset int64, handle uint64) (n int, hooked bool, ctx HookContext, err error)
+	PostRead(realRetCode int32, realBuf []byte, prehookCtx HookContext) (buf []byte, hooked bool, err error)
+}
+
 // HookOnWrite is called on write. This also implements Hook.
+//
+// If PreWrite returns hooked with a nil err, the hook is assumed to have taken care of
+// the data, and the whole of buf is reported as written. If PostWrite returns hooked with
+// a nil err, written is reported as written instead of what the real write() wrote, e.g.
+// to simulate a short write. written must be from 1 to len(buf): more is clamped to len(buf),
+// and 0, which would make writers retry forever, reports the real write() instead. Unless
+// hooked, the result of the real write() is reported. PreWrite may change the bytes of buf in
+// place, e.g. to encrypt them: the real write() stores what buf holds after the prehooks.
+//
+// Writes reach the hook as the application issued them, split at the maximum write size,
+// and an error returned here is seen by the write(2) call itself. With Options.WritebackCache,
+// consecutive writes on a handle reach the hook merged into one instead, and its errors are
+// seen by the next fsync(2) or close(2) of the handle.
 type HookOnWrite interface {
 	// if hooked is true, the real write() would not be called
 	PreWrite(path string, buf []byte, offset int64) (hooked bool, ctx HookContext, err error)
-	PostWrite(realRetCode int32, prehookCtx HookContext) (hooked bool, err error)
+	PostWrite(realRetCode int32, prehookCtx HookContext) (written uint32, hooked bool, err error)
 }
 
 // HookOnMkdir is called on mkdir. This also implements Hook.
@@ -47,6 +206,15 @@ type HookOnMkdir interface {
 	PostMkdir(realRetCode int32, prehookCtx HookContext) (hooked bool, err error)
 }
 
+// HookOnMkdirWithContext is HookOnMkdir with the caller's context. This also implements Hook.
+//
+// If a hook implements both, HookOnMkdirWithContext is used.
+type HookOnMkdirWithContext interface {
+	// if hooked is true, the real mkdir() would not be called
+	PreMkdirWithContext(path string, mode uint32, context *fuse.Context) (hooked bool, ctx HookContext, err error)
+	PostMkdir(realRetCode int32, prehookCtx HookContext) (hooked bool, err error)
+}
+
 // HookOnRmdir is called on rmdir. This also implements Hook.
 type HookOnRmdir interface {
 	// if hooked is true, the real rmdir() would not be called
@@ -54,6 +222,15 @@ type HookOnRmdir interface {
 	PostRmdir(realRetCode int32, prehookCtx HookContext) (hooked bool, err error)
 }
 
+// HookOnRmdirWithContext is HookOnRmdir with the caller's context. This also implements Hook.
+//
+// If a hook implements both, HookOnRmdirWithContext is used.
+type HookOnRmdirWithContext interface {
+	// if hooked is true, the real rmdir() would not be called
+	PreRmdirWithContext(path string, context *fuse.Context) (hooked bool, ctx HookContext, err error)
+	PostRmdir(realRetCode int32, prehookCtx HookContext) (hooked bool, err error)
+}
+
 // HookOnOpenDir is called on opendir. This also implements Hook.
 type HookOnOpenDir interface {
 	// if hooked is true, the real opendir() would not be called
@@ -61,6 +238,17 @@ type HookOnOpenDir interface {
 	PostOpenDir(realRetCode int32, prehookCtx HookContext) (hooked bool, err error)
 }
 
+// HookOnOpenDirWithEntries is HookOnOpenDir with access to the entries read from the original
+// directory. This also implements Hook.
+//
+// If a hook implements both, HookOnOpenDirWithEntries is used. When PostOpenDirWithEntries
+// returns hooked, entries are returned to the caller in place of the real ones.
+type HookOnOpenDirWithEntries interface {
+	// if hooked is true, the real opendir() would not be called
+	PreOpenDir(path string) (hooked bool, ctx HookContext, err error)
+	PostOpenDirWithEntries(realRetCode int32, realEntries []fuse.DirEntry, prehookCtx HookContext) (entries []fuse.DirEntry, hooked bool, err error)
+}
+
 // HookOnFsync is called on fsync. This also implements Hook.
 type HookOnFsync interface {
 	// if hooked is true, the real fsync() would not be called
@@ -82,6 +270,26 @@ type HookOnRelease interface {
 	PostRelease(prehookCtx HookContext) (hooked bool)
 }
 
+// HookOnReleaseWithFlags is HookOnRelease with the flags the file was opened or created with,
+// e.g. to tell readers from writers. This also implements Hook.
+//
+// If a hook implements both, HookOnReleaseWithFlags is used.
+type HookOnReleaseWithFlags interface {
+	// if hooked is true, the real release() would not be called
+	PreReleaseWithFlags(path string, flags uint32) (hooked bool, ctx HookContext)
+	PostRelease(prehookCtx HookContext) (hooked bool)
+}
+
+// HookOnReleaseWithHandle is HookOnReleaseWithFlags with the handle released,
+// as numbered for HookOnReadWithHandle. This also implements Hook.
+//
+// If a hook implements several of them, HookOnReleaseWithHandle is used.
+type HookOnReleaseWithHandle interface {
+	// if hooked is true, the real release() would not be called
+	PreReleaseWithHandle(path string, flags uint32, handle uint64) (hooked bool, ctx HookContext)
+	PostRelease(prehookCtx HookContext) (hooked bool)
+}
+
 // HookOn is called on release. This also implements Hook.
 type HookOnTruncate interface {
 	// if hooked is true, the real release() would not be called
@@ -89,11 +297,45 @@ type HookOnTruncate interface {
 	PostTruncate(realRetCode int32, prehookCtx HookContext) (hooked bool, err error)
 }
 
+// HookOnTruncateWithContext is HookOnTruncate with the caller's context. This also implements Hook.
+//
+// If a hook implements both, HookOnTruncateWithContext is used.
+// context is nil when the file is changed through an open handle (e.g. ftruncate(2)),
+// for which go-fuse has no context.
+type HookOnTruncateWithContext interface {
+	// if hooked is true, the real release() would not be called
+	PreTruncateWithContext(path string, size uint64, context *fuse.Context) (hooked bool, ctx HookContext, err error)
+	PostTruncate(realRetCode int32, prehookCtx HookContext) (hooked bool, err error)
+}
+
 // HookOn is called on getattr. This also implements Hook.
+//
+// The FUSE protocol spoken by go-fuse does not carry the statx(2) mask of the caller,
+// so a getattr is always for all the attributes, whatever subset the caller asked for.
+//
+// When PostGetAttr returns hooked, newAttr is returned to the caller in place of the real
+// attributes, unless err is not nil. A nil newAttr keeps the real result. Lookups go through
+// getattr, so returning attributes when realRetCode is ENOENT makes a path that doesn't exist
+// in the original directory appear to exist; opening or modifying it still fails, as for the
+// virtual entries of HookWithVirtualDirs.
 type HookOnGetAttr interface {
 	// if hooked is true, the real getattr() would not be called
 	PreGetAttr(path string) (hooked bool, ctx HookContext, err error)
-	PostGetAttr(realRetCode int32, prehookCtx HookContext) (hooked bool, err error)
+	// realAttr is nil if realRetCode is not 0
+	PostGetAttr(realRetCode int32, realAttr *fuse.Attr, prehookCtx HookContext) (newAttr *fuse.Attr, hooked bool, err error)
+}
+
+// HookOnGetAttrWithContext is HookOnGetAttr with the caller's context, e.g. to report
+// different attributes to different callers. This also implements Hook.
+//
+// If a hook implements both, HookOnGetAttrWithContext is used. Note that the kernel caches
+// attributes per inode for the attribute timeout of the mount, whoever the caller, so
+// per-caller attributes are only reliable with attribute caching off.
+type HookOnGetAttrWithContext interface {
+	// if hooked is true, the real getattr() would not be called
+	PreGetAttrWithContext(path string, context *fuse.Context) (hooked bool, ctx HookContext, err error)
+	// realAttr is nil if realRetCode is not 0
+	PostGetAttr(realRetCode int32, realAttr *fuse.Attr, prehookCtx HookContext) (newAttr *fuse.Attr, hooked bool, err error)
 }
 
 // HookOn is called on chown. This also implements Hook.
@@ -103,6 +345,17 @@ type HookOnChown interface {
 	PostChown(realRetCode int32, prehookCtx HookContext) (hooked bool, err error)
 }
 
+// HookOnChownWithContext is HookOnChown with the caller's context. This also implements Hook.
+//
+// If a hook implements both, HookOnChownWithContext is used.
+// context is nil when the file is changed through an open handle (e.g. fchown(2)),
+// for which go-fuse has no context.
+type HookOnChownWithContext interface {
+	// if hooked is true, the real chown() would not be called
+	PreChownWithContext(path string, uid uint32, gid uint32, context *fuse.Context) (hooked bool, ctx HookContext, err error)
+	PostChown(realRetCode int32, prehookCtx HookContext) (hooked bool, err error)
+}
+
 // HookOn is called on chmod. This also implements Hook.
 type HookOnChmod interface {
 	// if hooked is true, the real chmod() would not be called
@@ -110,6 +363,17 @@ type HookOnChmod interface {
 	PostChmod(realRetCode int32, prehookCtx HookContext) (hooked bool, err error)
 }
 
+// HookOnChmodWithContext is HookOnChmod with the caller's context. This also implements Hook.
+//
+// If a hook implements both, HookOnChmodWithContext is used.
+// context is nil when the file is changed through an open handle (e.g. fchmod(2)),
+// for which go-fuse has no context.
+type HookOnChmodWithContext interface {
+	// if hooked is true, the real chmod() would not be called
+	PreChmodWithContext(path string, perms uint32, context *fuse.Context) (hooked bool, ctx HookContext, err error)
+	PostChmod(realRetCode int32, prehookCtx HookContext) (hooked bool, err error)
+}
+
 // HookOn is called on chmod. This also implements Hook.
 type HookOnUtimens interface {
 	// if hooked is true, the real utimens() would not be called
@@ -117,6 +381,17 @@ type HookOnUtimens interface {
 	PostUtimens(realRetCode int32, prehookCtx HookContext) (hooked bool, err error)
 }
 
+// HookOnUtimensWithContext is HookOnUtimens with the caller's context. This also implements Hook.
+//
+// If a hook implements both, HookOnUtimensWithContext is used.
+// context is nil when the file is changed through an open handle (e.g. futimens(3)),
+// for which go-fuse has no context.
+type HookOnUtimensWithContext interface {
+	// if hooked is true, the real utimens() would not be called
+	PreUtimensWithContext(path string, atime *time.Time, mtime *time.Time, context *fuse.Context) (hooked bool, ctx HookContext, err error)
+	PostUtimens(realRetCode int32, prehookCtx HookContext) (hooked bool, err error)
+}
+
 // HookOn is called on allocate. This also implements Hook.
 type HookOnAllocate interface {
 	// if hooked is true, the real allocate() would not be called
@@ -124,21 +399,32 @@ type HookOnAllocate interface {
 	PostAllocate(realRetCode int32, prehookCtx HookContext) (hooked bool, err error)
 }
 
-// HookOn is called on getlk. This also implements Hook.
+// HookOn is called on getlk, with Options.EnableLocks only. This also implements Hook.
+//
+// The prehook may modify lk, e.g. to widen the range tested, before it reaches the original
+// directory. The real getlk fills out with the conflicting lock, if any; to rewrite it, keep
+// out in the context and modify it in the posthook. A prehooked getlk returns out as the
+// prehook left it.
 type HookOnGetLk interface {
 	// if hooked is true, the real getlk() would not be called
 	PreGetLk(path string, owner uint64, lk *fuse.FileLock, flags uint32, out *fuse.FileLock) (hooked bool, ctx HookContext, err error)
 	PostGetLk(realRetCode int32, prehookCtx HookContext) (hooked bool, err error)
 }
 
-// HookOn is called on setlk. This also implements Hook.
+// HookOn is called on setlk, with Options.EnableLocks only. This also implements Hook.
+//
+// The prehook may modify lk, e.g. to change the range or the type of the lock, before it
+// reaches the original directory. To inject a conflict, return hooked with syscall.EAGAIN,
+// which fcntl(2) F_SETLK returns for a lock held by another process.
 type HookOnSetLk interface {
 	// if hooked is true, the real setlk() would not be called
 	PreSetLk(path string, owner uint64, lk *fuse.FileLock, flags uint32) (hooked bool, ctx HookContext, err error)
 	PostSetLk(realRetCode int32, prehookCtx HookContext) (hooked bool, err error)
 }
 
-// HookOn is called on setlkm. This also implements Hook.
+// HookOn is called on setlkw, with Options.EnableLocks only. This also implements Hook.
+//
+// As for HookOnSetLk, the prehook may modify lk before it reaches the original directory.
 type HookOnSetLkw interface {
 	// if hooked is true, the real setlkw() would not be called
 	PreSetLkw(path string, owner uint64, lk *fuse.FileLock, flags uint32) (hooked bool, ctx HookContext, err error)
@@ -152,6 +438,22 @@ type HookOnStatFs interface {
 	PostStatFs(prehookCtx HookContext) (hooked bool, err error)
 }
 
+// HookOnStatFsWithResult is HookOnStatFs with the results of statfs, e.g. to report different
+// usage for different subtrees. This also implements Hook.
+//
+// path is the node being queried. When hooked is true and err is nil, out is returned to the
+// caller in place of the real result; a posthook returning no out leaves the real result.
+// If a hook implements both, HookOnStatFsWithResult is used.
+//
+// statfs can't fail with a given errno: go-fuse's StatFs returns no status, only a result or
+// nil, which the kernel gets as ENOSYS. So err, from either hook, fails statfs with ENOSYS, as
+// does a prehook returning hooked with no out.
+type HookOnStatFsWithResult interface {
+	// if hooked is true, the real statfs() would not be called
+	PreStatFsWithResult(path string) (out *fuse.StatfsOut, hooked bool, ctx HookContext, err error)
+	PostStatFsWithResult(realOut *fuse.StatfsOut, prehookCtx HookContext) (out *fuse.StatfsOut, hooked bool, err error)
+}
+
 // HookOn is called on readlink. This also implements Hook.
 type HookOnReadlink interface {
 	// if hooked is true, the real readlink() would not be called
@@ -159,6 +461,15 @@ type HookOnReadlink interface {
 	PostReadlink(realRetCode int32, prehookCtx HookContext) (hooked bool, err error)
 }
 
+// HookOnReadlinkWithContext is HookOnReadlink with the caller's context. This also implements Hook.
+//
+// If a hook implements both, HookOnReadlinkWithContext is used.
+type HookOnReadlinkWithContext interface {
+	// if hooked is true, the real readlink() would not be called
+	PreReadlinkWithContext(name string, context *fuse.Context) (hooked bool, ctx HookContext, err error)
+	PostReadlink(realRetCode int32, prehookCtx HookContext) (hooked bool, err error)
+}
+
 // HookOn is called on symink. This also implements Hook.
 type HookOnSymlink interface {
 	// if hooked is true, the real symlink() would not be called
@@ -166,13 +477,34 @@ type HookOnSymlink interface {
 	PostSymlink(realRetCode int32, prehookCtx HookContext) (hooked bool, err error)
 }
 
+// HookOnSymlinkWithContext is HookOnSymlink with the caller's context. This also implements Hook.
+//
+// If a hook implements both, HookOnSymlinkWithContext is used.
+type HookOnSymlinkWithContext interface {
+	// if hooked is true, the real symlink() would not be called
+	PreSymlinkWithContext(value string, linkName string, context *fuse.Context) (hooked bool, ctx HookContext, err error)
+	PostSymlink(realRetCode int32, prehookCtx HookContext) (hooked bool, err error)
+}
+
 // HookOn is called on create. This also implements Hook.
+//
+// Creates with O_EXCL in flags are serialized per path from PreCreate to PostCreate,
+// so of concurrent exclusive creates of a path exactly one succeeds and the others get EEXIST.
 type HookOnCreate interface {
 	// if hooked is true, the real create() would not be called
 	PreCreate(name string, flags uint32, mode uint32) (hooked bool, ctx HookContext, err error)
 	PostCreate(realRetCode int32, prehookCtx HookContext) (hooked bool, err error)
 }
 
+// HookOnCreateWithContext is HookOnCreate with the caller's context. This also implements Hook.
+//
+// If a hook implements both, HookOnCreateWithContext is used.
+type HookOnCreateWithContext interface {
+	// if hooked is true, the real create() would not be called
+	PreCreateWithContext(name string, flags uint32, mode uint32, context *fuse.Context) (hooked bool, ctx HookContext, err error)
+	PostCreate(realRetCode int32, prehookCtx HookContext) (hooked bool, err error)
+}
+
 // HookOn is called on access. This also implements Hook.
 type HookOnAccess interface {
 	// if hooked is true, the real access() would not be called
@@ -180,6 +512,15 @@ type HookOnAccess interface {
 	PostAccess(realRetCode int32, prehookCtx HookContext) (hooked bool, err error)
 }
 
+// HookOnAccessWithContext is HookOnAccess with the caller's context. This also implements Hook.
+//
+// If a hook implements both, HookOnAccessWithContext is used.
+type HookOnAccessWithContext interface {
+	// if hooked is true, the real access() would not be called
+	PreAccessWithContext(name string, mode uint32, context *fuse.Context) (hooked bool, ctx HookContext, err error)
+	PostAccess(realRetCode int32, prehookCtx HookContext) (hooked bool, err error)
+}
+
 // HookOn is called on link. This also implements Hook.
 type HookOnLink interface {
 	// if hooked is true, the real link() would not be called
@@ -187,6 +528,15 @@ type HookOnLink interface {
 	PostLink(realRetCode int32, prehookCtx HookContext) (hooked bool, err error)
 }
 
+// HookOnLinkWithContext is HookOnLink with the caller's context. This also implements Hook.
+//
+// If a hook implements both, HookOnLinkWithContext is used.
+type HookOnLinkWithContext interface {
+	// if hooked is true, the real link() would not be called
+	PreLinkWithContext(oldName string, newName string, context *fuse.Context) (hooked bool, ctx HookContext, err error)
+	PostLink(realRetCode int32, prehookCtx HookContext) (hooked bool, err error)
+}
+
 // HookOn is called on mknod. This also implements Hook.
 type HookOnMknod interface {
 	// if hooked is true, the real mknod() would not be called
@@ -194,6 +544,15 @@ type HookOnMknod interface {
 	PostMknod(realRetCode int32, prehookCtx HookContext) (hooked bool, err error)
 }
 
+// HookOnMknodWithContext is HookOnMknod with the caller's context. This also implements Hook.
+//
+// If a hook implements both, HookOnMknodWithContext is used.
+type HookOnMknodWithContext interface {
+	// if hooked is true, the real mknod() would not be called
+	PreMknodWithContext(name string, mode uint32, dev uint32, context *fuse.Context) (hooked bool, ctx HookContext, err error)
+	PostMknod(realRetCode int32, prehookCtx HookContext) (hooked bool, err error)
+}
+
 // HookOn is called on rename. This also implements Hook.
 type HookOnRename interface {
 	// if hooked is true, the real rename() would not be called
@@ -201,6 +560,28 @@ type HookOnRename interface {
 	PostRename(realRetCode int32, prehookCtx HookContext) (hooked bool, err error)
 }
 
+// HookOnRenameWithContext is HookOnRename with the caller's context. This also implements Hook.
+//
+// If a hook implements both, HookOnRenameWithContext is used.
+type HookOnRenameWithContext interface {
+	// if hooked is true, the real rename() would not be called
+	PreRenameWithContext(oldName string, newName string, context *fuse.Context) (hooked bool, ctx HookContext, err error)
+	PostRename(realRetCode int32, prehookCtx HookContext) (hooked bool, err error)
+}
+
+// HookOnRename2 is HookOnRename with the renameat2(2) flags, RENAME_NOREPLACE and
+// RENAME_EXCHANGE. This also implements Hook.
+//
+// If a hook implements several of the rename interfaces, HookOnRenameWithContext is used,
+// then HookOnRename2. The version of go-fuse hookfs builds on does not serve renameat2 with
+// flags: the kernel fails those with EINVAL before they reach hookfs, so flags is always 0
+// for now.
+type HookOnRename2 interface {
+	// if hooked is true, the real rename() would not be called
+	PreRename2(oldName string, newName string, flags uint32) (hooked bool, ctx HookContext, err error)
+	PostRename(realRetCode int32, prehookCtx HookContext) (hooked bool, err error)
+}
+
 // HookOn is called on unlink. This also implements Hook.
 type HookOnUnlink interface {
 	// if hooked is true, the real rename() would not be called
@@ -208,6 +589,15 @@ type HookOnUnlink interface {
 	PostUnlink(realRetCode int32, prehookCtx HookContext) (hooked bool, err error)
 }
 
+// HookOnUnlinkWithContext is HookOnUnlink with the caller's context. This also implements Hook.
+//
+// If a hook implements both, HookOnUnlinkWithContext is used.
+type HookOnUnlinkWithContext interface {
+	// if hooked is true, the real rename() would not be called
+	PreUnlinkWithContext(name string, context *fuse.Context) (hooked bool, ctx HookContext, err error)
+	PostUnlink(realRetCode int32, prehookCtx HookContext) (hooked bool, err error)
+}
+
 // HookOn is called on getxattr. This also implements Hook.
 type HookOnGetXAttr interface {
 	// if hooked is true, the real getxattr() would not be called
@@ -215,6 +605,15 @@ type HookOnGetXAttr interface {
 	PostGetXAttr(realRetCode int32, prehookCtx HookContext) (hooked bool, err error)
 }
 
+// HookOnGetXAttrWithContext is HookOnGetXAttr with the caller's context. This also implements Hook.
+//
+// If a hook implements both, HookOnGetXAttrWithContext is used.
+type HookOnGetXAttrWithContext interface {
+	// if hooked is true, the real getxattr() would not be called
+	PreGetXAttrWithContext(name string, attribute string, context *fuse.Context) (hooked bool, ctx HookContext, err error)
+	PostGetXAttr(realRetCode int32, prehookCtx HookContext) (hooked bool, err error)
+}
+
 // HookOn is called on listxattr. This also implements Hook.
 type HookOnListXAttr interface {
 	// if hooked is true, the real listxattr() would not be called
@@ -222,6 +621,15 @@ type HookOnListXAttr interface {
 	PostListXAttr(realRetCode int32, prehookCtx HookContext) (hooked bool, err error)
 }
 
+// HookOnListXAttrWithContext is HookOnListXAttr with the caller's context. This also implements Hook.
+//
+// If a hook implements both, HookOnListXAttrWithContext is used.
+type HookOnListXAttrWithContext interface {
+	// if hooked is true, the real listxattr() would not be called
+	PreListXAttrWithContext(name string, context *fuse.Context) (hooked bool, ctx HookContext, err error)
+	PostListXAttr(realRetCode int32, prehookCtx HookContext) (hooked bool, err error)
+}
+
 // HookOn is called on removeattr. This also implements Hook.
 type HookOnRemoveXAttr interface {
 	// if hooked is true, the real removexattr() would not be called
@@ -229,9 +637,27 @@ type HookOnRemoveXAttr interface {
 	PostRemoveXAttr(realRetCode int32, prehookCtx HookContext) (hooked bool, err error)
 }
 
+// HookOnRemoveXAttrWithContext is HookOnRemoveXAttr with the caller's context. This also implements Hook.
+//
+// If a hook implements both, HookOnRemoveXAttrWithContext is used.
+type HookOnRemoveXAttrWithContext interface {
+	// if hooked is true, the real removexattr() would not be called
+	PreRemoveXAttrWithContext(name string, attr string, context *fuse.Context) (hooked bool, ctx HookContext, err error)
+	PostRemoveXAttr(realRetCode int32, prehookCtx HookContext) (hooked bool, err error)
+}
+
 // HookOn is called on setxattr. This also implements Hook.
 type HookOnSetXAttr interface {
 	// if hooked is true, the real setxattr() would not be called
 	PreSetXAttr(name string, attr string, data []byte, flags int) (hooked bool, ctx HookContext, err error)
 	PostSetXAttr(realRetCode int32, prehookCtx HookContext) (hooked bool, err error)
+}
+
+// HookOnSetXAttrWithContext is HookOnSetXAttr with the caller's context. This also implements Hook.
+//
+// If a hook implements both, HookOnSetXAttrWithContext is used.
+type HookOnSetXAttrWithContext interface {
+	// if hooked is true, the real setxattr() would not be called
+	PreSetXAttrWithContext(name string, attr string, data []byte, flags int, context *fuse.Context) (hooked bool, ctx HookContext, err error)
+	PostSetXAttr(realRetCode int32, prehookCtx HookContext) (hooked bool, err error)
 }
\ No newline at end of file
@@ -0,0 +1,64 @@
+package hookfs
+
+import (
+	"errors"
+	"sync"
+	"syscall"
+	"testing"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+// failingInitHook fails to initialize, and denies getattr while enabled.
+type failingInitHook struct{}
+
+func (failingInitHook) Init() error {
+	return errors.New("no backend")
+}
+
+func (failingInitHook) PreGetAttr(path string) (bool, HookContext, error) {
+	return true, nil, syscall.EACCES
+}
+
+func (failingInitHook) PostGetAttr(realRetCode int32, realAttr *fuse.Attr, prehookCtx HookContext) (*fuse.Attr, bool, error) {
+	return nil, false, nil
+}
+
+// TestFailedInitDisablesHookWhileServing disables the hook from OnMount while operations run,
+// for go test -race to check that they see the hook or its absence, and nothing in between.
+func TestFailedInitDisablesHookWhileServing(t *testing.T) {
+	h, err := NewHookFs(t.TempDir(), t.TempDir(), failingInitHook{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, code := h.GetAttr("", &fuse.Context{}); code != fuse.Status(syscall.EACCES) {
+		t.Fatalf("getattr before mounting: %v, want EACCES from the hook", code)
+	}
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if _, code := h.GetAttr("", &fuse.Context{}); !code.Ok() && code != fuse.Status(syscall.EACCES) {
+					t.Errorf("getattr while disabling the hook: %v", code)
+					return
+				}
+			}
+		}()
+	}
+	h.OnMount(nil)
+	close(stop)
+	wg.Wait()
+
+	if _, code := h.GetAttr("", &fuse.Context{}); !code.Ok() {
+		t.Errorf("getattr after Init failed: %v, want the hook disabled", code)
+	}
+}
@@ -0,0 +1,89 @@
+package inject
+
+import (
+	"sync/atomic"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	log "github.com/sirupsen/logrus"
+)
+
+// AlignmentAuditHook counts the writes whose offset or length is not a multiple of the page
+// size, which are slow on backends working in pages, and lets all writes through. One in
+// LogEvery misaligned writes is logged as a sample.
+//
+// AlignmentAuditHook implements hookfs.HookOnWrite.
+type AlignmentAuditHook struct {
+	// accessed atomically; first for 64-bit alignment on 32-bit platforms
+	writes     uint64
+	misaligned uint64
+	logEvery   uint64
+
+	pageSize int64
+}
+
+// NewAlignmentAuditHook creates an AlignmentAuditHook for pages of pageSize bytes,
+// logging one in 100 misaligned writes.
+func NewAlignmentAuditHook(pageSize int64) *AlignmentAuditHook {
+	if pageSize <= 0 {
+		pageSize = 1
+	}
+	return &AlignmentAuditHook{
+		logEvery: 100,
+		pageSize: pageSize,
+	}
+}
+
+// PageSize returns the alignment writes are checked against.
+func (h *AlignmentAuditHook) PageSize() int64 {
+	return h.pageSize
+}
+
+// LogEvery returns how many misaligned writes there are per one logged.
+func (h *AlignmentAuditHook) LogEvery() uint64 {
+	return atomic.LoadUint64(&h.logEvery)
+}
+
+// SetLogEvery changes how many misaligned writes there are per one logged. 0 logs none.
+func (h *AlignmentAuditHook) SetLogEvery(logEvery uint64) {
+	atomic.StoreUint64(&h.logEvery, logEvery)
+}
+
+// Writes returns the number of writes checked so far.
+func (h *AlignmentAuditHook) Writes() uint64 {
+	return atomic.LoadUint64(&h.writes)
+}
+
+// Misaligned returns the number of misaligned writes so far.
+func (h *AlignmentAuditHook) Misaligned() uint64 {
+	return atomic.LoadUint64(&h.misaligned)
+}
+
+// Reset sets the counters back to zero.
+func (h *AlignmentAuditHook) Reset() {
+	atomic.StoreUint64(&h.writes, 0)
+	atomic.StoreUint64(&h.misaligned, 0)
+}
+
+// PreWrite implements hookfs.HookOnWrite
+func (h *AlignmentAuditHook) PreWrite(path string, buf []byte, offset int64) (bool, hookfs.HookContext, error) {
+	atomic.AddUint64(&h.writes, 1)
+	if offset%h.pageSize == 0 && int64(len(buf))%h.pageSize == 0 {
+		return false, nil, nil
+	}
+	n := atomic.AddUint64(&h.misaligned, 1)
+	if every := h.LogEvery(); every > 0 && (n-1)%every == 0 {
+		log.WithFields(log.Fields{
+			"path":       path,
+			"offset":     offset,
+			"length":     len(buf),
+			"pageSize":   h.pageSize,
+			"misaligned": n,
+		}).Warn("AlignmentAuditHook: misaligned write")
+	}
+	return false, nil, nil
+}
+
+// PostWrite implements hookfs.HookOnWrite
+func (h *AlignmentAuditHook) PostWrite(realRetCode int32, prehookCtx hookfs.HookContext) (uint32, bool, error) {
+	return 0, false, nil
+}
@@ -0,0 +1,45 @@
+package inject
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+func TestAlignmentAuditHookCountsMisalignedWrites(t *testing.T) {
+	hook := NewAlignmentAuditHook(4096)
+	h, err := hookfs.NewHookFs(t.TempDir(), t.TempDir(), hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, code := h.Create("file", syscall.O_WRONLY|syscall.O_CREAT, 0644, &fuse.Context{})
+	if !code.Ok() {
+		t.Fatal(code)
+	}
+	defer f.Release()
+
+	for _, w := range []struct {
+		offset, length int64
+		misaligned     bool
+	}{
+		{0, 4096, false},
+		{8192, 2 * 4096, false},
+		{0, 100, true},
+		{100, 4096, true},
+		{4096, 4097, true},
+	} {
+		before := hook.Misaligned()
+		// misaligned writes go through all the same
+		if n, code := f.Write(make([]byte, w.length), w.offset); !code.Ok() || int64(n) != w.length {
+			t.Errorf("write of %d bytes at %d = %d, %v, want all written", w.length, w.offset, n, code)
+		}
+		if counted := hook.Misaligned() > before; counted != w.misaligned {
+			t.Errorf("write of %d bytes at %d counted misaligned: %v, want %v", w.length, w.offset, counted, w.misaligned)
+		}
+	}
+	if hook.Writes() != 5 || hook.Misaligned() != 3 {
+		t.Errorf("%d writes with %d misaligned, want 5 with 3", hook.Writes(), hook.Misaligned())
+	}
+}
@@ -0,0 +1,217 @@
+package inject
+
+import (
+	"sync"
+	"syscall"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	log "github.com/sirupsen/logrus"
+)
+
+// AtomicWriteEnforceHook checks that applications replace files atomically (write a temporary
+// file, then rename it over the target) instead of modifying them in place.
+//
+// A file created through the mount is finalized once all the handles opened on it are released.
+// From then on, opening it for writing, writing to it and truncating it fail with EPERM.
+// Renaming over it is allowed, and the file renamed is finalized or not as it was under its old
+// name. Files that were not created through the mount are not checked.
+//
+// AtomicWriteEnforceHook implements hookfs.HookOnCreate, hookfs.HookOnOpen, hookfs.HookOnRelease,
+// hookfs.HookOnWrite, hookfs.HookOnTruncate, hookfs.HookOnRename and hookfs.HookOnUnlink.
+type AtomicWriteEnforceHook struct {
+	mu    sync.Mutex
+	files map[string]*atomicWriteFile
+}
+
+type atomicWriteFile struct {
+	// handles is the number of handles opened on the file while it was being written
+	handles   int
+	finalized bool
+}
+
+type atomicWriteCtx struct {
+	path string
+}
+
+// NewAtomicWriteEnforceHook creates an AtomicWriteEnforceHook.
+func NewAtomicWriteEnforceHook() *AtomicWriteEnforceHook {
+	return &AtomicWriteEnforceHook{files: make(map[string]*atomicWriteFile)}
+}
+
+// Finalized returns whether path may no longer be modified in place.
+func (h *AtomicWriteEnforceHook) Finalized(path string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	f, ok := h.files[cleanRel(path)]
+	return ok && f.finalized
+}
+
+// check returns EPERM if path is finalized. h.mu must be held.
+func (h *AtomicWriteEnforceHook) check(op string, path string) error {
+	if f, ok := h.files[path]; !ok || !f.finalized {
+		return nil
+	}
+	log.WithFields(log.Fields{
+		"op":   op,
+		"path": path,
+	}).Warn("AtomicWriteEnforceHook: in-place modification of a finalized file")
+	return syscall.EPERM
+}
+
+// PreCreate implements hookfs.HookOnCreate
+func (h *AtomicWriteEnforceHook) PreCreate(name string, flags uint32, mode uint32) (bool, hookfs.HookContext, error) {
+	name = cleanRel(name)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.check(hookfs.OpCreate, name); err != nil {
+		return true, nil, err
+	}
+	return false, &atomicWriteCtx{path: name}, nil
+}
+
+// PostCreate implements hookfs.HookOnCreate
+func (h *AtomicWriteEnforceHook) PostCreate(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	ctx, ok := prehookCtx.(*atomicWriteCtx)
+	if !ok || realRetCode != 0 {
+		return false, nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.files[ctx.path] = &atomicWriteFile{handles: 1}
+	return false, nil
+}
+
+// PreOpen implements hookfs.HookOnOpen
+func (h *AtomicWriteEnforceHook) PreOpen(path string, flags uint32) (bool, hookfs.HookContext, error) {
+	path = cleanRel(path)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	f, ok := h.files[path]
+	if !ok {
+		return false, nil, nil
+	}
+	if f.finalized {
+		if flags&syscall.O_ACCMODE == syscall.O_RDONLY && flags&syscall.O_TRUNC == 0 {
+			return false, nil, nil
+		}
+		return true, nil, h.check(hookfs.OpOpen, path)
+	}
+	f.handles++
+	return false, &atomicWriteCtx{path: path}, nil
+}
+
+// PostOpen implements hookfs.HookOnOpen
+func (h *AtomicWriteEnforceHook) PostOpen(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	ctx, ok := prehookCtx.(*atomicWriteCtx)
+	if !ok || realRetCode == 0 {
+		return false, nil
+	}
+	h.release(ctx.path)
+	return false, nil
+}
+
+// release drops a handle of path, finalizing it with the last one.
+func (h *AtomicWriteEnforceHook) release(path string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	f, ok := h.files[path]
+	if !ok || f.finalized {
+		return
+	}
+	f.handles--
+	if f.handles <= 0 {
+		f.finalized = true
+	}
+}
+
+// PreRelease implements hookfs.HookOnRelease
+func (h *AtomicWriteEnforceHook) PreRelease(path string) (bool, hookfs.HookContext) {
+	return false, &atomicWriteCtx{path: cleanRel(path)}
+}
+
+// PostRelease implements hookfs.HookOnRelease
+func (h *AtomicWriteEnforceHook) PostRelease(prehookCtx hookfs.HookContext) bool {
+	if ctx, ok := prehookCtx.(*atomicWriteCtx); ok {
+		h.release(ctx.path)
+	}
+	return false
+}
+
+// PreWrite implements hookfs.HookOnWrite
+func (h *AtomicWriteEnforceHook) PreWrite(path string, buf []byte, offset int64) (bool, hookfs.HookContext, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.check(hookfs.OpWrite, cleanRel(path)); err != nil {
+		return true, nil, err
+	}
+	return false, nil, nil
+}
+
+// PostWrite implements hookfs.HookOnWrite
+func (h *AtomicWriteEnforceHook) PostWrite(realRetCode int32, prehookCtx hookfs.HookContext) (uint32, bool, error) {
+	return 0, false, nil
+}
+
+// PreTruncate implements hookfs.HookOnTruncate
+func (h *AtomicWriteEnforceHook) PreTruncate(path string, size uint64) (bool, hookfs.HookContext, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.check(hookfs.OpTruncate, cleanRel(path)); err != nil {
+		return true, nil, err
+	}
+	return false, nil, nil
+}
+
+// PostTruncate implements hookfs.HookOnTruncate
+func (h *AtomicWriteEnforceHook) PostTruncate(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return false, nil
+}
+
+type atomicWriteRenameCtx struct {
+	oldName, newName string
+}
+
+// PreRename implements hookfs.HookOnRename
+func (h *AtomicWriteEnforceHook) PreRename(oldName string, newName string) (bool, hookfs.HookContext, error) {
+	return false, &atomicWriteRenameCtx{oldName: cleanRel(oldName), newName: cleanRel(newName)}, nil
+}
+
+// PostRename implements hookfs.HookOnRename
+func (h *AtomicWriteEnforceHook) PostRename(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	ctx, ok := prehookCtx.(*atomicWriteRenameCtx)
+	if !ok || realRetCode != 0 || ctx.oldName == ctx.newName {
+		return false, nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	f, ok := h.files[ctx.oldName]
+	delete(h.files, ctx.oldName)
+	if ok {
+		h.files[ctx.newName] = f
+	} else {
+		delete(h.files, ctx.newName)
+	}
+	return false, nil
+}
+
+// PreUnlink implements hookfs.HookOnUnlink
+func (h *AtomicWriteEnforceHook) PreUnlink(name string) (bool, hookfs.HookContext, error) {
+	return false, &atomicWriteCtx{path: cleanRel(name)}, nil
+}
+
+// PostUnlink implements hookfs.HookOnUnlink
+func (h *AtomicWriteEnforceHook) PostUnlink(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	ctx, ok := prehookCtx.(*atomicWriteCtx)
+	if !ok || realRetCode != 0 {
+		return false, nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.files, ctx.path)
+	return false, nil
+}
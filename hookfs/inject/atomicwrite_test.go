@@ -0,0 +1,50 @@
+package inject
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// waitFinalized waits for the release of the handles of path, which the kernel sends in the
+// background after close.
+func waitFinalized(t *testing.T, hook *AtomicWriteEnforceHook, path string) {
+	t.Helper()
+	for i := 0; !hook.Finalized(path); i++ {
+		if i == 100 {
+			t.Fatalf("%s is not finalized after close", path)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAtomicWriteEnforceHook(t *testing.T) {
+	hook := NewAtomicWriteEnforceHook()
+	_, _, mnt := mount(t, hook, nil)
+	config := filepath.Join(mnt, "config")
+
+	if err := ioutil.WriteFile(config, []byte("v1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitFinalized(t, hook, "config")
+	if _, err := os.OpenFile(config, os.O_WRONLY, 0); !errors.Is(err, syscall.EPERM) {
+		t.Errorf("reopening for write = %v, want EPERM", err)
+	}
+	if data, err := ioutil.ReadFile(config); err != nil || string(data) != "v1" {
+		t.Errorf("read %q, %v, want v1", data, err)
+	}
+
+	if err := ioutil.WriteFile(config+".tmp", []byte("v2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(config+".tmp", config); err != nil {
+		t.Errorf("renaming over: %v", err)
+	}
+	if data, err := ioutil.ReadFile(config); err != nil || string(data) != "v2" {
+		t.Errorf("read %q, %v after renaming over, want v2", data, err)
+	}
+}
@@ -0,0 +1,156 @@
+package inject
+
+import (
+	"sync"
+	"syscall"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	log "github.com/sirupsen/logrus"
+)
+
+// BarrierRule requires writes to Before to be durable before After is written,
+// e.g. a journal before the blocks it describes.
+type BarrierRule struct {
+	Before string
+	After  string
+}
+
+// BarrierViolation is a write to Rule.After issued while writes to Rule.Before were not durable.
+type BarrierViolation struct {
+	Rule BarrierRule
+	// Offset is the offset of the offending write to Rule.After.
+	Offset int64
+}
+
+// BarrierCheckHook checks the writes and fsyncs going through the mount against ordering rules,
+// for testing journaling and other crash-consistency protocols.
+//
+// A write is durable once an fsync of its file, started after the write completed, succeeds.
+// A write to the After path of a rule while a write to its Before path is not durable is a
+// violation. Violations are recorded, and reported to OnViolation.
+//
+// Paths are relative to the original directory, as passed to hooks.
+//
+// BarrierCheckHook implements hookfs.HookOnWrite and hookfs.HookOnFsync.
+type BarrierCheckHook struct {
+	// OnViolation, if set, is called for every violation.
+	OnViolation func(v BarrierViolation)
+	// FailOnViolation makes offending writes fail with EIO, without reaching Original.
+	FailOnViolation bool
+
+	rules []BarrierRule
+
+	mu         sync.Mutex
+	seq        uint64
+	written    map[string]uint64 // last completed write per path
+	durable    map[string]uint64 // last durable write per path
+	violations []BarrierViolation
+}
+
+type barrierCtx struct {
+	path string
+	seq  uint64 // for fsyncs, the last write completed when the fsync started
+}
+
+// NewBarrierCheckHook creates a BarrierCheckHook enforcing rules.
+func NewBarrierCheckHook(rules ...BarrierRule) *BarrierCheckHook {
+	cleaned := make([]BarrierRule, len(rules))
+	for i, rule := range rules {
+		cleaned[i] = BarrierRule{Before: cleanRel(rule.Before), After: cleanRel(rule.After)}
+	}
+	return &BarrierCheckHook{
+		rules:   cleaned,
+		written: make(map[string]uint64),
+		durable: make(map[string]uint64),
+	}
+}
+
+// Violations returns the violations seen so far.
+func (h *BarrierCheckHook) Violations() []BarrierViolation {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]BarrierViolation(nil), h.violations...)
+}
+
+// Reset forgets the violations and the writes seen so far.
+func (h *BarrierCheckHook) Reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.written = make(map[string]uint64)
+	h.durable = make(map[string]uint64)
+	h.violations = nil
+}
+
+// check returns the violations a write to path at offset would make. h.mu must be held.
+func (h *BarrierCheckHook) check(path string, offset int64) []BarrierViolation {
+	var violations []BarrierViolation
+	for _, rule := range h.rules {
+		if rule.After == path && h.written[rule.Before] > h.durable[rule.Before] {
+			violations = append(violations, BarrierViolation{Rule: rule, Offset: offset})
+		}
+	}
+	return violations
+}
+
+// PreWrite implements hookfs.HookOnWrite
+func (h *BarrierCheckHook) PreWrite(path string, buf []byte, offset int64) (bool, hookfs.HookContext, error) {
+	path = cleanRel(path)
+
+	h.mu.Lock()
+	violations := h.check(path, offset)
+	h.violations = append(h.violations, violations...)
+	h.mu.Unlock()
+
+	for _, v := range violations {
+		log.WithFields(log.Fields{
+			"before": v.Rule.Before,
+			"after":  v.Rule.After,
+			"offset": v.Offset,
+		}).Warn("BarrierCheckHook: write before its barrier is durable")
+		if h.OnViolation != nil {
+			h.OnViolation(v)
+		}
+	}
+	if len(violations) > 0 && h.FailOnViolation {
+		return true, nil, syscall.EIO
+	}
+	return false, &barrierCtx{path: path}, nil
+}
+
+// PostWrite implements hookfs.HookOnWrite
+func (h *BarrierCheckHook) PostWrite(realRetCode int32, prehookCtx hookfs.HookContext) (uint32, bool, error) {
+	ctx, ok := prehookCtx.(*barrierCtx)
+	if !ok || realRetCode != 0 {
+		return 0, false, nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.seq++
+	h.written[ctx.path] = h.seq
+	return 0, false, nil
+}
+
+// PreFsync implements hookfs.HookOnFsync
+func (h *BarrierCheckHook) PreFsync(path string, flags uint32) (bool, hookfs.HookContext, error) {
+	path = cleanRel(path)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return false, &barrierCtx{path: path, seq: h.written[path]}, nil
+}
+
+// PostFsync implements hookfs.HookOnFsync
+func (h *BarrierCheckHook) PostFsync(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	ctx, ok := prehookCtx.(*barrierCtx)
+	if !ok || realRetCode != 0 {
+		return false, nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if ctx.seq > h.durable[ctx.path] {
+		h.durable[ctx.path] = ctx.seq
+	}
+	return false, nil
+}
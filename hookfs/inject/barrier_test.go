@@ -0,0 +1,52 @@
+package inject
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ethercflow/hookfs/hookfs"
+)
+
+func TestBarrierCheckHook(t *testing.T) {
+	rule := BarrierRule{Before: "journal", After: "data"}
+	for _, tc := range []struct {
+		name string
+		sync bool
+		want []BarrierViolation
+	}{
+		{"violating", false, []BarrierViolation{{Rule: rule, Offset: 0}}},
+		{"conforming", true, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			hook := NewBarrierCheckHook(rule)
+			_, _, mnt := mount(t, hook, &hookfs.Options{DirectIO: true})
+			journal, err := os.Create(filepath.Join(mnt, "journal"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer journal.Close()
+			data, err := os.Create(filepath.Join(mnt, "data"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer data.Close()
+
+			if _, err := journal.Write([]byte("record")); err != nil {
+				t.Fatal(err)
+			}
+			if tc.sync {
+				if err := journal.Sync(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := data.Write([]byte("block")); err != nil {
+				t.Fatal(err)
+			}
+			if got := hook.Violations(); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("violations %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
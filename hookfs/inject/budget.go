@@ -0,0 +1,65 @@
+package inject
+
+import (
+	"sync/atomic"
+	"syscall"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	log "github.com/sirupsen/logrus"
+)
+
+// OperationBudgetHook lets exactly Budget operations through, then fails every further
+// operation with Errno, which bounds fuzzing and soak runs deterministically.
+// Operations are counted across the whole mount, whatever their type. Release cannot fail
+// and is counted only.
+//
+// OperationBudgetHook implements all the hookfs.HookOnXXX interfaces.
+type OperationBudgetHook struct {
+	// accessed atomically; first for 64-bit alignment on 32-bit platforms
+	budget uint64
+	count  uint64
+
+	gate
+	errno syscall.Errno
+}
+
+// NewOperationBudgetHook creates an OperationBudgetHook allowing budget operations.
+func NewOperationBudgetHook(budget uint64, errno syscall.Errno) *OperationBudgetHook {
+	h := &OperationBudgetHook{
+		budget: budget,
+		errno:  errno,
+	}
+	h.pick = func(op string, path string) (hookfs.Hook, error) {
+		n := atomic.AddUint64(&h.count, 1)
+		if n <= atomic.LoadUint64(&h.budget) {
+			return nil, nil
+		}
+		log.WithFields(log.Fields{
+			"op":    op,
+			"path":  path,
+			"count": n,
+		}).Debug("OperationBudgetHook: budget exhausted")
+		return nil, h.errno
+	}
+	return h
+}
+
+// Budget returns the number of operations allowed.
+func (h *OperationBudgetHook) Budget() uint64 {
+	return atomic.LoadUint64(&h.budget)
+}
+
+// SetBudget changes the number of operations allowed. Operations already counted stay counted.
+func (h *OperationBudgetHook) SetBudget(budget uint64) {
+	atomic.StoreUint64(&h.budget, budget)
+}
+
+// Count returns the number of operations seen so far, including failed ones.
+func (h *OperationBudgetHook) Count() uint64 {
+	return atomic.LoadUint64(&h.count)
+}
+
+// Reset sets the count back to zero, so Budget more operations are allowed.
+func (h *OperationBudgetHook) Reset() {
+	atomic.StoreUint64(&h.count, 0)
+}
@@ -0,0 +1,42 @@
+package inject
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+func TestOperationBudgetHook(t *testing.T) {
+	hook := NewOperationBudgetHook(3, syscall.ENOSPC)
+	h, err := hookfs.NewHookFs(t.TempDir(), t.TempDir(), hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := &fuse.Context{}
+	ops := []func() fuse.Status{
+		func() fuse.Status { return h.Mkdir("dir", 0755, ctx) },
+		func() fuse.Status { _, code := h.GetAttr("dir", ctx); return code },
+		func() fuse.Status { return h.Rmdir("dir", ctx) },
+		func() fuse.Status { _, code := h.GetAttr("", ctx); return code },
+		func() fuse.Status { return h.Mkdir("dir", 0755, ctx) },
+	}
+	for i, op := range ops {
+		want := fuse.OK
+		if uint64(i) >= hook.Budget() {
+			want = fuse.Status(syscall.ENOSPC)
+		}
+		if code := op(); code != want {
+			t.Errorf("operation %d = %v, want %v", i+1, code, want)
+		}
+	}
+	if got := hook.Count(); got != uint64(len(ops)) {
+		t.Errorf("Count = %d, want %d", got, len(ops))
+	}
+
+	hook.Reset()
+	if _, code := h.GetAttr("", ctx); !code.Ok() {
+		t.Errorf("getattr after Reset = %v, want OK", code)
+	}
+}
@@ -0,0 +1,150 @@
+package inject
+
+import (
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	log "github.com/sirupsen/logrus"
+)
+
+// BudgetedRateHook gives each operation type a budget of operations per window, such as 1000
+// getattrs per minute, to test how clients cope with a rate-limited service. Windows are fixed:
+// every Window, all the budgets are refilled at once. An operation over its budget fails with
+// Errno, typically EAGAIN, or if Errno is 0 waits for the next window. Operation types without
+// a budget are not limited.
+//
+// BudgetedRateHook implements all the hookfs.HookOnXXX interfaces.
+type BudgetedRateHook struct {
+	gate
+	errno syscall.Errno
+
+	mu        sync.Mutex
+	window    time.Duration
+	budgets   map[string]uint64
+	start     time.Time
+	used      map[string]uint64
+	throttled map[string]uint64
+}
+
+// NewBudgetedRateHook creates a BudgetedRateHook refilling budgets, keyed by hookfs.OpXXX,
+// every window. Operations over budget fail with errno, or wait if errno is 0. A window of 0
+// or less means no limit.
+func NewBudgetedRateHook(window time.Duration, budgets map[string]uint64, errno syscall.Errno) *BudgetedRateHook {
+	h := &BudgetedRateHook{
+		errno:     errno,
+		window:    window,
+		budgets:   make(map[string]uint64, len(budgets)),
+		start:     time.Now(),
+		used:      make(map[string]uint64),
+		throttled: make(map[string]uint64),
+	}
+	for op, budget := range budgets {
+		h.budgets[op] = budget
+	}
+	h.pick = func(op string, path string) (hookfs.Hook, error) {
+		for {
+			wait := h.spend(op, time.Now())
+			if wait <= 0 {
+				return nil, nil
+			}
+			log.WithFields(log.Fields{
+				"op":    op,
+				"path":  path,
+				"errno": h.errno,
+				"wait":  wait,
+			}).Debug("BudgetedRateHook: budget exhausted")
+			if h.errno != 0 {
+				return nil, h.errno
+			}
+			time.Sleep(wait)
+		}
+	}
+	return h
+}
+
+// Window returns how often the budgets are refilled.
+func (h *BudgetedRateHook) Window() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.window
+}
+
+// SetWindow changes how often the budgets are refilled. The current window is ended.
+func (h *BudgetedRateHook) SetWindow(window time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.window = window
+	h.refill(time.Now())
+}
+
+// Budget returns the budget of op per window, and whether op has one.
+func (h *BudgetedRateHook) Budget(op string) (uint64, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	budget, ok := h.budgets[op]
+	return budget, ok
+}
+
+// SetBudget changes the budget of op per window. Operations already counted in the current
+// window stay counted.
+func (h *BudgetedRateHook) SetBudget(op string, budget uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.budgets[op] = budget
+}
+
+// RemoveBudget stops limiting op.
+func (h *BudgetedRateHook) RemoveBudget(op string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.budgets, op)
+}
+
+// Used returns the number of op operations let through in the current window.
+func (h *BudgetedRateHook) Used(op string) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.roll(time.Now())
+	return h.used[op]
+}
+
+// Throttled returns the number of op operations failed or delayed so far. A delayed operation
+// is counted once per window it waited for.
+func (h *BudgetedRateHook) Throttled(op string) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.throttled[op]
+}
+
+// refill starts a new window at now. h.mu must be held.
+func (h *BudgetedRateHook) refill(now time.Time) {
+	h.start = now
+	h.used = make(map[string]uint64)
+}
+
+// roll starts a new window if the current one is over. h.mu must be held.
+func (h *BudgetedRateHook) roll(now time.Time) {
+	if h.window > 0 && now.Sub(h.start) >= h.window {
+		h.refill(now)
+	}
+}
+
+// spend takes an op operation from its budget, and returns 0 if it is let through, or else
+// how long until the next window.
+func (h *BudgetedRateHook) spend(op string, now time.Time) time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	budget, ok := h.budgets[op]
+	if !ok || h.window <= 0 {
+		return 0
+	}
+	h.roll(now)
+	if h.used[op] < budget {
+		h.used[op]++
+		return 0
+	}
+	h.throttled[op]++
+	return h.start.Add(h.window).Sub(now)
+}
@@ -0,0 +1,78 @@
+package inject
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+func TestBudgetedRateHookThrottlesGetAttr(t *testing.T) {
+	original := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(original, "file"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	hook := NewBudgetedRateHook(time.Hour, map[string]uint64{hookfs.OpGetAttr: 5}, syscall.EAGAIN)
+	h, err := hookfs.NewHookFs(original, t.TempDir(), hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := &fuse.Context{}
+	for i := 0; i < 5; i++ {
+		if _, code := h.GetAttr("file", ctx); !code.Ok() {
+			t.Fatalf("getattr %d within the budget: %v", i, code)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if _, code := h.GetAttr("file", ctx); code != fuse.EAGAIN {
+			t.Errorf("getattr over the budget: %v, want EAGAIN", code)
+		}
+	}
+	if used, throttled := hook.Used(hookfs.OpGetAttr), hook.Throttled(hookfs.OpGetAttr); used != 5 || throttled != 3 {
+		t.Errorf("Used = %d and Throttled = %d, want 5 and 3", used, throttled)
+	}
+
+	// operations without a budget go on
+	f, code := h.Open("file", syscall.O_RDONLY, ctx)
+	if !code.Ok() {
+		t.Fatalf("open with getattr over its budget: %v", code)
+	}
+	buf := make([]byte, 4)
+	if _, code := f.Read(buf, 0); !code.Ok() {
+		t.Errorf("read with getattr over its budget: %v", code)
+	}
+	f.Release()
+
+	// a new window refills the budget
+	hook.SetWindow(time.Hour)
+	if _, code := h.GetAttr("file", ctx); !code.Ok() {
+		t.Errorf("getattr in a new window: %v", code)
+	}
+}
+
+func TestBudgetedRateHookDelaysWithoutErrno(t *testing.T) {
+	const window = 50 * time.Millisecond
+	original := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(original, "file"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	hook := NewBudgetedRateHook(window, map[string]uint64{hookfs.OpGetAttr: 1}, 0)
+	h, err := hookfs.NewHookFs(original, t.TempDir(), hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, code := h.GetAttr("file", &fuse.Context{}); !code.Ok() {
+			t.Fatal(code)
+		}
+	}
+	// the second and third wait for a window each
+	if took := time.Since(start); took < window {
+		t.Errorf("3 getattrs with a budget of 1 per %v took %v, want them delayed", window, took)
+	}
+}
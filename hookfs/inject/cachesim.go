@@ -0,0 +1,190 @@
+package inject
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	log "github.com/sirupsen/logrus"
+)
+
+// CacheSimHook models a read cache in front of a slow backend: reads whose blocks are all
+// cached wait HitLatency, the others wait MissLatency, after which their blocks are cached.
+// The cache holds up to Blocks blocks of BlockSize bytes, from any file, and evicts the least
+// recently read ones.
+//
+// Only reads that reach hookfs are counted, so reads served from the page cache of the kernel
+// are neither delayed nor recorded; set hookfs.Options.DirectIO to see all of them.
+//
+// CacheSimHook implements hookfs.HookOnReadMetadata.
+type CacheSimHook struct {
+	blockSize int64
+
+	mu          sync.Mutex
+	blocks      int
+	hitLatency  time.Duration
+	missLatency time.Duration
+	lru         *list.List // of cacheBlock, most recently read first
+	cached      map[cacheBlock]*list.Element
+	hits        uint64
+	misses      uint64
+}
+
+type cacheBlock struct {
+	path  string
+	index int64
+}
+
+// NewCacheSimHook creates a CacheSimHook caching blocks blocks of blockSize bytes,
+// delaying hits by hitLatency and misses by missLatency.
+func NewCacheSimHook(blockSize int64, blocks int, hitLatency time.Duration, missLatency time.Duration) *CacheSimHook {
+	if blockSize <= 0 {
+		blockSize = 1
+	}
+	return &CacheSimHook{
+		blockSize:   blockSize,
+		blocks:      blocks,
+		hitLatency:  hitLatency,
+		missLatency: missLatency,
+		lru:         list.New(),
+		cached:      make(map[cacheBlock]*list.Element),
+	}
+}
+
+// BlockSize returns the size of the blocks cached.
+func (h *CacheSimHook) BlockSize() int64 {
+	return h.blockSize
+}
+
+// Blocks returns the number of blocks the cache holds.
+func (h *CacheSimHook) Blocks() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.blocks
+}
+
+// SetBlocks changes the number of blocks the cache holds, evicting the blocks in excess.
+func (h *CacheSimHook) SetBlocks(blocks int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.blocks = blocks
+	h.evict()
+}
+
+// HitLatency returns the delay of the reads served from the cache.
+func (h *CacheSimHook) HitLatency() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.hitLatency
+}
+
+// SetHitLatency changes the delay of the reads served from the cache.
+func (h *CacheSimHook) SetHitLatency(hitLatency time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.hitLatency = hitLatency
+}
+
+// MissLatency returns the delay of the reads missing the cache.
+func (h *CacheSimHook) MissLatency() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.missLatency
+}
+
+// SetMissLatency changes the delay of the reads missing the cache.
+func (h *CacheSimHook) SetMissLatency(missLatency time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.missLatency = missLatency
+}
+
+// Hits returns the number of reads served from the cache so far.
+func (h *CacheSimHook) Hits() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.hits
+}
+
+// Misses returns the number of reads that missed the cache so far.
+func (h *CacheSimHook) Misses() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.misses
+}
+
+// HitRatio returns the fraction of the reads served from the cache so far, 0 before any read.
+func (h *CacheSimHook) HitRatio() float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.hits+h.misses == 0 {
+		return 0
+	}
+	return float64(h.hits) / float64(h.hits+h.misses)
+}
+
+// Drop empties the cache, as after a restart of the caching tier.
+func (h *CacheSimHook) Drop() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lru.Init()
+	h.cached = make(map[cacheBlock]*list.Element)
+}
+
+// evict drops the least recently read blocks in excess. h.mu must be held.
+func (h *CacheSimHook) evict() {
+	for h.lru.Len() > 0 && h.lru.Len() > h.blocks {
+		delete(h.cached, h.lru.Remove(h.lru.Back()).(cacheBlock))
+	}
+}
+
+// access records a read of [offset, offset+length) of path and returns whether it hit.
+// h.mu must be held.
+func (h *CacheSimHook) access(path string, length int64, offset int64) bool {
+	hit := true
+	first := offset / h.blockSize
+	last := first
+	if length > 0 {
+		last = (offset + length - 1) / h.blockSize
+	}
+	for i := first; i <= last; i++ {
+		b := cacheBlock{path: path, index: i}
+		if e, ok := h.cached[b]; ok {
+			h.lru.MoveToFront(e)
+			continue
+		}
+		hit = false
+		h.cached[b] = h.lru.PushFront(b)
+	}
+	h.evict()
+	return hit
+}
+
+// PreReadMetadata implements hookfs.HookOnReadMetadata
+func (h *CacheSimHook) PreReadMetadata(path string, length int64, offset int64) (bool, hookfs.HookContext, error) {
+	h.mu.Lock()
+	hit := h.access(cleanRel(path), length, offset)
+	delay := h.missLatency
+	if hit {
+		h.hits++
+		delay = h.hitLatency
+	} else {
+		h.misses++
+	}
+	h.mu.Unlock()
+
+	log.WithFields(log.Fields{
+		"path":   path,
+		"offset": offset,
+		"length": length,
+		"hit":    hit,
+	}).Debug("CacheSimHook: read")
+	time.Sleep(delay)
+	return false, nil, nil
+}
+
+// PostReadMetadata implements hookfs.HookOnReadMetadata
+func (h *CacheSimHook) PostReadMetadata(realRetCode int32, realSize int, prehookCtx hookfs.HookContext) (bool, error) {
+	return false, nil
+}
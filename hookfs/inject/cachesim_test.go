@@ -0,0 +1,73 @@
+package inject
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+func TestCacheSimHookHitsAreFast(t *testing.T) {
+	const block = 4096
+	const hit, miss = time.Millisecond, 50 * time.Millisecond
+	original := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(original, "file"), bytes.Repeat([]byte("x"), 8*block), 0644); err != nil {
+		t.Fatal(err)
+	}
+	hook := NewCacheSimHook(block, 2, hit, miss)
+	h, err := hookfs.NewHookFs(original, t.TempDir(), hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, code := h.Open("file", syscall.O_RDONLY, &fuse.Context{})
+	if !code.Ok() {
+		t.Fatal(code)
+	}
+	defer f.Release()
+	buf := make([]byte, block)
+	read := func(index int64) time.Duration {
+		t.Helper()
+		start := time.Now()
+		res, code := f.Read(buf, index*block)
+		if !code.Ok() {
+			t.Fatal(code)
+		}
+		res.Done()
+		return time.Since(start)
+	}
+
+	for i, test := range []struct {
+		index int64
+		hit   bool
+	}{
+		{0, false}, // cold
+		{0, true},
+		{0, true},
+		{1, false},
+		{0, true},
+		{2, false}, // evicts 1, the least recently read
+		{0, true},
+		{1, false},
+	} {
+		took := read(test.index)
+		if test.hit && took >= miss {
+			t.Errorf("read %d of block %d took %v, want a hit faster than %v", i, test.index, took, miss)
+		}
+		if !test.hit && took < miss {
+			t.Errorf("read %d of block %d took %v, want a miss taking at least %v", i, test.index, took, miss)
+		}
+	}
+	if hook.Hits() != 4 || hook.Misses() != 4 || hook.HitRatio() != 0.5 {
+		t.Errorf("Hits = %d, Misses = %d and HitRatio = %v, want 4, 4 and 0.5", hook.Hits(), hook.Misses(), hook.HitRatio())
+	}
+
+	hook.Drop()
+	if took := read(0); took < miss {
+		t.Errorf("read after Drop took %v, want a miss", took)
+	}
+}
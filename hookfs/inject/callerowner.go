@@ -0,0 +1,39 @@
+package inject
+
+import (
+	"github.com/ethercflow/hookfs/hookfs"
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+// CallerOwnerHook makes every file appear owned by whoever looks at it: GetAttr reports
+// the uid and gid of the caller as the owner. The real ownership is unchanged, and still
+// decides what the caller may do, since hookfs acts with its own privileges.
+//
+// The kernel caches attributes per inode, so different callers only see themselves as owners
+// when attribute caching is off; see hookfs.HookOnGetAttrWithContext.
+//
+// CallerOwnerHook implements hookfs.HookOnGetAttrWithContext.
+type CallerOwnerHook struct{}
+
+type callerOwnerCtx struct {
+	uid, gid uint32
+}
+
+// PreGetAttrWithContext implements hookfs.HookOnGetAttrWithContext
+func (h *CallerOwnerHook) PreGetAttrWithContext(path string, context *fuse.Context) (bool, hookfs.HookContext, error) {
+	if context == nil {
+		return false, nil, nil
+	}
+	return false, callerOwnerCtx{uid: context.Uid, gid: context.Gid}, nil
+}
+
+// PostGetAttr implements hookfs.HookOnGetAttrWithContext
+func (h *CallerOwnerHook) PostGetAttr(realRetCode int32, realAttr *fuse.Attr, prehookCtx hookfs.HookContext) (*fuse.Attr, bool, error) {
+	ctx, ok := prehookCtx.(callerOwnerCtx)
+	if !ok || realRetCode != 0 || realAttr == nil {
+		return nil, false, nil
+	}
+	attr := *realAttr
+	attr.Uid, attr.Gid = ctx.uid, ctx.gid
+	return &attr, true, nil
+}
@@ -0,0 +1,31 @@
+package inject
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+func TestCallerOwnerHook(t *testing.T) {
+	original := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(original, "file"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	h, err := hookfs.NewHookFs(original, t.TempDir(), &CallerOwnerHook{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, caller := range []fuse.Owner{{Uid: 1000, Gid: 1000}, {Uid: 2000, Gid: 3000}} {
+		attr, code := h.GetAttr("file", &fuse.Context{Owner: caller})
+		if !code.Ok() {
+			t.Fatal(code)
+		}
+		if attr.Uid != caller.Uid || attr.Gid != caller.Gid {
+			t.Errorf("caller %d:%d sees the owner %d:%d, want itself", caller.Uid, caller.Gid, attr.Uid, attr.Gid)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package inject
+
+import (
+	"sync"
+	"syscall"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	log "github.com/sirupsen/logrus"
+)
+
+// Capability is a feature that some filesystems lack.
+type Capability int
+
+const (
+	// Hardlinks is link(2).
+	Hardlinks Capability = iota
+	// Symlinks is symlink(2).
+	Symlinks
+	// XAttrs are the extended attribute calls: getxattr(2), listxattr(2), removexattr(2) and setxattr(2).
+	XAttrs
+	// SparseFiles is punching holes with fallocate(2).
+	SparseFiles
+)
+
+func (c Capability) String() string {
+	switch c {
+	case Hardlinks:
+		return "hardlinks"
+	case Symlinks:
+		return "symlinks"
+	case XAttrs:
+		return "xattrs"
+	case SparseFiles:
+		return "sparse files"
+	default:
+		return "unknown"
+	}
+}
+
+// fallocPunchHole is FALLOC_FL_PUNCH_HOLE from linux/falloc.h
+const fallocPunchHole = 0x02
+
+// CapabilityHook makes the mount look like a filesystem lacking some capabilities
+// (e.g. FAT-like, without links), by failing the corresponding operations with an errno
+// while everything else works. All the capabilities are enabled initially.
+//
+// CapabilityHook implements hookfs.HookOnLink, hookfs.HookOnSymlink, hookfs.HookOnGetXAttr,
+// hookfs.HookOnListXAttr, hookfs.HookOnRemoveXAttr, hookfs.HookOnSetXAttr and hookfs.HookOnAllocate.
+type CapabilityHook struct {
+	mu       sync.Mutex
+	disabled map[Capability]syscall.Errno
+}
+
+// NewCapabilityHook creates a CapabilityHook with all the capabilities enabled.
+func NewCapabilityHook() *CapabilityHook {
+	return &CapabilityHook{disabled: make(map[Capability]syscall.Errno)}
+}
+
+// Disable makes the operations of c fail with errno, typically EPERM or EOPNOTSUPP.
+func (h *CapabilityHook) Disable(c Capability, errno syscall.Errno) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.disabled[c] = errno
+}
+
+// Enable lets the operations of c through again.
+func (h *CapabilityHook) Enable(c Capability) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.disabled, c)
+}
+
+// Disabled returns whether c is disabled, and the errno its operations fail with.
+func (h *CapabilityHook) Disabled(c Capability) (syscall.Errno, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	errno, ok := h.disabled[c]
+	return errno, ok
+}
+
+func (h *CapabilityHook) check(c Capability, op string, path string) (bool, hookfs.HookContext, error) {
+	errno, disabled := h.Disabled(c)
+	if !disabled {
+		return false, nil, nil
+	}
+	log.WithFields(log.Fields{
+		"capability": c,
+		"op":         op,
+		"path":       path,
+		"errno":      errno,
+	}).Debug("CapabilityHook: capability disabled")
+	return true, nil, errno
+}
+
+// PreLink implements hookfs.HookOnLink
+func (h *CapabilityHook) PreLink(oldName string, newName string) (bool, hookfs.HookContext, error) {
+	return h.check(Hardlinks, hookfs.OpLink, newName)
+}
+
+// PostLink implements hookfs.HookOnLink
+func (h *CapabilityHook) PostLink(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return false, nil
+}
+
+// PreSymlink implements hookfs.HookOnSymlink
+func (h *CapabilityHook) PreSymlink(value string, linkName string) (bool, hookfs.HookContext, error) {
+	return h.check(Symlinks, hookfs.OpSymlink, linkName)
+}
+
+// PostSymlink implements hookfs.HookOnSymlink
+func (h *CapabilityHook) PostSymlink(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return false, nil
+}
+
+// PreGetXAttr implements hookfs.HookOnGetXAttr
+func (h *CapabilityHook) PreGetXAttr(name string, attribute string) (bool, hookfs.HookContext, error) {
+	return h.check(XAttrs, hookfs.OpGetXAttr, name)
+}
+
+// PostGetXAttr implements hookfs.HookOnGetXAttr
+func (h *CapabilityHook) PostGetXAttr(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return false, nil
+}
+
+// PreListXAttr implements hookfs.HookOnListXAttr
+func (h *CapabilityHook) PreListXAttr(name string) (bool, hookfs.HookContext, error) {
+	return h.check(XAttrs, hookfs.OpListXAttr, name)
+}
+
+// PostListXAttr implements hookfs.HookOnListXAttr
+func (h *CapabilityHook) PostListXAttr(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return false, nil
+}
+
+// PreRemoveXAttr implements hookfs.HookOnRemoveXAttr
+func (h *CapabilityHook) PreRemoveXAttr(name string, attr string) (bool, hookfs.HookContext, error) {
+	return h.check(XAttrs, hookfs.OpRemoveXAttr, name)
+}
+
+// PostRemoveXAttr implements hookfs.HookOnRemoveXAttr
+func (h *CapabilityHook) PostRemoveXAttr(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return false, nil
+}
+
+// PreSetXAttr implements hookfs.HookOnSetXAttr
+func (h *CapabilityHook) PreSetXAttr(name string, attr string, data []byte, flags int) (bool, hookfs.HookContext, error) {
+	return h.check(XAttrs, hookfs.OpSetXAttr, name)
+}
+
+// PostSetXAttr implements hookfs.HookOnSetXAttr
+func (h *CapabilityHook) PostSetXAttr(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return false, nil
+}
+
+// PreAllocate implements hookfs.HookOnAllocate
+func (h *CapabilityHook) PreAllocate(path string, off uint64, size uint64, mode uint32) (bool, hookfs.HookContext, error) {
+	if mode&fallocPunchHole == 0 {
+		return false, nil, nil
+	}
+	return h.check(SparseFiles, hookfs.OpAllocate, path)
+}
+
+// PostAllocate implements hookfs.HookOnAllocate
+func (h *CapabilityHook) PostAllocate(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return false, nil
+}
@@ -0,0 +1,35 @@
+package inject
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestCapabilityHookDowngrade(t *testing.T) {
+	hook := NewCapabilityHook()
+	hook.Disable(Hardlinks, syscall.EPERM)
+	hook.Disable(Symlinks, syscall.EOPNOTSUPP)
+	_, _, mnt := mount(t, hook, nil)
+
+	if err := ioutil.WriteFile(filepath.Join(mnt, "file"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(filepath.Join(mnt, "file"), filepath.Join(mnt, "link")); !errors.Is(err, syscall.EPERM) {
+		t.Errorf("link = %v, want EPERM", err)
+	}
+	if err := os.Symlink("file", filepath.Join(mnt, "symlink")); !errors.Is(err, syscall.EOPNOTSUPP) {
+		t.Errorf("symlink = %v, want EOPNOTSUPP", err)
+	}
+	if err := os.Rename(filepath.Join(mnt, "file"), filepath.Join(mnt, "renamed")); err != nil {
+		t.Errorf("rename: %v", err)
+	}
+
+	hook.Enable(Symlinks)
+	if err := os.Symlink("renamed", filepath.Join(mnt, "symlink")); err != nil {
+		t.Errorf("symlink once enabled: %v", err)
+	}
+}
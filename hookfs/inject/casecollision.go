@@ -0,0 +1,175 @@
+package inject
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	log "github.com/sirupsen/logrus"
+)
+
+// CaseCollisionPolicy is what a CaseCollisionHook does when a name is created next to one
+// differing only in case.
+type CaseCollisionPolicy int32
+
+const (
+	// CaseCollisionFail fails the operation with EEXIST.
+	CaseCollisionFail CaseCollisionPolicy = iota
+	// CaseCollisionOverwrite replaces the existing entry, as creating or renaming over it would.
+	// The entry is removed from Original before the real operation, so the new name has the
+	// case given by the caller, where a case-insensitive filesystem may keep the old one.
+	// Directories, and creations with O_EXCL, still fail with EEXIST. The kernel may still
+	// have the removed name cached; see hookfs.HookFs.InvalidateEntry.
+	CaseCollisionOverwrite
+)
+
+// CaseCollisionHook makes Create, Mkdir, Mknod, Symlink, Link and Rename notice names
+// differing only in case from an existing name of the same directory, as a case-insensitive
+// filesystem would, and applies the policy to them. Case-only renames of an entry are allowed.
+// Names are compared with strings.EqualFold, i.e. with Unicode simple case folding.
+//
+// CaseCollisionHook implements hookfs.HookOnCreate, hookfs.HookOnMkdir, hookfs.HookOnMknod,
+// hookfs.HookOnSymlink, hookfs.HookOnLink and hookfs.HookOnRename.
+type CaseCollisionHook struct {
+	// Original is the original directory of the mount.
+	Original string
+
+	policy int32
+}
+
+// NewCaseCollisionHook creates a CaseCollisionHook for original applying policy.
+func NewCaseCollisionHook(original string, policy CaseCollisionPolicy) *CaseCollisionHook {
+	return &CaseCollisionHook{
+		Original: original,
+		policy:   int32(policy),
+	}
+}
+
+// Policy returns what is done on a collision.
+func (h *CaseCollisionHook) Policy() CaseCollisionPolicy {
+	return CaseCollisionPolicy(atomic.LoadInt32(&h.policy))
+}
+
+// SetPolicy changes what is done on a collision. It is safe to call while mounted.
+func (h *CaseCollisionHook) SetPolicy(policy CaseCollisionPolicy) {
+	atomic.StoreInt32(&h.policy, int32(policy))
+}
+
+// collision returns the name of Original differing from path only in case, other than except,
+// or "".
+func (h *CaseCollisionHook) collision(path string, except string) string {
+	path = cleanRel(path)
+	dir := parentRel(path)
+	base := filepath.Base(path)
+	f, err := os.Open(filepath.Join(h.Original, dir))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	names, err := f.Readdirnames(-1)
+	if err != nil {
+		return ""
+	}
+	for _, name := range names {
+		other := filepath.Join(dir, name)
+		if name != base && other != except && strings.EqualFold(name, base) {
+			return other
+		}
+	}
+	return ""
+}
+
+// check applies the policy to a creation of path. overwrite is whether the operation may
+// replace an existing entry.
+func (h *CaseCollisionHook) check(op string, path string, except string, overwrite bool) (bool, hookfs.HookContext, error) {
+	other := h.collision(path, except)
+	if other == "" {
+		return false, nil, nil
+	}
+	policy := h.Policy()
+	log.WithFields(log.Fields{
+		"op":       op,
+		"path":     path,
+		"existing": other,
+		"policy":   policy,
+	}).Debug("CaseCollisionHook: case-only collision")
+	if policy != CaseCollisionOverwrite || !overwrite {
+		return true, nil, syscall.EEXIST
+	}
+	otherPath := filepath.Join(h.Original, other)
+	fi, err := os.Lstat(otherPath)
+	if err != nil {
+		// gone already
+		return false, nil, nil
+	}
+	if fi.IsDir() {
+		return true, nil, syscall.EEXIST
+	}
+	if err := os.Remove(otherPath); err != nil && !os.IsNotExist(err) {
+		return true, nil, err
+	}
+	return false, nil, nil
+}
+
+// PreCreate implements hookfs.HookOnCreate
+func (h *CaseCollisionHook) PreCreate(name string, flags uint32, mode uint32) (bool, hookfs.HookContext, error) {
+	return h.check(hookfs.OpCreate, name, "", flags&syscall.O_EXCL == 0)
+}
+
+// PostCreate implements hookfs.HookOnCreate
+func (h *CaseCollisionHook) PostCreate(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return false, nil
+}
+
+// PreMkdir implements hookfs.HookOnMkdir
+func (h *CaseCollisionHook) PreMkdir(path string, mode uint32) (bool, hookfs.HookContext, error) {
+	return h.check(hookfs.OpMkdir, path, "", false)
+}
+
+// PostMkdir implements hookfs.HookOnMkdir
+func (h *CaseCollisionHook) PostMkdir(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return false, nil
+}
+
+// PreMknod implements hookfs.HookOnMknod
+func (h *CaseCollisionHook) PreMknod(name string, mode uint32, dev uint32) (bool, hookfs.HookContext, error) {
+	return h.check(hookfs.OpMknod, name, "", false)
+}
+
+// PostMknod implements hookfs.HookOnMknod
+func (h *CaseCollisionHook) PostMknod(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return false, nil
+}
+
+// PreSymlink implements hookfs.HookOnSymlink
+func (h *CaseCollisionHook) PreSymlink(value string, linkName string) (bool, hookfs.HookContext, error) {
+	return h.check(hookfs.OpSymlink, linkName, "", false)
+}
+
+// PostSymlink implements hookfs.HookOnSymlink
+func (h *CaseCollisionHook) PostSymlink(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return false, nil
+}
+
+// PreLink implements hookfs.HookOnLink
+func (h *CaseCollisionHook) PreLink(oldName string, newName string) (bool, hookfs.HookContext, error) {
+	return h.check(hookfs.OpLink, newName, "", false)
+}
+
+// PostLink implements hookfs.HookOnLink
+func (h *CaseCollisionHook) PostLink(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return false, nil
+}
+
+// PreRename implements hookfs.HookOnRename
+func (h *CaseCollisionHook) PreRename(oldName string, newName string) (bool, hookfs.HookContext, error) {
+	return h.check(hookfs.OpRename, newName, cleanRel(oldName), true)
+}
+
+// PostRename implements hookfs.HookOnRename
+func (h *CaseCollisionHook) PostRename(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return false, nil
+}
@@ -0,0 +1,80 @@
+package inject
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+func TestCaseCollisionHook(t *testing.T) {
+	for _, tt := range []struct {
+		policy CaseCollisionPolicy
+		create fuse.Status
+		// the names left in Original
+		names []string
+	}{
+		{CaseCollisionFail, fuse.Status(syscall.EEXIST), []string{"dir", "file"}},
+		{CaseCollisionOverwrite, fuse.OK, []string{"File", "dir"}},
+	} {
+		original := t.TempDir()
+		if err := ioutil.WriteFile(filepath.Join(original, "file"), []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Mkdir(filepath.Join(original, "dir"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		h, err := hookfs.NewHookFs(original, t.TempDir(), NewCaseCollisionHook(original, tt.policy))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx := &fuse.Context{}
+
+		f, code := h.Create("File", syscall.O_CREAT|syscall.O_WRONLY, 0644, ctx)
+		if code != tt.create {
+			t.Errorf("policy %d: create File = %v, want %v", tt.policy, code, tt.create)
+		}
+		if code.Ok() {
+			f.Release()
+		}
+		// directories are never overwritten
+		if code := h.Mkdir("DIR", 0755, ctx); code != fuse.Status(syscall.EEXIST) {
+			t.Errorf("policy %d: mkdir DIR = %v, want EEXIST", tt.policy, code)
+		}
+		// nor is anything created with O_EXCL
+		if _, code := h.Create("FILE", syscall.O_CREAT|syscall.O_EXCL|syscall.O_WRONLY, 0644, ctx); code != fuse.Status(syscall.EEXIST) {
+			t.Errorf("policy %d: exclusive create FILE = %v, want EEXIST", tt.policy, code)
+		}
+		// renaming an entry to another case of its own name is fine
+		if code := h.Rename("dir", "Dir", ctx); !code.Ok() {
+			t.Errorf("policy %d: rename dir to Dir = %v, want OK", tt.policy, code)
+		} else if code := h.Rename("Dir", "dir", ctx); !code.Ok() {
+			t.Fatal(code)
+		}
+
+		names, err := readDirNames(original)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(names, tt.names) {
+			t.Errorf("policy %d: Original holds %q, want %q", tt.policy, names, tt.names)
+		}
+	}
+}
+
+func readDirNames(dir string) ([]string, error) {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(fis))
+	for i, fi := range fis {
+		names[i] = fi.Name()
+	}
+	return names, nil
+}
@@ -0,0 +1,56 @@
+package inject
+
+import (
+	"github.com/ethercflow/hookfs/hookfs"
+)
+
+// Category is a class of operations.
+type Category int
+
+const (
+	// Metadata operations work on names and attributes: getattr (which is also how lookups
+	// reach hookfs), opendir, readlink, access, statfs, chmod, chown, utimens, xattrs, and
+	// the namespace operations create, mkdir, mknod, symlink, link, rename, unlink and rmdir.
+	Metadata Category = iota
+	// Data operations work on file contents: read, write, fsync, flush, truncate and allocate.
+	Data
+	// Other operations are neither: open, release and byte-range locks.
+	Other
+)
+
+var opCategories = map[string]Category{
+	hookfs.OpGetAttr:     Metadata,
+	hookfs.OpOpenDir:     Metadata,
+	hookfs.OpReadlink:    Metadata,
+	hookfs.OpAccess:      Metadata,
+	hookfs.OpStatFs:      Metadata,
+	hookfs.OpChmod:       Metadata,
+	hookfs.OpChown:       Metadata,
+	hookfs.OpUtimens:     Metadata,
+	hookfs.OpGetXAttr:    Metadata,
+	hookfs.OpListXAttr:   Metadata,
+	hookfs.OpSetXAttr:    Metadata,
+	hookfs.OpRemoveXAttr: Metadata,
+	hookfs.OpCreate:      Metadata,
+	hookfs.OpMkdir:       Metadata,
+	hookfs.OpMknod:       Metadata,
+	hookfs.OpSymlink:     Metadata,
+	hookfs.OpLink:        Metadata,
+	hookfs.OpRename:      Metadata,
+	hookfs.OpUnlink:      Metadata,
+	hookfs.OpRmdir:       Metadata,
+	hookfs.OpRead:        Data,
+	hookfs.OpWrite:       Data,
+	hookfs.OpFsync:       Data,
+	hookfs.OpFlush:       Data,
+	hookfs.OpTruncate:    Data,
+	hookfs.OpAllocate:    Data,
+}
+
+// CategoryOf returns the category of the operation op (one of the hookfs.OpXXX names).
+func CategoryOf(op string) Category {
+	if c, ok := opCategories[op]; ok {
+		return c
+	}
+	return Other
+}
@@ -0,0 +1,60 @@
+package inject
+
+import (
+	"math"
+	"sync"
+	"syscall"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+// CompressionHook makes regular files look transparently compressed: GetAttr reports the real
+// size, but a block count divided by Ratio, as du(1) would see on a compressing filesystem.
+// Blocks are 512-byte units, rounded up, and a non-empty file takes at least one.
+//
+// CompressionHook implements hookfs.HookOnGetAttr.
+type CompressionHook struct {
+	mu    sync.Mutex
+	ratio float64
+}
+
+// NewCompressionHook creates a CompressionHook with a compression ratio of ratio,
+// e.g. 4 for files taking a quarter of their size. A ratio of 1 or less reports
+// the blocks of an uncompressed file.
+func NewCompressionHook(ratio float64) *CompressionHook {
+	return &CompressionHook{ratio: ratio}
+}
+
+// Ratio returns the compression ratio.
+func (h *CompressionHook) Ratio() float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.ratio
+}
+
+// SetRatio changes the compression ratio.
+func (h *CompressionHook) SetRatio(ratio float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.ratio = ratio
+}
+
+// PreGetAttr implements hookfs.HookOnGetAttr
+func (h *CompressionHook) PreGetAttr(path string) (bool, hookfs.HookContext, error) {
+	return false, nil, nil
+}
+
+// PostGetAttr implements hookfs.HookOnGetAttr
+func (h *CompressionHook) PostGetAttr(realRetCode int32, realAttr *fuse.Attr, prehookCtx hookfs.HookContext) (*fuse.Attr, bool, error) {
+	if realRetCode != 0 || realAttr == nil || realAttr.Mode&syscall.S_IFMT != syscall.S_IFREG {
+		return nil, false, nil
+	}
+	ratio := h.Ratio()
+	if ratio < 1 {
+		ratio = 1
+	}
+	attr := *realAttr
+	attr.Blocks = uint64(math.Ceil(float64(attr.Size) / 512 / ratio))
+	return &attr, true, nil
+}
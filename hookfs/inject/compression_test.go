@@ -0,0 +1,56 @@
+package inject
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+func TestCompressionHookReportsFewerBlocks(t *testing.T) {
+	const size = 1 << 20
+	original := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(original, "file"), bytes.Repeat([]byte("x"), size), 0644); err != nil {
+		t.Fatal(err)
+	}
+	hook := NewCompressionHook(4)
+	h, err := hookfs.NewHookFs(original, t.TempDir(), hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		ratio  float64
+		blocks uint64
+	}{
+		{4, size / 512 / 4},
+		{2.5, 820}, // 819.2, rounded up
+		{1, size / 512},
+	} {
+		hook.SetRatio(test.ratio)
+		attr, code := h.GetAttr("file", &fuse.Context{})
+		if !code.Ok() {
+			t.Fatal(code)
+		}
+		if attr.Size != size || attr.Blocks != test.blocks {
+			t.Errorf("ratio %v: Size = %d and Blocks = %d, want %d and %d",
+				test.ratio, attr.Size, attr.Blocks, size, test.blocks)
+		}
+	}
+
+	// directories are left alone
+	var st syscall.Stat_t
+	if err := syscall.Stat(original, &st); err != nil {
+		t.Fatal(err)
+	}
+	dir, code := h.GetAttr("", &fuse.Context{})
+	if !code.Ok() {
+		t.Fatal(code)
+	}
+	if dir.Blocks != uint64(st.Blocks) {
+		t.Errorf("the root reports %d blocks, want the real %d", dir.Blocks, st.Blocks)
+	}
+}
@@ -0,0 +1,175 @@
+package inject
+
+import (
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+// ConcurrentModifierHook makes regular files look modified by another writer every Interval,
+// whether or not the application wrote to them.
+//
+// After each modification, GetAttr reports the time of the modification as mtime and ctime
+// (unless the real ones are later) and the real size grown by SizeDelta per modification so far.
+// If CorruptReads is set, the data read changes with every modification as well. Original is
+// left untouched. The kernel caches attributes and data, so changes may show up an attribute
+// timeout late, and reads served from the page cache don't change.
+//
+// ConcurrentModifierHook implements hookfs.HookOnGetAttr and hookfs.HookOnRead.
+type ConcurrentModifierHook struct {
+	mu           sync.Mutex
+	interval     time.Duration
+	sizeDelta    uint64
+	corruptReads bool
+	// modifications made before start, under previous intervals
+	base  uint64
+	start time.Time
+}
+
+// NewConcurrentModifierHook creates a ConcurrentModifierHook modifying files every interval,
+// growing them by sizeDelta bytes each time. An interval of 0 or less means no modification.
+func NewConcurrentModifierHook(interval time.Duration, sizeDelta uint64) *ConcurrentModifierHook {
+	return &ConcurrentModifierHook{
+		interval:  interval,
+		sizeDelta: sizeDelta,
+		start:     time.Now(),
+	}
+}
+
+// modifications returns the number of modifications so far and the time of the last one.
+// h.mu must be held.
+func (h *ConcurrentModifierHook) modifications(now time.Time) (uint64, time.Time) {
+	if h.interval <= 0 {
+		return h.base, h.start
+	}
+	n := uint64(now.Sub(h.start) / h.interval)
+	return h.base + n, h.start.Add(time.Duration(n) * h.interval)
+}
+
+// Interval returns the time between modifications.
+func (h *ConcurrentModifierHook) Interval() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.interval
+}
+
+// SetInterval changes the time between modifications. The next one is interval from now.
+func (h *ConcurrentModifierHook) SetInterval(interval time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := time.Now()
+	h.base, _ = h.modifications(now)
+	h.start = now
+	h.interval = interval
+}
+
+// SizeDelta returns the bytes files grow by with each modification.
+func (h *ConcurrentModifierHook) SizeDelta() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.sizeDelta
+}
+
+// SetSizeDelta changes the bytes files grow by with each modification,
+// including the modifications made so far.
+func (h *ConcurrentModifierHook) SetSizeDelta(sizeDelta uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sizeDelta = sizeDelta
+}
+
+// CorruptReads returns whether the data read changes with every modification.
+func (h *ConcurrentModifierHook) CorruptReads() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.corruptReads
+}
+
+// SetCorruptReads changes whether the data read changes with every modification.
+func (h *ConcurrentModifierHook) SetCorruptReads(corruptReads bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.corruptReads = corruptReads
+}
+
+// Modifications returns the number of modifications made so far.
+func (h *ConcurrentModifierHook) Modifications() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	n, _ := h.modifications(time.Now())
+	return n
+}
+
+// NextModification returns when the next modification is due,
+// or the zero time if files are not modified.
+func (h *ConcurrentModifierHook) NextModification() time.Time {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.interval <= 0 {
+		return time.Time{}
+	}
+	_, last := h.modifications(time.Now())
+	return last.Add(h.interval)
+}
+
+// PreGetAttr implements hookfs.HookOnGetAttr
+func (h *ConcurrentModifierHook) PreGetAttr(path string) (bool, hookfs.HookContext, error) {
+	return false, nil, nil
+}
+
+// PostGetAttr implements hookfs.HookOnGetAttr
+func (h *ConcurrentModifierHook) PostGetAttr(realRetCode int32, realAttr *fuse.Attr, prehookCtx hookfs.HookContext) (*fuse.Attr, bool, error) {
+	if realRetCode != 0 || realAttr == nil || realAttr.Mode&syscall.S_IFMT != syscall.S_IFREG {
+		return nil, false, nil
+	}
+
+	h.mu.Lock()
+	n, last := h.modifications(time.Now())
+	sizeDelta := h.sizeDelta
+	h.mu.Unlock()
+	if n == 0 {
+		return nil, false, nil
+	}
+
+	attr := *realAttr
+	attr.Size += n * sizeDelta
+	sec, nsec := uint64(last.Unix()), uint32(last.Nanosecond())
+	if attr.Mtime < sec || attr.Mtime == sec && attr.Mtimensec < nsec {
+		attr.Mtime, attr.Mtimensec = sec, nsec
+	}
+	if attr.Ctime < sec || attr.Ctime == sec && attr.Ctimensec < nsec {
+		attr.Ctime, attr.Ctimensec = sec, nsec
+	}
+	return &attr, true, nil
+}
+
+// PreRead implements hookfs.HookOnRead
+func (h *ConcurrentModifierHook) PreRead(path string, length int64, offset int64) ([]byte, bool, hookfs.HookContext, error) {
+	return nil, false, nil, nil
+}
+
+// PostRead implements hookfs.HookOnRead
+func (h *ConcurrentModifierHook) PostRead(realRetCode int32, realBuf []byte, prehookCtx hookfs.HookContext) ([]byte, bool, error) {
+	if realRetCode != 0 {
+		return nil, false, nil
+	}
+
+	h.mu.Lock()
+	n, _ := h.modifications(time.Now())
+	corruptReads := h.corruptReads
+	h.mu.Unlock()
+	// every 256th modification flips nothing, which a real writer could do as well
+	mask := byte(n)
+	if !corruptReads || mask == 0 {
+		return nil, false, nil
+	}
+
+	buf := make([]byte, len(realBuf))
+	for i, b := range realBuf {
+		buf[i] = b ^ mask
+	}
+	return buf, true, nil
+}
@@ -0,0 +1,49 @@
+package inject
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethercflow/hookfs/hookfs"
+)
+
+func TestConcurrentModifierHookChangesMtime(t *testing.T) {
+	const interval = 100 * time.Millisecond
+	hook := NewConcurrentModifierHook(interval, 10)
+	_, original, mnt := mount(t, hook, &hookfs.Options{AttrTimeout: -1})
+	path := filepath.Join(original, "file")
+	if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(interval)
+	first, err := os.Stat(filepath.Join(mnt, "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * interval)
+	second, err := os.Stat(filepath.Join(mnt, "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !second.ModTime().After(first.ModTime()) {
+		t.Errorf("mtime went from %v to %v without a write, want it later", first.ModTime(), second.ModTime())
+	}
+	if second.Size() <= first.Size() {
+		t.Errorf("size went from %d to %d, want it grown", first.Size(), second.Size())
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fi.ModTime().Equal(old) || fi.Size() != 0 {
+		t.Errorf("the file in Original changed to %d bytes modified at %v", fi.Size(), fi.ModTime())
+	}
+}
@@ -0,0 +1,364 @@
+package inject
+
+import (
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	"github.com/hanwen/go-fuse/fuse"
+	log "github.com/sirupsen/logrus"
+)
+
+// DeadlineHook measures how long the original filesystem takes for each operation against
+// a latency budget per operation type, for SLO testing. Operations over budget are counted
+// and logged, and fail with a timeout errno if Fail is set. A failed operation has been done
+// in the original directory all the same, as with a client giving up on a slow server.
+//
+// Only the time taken by the original filesystem is measured, not the time taken by the
+// kernel and the other hooks. Release, locks, statfs and xattrs are not measured.
+//
+// DeadlineHook implements hookfs.HookOnOpen, hookfs.HookOnReadMetadata, hookfs.HookOnWrite,
+// hookfs.HookOnMkdir, hookfs.HookOnRmdir, hookfs.HookOnOpenDir, hookfs.HookOnFsync,
+// hookfs.HookOnFlush, hookfs.HookOnTruncate, hookfs.HookOnGetAttr, hookfs.HookOnChown,
+// hookfs.HookOnChmod, hookfs.HookOnUtimens, hookfs.HookOnAllocate, hookfs.HookOnReadlink,
+// hookfs.HookOnSymlink, hookfs.HookOnCreate, hookfs.HookOnAccess, hookfs.HookOnLink,
+// hookfs.HookOnMknod, hookfs.HookOnRename and hookfs.HookOnUnlink.
+type DeadlineHook struct {
+	errno syscall.Errno
+
+	mu       sync.Mutex
+	fail     bool
+	budgets  map[string]time.Duration
+	breaches map[string]uint64
+}
+
+type deadlineCtx struct {
+	op    string
+	path  string
+	start time.Time
+}
+
+// NewDeadlineHook creates a DeadlineHook with no budget, failing operations over budget
+// with errno, typically ETIMEDOUT, once Fail is set.
+func NewDeadlineHook(errno syscall.Errno) *DeadlineHook {
+	return &DeadlineHook{
+		errno:    errno,
+		budgets:  make(map[string]time.Duration),
+		breaches: make(map[string]uint64),
+	}
+}
+
+// Budget returns the latency budget of op, one of the hookfs.OpXXX constants, or 0 if none.
+func (h *DeadlineHook) Budget(op string) time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.budgets[op]
+}
+
+// SetBudget changes the latency budget of op. A budget of 0 or less means no budget.
+func (h *DeadlineHook) SetBudget(op string, budget time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if budget <= 0 {
+		delete(h.budgets, op)
+		return
+	}
+	h.budgets[op] = budget
+}
+
+// Budgets returns the latency budgets by operation.
+func (h *DeadlineHook) Budgets() map[string]time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	budgets := make(map[string]time.Duration, len(h.budgets))
+	for op, budget := range h.budgets {
+		budgets[op] = budget
+	}
+	return budgets
+}
+
+// Fail returns whether operations over budget fail.
+func (h *DeadlineHook) Fail() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.fail
+}
+
+// SetFail changes whether operations over budget fail.
+func (h *DeadlineHook) SetFail(fail bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.fail = fail
+}
+
+// Breaches returns the number of operations over budget by operation.
+func (h *DeadlineHook) Breaches() map[string]uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	breaches := make(map[string]uint64, len(h.breaches))
+	for op, n := range h.breaches {
+		breaches[op] = n
+	}
+	return breaches
+}
+
+// Reset sets the breach counters back to zero.
+func (h *DeadlineHook) Reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.breaches = make(map[string]uint64)
+}
+
+func (h *DeadlineHook) start(op string, path string) hookfs.HookContext {
+	return &deadlineCtx{op: op, path: path, start: time.Now()}
+}
+
+// check counts the operation of prehookCtx if it is over budget.
+func (h *DeadlineHook) check(prehookCtx hookfs.HookContext) (bool, error) {
+	ctx, ok := prehookCtx.(*deadlineCtx)
+	if !ok {
+		return false, nil
+	}
+	took := time.Since(ctx.start)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	budget, ok := h.budgets[ctx.op]
+	if !ok || took <= budget {
+		return false, nil
+	}
+	h.breaches[ctx.op]++
+	log.WithFields(log.Fields{
+		"op":     ctx.op,
+		"path":   ctx.path,
+		"took":   took,
+		"budget": budget,
+	}).Warn("DeadlineHook: operation over budget")
+	if !h.fail {
+		return false, nil
+	}
+	return true, h.errno
+}
+
+// PreOpen implements hookfs.HookOnOpen
+func (h *DeadlineHook) PreOpen(path string, flags uint32) (bool, hookfs.HookContext, error) {
+	return false, h.start(hookfs.OpOpen, path), nil
+}
+
+// PostOpen implements hookfs.HookOnOpen
+func (h *DeadlineHook) PostOpen(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return h.check(prehookCtx)
+}
+
+// PreReadMetadata implements hookfs.HookOnReadMetadata
+func (h *DeadlineHook) PreReadMetadata(path string, length int64, offset int64) (bool, hookfs.HookContext, error) {
+	return false, h.start(hookfs.OpRead, path), nil
+}
+
+// PostReadMetadata implements hookfs.HookOnReadMetadata
+func (h *DeadlineHook) PostReadMetadata(realRetCode int32, realSize int, prehookCtx hookfs.HookContext) (bool, error) {
+	return h.check(prehookCtx)
+}
+
+// PreWrite implements hookfs.HookOnWrite
+func (h *DeadlineHook) PreWrite(path string, buf []byte, offset int64) (bool, hookfs.HookContext, error) {
+	return false, h.start(hookfs.OpWrite, path), nil
+}
+
+// PostWrite implements hookfs.HookOnWrite
+func (h *DeadlineHook) PostWrite(realRetCode int32, prehookCtx hookfs.HookContext) (uint32, bool, error) {
+	hooked, err := h.check(prehookCtx)
+	return 0, hooked, err
+}
+
+// PreMkdir implements hookfs.HookOnMkdir
+func (h *DeadlineHook) PreMkdir(path string, mode uint32) (bool, hookfs.HookContext, error) {
+	return false, h.start(hookfs.OpMkdir, path), nil
+}
+
+// PostMkdir implements hookfs.HookOnMkdir
+func (h *DeadlineHook) PostMkdir(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return h.check(prehookCtx)
+}
+
+// PreRmdir implements hookfs.HookOnRmdir
+func (h *DeadlineHook) PreRmdir(path string) (bool, hookfs.HookContext, error) {
+	return false, h.start(hookfs.OpRmdir, path), nil
+}
+
+// PostRmdir implements hookfs.HookOnRmdir
+func (h *DeadlineHook) PostRmdir(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return h.check(prehookCtx)
+}
+
+// PreOpenDir implements hookfs.HookOnOpenDir
+func (h *DeadlineHook) PreOpenDir(path string) (bool, hookfs.HookContext, error) {
+	return false, h.start(hookfs.OpOpenDir, path), nil
+}
+
+// PostOpenDir implements hookfs.HookOnOpenDir
+func (h *DeadlineHook) PostOpenDir(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return h.check(prehookCtx)
+}
+
+// PreFsync implements hookfs.HookOnFsync
+func (h *DeadlineHook) PreFsync(path string, flags uint32) (bool, hookfs.HookContext, error) {
+	return false, h.start(hookfs.OpFsync, path), nil
+}
+
+// PostFsync implements hookfs.HookOnFsync
+func (h *DeadlineHook) PostFsync(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return h.check(prehookCtx)
+}
+
+// PreFlush implements hookfs.HookOnFlush
+func (h *DeadlineHook) PreFlush(path string) (bool, hookfs.HookContext, error) {
+	return false, h.start(hookfs.OpFlush, path), nil
+}
+
+// PostFlush implements hookfs.HookOnFlush
+func (h *DeadlineHook) PostFlush(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return h.check(prehookCtx)
+}
+
+// PreTruncate implements hookfs.HookOnTruncate
+func (h *DeadlineHook) PreTruncate(path string, size uint64) (bool, hookfs.HookContext, error) {
+	return false, h.start(hookfs.OpTruncate, path), nil
+}
+
+// PostTruncate implements hookfs.HookOnTruncate
+func (h *DeadlineHook) PostTruncate(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return h.check(prehookCtx)
+}
+
+// PreGetAttr implements hookfs.HookOnGetAttr
+func (h *DeadlineHook) PreGetAttr(path string) (bool, hookfs.HookContext, error) {
+	return false, h.start(hookfs.OpGetAttr, path), nil
+}
+
+// PostGetAttr implements hookfs.HookOnGetAttr
+func (h *DeadlineHook) PostGetAttr(realRetCode int32, realAttr *fuse.Attr, prehookCtx hookfs.HookContext) (*fuse.Attr, bool, error) {
+	hooked, err := h.check(prehookCtx)
+	return nil, hooked, err
+}
+
+// PreChown implements hookfs.HookOnChown
+func (h *DeadlineHook) PreChown(path string, uid uint32, gid uint32) (bool, hookfs.HookContext, error) {
+	return false, h.start(hookfs.OpChown, path), nil
+}
+
+// PostChown implements hookfs.HookOnChown
+func (h *DeadlineHook) PostChown(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return h.check(prehookCtx)
+}
+
+// PreChmod implements hookfs.HookOnChmod
+func (h *DeadlineHook) PreChmod(path string, perms uint32) (bool, hookfs.HookContext, error) {
+	return false, h.start(hookfs.OpChmod, path), nil
+}
+
+// PostChmod implements hookfs.HookOnChmod
+func (h *DeadlineHook) PostChmod(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return h.check(prehookCtx)
+}
+
+// PreUtimens implements hookfs.HookOnUtimens
+func (h *DeadlineHook) PreUtimens(path string, atime *time.Time, mtime *time.Time) (bool, hookfs.HookContext, error) {
+	return false, h.start(hookfs.OpUtimens, path), nil
+}
+
+// PostUtimens implements hookfs.HookOnUtimens
+func (h *DeadlineHook) PostUtimens(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return h.check(prehookCtx)
+}
+
+// PreAllocate implements hookfs.HookOnAllocate
+func (h *DeadlineHook) PreAllocate(path string, off uint64, size uint64, mode uint32) (bool, hookfs.HookContext, error) {
+	return false, h.start(hookfs.OpAllocate, path), nil
+}
+
+// PostAllocate implements hookfs.HookOnAllocate
+func (h *DeadlineHook) PostAllocate(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return h.check(prehookCtx)
+}
+
+// PreReadlink implements hookfs.HookOnReadlink
+func (h *DeadlineHook) PreReadlink(name string) (bool, hookfs.HookContext, error) {
+	return false, h.start(hookfs.OpReadlink, name), nil
+}
+
+// PostReadlink implements hookfs.HookOnReadlink
+func (h *DeadlineHook) PostReadlink(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return h.check(prehookCtx)
+}
+
+// PreSymlink implements hookfs.HookOnSymlink
+func (h *DeadlineHook) PreSymlink(value string, linkName string) (bool, hookfs.HookContext, error) {
+	return false, h.start(hookfs.OpSymlink, linkName), nil
+}
+
+// PostSymlink implements hookfs.HookOnSymlink
+func (h *DeadlineHook) PostSymlink(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return h.check(prehookCtx)
+}
+
+// PreCreate implements hookfs.HookOnCreate
+func (h *DeadlineHook) PreCreate(name string, flags uint32, mode uint32) (bool, hookfs.HookContext, error) {
+	return false, h.start(hookfs.OpCreate, name), nil
+}
+
+// PostCreate implements hookfs.HookOnCreate
+func (h *DeadlineHook) PostCreate(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return h.check(prehookCtx)
+}
+
+// PreAccess implements hookfs.HookOnAccess
+func (h *DeadlineHook) PreAccess(name string, mode uint32) (bool, hookfs.HookContext, error) {
+	return false, h.start(hookfs.OpAccess, name), nil
+}
+
+// PostAccess implements hookfs.HookOnAccess
+func (h *DeadlineHook) PostAccess(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return h.check(prehookCtx)
+}
+
+// PreLink implements hookfs.HookOnLink
+func (h *DeadlineHook) PreLink(oldName string, newName string) (bool, hookfs.HookContext, error) {
+	return false, h.start(hookfs.OpLink, newName), nil
+}
+
+// PostLink implements hookfs.HookOnLink
+func (h *DeadlineHook) PostLink(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return h.check(prehookCtx)
+}
+
+// PreMknod implements hookfs.HookOnMknod
+func (h *DeadlineHook) PreMknod(name string, mode uint32, dev uint32) (bool, hookfs.HookContext, error) {
+	return false, h.start(hookfs.OpMknod, name), nil
+}
+
+// PostMknod implements hookfs.HookOnMknod
+func (h *DeadlineHook) PostMknod(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return h.check(prehookCtx)
+}
+
+// PreRename implements hookfs.HookOnRename
+func (h *DeadlineHook) PreRename(oldName string, newName string) (bool, hookfs.HookContext, error) {
+	return false, h.start(hookfs.OpRename, oldName), nil
+}
+
+// PostRename implements hookfs.HookOnRename
+func (h *DeadlineHook) PostRename(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return h.check(prehookCtx)
+}
+
+// PreUnlink implements hookfs.HookOnUnlink
+func (h *DeadlineHook) PreUnlink(name string) (bool, hookfs.HookContext, error) {
+	return false, h.start(hookfs.OpUnlink, name), nil
+}
+
+// PostUnlink implements hookfs.HookOnUnlink
+func (h *DeadlineHook) PostUnlink(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return h.check(prehookCtx)
+}
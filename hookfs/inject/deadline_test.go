@@ -0,0 +1,48 @@
+package inject
+
+import (
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ethercflow/hookfs/hookfs"
+)
+
+// slowGetAttr runs a GetAttr through hook taking took in the original filesystem.
+func slowGetAttr(h *DeadlineHook, took time.Duration) (bool, error) {
+	_, ctx, _ := h.PreGetAttr("file")
+	time.Sleep(took)
+	_, hooked, err := h.PostGetAttr(0, nil, ctx)
+	return hooked, err
+}
+
+func TestDeadlineHookCountsBreaches(t *testing.T) {
+	h := NewDeadlineHook(syscall.ETIMEDOUT)
+	h.SetBudget(hookfs.OpGetAttr, 10*time.Millisecond)
+
+	if hooked, err := slowGetAttr(h, 0); hooked || err != nil {
+		t.Errorf("fast getattr = %v, %v, want passed through", hooked, err)
+	}
+	if hooked, err := slowGetAttr(h, 20*time.Millisecond); hooked || err != nil {
+		t.Errorf("slow getattr without Fail = %v, %v, want passed through", hooked, err)
+	}
+	h.SetFail(true)
+	if hooked, err := slowGetAttr(h, 20*time.Millisecond); !hooked || err != syscall.ETIMEDOUT {
+		t.Errorf("slow getattr with Fail = %v, %v, want ETIMEDOUT", hooked, err)
+	}
+	// operations without a budget are never over it
+	_, ctx, _ := h.PreMkdir("dir", 0755)
+	time.Sleep(20 * time.Millisecond)
+	if hooked, err := h.PostMkdir(0, ctx); hooked || err != nil {
+		t.Errorf("slow mkdir without budget = %v, %v, want passed through", hooked, err)
+	}
+
+	breaches := h.Breaches()
+	if breaches[hookfs.OpGetAttr] != 2 || len(breaches) != 1 {
+		t.Errorf("Breaches = %v, want 2 getattrs", breaches)
+	}
+	h.Reset()
+	if breaches := h.Breaches(); len(breaches) != 0 {
+		t.Errorf("Breaches after Reset = %v, want none", breaches)
+	}
+}
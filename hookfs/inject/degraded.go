@@ -0,0 +1,133 @@
+package inject
+
+import (
+	"math/rand"
+	"sync"
+	"syscall"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	log "github.com/sirupsen/logrus"
+)
+
+// DegradedModeHook models a degraded storage array, which keeps serving one direction of I/O
+// while failing the other: reads fail with EIO with one probability, writes and fsyncs with
+// another. Setting a probability to 1 fails the direction entirely, 0 restores it.
+//
+// DegradedModeHook implements hookfs.HookOnReadMetadata, hookfs.HookOnWrite and
+// hookfs.HookOnFsync.
+type DegradedModeHook struct {
+	mu            sync.Mutex
+	rnd           *rand.Rand
+	readFailProb  float64
+	writeFailProb float64
+	failedReads   uint64
+	failedWrites  uint64
+}
+
+// NewDegradedModeHook creates a DegradedModeHook failing nothing until told to, drawing from
+// a generator seeded with seed.
+func NewDegradedModeHook(seed int64) *DegradedModeHook {
+	return &DegradedModeHook{rnd: rand.New(rand.NewSource(seed))}
+}
+
+// ReadFailProbability returns the probability that a read fails.
+func (h *DegradedModeHook) ReadFailProbability() float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.readFailProb
+}
+
+// SetReadFailProbability changes the probability that a read fails. It is safe to call while
+// mounted.
+func (h *DegradedModeHook) SetReadFailProbability(p float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.readFailProb = p
+}
+
+// WriteFailProbability returns the probability that a write or fsync fails.
+func (h *DegradedModeHook) WriteFailProbability() float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.writeFailProb
+}
+
+// SetWriteFailProbability changes the probability that a write or fsync fails. It is safe to
+// call while mounted.
+func (h *DegradedModeHook) SetWriteFailProbability(p float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.writeFailProb = p
+}
+
+// FailedReads returns the number of reads failed so far.
+func (h *DegradedModeHook) FailedReads() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.failedReads
+}
+
+// FailedWrites returns the number of writes and fsyncs failed so far.
+func (h *DegradedModeHook) FailedWrites() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.failedWrites
+}
+
+// fail returns whether to fail an operation with probability p. h.mu must be held.
+func (h *DegradedModeHook) fail(op string, path string, p float64) bool {
+	if p <= 0 || p < 1 && h.rnd.Float64() >= p {
+		return false
+	}
+	log.WithFields(log.Fields{
+		"op":   op,
+		"path": path,
+	}).Debug("DegradedModeHook: returning EIO")
+	return true
+}
+
+func (h *DegradedModeHook) write(op string, path string) (bool, hookfs.HookContext, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.fail(op, path, h.writeFailProb) {
+		return false, nil, nil
+	}
+	h.failedWrites++
+	return true, nil, syscall.EIO
+}
+
+// PreReadMetadata implements hookfs.HookOnReadMetadata
+func (h *DegradedModeHook) PreReadMetadata(path string, length int64, offset int64) (bool, hookfs.HookContext, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.fail(hookfs.OpRead, path, h.readFailProb) {
+		return false, nil, nil
+	}
+	h.failedReads++
+	return true, nil, syscall.EIO
+}
+
+// PostReadMetadata implements hookfs.HookOnReadMetadata
+func (h *DegradedModeHook) PostReadMetadata(realRetCode int32, realSize int, prehookCtx hookfs.HookContext) (bool, error) {
+	return false, nil
+}
+
+// PreWrite implements hookfs.HookOnWrite
+func (h *DegradedModeHook) PreWrite(path string, buf []byte, offset int64) (bool, hookfs.HookContext, error) {
+	return h.write(hookfs.OpWrite, path)
+}
+
+// PostWrite implements hookfs.HookOnWrite
+func (h *DegradedModeHook) PostWrite(realRetCode int32, prehookCtx hookfs.HookContext) (uint32, bool, error) {
+	return 0, false, nil
+}
+
+// PreFsync implements hookfs.HookOnFsync
+func (h *DegradedModeHook) PreFsync(path string, flags uint32) (bool, hookfs.HookContext, error) {
+	return h.write(hookfs.OpFsync, path)
+}
+
+// PostFsync implements hookfs.HookOnFsync
+func (h *DegradedModeHook) PostFsync(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return false, nil
+}
@@ -0,0 +1,71 @@
+package inject
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+func TestDegradedModeHookFailsOneDirection(t *testing.T) {
+	original := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(original, "file"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	hook := NewDegradedModeHook(1)
+	h, err := hookfs.NewHookFs(original, t.TempDir(), hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, code := h.Open("file", syscall.O_RDWR, &fuse.Context{})
+	if !code.Ok() {
+		t.Fatal(code)
+	}
+	defer f.Release()
+	buf := make([]byte, 4)
+	read := func() fuse.Status {
+		res, code := f.Read(buf, 0)
+		if code.Ok() {
+			_, code = res.Bytes(buf)
+			res.Done()
+		}
+		return code
+	}
+	write := func() fuse.Status {
+		_, code := f.Write([]byte("D"), 0)
+		return code
+	}
+
+	hook.SetWriteFailProbability(1)
+	for i := 0; i < 10; i++ {
+		if code := read(); !code.Ok() {
+			t.Fatalf("read while write-degraded: %v", code)
+		}
+		if code := write(); code != fuse.EIO {
+			t.Fatalf("write while write-degraded: %v, want EIO", code)
+		}
+	}
+	if code := f.Fsync(0); code != fuse.EIO {
+		t.Errorf("fsync while write-degraded: %v, want EIO", code)
+	}
+	if hook.FailedReads() != 0 || hook.FailedWrites() != 11 {
+		t.Errorf("FailedReads = %d and FailedWrites = %d, want 0 and 11", hook.FailedReads(), hook.FailedWrites())
+	}
+
+	hook.SetWriteFailProbability(0)
+	hook.SetReadFailProbability(1)
+	if code := read(); code != fuse.EIO {
+		t.Errorf("read while read-degraded: %v, want EIO", code)
+	}
+	if code := write(); !code.Ok() {
+		t.Errorf("write while read-degraded: %v", code)
+	}
+
+	hook.SetReadFailProbability(0)
+	if code := read(); !code.Ok() || string(buf) != "Data" {
+		t.Errorf("read %q: %v once restored, want %q", buf, code, "Data")
+	}
+}
@@ -0,0 +1,109 @@
+package inject
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	"github.com/hanwen/go-fuse/fuse"
+	log "github.com/sirupsen/logrus"
+)
+
+// DelayHook sleeps for Delay before reads, writes, opens and getattrs of the paths matching
+// one of Paths, then lets the real operation run. The delays in progress end when the mount
+// stops, so that hookfs.HookFs.Unmount does not wait for them.
+//
+// DelayHook implements hookfs.HookWithInit, hookfs.HookWithStop, hookfs.HookOnRead,
+// hookfs.HookOnWrite, hookfs.HookOnOpen and hookfs.HookOnGetAttr.
+type DelayHook struct {
+	stopper
+
+	// Delay is how long matching operations are delayed.
+	Delay time.Duration
+	// Paths are patterns as for filepath.Match, on paths relative to the original directory.
+	// With no pattern, all the paths are delayed.
+	Paths []string
+	// Context, if set, also ends the delays early once it is done.
+	Context context.Context
+}
+
+// delay sleeps if path matches.
+func (h *DelayHook) delay(op string, path string) {
+	if h.Delay <= 0 || !h.matches(path) {
+		return
+	}
+	log.WithFields(log.Fields{
+		"op":    op,
+		"path":  path,
+		"delay": h.Delay,
+	}).Debug("DelayHook: delaying")
+
+	var done <-chan struct{}
+	if h.Context != nil {
+		done = h.Context.Done()
+	}
+	t := time.NewTimer(h.Delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-done:
+	case <-h.stopped():
+	}
+}
+
+func (h *DelayHook) matches(path string) bool {
+	if len(h.Paths) == 0 {
+		return true
+	}
+	for _, pattern := range h.Paths {
+		if ok, _ := filepath.Match(cleanRel(pattern), cleanRel(path)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// PreRead implements hookfs.HookOnRead
+func (h *DelayHook) PreRead(path string, length int64, offset int64) ([]byte, bool, hookfs.HookContext, error) {
+	h.delay(hookfs.OpRead, path)
+	return nil, false, nil, nil
+}
+
+// PostRead implements hookfs.HookOnRead
+func (h *DelayHook) PostRead(realRetCode int32, realBuf []byte, prehookCtx hookfs.HookContext) ([]byte, bool, error) {
+	return nil, false, nil
+}
+
+// PreWrite implements hookfs.HookOnWrite
+func (h *DelayHook) PreWrite(path string, buf []byte, offset int64) (bool, hookfs.HookContext, error) {
+	h.delay(hookfs.OpWrite, path)
+	return false, nil, nil
+}
+
+// PostWrite implements hookfs.HookOnWrite
+func (h *DelayHook) PostWrite(realRetCode int32, prehookCtx hookfs.HookContext) (uint32, bool, error) {
+	return 0, false, nil
+}
+
+// PreOpen implements hookfs.HookOnOpen
+func (h *DelayHook) PreOpen(path string, flags uint32) (bool, hookfs.HookContext, error) {
+	h.delay(hookfs.OpOpen, path)
+	return false, nil, nil
+}
+
+// PostOpen implements hookfs.HookOnOpen
+func (h *DelayHook) PostOpen(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return false, nil
+}
+
+// PreGetAttr implements hookfs.HookOnGetAttr
+func (h *DelayHook) PreGetAttr(path string) (bool, hookfs.HookContext, error) {
+	h.delay(hookfs.OpGetAttr, path)
+	return false, nil, nil
+}
+
+// PostGetAttr implements hookfs.HookOnGetAttr
+func (h *DelayHook) PostGetAttr(realRetCode int32, realAttr *fuse.Attr, prehookCtx hookfs.HookContext) (*fuse.Attr, bool, error) {
+	return nil, false, nil
+}
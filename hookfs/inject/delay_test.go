@@ -0,0 +1,102 @@
+package inject
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+func TestDelayHookDelaysMatchedReads(t *testing.T) {
+	const delay = 50 * time.Millisecond
+	original := t.TempDir()
+	for _, name := range []string{"slow.db", "fast.txt"} {
+		if err := ioutil.WriteFile(filepath.Join(original, name), []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hook := &DelayHook{Delay: delay, Paths: []string{"*.db"}, Context: ctx}
+	h, err := hookfs.NewHookFs(original, t.TempDir(), hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := func(name string) time.Duration {
+		t.Helper()
+		// the open and getattr are delayed as well, only the read is timed
+		f, code := h.Open(name, syscall.O_RDONLY, &fuse.Context{})
+		if !code.Ok() {
+			t.Fatal(code)
+		}
+		defer f.Release()
+		buf := make([]byte, 4)
+		start := time.Now()
+		if _, code := f.Read(buf, 0); !code.Ok() {
+			t.Fatal(code)
+		}
+		return time.Since(start)
+	}
+
+	if took := read("slow.db"); took < delay {
+		t.Errorf("a matched read took %v, want at least %v", took, delay)
+	}
+	if took := read("fast.txt"); took >= delay {
+		t.Errorf("an unmatched read took %v, want it not delayed", took)
+	}
+
+	hook.Delay = time.Hour
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.GetAttr("slow.db", &fuse.Context{})
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("a delayed getattr went on after the context was canceled")
+	}
+}
+
+func TestDelayHookEndsDelaysOnUnmount(t *testing.T) {
+	original := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(original, "slow"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	hook := &DelayHook{Delay: time.Hour, Paths: []string{"slow"}}
+	h, mnt := mountOriginal(t, original, hook, &hookfs.Options{AttrTimeout: -1, EntryTimeout: -1})
+	stated := make(chan struct{})
+	go func() {
+		defer close(stated)
+		os.Stat(filepath.Join(mnt, "slow"))
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	unmounted := make(chan error, 1)
+	go func() {
+		// the stat being delayed may keep the mount busy for a while
+		err := h.Unmount()
+		for i := 0; err != nil && i < 100; i++ {
+			time.Sleep(10 * time.Millisecond)
+			err = h.Unmount()
+		}
+		unmounted <- err
+	}()
+	select {
+	case err := <-unmounted:
+		if err != nil {
+			t.Fatalf("Unmount: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Unmount waited for a delayed stat")
+	}
+	<-stated
+}
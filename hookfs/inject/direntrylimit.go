@@ -0,0 +1,265 @@
+package inject
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	log "github.com/sirupsen/logrus"
+)
+
+// DirEntryLimitHook caps the number of entries per directory: once a directory holds Limit
+// entries, Create, Mkdir, Mknod, Symlink, Link and Rename into it fail with ENOSPC.
+//
+// The count of a directory is read from Original the first time it is needed, then maintained
+// from the operations going through the mount. Entries added or removed directly in Original
+// afterwards are not seen until Reset.
+//
+// DirEntryLimitHook implements hookfs.HookOnCreate, hookfs.HookOnMkdir, hookfs.HookOnMknod,
+// hookfs.HookOnSymlink, hookfs.HookOnLink, hookfs.HookOnRename, hookfs.HookOnUnlink and
+// hookfs.HookOnRmdir.
+type DirEntryLimitHook struct {
+	// Original is the original directory of the mount.
+	Original string
+
+	mu     sync.Mutex
+	limit  int
+	counts map[string]int
+}
+
+// entryDelta is the change to the counts an operation makes if it succeeds.
+// An entry is reserved in the prehook, so that concurrent operations can't overshoot the limit,
+// and given back in the posthook if the operation fails.
+type entryDelta struct {
+	added   bool
+	addDir  string
+	removed bool
+	rmDir   string
+	moved   []string // paths of directories whose counts go stale
+}
+
+// NewDirEntryLimitHook creates a DirEntryLimitHook allowing limit entries per directory
+// of original.
+func NewDirEntryLimitHook(original string, limit int) *DirEntryLimitHook {
+	return &DirEntryLimitHook{
+		Original: original,
+		limit:    limit,
+		counts:   make(map[string]int),
+	}
+}
+
+// Limit returns the maximum number of entries per directory.
+func (h *DirEntryLimitHook) Limit() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.limit
+}
+
+// SetLimit changes the maximum number of entries per directory.
+// Directories already over the new limit keep their entries, but get no more.
+func (h *DirEntryLimitHook) SetLimit(limit int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.limit = limit
+}
+
+// Reset forgets all the counts, so they are read from Original again.
+func (h *DirEntryLimitHook) Reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.counts = make(map[string]int)
+}
+
+// count returns the number of entries in dir. h.mu must be held.
+func (h *DirEntryLimitHook) count(dir string) (int, error) {
+	if n, ok := h.counts[dir]; ok {
+		return n, nil
+	}
+	f, err := os.Open(filepath.Join(h.Original, dir))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	names, err := f.Readdirnames(-1)
+	if err != nil {
+		return 0, err
+	}
+	h.counts[dir] = len(names)
+	return len(names), nil
+}
+
+// reserve takes an entry in the parent of path for op. h.mu must be held.
+func (h *DirEntryLimitHook) reserve(op string, path string, delta *entryDelta) error {
+	if _, err := os.Lstat(filepath.Join(h.Original, path)); err == nil {
+		// replaces an existing entry, or fails with EEXIST
+		return nil
+	}
+	dir := parentRel(path)
+	n, err := h.count(dir)
+	if err != nil {
+		// let the real operation report the error
+		return nil
+	}
+	if n >= h.limit {
+		log.WithFields(log.Fields{
+			"op":    op,
+			"path":  path,
+			"limit": h.limit,
+		}).Debug("DirEntryLimitHook: returning ENOSPC")
+		return syscall.ENOSPC
+	}
+	h.counts[dir]++
+	delta.added = true
+	delta.addDir = dir
+	return nil
+}
+
+func (h *DirEntryLimitHook) preAdd(op string, path string) (bool, hookfs.HookContext, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delta := &entryDelta{}
+	if err := h.reserve(op, cleanRel(path), delta); err != nil {
+		return true, nil, err
+	}
+	return false, delta, nil
+}
+
+func (h *DirEntryLimitHook) preRemove(path string, dir bool) (bool, hookfs.HookContext, error) {
+	path = cleanRel(path)
+	delta := &entryDelta{
+		removed: true,
+		rmDir:   parentRel(path),
+	}
+	if dir {
+		delta.moved = []string{path}
+	}
+	return false, delta, nil
+}
+
+func (h *DirEntryLimitHook) post(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	delta, ok := prehookCtx.(*entryDelta)
+	if !ok {
+		return false, nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if realRetCode != 0 {
+		if _, ok := h.counts[delta.addDir]; delta.added && ok {
+			h.counts[delta.addDir]--
+		}
+		return false, nil
+	}
+	if _, ok := h.counts[delta.rmDir]; delta.removed && ok {
+		h.counts[delta.rmDir]--
+	}
+	for _, moved := range delta.moved {
+		for dir := range h.counts {
+			if dir == moved || strings.HasPrefix(dir, moved+"/") {
+				delete(h.counts, dir)
+			}
+		}
+	}
+	return false, nil
+}
+
+// PreCreate implements hookfs.HookOnCreate
+func (h *DirEntryLimitHook) PreCreate(name string, flags uint32, mode uint32) (bool, hookfs.HookContext, error) {
+	return h.preAdd(hookfs.OpCreate, name)
+}
+
+// PostCreate implements hookfs.HookOnCreate
+func (h *DirEntryLimitHook) PostCreate(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return h.post(realRetCode, prehookCtx)
+}
+
+// PreMkdir implements hookfs.HookOnMkdir
+func (h *DirEntryLimitHook) PreMkdir(path string, mode uint32) (bool, hookfs.HookContext, error) {
+	return h.preAdd(hookfs.OpMkdir, path)
+}
+
+// PostMkdir implements hookfs.HookOnMkdir
+func (h *DirEntryLimitHook) PostMkdir(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return h.post(realRetCode, prehookCtx)
+}
+
+// PreMknod implements hookfs.HookOnMknod
+func (h *DirEntryLimitHook) PreMknod(name string, mode uint32, dev uint32) (bool, hookfs.HookContext, error) {
+	return h.preAdd(hookfs.OpMknod, name)
+}
+
+// PostMknod implements hookfs.HookOnMknod
+func (h *DirEntryLimitHook) PostMknod(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return h.post(realRetCode, prehookCtx)
+}
+
+// PreSymlink implements hookfs.HookOnSymlink
+func (h *DirEntryLimitHook) PreSymlink(value string, linkName string) (bool, hookfs.HookContext, error) {
+	return h.preAdd(hookfs.OpSymlink, linkName)
+}
+
+// PostSymlink implements hookfs.HookOnSymlink
+func (h *DirEntryLimitHook) PostSymlink(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return h.post(realRetCode, prehookCtx)
+}
+
+// PreLink implements hookfs.HookOnLink
+func (h *DirEntryLimitHook) PreLink(oldName string, newName string) (bool, hookfs.HookContext, error) {
+	return h.preAdd(hookfs.OpLink, newName)
+}
+
+// PostLink implements hookfs.HookOnLink
+func (h *DirEntryLimitHook) PostLink(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return h.post(realRetCode, prehookCtx)
+}
+
+// PreRename implements hookfs.HookOnRename
+func (h *DirEntryLimitHook) PreRename(oldName string, newName string) (bool, hookfs.HookContext, error) {
+	oldName, newName = cleanRel(oldName), cleanRel(newName)
+	delta := &entryDelta{moved: []string{oldName, newName}}
+	if parentRel(oldName) == parentRel(newName) {
+		// the directory loses an entry only when newName is replaced
+		if _, err := os.Lstat(filepath.Join(h.Original, newName)); err == nil && oldName != newName {
+			delta.removed = true
+			delta.rmDir = parentRel(oldName)
+		}
+		return false, delta, nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.reserve(hookfs.OpRename, newName, delta); err != nil {
+		return true, nil, err
+	}
+	delta.removed = true
+	delta.rmDir = parentRel(oldName)
+	return false, delta, nil
+}
+
+// PostRename implements hookfs.HookOnRename
+func (h *DirEntryLimitHook) PostRename(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return h.post(realRetCode, prehookCtx)
+}
+
+// PreUnlink implements hookfs.HookOnUnlink
+func (h *DirEntryLimitHook) PreUnlink(name string) (bool, hookfs.HookContext, error) {
+	return h.preRemove(name, false)
+}
+
+// PostUnlink implements hookfs.HookOnUnlink
+func (h *DirEntryLimitHook) PostUnlink(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return h.post(realRetCode, prehookCtx)
+}
+
+// PreRmdir implements hookfs.HookOnRmdir
+func (h *DirEntryLimitHook) PreRmdir(path string) (bool, hookfs.HookContext, error) {
+	return h.preRemove(path, true)
+}
+
+// PostRmdir implements hookfs.HookOnRmdir
+func (h *DirEntryLimitHook) PostRmdir(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return h.post(realRetCode, prehookCtx)
+}
@@ -0,0 +1,48 @@
+package inject
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestDirEntryLimitHook(t *testing.T) {
+	const limit = 3
+	original := t.TempDir()
+	hook := NewDirEntryLimitHook(original, limit)
+	_, mnt := mountOriginal(t, original, hook, nil)
+	if err := os.Mkdir(filepath.Join(mnt, "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	create := func(name string) error {
+		return ioutil.WriteFile(filepath.Join(mnt, "dir", name), nil, 0644)
+	}
+	for i := 0; i < limit; i++ {
+		if err := create(string(rune('a' + i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := create("full"); !errors.Is(err, syscall.ENOSPC) {
+		t.Errorf("create in a full directory = %v, want ENOSPC", err)
+	}
+	if err := os.Mkdir(filepath.Join(mnt, "dir", "sub"), 0755); !errors.Is(err, syscall.ENOSPC) {
+		t.Errorf("mkdir in a full directory = %v, want ENOSPC", err)
+	}
+	if err := create("a"); err != nil {
+		t.Errorf("rewriting an existing entry of a full directory: %v", err)
+	}
+
+	if err := os.Remove(filepath.Join(mnt, "dir", "a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := create("room"); err != nil {
+		t.Errorf("create after an unlink: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(mnt, "elsewhere"), nil, 0644); err != nil {
+		t.Errorf("create in another directory: %v", err)
+	}
+}
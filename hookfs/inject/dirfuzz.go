@@ -0,0 +1,91 @@
+package inject
+
+import (
+	"math/rand"
+	"strings"
+	"sync"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	"github.com/hanwen/go-fuse/fuse"
+	log "github.com/sirupsen/logrus"
+)
+
+// fuzzNames are the synthetic entries injected by DirFuzzHook.
+// They are all valid on Linux: no '/', no NUL, and at most NAME_MAX bytes.
+var fuzzNames = []string{
+	"hookfs\nfuzz",
+	"hookfs\tfuzz ",
+	" hookfs-fuzz",
+	"-hookfs-fuzz",
+	"hookfs-\xff\xfe-fuzz",
+	"hookfs-\xc3\x28-fuzz",
+	strings.Repeat("f", 255),
+}
+
+// DirFuzzHook mixes entries with unusual names (embedded newlines and tabs, leading spaces
+// and dashes, invalid UTF-8, names of NAME_MAX bytes) into directory listings, for fuzzing
+// tools that assume well-formed names.
+//
+// Each listing gets the synthetic entries with probability Rate, at random positions among
+// the real ones. The synthetic entries exist only in listings: looking them up fails with ENOENT.
+//
+// DirFuzzHook implements hookfs.HookOnOpenDirWithEntries.
+type DirFuzzHook struct {
+	mu   sync.Mutex
+	rate float64
+	rnd  *rand.Rand
+}
+
+// NewDirFuzzHook creates a DirFuzzHook injecting into a listing with probability rate (0 to 1),
+// drawing from a generator seeded with seed.
+func NewDirFuzzHook(rate float64, seed int64) *DirFuzzHook {
+	return &DirFuzzHook{
+		rate: rate,
+		rnd:  rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Rate returns the probability that a listing gets synthetic entries.
+func (h *DirFuzzHook) Rate() float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.rate
+}
+
+// SetRate changes the probability that a listing gets synthetic entries.
+func (h *DirFuzzHook) SetRate(rate float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.rate = rate
+}
+
+// PreOpenDir implements hookfs.HookOnOpenDirWithEntries
+func (h *DirFuzzHook) PreOpenDir(path string) (bool, hookfs.HookContext, error) {
+	return false, path, nil
+}
+
+// PostOpenDirWithEntries implements hookfs.HookOnOpenDirWithEntries
+func (h *DirFuzzHook) PostOpenDirWithEntries(realRetCode int32, realEntries []fuse.DirEntry, prehookCtx hookfs.HookContext) ([]fuse.DirEntry, bool, error) {
+	if realRetCode != 0 {
+		return nil, false, nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.rnd.Float64() >= h.rate {
+		return nil, false, nil
+	}
+
+	entries := make([]fuse.DirEntry, 0, len(realEntries)+len(fuzzNames))
+	entries = append(entries, realEntries...)
+	for _, name := range fuzzNames {
+		entries = append(entries, fuse.DirEntry{Name: name, Mode: fuse.S_IFREG})
+		i := h.rnd.Intn(len(entries))
+		entries[i], entries[len(entries)-1] = entries[len(entries)-1], entries[i]
+	}
+	log.WithFields(log.Fields{
+		"path":    prehookCtx,
+		"entries": len(fuzzNames),
+	}).Debug("DirFuzzHook: injecting synthetic entries")
+	return entries, true, nil
+}
@@ -0,0 +1,37 @@
+package inject
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDirFuzzHookInjectsEntries(t *testing.T) {
+	_, original, mnt := mount(t, NewDirFuzzHook(1, 1), nil)
+	if err := ioutil.WriteFile(filepath.Join(original, "real"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := os.Open(mnt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, err := dir.Readdirnames(-1)
+	dir.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	listed := make(map[string]bool)
+	for _, name := range names {
+		listed[name] = true
+	}
+	for _, name := range append([]string{"real"}, fuzzNames...) {
+		if !listed[name] {
+			t.Errorf("%q is not listed", name)
+		}
+	}
+	if _, err := os.Lstat(filepath.Join(mnt, fuzzNames[0])); !os.IsNotExist(err) {
+		t.Errorf("stat of a synthetic entry = %v, want ENOENT", err)
+	}
+}
@@ -0,0 +1,202 @@
+package inject
+
+import (
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	log "github.com/sirupsen/logrus"
+)
+
+// HandlePolicy is what becomes of the handles open when a DisconnectHook disconnects.
+type HandlePolicy int
+
+const (
+	// HandlesSurvive lets handles opened before a disconnection work again after reconnection.
+	HandlesSurvive HandlePolicy = iota
+	// HandlesStale makes handles opened before a disconnection fail with ESTALE for good,
+	// as on an NFS client whose server lost its state. They can only be released.
+	HandlesStale
+)
+
+// handleOps are the operations made on an open handle.
+var handleOps = map[string]bool{
+	hookfs.OpRead:     true,
+	hookfs.OpWrite:    true,
+	hookfs.OpFsync:    true,
+	hookfs.OpFlush:    true,
+	hookfs.OpAllocate: true,
+	hookfs.OpGetLk:    true,
+	hookfs.OpSetLk:    true,
+	hookfs.OpSetLkw:   true,
+}
+
+// DisconnectHook models a network filesystem losing its server: while disconnected, every
+// operation fails with an errno, typically EIO or ESTALE, then everything works again on
+// reconnection, except for the handles made stale by HandlesStale. Release cannot fail, and
+// goes through even while disconnected.
+//
+// Handles are tracked by path: with HandlesStale, a file reopened while some of its stale
+// handles are still open is stale as well, until they are all released.
+//
+// DisconnectHook implements all the hookfs.HookOnXXX interfaces.
+type DisconnectHook struct {
+	gate
+	errno  syscall.Errno
+	policy HandlePolicy
+
+	mu sync.Mutex
+	// disconnected until then, or until Reconnect if forever
+	until   time.Time
+	forever bool
+	// handles open and handles stale by path
+	open  map[string]int
+	stale map[string]int
+}
+
+// disconnectHandles tracks the handles open for a DisconnectHook.
+type disconnectHandles struct {
+	h *DisconnectHook
+}
+
+// NewDisconnectHook creates a connected DisconnectHook failing operations with errno
+// while disconnected, and applying policy to the handles open on disconnection.
+func NewDisconnectHook(errno syscall.Errno, policy HandlePolicy) *DisconnectHook {
+	h := &DisconnectHook{
+		errno:  errno,
+		policy: policy,
+		open:   make(map[string]int),
+		stale:  make(map[string]int),
+	}
+	h.pick = h.pickOp
+	return h
+}
+
+// Policy returns what becomes of the handles open on disconnection.
+func (h *DisconnectHook) Policy() HandlePolicy {
+	return h.policy
+}
+
+// Disconnect disconnects for duration, or until Reconnect if duration is 0 or less.
+// Disconnecting while disconnected changes when reconnection happens.
+func (h *DisconnectHook) Disconnect(duration time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.disconnected(time.Now()) && h.policy == HandlesStale {
+		for path, n := range h.open {
+			h.stale[path] = n
+		}
+	}
+	h.forever = duration <= 0
+	h.until = time.Now().Add(duration)
+	log.WithFields(log.Fields{
+		"duration": duration,
+	}).Debug("DisconnectHook: disconnecting")
+}
+
+// Reconnect ends the disconnection right away.
+func (h *DisconnectHook) Reconnect() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.forever = false
+	h.until = time.Time{}
+	log.Debug("DisconnectHook: reconnecting")
+}
+
+// Connected returns whether operations go through.
+func (h *DisconnectHook) Connected() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return !h.disconnected(time.Now())
+}
+
+// disconnected returns whether operations fail at now. h.mu must be held.
+func (h *DisconnectHook) disconnected(now time.Time) bool {
+	return h.forever || now.Before(h.until)
+}
+
+func (h *DisconnectHook) pickOp(op string, path string) (hookfs.Hook, error) {
+	switch op {
+	case hookfs.OpOpen, hookfs.OpCreate, hookfs.OpRelease:
+		if op == hookfs.OpRelease || h.Connected() {
+			return disconnectHandles{h}, nil
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var errno syscall.Errno
+	switch {
+	case h.disconnected(time.Now()):
+		errno = h.errno
+	case handleOps[op] && h.stale[cleanRel(path)] > 0:
+		errno = syscall.ESTALE
+	default:
+		return nil, nil
+	}
+	log.WithFields(log.Fields{
+		"op":    op,
+		"path":  path,
+		"errno": errno,
+	}).Debug("DisconnectHook: injecting")
+	return nil, errno
+}
+
+// opened counts a handle on the path of prehookCtx if the open succeeded.
+func (d disconnectHandles) opened(realRetCode int32, prehookCtx hookfs.HookContext) {
+	path, ok := prehookCtx.(string)
+	if !ok || realRetCode != 0 {
+		return
+	}
+	d.h.mu.Lock()
+	defer d.h.mu.Unlock()
+	d.h.open[path]++
+}
+
+// PreOpen implements hookfs.HookOnOpen
+func (d disconnectHandles) PreOpen(path string, flags uint32) (bool, hookfs.HookContext, error) {
+	return false, cleanRel(path), nil
+}
+
+// PostOpen implements hookfs.HookOnOpen
+func (d disconnectHandles) PostOpen(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	d.opened(realRetCode, prehookCtx)
+	return false, nil
+}
+
+// PreCreate implements hookfs.HookOnCreate
+func (d disconnectHandles) PreCreate(name string, flags uint32, mode uint32) (bool, hookfs.HookContext, error) {
+	return false, cleanRel(name), nil
+}
+
+// PostCreate implements hookfs.HookOnCreate
+func (d disconnectHandles) PostCreate(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	d.opened(realRetCode, prehookCtx)
+	return false, nil
+}
+
+// PreRelease implements hookfs.HookOnRelease
+func (d disconnectHandles) PreRelease(path string) (bool, hookfs.HookContext) {
+	path = cleanRel(path)
+	d.h.mu.Lock()
+	defer d.h.mu.Unlock()
+	if d.h.open[path] > 0 {
+		d.h.open[path]--
+		if d.h.open[path] == 0 {
+			delete(d.h.open, path)
+		}
+	}
+	if d.h.stale[path] > 0 {
+		d.h.stale[path]--
+		if d.h.stale[path] == 0 {
+			delete(d.h.stale, path)
+		}
+	}
+	return false, nil
+}
+
+// PostRelease implements hookfs.HookOnRelease
+func (d disconnectHandles) PostRelease(prehookCtx hookfs.HookContext) bool {
+	return false
+}
@@ -0,0 +1,62 @@
+package inject
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ethercflow/hookfs/hookfs"
+)
+
+func TestDisconnectHookRecovers(t *testing.T) {
+	for _, tt := range []struct {
+		policy HandlePolicy
+		// the error of a handle opened before the disconnection, after reconnection
+		want error
+	}{
+		{HandlesSurvive, nil},
+		{HandlesStale, syscall.ESTALE},
+	} {
+		hook := NewDisconnectHook(syscall.EIO, tt.policy)
+		_, original, mnt := mount(t, hook, &hookfs.Options{DirectIO: true, AttrTimeout: -1, EntryTimeout: -1})
+		if err := ioutil.WriteFile(filepath.Join(original, "file"), []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Open(filepath.Join(mnt, "file"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, 4)
+
+		hook.Disconnect(0)
+		if _, err := os.Stat(filepath.Join(mnt, "file")); !errors.Is(err, syscall.EIO) {
+			t.Errorf("policy %d: stat while disconnected = %v, want EIO", tt.policy, err)
+		}
+		if _, err := f.ReadAt(buf, 0); !errors.Is(err, syscall.EIO) {
+			t.Errorf("policy %d: read while disconnected = %v, want EIO", tt.policy, err)
+		}
+
+		hook.Reconnect()
+		if _, err := os.Stat(filepath.Join(mnt, "file")); err != nil {
+			t.Errorf("policy %d: stat after reconnection = %v, want success", tt.policy, err)
+		}
+		if _, err := f.ReadAt(buf, 0); !errors.Is(err, tt.want) {
+			t.Errorf("policy %d: read of an old handle after reconnection = %v, want %v", tt.policy, err, tt.want)
+		}
+		f.Close()
+		// the stale handle is released in the background
+		for i := 0; i < 100; i++ {
+			if _, err = ioutil.ReadFile(filepath.Join(mnt, "file")); err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err != nil {
+			t.Errorf("policy %d: read of a new handle = %v, want success", tt.policy, err)
+		}
+	}
+}
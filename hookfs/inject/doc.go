@@ -0,0 +1,4 @@
+// Package inject provides ready-made hookfs hooks for common fault injection scenarios.
+//
+// Hooks are plain values; pass one to hookfs.NewHookFs like any user-written hook.
+package inject
@@ -0,0 +1,86 @@
+package inject
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+
+	"github.com/ethercflow/hookfs/hookfs"
+)
+
+// EncryptionHook encrypts file contents at rest, to test applications and tools against
+// a backend storing ciphertext: writes are encrypted in place before the real write stores
+// them, and reads are decrypted before they are returned. The cipher is AES in CTR mode,
+// which keeps offsets and sizes the same in the mount and in Original. Hooks after it in a
+// hookfs.HookChain see the ciphertext of writes.
+//
+// The keystream of a file depends on its path and the offset only: the first 8 bytes of the
+// SHA-256 of the path passed to hooks are the nonce, and the counter is the offset divided by
+// the AES block size, so that any range can be encrypted or decrypted on its own.
+// This is for testing only, not real protection:
+//
+//   - Rewriting a range reuses its keystream, so comparing the ciphertexts of two versions
+//     reveals the XOR of the plaintexts.
+//   - Renaming or hard-linking a file changes the keystream its content is read with, which
+//     comes back as garbage under the new name. So do holes and the zeros that truncate adds.
+//   - Nothing is authenticated: changes of the ciphertext go undetected.
+//
+// EncryptionHook implements hookfs.HookOnRead and hookfs.HookOnWrite.
+type EncryptionHook struct {
+	block cipher.Block
+}
+
+type encryptionCtx struct {
+	path   string
+	offset int64
+}
+
+// NewEncryptionHook creates an EncryptionHook with an AES key of 16, 24 or 32 bytes.
+func NewEncryptionHook(key []byte) (*EncryptionHook, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return &EncryptionHook{block: block}, nil
+}
+
+// xor returns data encrypted, or decrypted, as found at offset in the file at path.
+func (h *EncryptionHook) xor(path string, offset int64, data []byte) []byte {
+	sum := sha256.Sum256([]byte(cleanRel(path)))
+	iv := make([]byte, aes.BlockSize)
+	copy(iv, sum[:8])
+	binary.BigEndian.PutUint64(iv[8:], uint64(offset/aes.BlockSize))
+
+	// start at the beginning of the block offset is in
+	skip := int(offset % aes.BlockSize)
+	buf := make([]byte, skip+len(data))
+	copy(buf[skip:], data)
+	cipher.NewCTR(h.block, iv).XORKeyStream(buf, buf)
+	return buf[skip:]
+}
+
+// PreRead implements hookfs.HookOnRead
+func (h *EncryptionHook) PreRead(path string, length int64, offset int64) ([]byte, bool, hookfs.HookContext, error) {
+	return nil, false, &encryptionCtx{path: path, offset: offset}, nil
+}
+
+// PostRead implements hookfs.HookOnRead
+func (h *EncryptionHook) PostRead(realRetCode int32, realBuf []byte, prehookCtx hookfs.HookContext) ([]byte, bool, error) {
+	ctx, ok := prehookCtx.(*encryptionCtx)
+	if !ok || realRetCode != 0 {
+		return nil, false, nil
+	}
+	return h.xor(ctx.path, ctx.offset, realBuf), true, nil
+}
+
+// PreWrite implements hookfs.HookOnWrite
+func (h *EncryptionHook) PreWrite(path string, buf []byte, offset int64) (bool, hookfs.HookContext, error) {
+	copy(buf, h.xor(path, offset, buf))
+	return false, nil, nil
+}
+
+// PostWrite implements hookfs.HookOnWrite
+func (h *EncryptionHook) PostWrite(realRetCode int32, prehookCtx hookfs.HookContext) (uint32, bool, error) {
+	return 0, false, nil
+}
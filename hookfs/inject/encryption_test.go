@@ -0,0 +1,51 @@
+package inject
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethercflow/hookfs/hookfs"
+)
+
+func TestEncryptionHookStoresCiphertext(t *testing.T) {
+	hook, err := NewEncryptionHook(bytes.Repeat([]byte("k"), 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, original, mnt := mount(t, hook, &hookfs.Options{DirectIO: true})
+	plaintext := []byte("attack at dawn, not a byte later than agreed")
+
+	check := func(original string, name string) {
+		t.Helper()
+		if err := ioutil.WriteFile(filepath.Join(mnt, name), plaintext, 0644); err != nil {
+			t.Fatal(err)
+		}
+		read, err := ioutil.ReadFile(filepath.Join(mnt, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(read, plaintext) {
+			t.Errorf("read %q back from %s, want %q", read, name, plaintext)
+		}
+		stored, err := ioutil.ReadFile(filepath.Join(original, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(stored) != len(plaintext) || bytes.Equal(stored, plaintext) {
+			t.Errorf("stored %q for %s, want ciphertext of the same size", stored, name)
+		}
+		if decrypted := hook.xor(name, 0, stored); !bytes.Equal(decrypted, plaintext) {
+			t.Errorf("stored %s decrypts to %q, want %q", name, decrypted, plaintext)
+		}
+	}
+	check(original, "file")
+
+	// the writes go wherever the HookFs does
+	moved := t.TempDir()
+	if err := h.SetOriginal(moved); err != nil {
+		t.Fatal(err)
+	}
+	check(moved, "moved")
+}
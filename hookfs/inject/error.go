@@ -0,0 +1,131 @@
+package inject
+
+import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"sync"
+	"syscall"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrorHook fails the given operations (hookfs.OpRead, hookfs.OpOpen, ...) on the paths
+// matching a pattern with an errno, while everything else passes through. For operations on
+// two paths, such as rename, the first one is matched. Matching operations fail with a
+// probability, drawing from a generator, so that runs with the same seed fail the same
+// operations as long as they are issued in the same order.
+//
+// Create it with NewErrorHook: the zero value injects nothing.
+//
+// ErrorHook implements all the hookfs.HookOnXXX interfaces.
+type ErrorHook struct {
+	gate
+	pattern string
+	errno   syscall.Errno
+	ops     []string
+
+	mu          sync.Mutex // guards probability and rnd
+	probability float64
+	rnd         *rand.Rand
+}
+
+// NewErrorHook creates an ErrorHook failing ops on the paths matching pattern with errno,
+// always, drawing from a generator seeded with 1 if the probability is lowered. pattern is
+// as for filepath.Match, on paths relative to the original directory; an empty pattern
+// matches every path. With no op, all the operations fail. errno must not be 0, which would
+// make the operations succeed without being performed.
+func NewErrorHook(pattern string, errno syscall.Errno, ops ...string) (*ErrorHook, error) {
+	if errno == 0 {
+		return nil, fmt.Errorf("ErrorHook: errno must not be 0")
+	}
+	if _, err := filepath.Match(cleanRel(pattern), ""); err != nil {
+		return nil, fmt.Errorf("ErrorHook: pattern %q: %v", pattern, err)
+	}
+	h := &ErrorHook{
+		pattern:     pattern,
+		errno:       errno,
+		ops:         append([]string(nil), ops...),
+		probability: 1,
+		rnd:         rand.New(rand.NewSource(1)),
+	}
+	h.pick = func(op string, path string) (hookfs.Hook, error) {
+		if !h.matches(op, path) || !h.roll() {
+			return nil, nil
+		}
+		log.WithFields(log.Fields{
+			"op":    op,
+			"path":  path,
+			"errno": h.errno,
+		}).Debug("ErrorHook: injecting")
+		return nil, h.errno
+	}
+	return h, nil
+}
+
+// Pattern returns the pattern selecting the paths to fail.
+func (h *ErrorHook) Pattern() string {
+	return h.pattern
+}
+
+// Errno returns the errno the operations fail with.
+func (h *ErrorHook) Errno() syscall.Errno {
+	return h.errno
+}
+
+// Ops returns the operations to fail, none meaning all of them.
+func (h *ErrorHook) Ops() []string {
+	return append([]string(nil), h.ops...)
+}
+
+// Probability returns the probability that a matching operation fails.
+func (h *ErrorHook) Probability() float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.probability
+}
+
+// SetProbability changes the probability that a matching operation fails, from 0 to 1.
+func (h *ErrorHook) SetProbability(probability float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.probability = probability
+}
+
+// SetRand changes the generator drawn from when the probability is less than 1.
+func (h *ErrorHook) SetRand(rnd *rand.Rand) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.rnd = rnd
+}
+
+// roll returns whether a matching operation fails.
+func (h *ErrorHook) roll() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.probability >= 1 {
+		return true
+	}
+	if h.probability <= 0 {
+		return false
+	}
+	return h.rnd.Float64() < h.probability
+}
+
+func (h *ErrorHook) matches(op string, path string) bool {
+	if h.pattern != "" {
+		if ok, _ := filepath.Match(cleanRel(h.pattern), cleanRel(path)); !ok {
+			return false
+		}
+	}
+	if len(h.ops) == 0 {
+		return true
+	}
+	for _, o := range h.ops {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
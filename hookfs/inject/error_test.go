@@ -0,0 +1,116 @@
+package inject
+
+import (
+	"errors"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+// newErrorHook creates an ErrorHook, failing the test if it cannot.
+func newErrorHook(t *testing.T, pattern string, errno syscall.Errno, ops ...string) *ErrorHook {
+	t.Helper()
+	h, err := NewErrorHook(pattern, errno, ops...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func TestErrorHookFailsMatchedOpens(t *testing.T) {
+	hook := newErrorHook(t, "*.db", syscall.EIO, hookfs.OpRead, hookfs.OpOpen)
+	_, original, mnt := mount(t, hook, &hookfs.Options{DirectIO: true, AttrTimeout: -1, EntryTimeout: -1})
+	for _, name := range []string{"data.db", "notes.txt"} {
+		if err := ioutil.WriteFile(filepath.Join(original, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if f, err := os.Open(filepath.Join(mnt, "data.db")); !errors.Is(err, syscall.EIO) {
+		if err == nil {
+			f.Close()
+		}
+		t.Errorf("open of a matched file: %v, want EIO", err)
+	}
+	// other operations on matched files pass through
+	if _, err := os.Stat(filepath.Join(mnt, "data.db")); err != nil {
+		t.Errorf("stat of a matched file: %v", err)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(mnt, "notes.txt")); err != nil || string(data) != "notes.txt" {
+		t.Errorf("read %q, %v from an unmatched file", data, err)
+	}
+}
+
+func TestErrorHookProbability(t *testing.T) {
+	original := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(original, "file"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	hook := newErrorHook(t, "", syscall.EIO, hookfs.OpGetAttr)
+	h, err := hookfs.NewHookFs(original, t.TempDir(), hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	failures := func(seed int64, probability float64) []bool {
+		t.Helper()
+		hook.SetProbability(probability)
+		hook.SetRand(rand.New(rand.NewSource(seed)))
+		var failed []bool
+		for i := 0; i < 100; i++ {
+			_, code := h.GetAttr("file", &fuse.Context{})
+			if !code.Ok() && code != fuse.EIO {
+				t.Fatalf("getattr: %v, want EIO or success", code)
+			}
+			failed = append(failed, !code.Ok())
+		}
+		return failed
+	}
+	count := func(failed []bool) (n int) {
+		for _, f := range failed {
+			if f {
+				n++
+			}
+		}
+		return n
+	}
+
+	if n := count(failures(1, 0)); n != 0 {
+		t.Errorf("%d getattrs failed with Probability 0, want none", n)
+	}
+	if n := count(failures(1, 1)); n != 100 {
+		t.Errorf("%d getattrs failed with Probability 1, want all 100", n)
+	}
+	half := failures(1, 0.5)
+	if n := count(half); n == 0 || n == 100 {
+		t.Errorf("%d getattrs failed with Probability 0.5, want some", n)
+	}
+	if again := failures(1, 0.5); !reflect.DeepEqual(again, half) {
+		t.Error("the same seed failed other getattrs, want the same ones")
+	}
+}
+
+func TestNewErrorHookRejectsInvalidArguments(t *testing.T) {
+	if _, err := NewErrorHook("", 0, hookfs.OpOpen); err == nil {
+		t.Error("errno 0 accepted, want an error")
+	}
+	if _, err := NewErrorHook("[", syscall.EIO); err == nil {
+		t.Error("malformed pattern accepted, want an error")
+	}
+}
+
+func TestZeroErrorHookPassesThrough(t *testing.T) {
+	_, original, mnt := mount(t, &ErrorHook{}, nil)
+	if err := ioutil.WriteFile(filepath.Join(original, "file"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(mnt, "file")); err != nil || string(data) != "data" {
+		t.Errorf("read %q, %v through a zero ErrorHook, want %q", data, err, "data")
+	}
+}
@@ -0,0 +1,60 @@
+package inject
+
+import (
+	"sync/atomic"
+	"syscall"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	log "github.com/sirupsen/logrus"
+)
+
+// FaultHook fails every operation of one category with an errno, e.g. all metadata operations
+// while reads and writes keep working, or the other way around.
+//
+// FaultHook implements all the hookfs.HookOnXXX interfaces.
+type FaultHook struct {
+	gate
+	category Category
+	errno    syscall.Errno
+	enabled  int32
+}
+
+// NewFaultHook creates an enabled FaultHook failing operations of category with errno.
+func NewFaultHook(category Category, errno syscall.Errno) *FaultHook {
+	h := &FaultHook{
+		category: category,
+		errno:    errno,
+		enabled:  1,
+	}
+	h.pick = func(op string, path string) (hookfs.Hook, error) {
+		if atomic.LoadInt32(&h.enabled) == 0 || CategoryOf(op) != h.category {
+			return nil, nil
+		}
+		log.WithFields(log.Fields{
+			"op":    op,
+			"path":  path,
+			"errno": h.errno,
+		}).Debug("FaultHook: injecting")
+		return nil, h.errno
+	}
+	return h
+}
+
+// NewMetadataFaultHook creates a FaultHook failing metadata operations with errno.
+func NewMetadataFaultHook(errno syscall.Errno) *FaultHook {
+	return NewFaultHook(Metadata, errno)
+}
+
+// NewDataFaultHook creates a FaultHook failing data operations with errno.
+func NewDataFaultHook(errno syscall.Errno) *FaultHook {
+	return NewFaultHook(Data, errno)
+}
+
+// SetEnabled turns injection on or off. It is safe to call while mounted.
+func (h *FaultHook) SetEnabled(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&h.enabled, v)
+}
@@ -0,0 +1,56 @@
+package inject
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/ethercflow/hookfs/hookfs"
+)
+
+func TestFaultHookCategories(t *testing.T) {
+	for _, tc := range []struct {
+		name              string
+		hook              *FaultHook
+		metadata, reading error
+	}{
+		{"metadata", NewMetadataFaultHook(syscall.EIO), syscall.EIO, nil},
+		{"data", NewDataFaultHook(syscall.EIO), nil, syscall.EIO},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.hook.SetEnabled(false)
+			_, original, mnt := mount(t, tc.hook, &hookfs.Options{DirectIO: true, AttrTimeout: -1, EntryTimeout: -1})
+			if err := ioutil.WriteFile(filepath.Join(original, "file"), []byte("data"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			// opened before, as looking the file up is metadata
+			f, err := os.Open(filepath.Join(mnt, "file"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			tc.hook.SetEnabled(true)
+
+			if _, err := f.ReadAt(make([]byte, 4), 0); !errors.Is(err, tc.reading) {
+				t.Errorf("read = %v, want %v", err, tc.reading)
+			}
+			for what, err := range map[string]error{
+				"stat":  stat(filepath.Join(mnt, "file")),
+				"mkdir": os.Mkdir(filepath.Join(mnt, "dir"), 0755),
+				"chmod": os.Chmod(filepath.Join(mnt, "file"), 0600),
+			} {
+				if !errors.Is(err, tc.metadata) {
+					t.Errorf("%s = %v, want %v", what, err, tc.metadata)
+				}
+			}
+		})
+	}
+}
+
+func stat(path string) error {
+	_, err := os.Stat(path)
+	return err
+}
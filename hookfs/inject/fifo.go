@@ -0,0 +1,107 @@
+package inject
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ethercflow/hookfs/hookfs"
+)
+
+// FIFOHook queues every operation and releases them one by one, strictly in arrival order,
+// at Rate operations per second, like a backend serving requests in order. This shows whether
+// an application starves some of its operations under a slow, fair backend, which a random
+// delay per operation would not, as it reorders them.
+//
+// Operations are released in order, then run concurrently. Release cannot be delayed without
+// holding up the kernel, so it is not queued.
+//
+// FIFOHook implements all the hookfs.HookOnXXX interfaces.
+type FIFOHook struct {
+	gate
+
+	mu   sync.Mutex
+	cond *sync.Cond
+	rate float64
+	// next is the ticket of the next operation to arrive, serving the one of the next to go
+	next, serving uint64
+	// last is when the last operation queued is released
+	last     time.Time
+	depth    int
+	maxDepth int
+}
+
+// NewFIFOHook creates a FIFOHook releasing rate operations per second.
+// A rate of 0 or less means no queueing.
+func NewFIFOHook(rate float64) *FIFOHook {
+	h := &FIFOHook{rate: rate}
+	h.cond = sync.NewCond(&h.mu)
+	h.pick = func(op string, path string) (hookfs.Hook, error) {
+		if op != hookfs.OpRelease {
+			h.wait()
+		}
+		return nil, nil
+	}
+	return h
+}
+
+// Rate returns the number of operations released per second.
+func (h *FIFOHook) Rate() float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.rate
+}
+
+// SetRate changes the number of operations released per second.
+// Operations already queued keep their release time.
+func (h *FIFOHook) SetRate(rate float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.rate = rate
+}
+
+// QueueDepth returns the number of operations waiting to be released.
+func (h *FIFOHook) QueueDepth() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.depth
+}
+
+// MaxQueueDepth returns the largest number of operations that waited at once so far.
+func (h *FIFOHook) MaxQueueDepth() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.maxDepth
+}
+
+// wait blocks until it is the turn of the calling operation.
+func (h *FIFOHook) wait() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.rate <= 0 && h.depth == 0 {
+		return
+	}
+
+	ticket := h.next
+	h.next++
+	release := time.Now()
+	if h.rate > 0 {
+		if at := h.last.Add(time.Duration(float64(time.Second) / h.rate)); at.After(release) {
+			release = at
+		}
+	}
+	h.last = release
+	h.depth++
+	if h.depth > h.maxDepth {
+		h.maxDepth = h.depth
+	}
+
+	h.mu.Unlock()
+	time.Sleep(time.Until(release))
+	h.mu.Lock()
+	for h.serving != ticket {
+		h.cond.Wait()
+	}
+	h.serving++
+	h.depth--
+	h.cond.Broadcast()
+}
@@ -0,0 +1,55 @@
+package inject
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+func TestFIFOHookCompletesInArrivalOrder(t *testing.T) {
+	hook := NewFIFOHook(50)
+	h, err := hookfs.NewHookFs(t.TempDir(), t.TempDir(), hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 6
+	var (
+		mu   sync.Mutex
+		done []string
+		wg   sync.WaitGroup
+		want []string
+	)
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("dir%d", i)
+		want = append(want, name)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if code := h.Mkdir(name, 0755, &fuse.Context{}); !code.Ok() {
+				t.Errorf("mkdir %s = %v", name, code)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			done = append(done, name)
+		}()
+		// each arrives well before it would be served
+		time.Sleep(2 * time.Millisecond)
+	}
+	wg.Wait()
+
+	if !reflect.DeepEqual(done, want) {
+		t.Errorf("completed in order %q, want %q", done, want)
+	}
+	if d := hook.MaxQueueDepth(); d < 2 {
+		t.Errorf("MaxQueueDepth = %d, want operations to have queued", d)
+	}
+	if d := hook.QueueDepth(); d != 0 {
+		t.Errorf("QueueDepth = %d after all completed, want 0", d)
+	}
+}
@@ -0,0 +1,215 @@
+package inject
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	log "github.com/sirupsen/logrus"
+)
+
+// ForensicRecord is a read, write or truncate of a file watched by a ForensicHook.
+type ForensicRecord struct {
+	// Seq orders the records by completion.
+	Seq    uint64
+	Op     string
+	Path   string
+	Offset int64
+	// Length is the length asked for by a read, and the size set by a truncate.
+	Length int64
+	// Data is what a write wrote or a read returned.
+	Data   []byte
+	Status int32
+	Start  time.Time
+	End    time.Time
+}
+
+// ForensicHook records the complete I/O history of some files for post-mortem analysis
+// of data corruption: every write with its data, every read with the data returned, and
+// every truncate, in order of completion, with their timing and status.
+//
+// Records are kept in memory until their data reaches Cap bytes; later ones are counted as
+// dropped, so that the history kept has no holes. If W is set, records are written to it
+// as JSON lines (data in base64) as well, whatever Cap. Hooks are not told which handle an
+// operation goes through, so records have none.
+//
+// ForensicHook implements hookfs.HookOnRead, hookfs.HookOnWrite and hookfs.HookOnTruncate.
+type ForensicHook struct {
+	// W, if set, receives every record as a line of JSON.
+	W io.Writer
+
+	paths map[string]bool
+	cap   int
+
+	mu      sync.Mutex
+	seq     uint64
+	size    int
+	records []ForensicRecord
+	dropped uint64
+}
+
+type forensicCtx struct {
+	record ForensicRecord
+}
+
+// NewForensicHook creates a ForensicHook recording the I/O of paths, keeping at most
+// cap bytes of data in memory.
+func NewForensicHook(cap int, paths ...string) *ForensicHook {
+	h := &ForensicHook{
+		paths: make(map[string]bool),
+		cap:   cap,
+	}
+	for _, path := range paths {
+		h.paths[cleanRel(path)] = true
+	}
+	return h
+}
+
+// Paths returns the paths watched, sorted.
+func (h *ForensicHook) Paths() []string {
+	paths := make([]string, 0, len(h.paths))
+	for path := range h.paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Cap returns the maximum number of bytes of data kept in memory.
+func (h *ForensicHook) Cap() int {
+	return h.cap
+}
+
+// Records returns the records kept in memory, in order.
+func (h *ForensicHook) Records() []ForensicRecord {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]ForensicRecord(nil), h.records...)
+}
+
+// Dropped returns the number of records not kept because of Cap.
+func (h *ForensicHook) Dropped() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.dropped
+}
+
+// Contents replays the successful writes and truncates of path kept in memory over initial,
+// the contents of the file when recording started, and returns the contents they produce.
+func (h *ForensicHook) Contents(path string, initial []byte) []byte {
+	path = cleanRel(path)
+	data := append([]byte(nil), initial...)
+	for _, r := range h.Records() {
+		if r.Path != path || r.Status != 0 {
+			continue
+		}
+		switch r.Op {
+		case hookfs.OpWrite:
+			if end := r.Offset + int64(len(r.Data)); end > int64(len(data)) {
+				data = append(data, make([]byte, end-int64(len(data)))...)
+			}
+			copy(data[r.Offset:], r.Data)
+		case hookfs.OpTruncate:
+			if r.Length <= int64(len(data)) {
+				data = data[:r.Length]
+			} else {
+				data = append(data, make([]byte, r.Length-int64(len(data)))...)
+			}
+		}
+	}
+	return data
+}
+
+// start returns the context of an operation on path, or nil if path is not watched.
+func (h *ForensicHook) start(op string, path string, offset int64, length int64, data []byte) hookfs.HookContext {
+	path = cleanRel(path)
+	if !h.paths[path] {
+		return nil
+	}
+	return &forensicCtx{record: ForensicRecord{
+		Op:     op,
+		Path:   path,
+		Offset: offset,
+		Length: length,
+		Data:   data,
+		Start:  time.Now(),
+	}}
+}
+
+// done records the operation of prehookCtx.
+func (h *ForensicHook) done(realRetCode int32, prehookCtx hookfs.HookContext) {
+	ctx, ok := prehookCtx.(*forensicCtx)
+	if !ok {
+		return
+	}
+	r := ctx.record
+	r.Status = realRetCode
+	r.End = time.Now()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.seq++
+	r.Seq = h.seq
+	if h.W != nil {
+		b, err := json.Marshal(r)
+		if err == nil {
+			b = append(b, '\n')
+			_, err = h.W.Write(b)
+		}
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+			}).Warn("ForensicHook: could not write a record")
+		}
+	}
+	if h.dropped > 0 || h.size+len(r.Data) > h.cap {
+		h.dropped++
+		return
+	}
+	h.size += len(r.Data)
+	h.records = append(h.records, r)
+}
+
+// PreRead implements hookfs.HookOnRead
+func (h *ForensicHook) PreRead(path string, length int64, offset int64) ([]byte, bool, hookfs.HookContext, error) {
+	return nil, false, h.start(hookfs.OpRead, path, offset, length, nil), nil
+}
+
+// PostRead implements hookfs.HookOnRead
+func (h *ForensicHook) PostRead(realRetCode int32, realBuf []byte, prehookCtx hookfs.HookContext) ([]byte, bool, error) {
+	if ctx, ok := prehookCtx.(*forensicCtx); ok {
+		ctx.record.Data = append([]byte(nil), realBuf...)
+	}
+	h.done(realRetCode, prehookCtx)
+	return nil, false, nil
+}
+
+// PreWrite implements hookfs.HookOnWrite
+func (h *ForensicHook) PreWrite(path string, buf []byte, offset int64) (bool, hookfs.HookContext, error) {
+	if !h.paths[cleanRel(path)] {
+		return false, nil, nil
+	}
+	// buf is reused by go-fuse once the write is done
+	data := append([]byte(nil), buf...)
+	return false, h.start(hookfs.OpWrite, path, offset, int64(len(buf)), data), nil
+}
+
+// PostWrite implements hookfs.HookOnWrite
+func (h *ForensicHook) PostWrite(realRetCode int32, prehookCtx hookfs.HookContext) (uint32, bool, error) {
+	h.done(realRetCode, prehookCtx)
+	return 0, false, nil
+}
+
+// PreTruncate implements hookfs.HookOnTruncate
+func (h *ForensicHook) PreTruncate(path string, size uint64) (bool, hookfs.HookContext, error) {
+	return false, h.start(hookfs.OpTruncate, path, 0, int64(size), nil), nil
+}
+
+// PostTruncate implements hookfs.HookOnTruncate
+func (h *ForensicHook) PostTruncate(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	h.done(realRetCode, prehookCtx)
+	return false, nil
+}
@@ -0,0 +1,99 @@
+package inject
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethercflow/hookfs/hookfs"
+)
+
+func TestForensicHookReconstructsContents(t *testing.T) {
+	hook := NewForensicHook(1<<20, "watched")
+	var w bytes.Buffer
+	hook.W = &w
+	_, original, mnt := mount(t, hook, &hookfs.Options{DirectIO: true})
+	initial := []byte("hello, world")
+	for _, name := range []string{"watched", "other"} {
+		if err := ioutil.WriteFile(filepath.Join(original, name), initial, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, name := range []string{"watched", "other"} {
+		f, err := os.OpenFile(filepath.Join(mnt, name), os.O_RDWR, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, step := range []func() error{
+			func() error { _, err := f.WriteAt([]byte("HELLO"), 0); return err },
+			func() error { _, err := f.WriteAt([]byte("there!"), 20); return err },
+			func() error { return f.Truncate(23) },
+			func() error { _, err := f.ReadAt(make([]byte, 5), 0); return err },
+			func() error { _, err := f.WriteAt([]byte("W"), 7); return err },
+		} {
+			if err := step(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		f.Close()
+	}
+
+	want, err := ioutil.ReadFile(filepath.Join(original, "watched"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hook.Contents("watched", initial); !bytes.Equal(got, want) {
+		t.Errorf("reconstructed %q, want %q", got, want)
+	}
+	records := hook.Records()
+	read := false
+	for i, r := range records {
+		if r.Path != "watched" {
+			t.Errorf("record of %q, want watched only", r.Path)
+		}
+		if r.Seq != uint64(i+1) {
+			t.Errorf("record %d has Seq %d", i, r.Seq)
+		}
+		if r.Op == hookfs.OpRead && string(r.Data) == "HELLO" {
+			read = true
+		}
+	}
+	if !read {
+		t.Errorf("no read of HELLO in %+v", records)
+	}
+
+	// W got the same records
+	var logged []ForensicRecord
+	for s := bufio.NewScanner(&w); s.Scan(); {
+		var r ForensicRecord
+		if err := json.Unmarshal(s.Bytes(), &r); err != nil {
+			t.Fatal(err)
+		}
+		logged = append(logged, r)
+	}
+	if len(logged) != len(records) {
+		t.Fatalf("%d records written to W, want %d", len(logged), len(records))
+	}
+	for i := range logged {
+		if logged[i].Op != records[i].Op || !bytes.Equal(logged[i].Data, records[i].Data) {
+			t.Errorf("record %d written as %+v, want %+v", i, logged[i], records[i])
+		}
+	}
+}
+
+func TestForensicHookCap(t *testing.T) {
+	hook := NewForensicHook(8, "file")
+	for _, data := range []string{"12345", "678", "9", "0"} {
+		_, ctx, _ := hook.PreWrite("file", []byte(data), 0)
+		hook.PostWrite(0, ctx)
+	}
+	// the history kept has no holes: "0" would fit, but comes after a dropped record
+	if n := len(hook.Records()); n != 2 || hook.Dropped() != 2 {
+		t.Errorf("%d records kept and %d dropped, want 2 and 2", n, hook.Dropped())
+	}
+}
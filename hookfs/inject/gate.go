@@ -0,0 +1,43 @@
+package inject
+
+import (
+	"time"
+
+	"github.com/ethercflow/hookfs/hookfs"
+)
+
+//go:generate go run gengate.go
+
+// gate implements every hookfs.HookOnXXX interface by forwarding to the hook chosen by pick.
+// If pick returns an error, the operation is prehooked and fails with it.
+// If pick returns nil, or a hook not implementing the interface, the operation is not hooked,
+// as none is when pick is unset.
+// The chosen hook runs as a hookfs.HookChain of one, so it may implement any variant of the
+// interfaces the chain accepts, and the chain's context sends the posthook to the same hook.
+//
+// The methods are generated from those of hookfs.HookChain into gateops.go.
+type gate struct {
+	pick func(op string, path string) (hookfs.Hook, error)
+	// spent, if set, is told how long every prehook and posthook took, pick included.
+	spent func(op string, took time.Duration)
+}
+
+type gateCtx struct {
+	op  string
+	ctx hookfs.HookContext
+}
+
+// spend tells g.spent how long a hook took since start.
+func (g *gate) spend(op string, start time.Time) {
+	if g.spent != nil {
+		g.spent(op, time.Since(start))
+	}
+}
+
+// choose returns the hook g.pick chooses for op on path, or nil if g.pick is unset.
+func (g *gate) choose(op string, path string) (hookfs.Hook, error) {
+	if g.pick == nil {
+		return nil, nil
+	}
+	return g.pick(op, path)
+}
@@ -0,0 +1,135 @@
+package inject
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethercflow/hookfs/hookfs"
+)
+
+var errTest = errors.New("test")
+
+// recordingHook records its mkdir hooks.
+type recordingHook struct {
+	calls []string
+}
+
+func (h *recordingHook) PreMkdir(path string, mode uint32) (bool, hookfs.HookContext, error) {
+	h.calls = append(h.calls, "PreMkdir "+path)
+	return false, path, nil
+}
+
+func (h *recordingHook) PostMkdir(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	h.calls = append(h.calls, "PostMkdir")
+	return false, nil
+}
+
+// funcType drops the receiver of a method type.
+func funcType(method reflect.Method) reflect.Type {
+	in := make([]reflect.Type, 0, method.Type.NumIn()-1)
+	for i := 1; i < method.Type.NumIn(); i++ {
+		in = append(in, method.Type.In(i))
+	}
+	out := make([]reflect.Type, 0, method.Type.NumOut())
+	for i := 0; i < method.Type.NumOut(); i++ {
+		out = append(out, method.Type.Out(i))
+	}
+	return reflect.FuncOf(in, out, method.Type.IsVariadic())
+}
+
+func TestGateForwardsEveryChainHook(t *testing.T) {
+	chain := reflect.TypeOf(hookfs.HookChain(nil))
+	g := reflect.TypeOf(&gate{})
+	for i := 0; i < chain.NumMethod(); i++ {
+		want := chain.Method(i)
+		if !strings.HasPrefix(want.Name, "Pre") && !strings.HasPrefix(want.Name, "Post") {
+			continue
+		}
+		got, ok := g.MethodByName(want.Name)
+		if !ok {
+			t.Errorf("gate has no %s: run go generate", want.Name)
+			continue
+		}
+		if funcType(got) != funcType(want) {
+			t.Errorf("gate.%s is %v, HookChain.%s is %v: run go generate", want.Name, funcType(got), want.Name, funcType(want))
+		}
+	}
+}
+
+func TestGatePickError(t *testing.T) {
+	g := &gate{pick: func(op string, path string) (hookfs.Hook, error) {
+		if op != hookfs.OpRename || path != "old" {
+			t.Errorf("picked for %s %q, want %s %q", op, path, hookfs.OpRename, "old")
+		}
+		return nil, errTest
+	}}
+	hooked, _, err := g.PreRenameWithContext("old", "new", nil)
+	if !hooked || err != errTest {
+		t.Errorf("PreRenameWithContext = %v, %v; want true, %v", hooked, err, errTest)
+	}
+}
+
+func TestGatePostGoesToPicked(t *testing.T) {
+	hook := &recordingHook{}
+	var spent []string
+	g := &gate{
+		pick: func(op string, path string) (hookfs.Hook, error) {
+			return hook, nil
+		},
+		spent: func(op string, took time.Duration) {
+			spent = append(spent, op)
+		},
+	}
+	hooked, ctx, err := g.PreMkdirWithContext("dir", 0755, nil)
+	if hooked || err != nil {
+		t.Fatalf("PreMkdirWithContext = %v, %v; want false, nil", hooked, err)
+	}
+	if _, err := g.PostMkdir(0, ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(hook.calls, []string{"PreMkdir dir", "PostMkdir"}) {
+		t.Errorf("hook got %v", hook.calls)
+	}
+	if !reflect.DeepEqual(spent, []string{hookfs.OpMkdir, hookfs.OpMkdir}) {
+		t.Errorf("spent got %v", spent)
+	}
+}
+
+// intoHook fills reads with its byte, recording the buffers it was given.
+type intoHook struct {
+	b     byte
+	dests [][]byte
+}
+
+func (h *intoHook) PreReadInto(path string, dest []byte, offset int64) (int, bool, hookfs.HookContext, error) {
+	h.dests = append(h.dests, dest)
+	for i := range dest {
+		dest[i] = h.b
+	}
+	return len(dest), true, nil, nil
+}
+
+func (h *intoHook) PostRead(realRetCode int32, realBuf []byte, prehookCtx hookfs.HookContext) ([]byte, bool, error) {
+	return nil, false, nil
+}
+
+func TestGateReadsIntoDest(t *testing.T) {
+	hook := &intoHook{b: 'x'}
+	g := &gate{pick: func(op string, path string) (hookfs.Hook, error) {
+		return hook, nil
+	}}
+	dest := make([]byte, 4096)
+	n, hooked, _, err := g.PreReadIntoWithHandle("file", dest, 0, 1)
+	if n != len(dest) || !hooked || err != nil {
+		t.Fatalf("PreReadIntoWithHandle = %d, %v, %v; want %d, true, nil", n, hooked, err, len(dest))
+	}
+	if len(hook.dests) != 1 || &hook.dests[0][0] != &dest[0] {
+		t.Error("the hook did not get the buffer of the read")
+	}
+	if dest[0] != 'x' || dest[len(dest)-1] != 'x' {
+		t.Error("dest was not filled")
+	}
+}
@@ -0,0 +1,751 @@
+// Code generated by gengate.go from ../chain.go; DO NOT EDIT.
+
+package inject
+
+import (
+	"time"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+// PreOpenWithContext implements hookfs.HookOnOpenWithContext
+func (g *gate) PreOpenWithContext(path string, flags uint32, context *fuse.Context) (bool, hookfs.HookContext, error) {
+	defer g.spend(hookfs.OpOpen, time.Now())
+	h, err := g.choose(hookfs.OpOpen, path)
+	if err != nil {
+		return true, nil, err
+	}
+	if h == nil {
+		return false, nil, nil
+	}
+	hooked, ctx, err := hookfs.HookChain{h}.PreOpenWithContext(path, flags, context)
+	return hooked, &gateCtx{op: hookfs.OpOpen, ctx: ctx}, err
+}
+
+// PostOpen implements hookfs.HookOnOpenWithContext
+func (g *gate) PostOpen(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	gctx, ok := prehookCtx.(*gateCtx)
+	if !ok {
+		return false, nil
+	}
+	defer g.spend(gctx.op, time.Now())
+	return hookfs.HookChain(nil).PostOpen(realRetCode, gctx.ctx)
+}
+
+// PreReadIntoWithHandle implements hookfs.HookOnReadIntoWithHandle
+func (g *gate) PreReadIntoWithHandle(path string, dest []byte, offset int64, handle uint64) (int, bool, hookfs.HookContext, error) {
+	defer g.spend(hookfs.OpRead, time.Now())
+	h, err := g.choose(hookfs.OpRead, path)
+	if err != nil {
+		return 0, true, nil, err
+	}
+	if h == nil {
+		return 0, false, nil, nil
+	}
+	n, hooked, ctx, err := hookfs.HookChain{h}.PreReadIntoWithHandle(path, dest, offset, handle)
+	return n, hooked, &gateCtx{op: hookfs.OpRead, ctx: ctx}, err
+}
+
+// PostRead implements hookfs.HookOnReadIntoWithHandle
+func (g *gate) PostRead(realRetCode int32, realBuf []byte, prehookCtx hookfs.HookContext) ([]byte, bool, error) {
+	gctx, ok := prehookCtx.(*gateCtx)
+	if !ok {
+		return nil, false, nil
+	}
+	defer g.spend(gctx.op, time.Now())
+	return hookfs.HookChain(nil).PostRead(realRetCode, realBuf, gctx.ctx)
+}
+
+// PreWrite implements hookfs.HookOnWrite
+func (g *gate) PreWrite(path string, buf []byte, offset int64) (bool, hookfs.HookContext, error) {
+	defer g.spend(hookfs.OpWrite, time.Now())
+	h, err := g.choose(hookfs.OpWrite, path)
+	if err != nil {
+		return true, nil, err
+	}
+	if h == nil {
+		return false, nil, nil
+	}
+	hooked, ctx, err := hookfs.HookChain{h}.PreWrite(path, buf, offset)
+	return hooked, &gateCtx{op: hookfs.OpWrite, ctx: ctx}, err
+}
+
+// PostWrite implements hookfs.HookOnWrite
+func (g *gate) PostWrite(realRetCode int32, prehookCtx hookfs.HookContext) (uint32, bool, error) {
+	gctx, ok := prehookCtx.(*gateCtx)
+	if !ok {
+		return 0, false, nil
+	}
+	defer g.spend(gctx.op, time.Now())
+	return hookfs.HookChain(nil).PostWrite(realRetCode, gctx.ctx)
+}
+
+// PreMkdirWithContext implements hookfs.HookOnMkdirWithContext
+func (g *gate) PreMkdirWithContext(path string, mode uint32, context *fuse.Context) (bool, hookfs.HookContext, error) {
+	defer g.spend(hookfs.OpMkdir, time.Now())
+	h, err := g.choose(hookfs.OpMkdir, path)
+	if err != nil {
+		return true, nil, err
+	}
+	if h == nil {
+		return false, nil, nil
+	}
+	hooked, ctx, err := hookfs.HookChain{h}.PreMkdirWithContext(path, mode, context)
+	return hooked, &gateCtx{op: hookfs.OpMkdir, ctx: ctx}, err
+}
+
+// PostMkdir implements hookfs.HookOnMkdirWithContext
+func (g *gate) PostMkdir(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	gctx, ok := prehookCtx.(*gateCtx)
+	if !ok {
+		return false, nil
+	}
+	defer g.spend(gctx.op, time.Now())
+	return hookfs.HookChain(nil).PostMkdir(realRetCode, gctx.ctx)
+}
+
+// PreRmdirWithContext implements hookfs.HookOnRmdirWithContext
+func (g *gate) PreRmdirWithContext(path string, context *fuse.Context) (bool, hookfs.HookContext, error) {
+	defer g.spend(hookfs.OpRmdir, time.Now())
+	h, err := g.choose(hookfs.OpRmdir, path)
+	if err != nil {
+		return true, nil, err
+	}
+	if h == nil {
+		return false, nil, nil
+	}
+	hooked, ctx, err := hookfs.HookChain{h}.PreRmdirWithContext(path, context)
+	return hooked, &gateCtx{op: hookfs.OpRmdir, ctx: ctx}, err
+}
+
+// PostRmdir implements hookfs.HookOnRmdirWithContext
+func (g *gate) PostRmdir(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	gctx, ok := prehookCtx.(*gateCtx)
+	if !ok {
+		return false, nil
+	}
+	defer g.spend(gctx.op, time.Now())
+	return hookfs.HookChain(nil).PostRmdir(realRetCode, gctx.ctx)
+}
+
+// PreOpenDir implements hookfs.HookOnOpenDirWithEntries
+func (g *gate) PreOpenDir(path string) (bool, hookfs.HookContext, error) {
+	defer g.spend(hookfs.OpOpenDir, time.Now())
+	h, err := g.choose(hookfs.OpOpenDir, path)
+	if err != nil {
+		return true, nil, err
+	}
+	if h == nil {
+		return false, nil, nil
+	}
+	hooked, ctx, err := hookfs.HookChain{h}.PreOpenDir(path)
+	return hooked, &gateCtx{op: hookfs.OpOpenDir, ctx: ctx}, err
+}
+
+// PostOpenDirWithEntries implements hookfs.HookOnOpenDirWithEntries
+func (g *gate) PostOpenDirWithEntries(realRetCode int32, realEntries []fuse.DirEntry, prehookCtx hookfs.HookContext) ([]fuse.DirEntry, bool, error) {
+	gctx, ok := prehookCtx.(*gateCtx)
+	if !ok {
+		return nil, false, nil
+	}
+	defer g.spend(gctx.op, time.Now())
+	return hookfs.HookChain(nil).PostOpenDirWithEntries(realRetCode, realEntries, gctx.ctx)
+}
+
+// PreFsync implements hookfs.HookOnFsync
+func (g *gate) PreFsync(path string, flags uint32) (bool, hookfs.HookContext, error) {
+	defer g.spend(hookfs.OpFsync, time.Now())
+	h, err := g.choose(hookfs.OpFsync, path)
+	if err != nil {
+		return true, nil, err
+	}
+	if h == nil {
+		return false, nil, nil
+	}
+	hooked, ctx, err := hookfs.HookChain{h}.PreFsync(path, flags)
+	return hooked, &gateCtx{op: hookfs.OpFsync, ctx: ctx}, err
+}
+
+// PostFsync implements hookfs.HookOnFsync
+func (g *gate) PostFsync(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	gctx, ok := prehookCtx.(*gateCtx)
+	if !ok {
+		return false, nil
+	}
+	defer g.spend(gctx.op, time.Now())
+	return hookfs.HookChain(nil).PostFsync(realRetCode, gctx.ctx)
+}
+
+// PreFlush implements hookfs.HookOnFlush
+func (g *gate) PreFlush(path string) (bool, hookfs.HookContext, error) {
+	defer g.spend(hookfs.OpFlush, time.Now())
+	h, err := g.choose(hookfs.OpFlush, path)
+	if err != nil {
+		return true, nil, err
+	}
+	if h == nil {
+		return false, nil, nil
+	}
+	hooked, ctx, err := hookfs.HookChain{h}.PreFlush(path)
+	return hooked, &gateCtx{op: hookfs.OpFlush, ctx: ctx}, err
+}
+
+// PostFlush implements hookfs.HookOnFlush
+func (g *gate) PostFlush(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	gctx, ok := prehookCtx.(*gateCtx)
+	if !ok {
+		return false, nil
+	}
+	defer g.spend(gctx.op, time.Now())
+	return hookfs.HookChain(nil).PostFlush(realRetCode, gctx.ctx)
+}
+
+// PreReleaseWithHandle implements hookfs.HookOnReleaseWithHandle
+func (g *gate) PreReleaseWithHandle(path string, flags uint32, handle uint64) (bool, hookfs.HookContext) {
+	defer g.spend(hookfs.OpRelease, time.Now())
+	h, err := g.choose(hookfs.OpRelease, path)
+	if err != nil || h == nil {
+		return false, nil
+	}
+	hooked, ctx := hookfs.HookChain{h}.PreReleaseWithHandle(path, flags, handle)
+	return hooked, &gateCtx{op: hookfs.OpRelease, ctx: ctx}
+}
+
+// PostRelease implements hookfs.HookOnReleaseWithHandle
+func (g *gate) PostRelease(prehookCtx hookfs.HookContext) bool {
+	gctx, ok := prehookCtx.(*gateCtx)
+	if !ok {
+		return false
+	}
+	defer g.spend(gctx.op, time.Now())
+	return hookfs.HookChain(nil).PostRelease(gctx.ctx)
+}
+
+// PreTruncateWithContext implements hookfs.HookOnTruncateWithContext
+func (g *gate) PreTruncateWithContext(path string, size uint64, context *fuse.Context) (bool, hookfs.HookContext, error) {
+	defer g.spend(hookfs.OpTruncate, time.Now())
+	h, err := g.choose(hookfs.OpTruncate, path)
+	if err != nil {
+		return true, nil, err
+	}
+	if h == nil {
+		return false, nil, nil
+	}
+	hooked, ctx, err := hookfs.HookChain{h}.PreTruncateWithContext(path, size, context)
+	return hooked, &gateCtx{op: hookfs.OpTruncate, ctx: ctx}, err
+}
+
+// PostTruncate implements hookfs.HookOnTruncateWithContext
+func (g *gate) PostTruncate(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	gctx, ok := prehookCtx.(*gateCtx)
+	if !ok {
+		return false, nil
+	}
+	defer g.spend(gctx.op, time.Now())
+	return hookfs.HookChain(nil).PostTruncate(realRetCode, gctx.ctx)
+}
+
+// PreGetAttrWithContext implements hookfs.HookOnGetAttrWithContext
+func (g *gate) PreGetAttrWithContext(path string, context *fuse.Context) (bool, hookfs.HookContext, error) {
+	defer g.spend(hookfs.OpGetAttr, time.Now())
+	h, err := g.choose(hookfs.OpGetAttr, path)
+	if err != nil {
+		return true, nil, err
+	}
+	if h == nil {
+		return false, nil, nil
+	}
+	hooked, ctx, err := hookfs.HookChain{h}.PreGetAttrWithContext(path, context)
+	return hooked, &gateCtx{op: hookfs.OpGetAttr, ctx: ctx}, err
+}
+
+// PostGetAttr implements hookfs.HookOnGetAttrWithContext
+func (g *gate) PostGetAttr(realRetCode int32, realAttr *fuse.Attr, prehookCtx hookfs.HookContext) (*fuse.Attr, bool, error) {
+	gctx, ok := prehookCtx.(*gateCtx)
+	if !ok {
+		return nil, false, nil
+	}
+	defer g.spend(gctx.op, time.Now())
+	return hookfs.HookChain(nil).PostGetAttr(realRetCode, realAttr, gctx.ctx)
+}
+
+// PreChownWithContext implements hookfs.HookOnChownWithContext
+func (g *gate) PreChownWithContext(path string, uid uint32, gid uint32, context *fuse.Context) (bool, hookfs.HookContext, error) {
+	defer g.spend(hookfs.OpChown, time.Now())
+	h, err := g.choose(hookfs.OpChown, path)
+	if err != nil {
+		return true, nil, err
+	}
+	if h == nil {
+		return false, nil, nil
+	}
+	hooked, ctx, err := hookfs.HookChain{h}.PreChownWithContext(path, uid, gid, context)
+	return hooked, &gateCtx{op: hookfs.OpChown, ctx: ctx}, err
+}
+
+// PostChown implements hookfs.HookOnChownWithContext
+func (g *gate) PostChown(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	gctx, ok := prehookCtx.(*gateCtx)
+	if !ok {
+		return false, nil
+	}
+	defer g.spend(gctx.op, time.Now())
+	return hookfs.HookChain(nil).PostChown(realRetCode, gctx.ctx)
+}
+
+// PreChmodWithContext implements hookfs.HookOnChmodWithContext
+func (g *gate) PreChmodWithContext(path string, perms uint32, context *fuse.Context) (bool, hookfs.HookContext, error) {
+	defer g.spend(hookfs.OpChmod, time.Now())
+	h, err := g.choose(hookfs.OpChmod, path)
+	if err != nil {
+		return true, nil, err
+	}
+	if h == nil {
+		return false, nil, nil
+	}
+	hooked, ctx, err := hookfs.HookChain{h}.PreChmodWithContext(path, perms, context)
+	return hooked, &gateCtx{op: hookfs.OpChmod, ctx: ctx}, err
+}
+
+// PostChmod implements hookfs.HookOnChmodWithContext
+func (g *gate) PostChmod(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	gctx, ok := prehookCtx.(*gateCtx)
+	if !ok {
+		return false, nil
+	}
+	defer g.spend(gctx.op, time.Now())
+	return hookfs.HookChain(nil).PostChmod(realRetCode, gctx.ctx)
+}
+
+// PreUtimensWithContext implements hookfs.HookOnUtimensWithContext
+func (g *gate) PreUtimensWithContext(path string, atime *time.Time, mtime *time.Time, context *fuse.Context) (bool, hookfs.HookContext, error) {
+	defer g.spend(hookfs.OpUtimens, time.Now())
+	h, err := g.choose(hookfs.OpUtimens, path)
+	if err != nil {
+		return true, nil, err
+	}
+	if h == nil {
+		return false, nil, nil
+	}
+	hooked, ctx, err := hookfs.HookChain{h}.PreUtimensWithContext(path, atime, mtime, context)
+	return hooked, &gateCtx{op: hookfs.OpUtimens, ctx: ctx}, err
+}
+
+// PostUtimens implements hookfs.HookOnUtimensWithContext
+func (g *gate) PostUtimens(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	gctx, ok := prehookCtx.(*gateCtx)
+	if !ok {
+		return false, nil
+	}
+	defer g.spend(gctx.op, time.Now())
+	return hookfs.HookChain(nil).PostUtimens(realRetCode, gctx.ctx)
+}
+
+// PreAllocate implements hookfs.HookOnAllocate
+func (g *gate) PreAllocate(path string, off uint64, size uint64, mode uint32) (bool, hookfs.HookContext, error) {
+	defer g.spend(hookfs.OpAllocate, time.Now())
+	h, err := g.choose(hookfs.OpAllocate, path)
+	if err != nil {
+		return true, nil, err
+	}
+	if h == nil {
+		return false, nil, nil
+	}
+	hooked, ctx, err := hookfs.HookChain{h}.PreAllocate(path, off, size, mode)
+	return hooked, &gateCtx{op: hookfs.OpAllocate, ctx: ctx}, err
+}
+
+// PostAllocate implements hookfs.HookOnAllocate
+func (g *gate) PostAllocate(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	gctx, ok := prehookCtx.(*gateCtx)
+	if !ok {
+		return false, nil
+	}
+	defer g.spend(gctx.op, time.Now())
+	return hookfs.HookChain(nil).PostAllocate(realRetCode, gctx.ctx)
+}
+
+// PreGetLk implements hookfs.HookOnGetLk
+func (g *gate) PreGetLk(path string, owner uint64, lk *fuse.FileLock, flags uint32, out *fuse.FileLock) (bool, hookfs.HookContext, error) {
+	defer g.spend(hookfs.OpGetLk, time.Now())
+	h, err := g.choose(hookfs.OpGetLk, path)
+	if err != nil {
+		return true, nil, err
+	}
+	if h == nil {
+		return false, nil, nil
+	}
+	hooked, ctx, err := hookfs.HookChain{h}.PreGetLk(path, owner, lk, flags, out)
+	return hooked, &gateCtx{op: hookfs.OpGetLk, ctx: ctx}, err
+}
+
+// PostGetLk implements hookfs.HookOnGetLk
+func (g *gate) PostGetLk(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	gctx, ok := prehookCtx.(*gateCtx)
+	if !ok {
+		return false, nil
+	}
+	defer g.spend(gctx.op, time.Now())
+	return hookfs.HookChain(nil).PostGetLk(realRetCode, gctx.ctx)
+}
+
+// PreSetLk implements hookfs.HookOnSetLk
+func (g *gate) PreSetLk(path string, owner uint64, lk *fuse.FileLock, flags uint32) (bool, hookfs.HookContext, error) {
+	defer g.spend(hookfs.OpSetLk, time.Now())
+	h, err := g.choose(hookfs.OpSetLk, path)
+	if err != nil {
+		return true, nil, err
+	}
+	if h == nil {
+		return false, nil, nil
+	}
+	hooked, ctx, err := hookfs.HookChain{h}.PreSetLk(path, owner, lk, flags)
+	return hooked, &gateCtx{op: hookfs.OpSetLk, ctx: ctx}, err
+}
+
+// PostSetLk implements hookfs.HookOnSetLk
+func (g *gate) PostSetLk(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	gctx, ok := prehookCtx.(*gateCtx)
+	if !ok {
+		return false, nil
+	}
+	defer g.spend(gctx.op, time.Now())
+	return hookfs.HookChain(nil).PostSetLk(realRetCode, gctx.ctx)
+}
+
+// PreSetLkw implements hookfs.HookOnSetLkw
+func (g *gate) PreSetLkw(path string, owner uint64, lk *fuse.FileLock, flags uint32) (bool, hookfs.HookContext, error) {
+	defer g.spend(hookfs.OpSetLkw, time.Now())
+	h, err := g.choose(hookfs.OpSetLkw, path)
+	if err != nil {
+		return true, nil, err
+	}
+	if h == nil {
+		return false, nil, nil
+	}
+	hooked, ctx, err := hookfs.HookChain{h}.PreSetLkw(path, owner, lk, flags)
+	return hooked, &gateCtx{op: hookfs.OpSetLkw, ctx: ctx}, err
+}
+
+// PostSetLkw implements hookfs.HookOnSetLkw
+func (g *gate) PostSetLkw(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	gctx, ok := prehookCtx.(*gateCtx)
+	if !ok {
+		return false, nil
+	}
+	defer g.spend(gctx.op, time.Now())
+	return hookfs.HookChain(nil).PostSetLkw(realRetCode, gctx.ctx)
+}
+
+// PreStatFsWithResult implements hookfs.HookOnStatFsWithResult
+func (g *gate) PreStatFsWithResult(path string) (*fuse.StatfsOut, bool, hookfs.HookContext, error) {
+	defer g.spend(hookfs.OpStatFs, time.Now())
+	h, err := g.choose(hookfs.OpStatFs, path)
+	if err != nil {
+		return nil, true, nil, err
+	}
+	if h == nil {
+		return nil, false, nil, nil
+	}
+	out, hooked, ctx, err := hookfs.HookChain{h}.PreStatFsWithResult(path)
+	return out, hooked, &gateCtx{op: hookfs.OpStatFs, ctx: ctx}, err
+}
+
+// PostStatFsWithResult implements hookfs.HookOnStatFsWithResult
+func (g *gate) PostStatFsWithResult(realOut *fuse.StatfsOut, prehookCtx hookfs.HookContext) (*fuse.StatfsOut, bool, error) {
+	gctx, ok := prehookCtx.(*gateCtx)
+	if !ok {
+		return nil, false, nil
+	}
+	defer g.spend(gctx.op, time.Now())
+	return hookfs.HookChain(nil).PostStatFsWithResult(realOut, gctx.ctx)
+}
+
+// PreReadlinkWithContext implements hookfs.HookOnReadlinkWithContext
+func (g *gate) PreReadlinkWithContext(name string, context *fuse.Context) (bool, hookfs.HookContext, error) {
+	defer g.spend(hookfs.OpReadlink, time.Now())
+	h, err := g.choose(hookfs.OpReadlink, name)
+	if err != nil {
+		return true, nil, err
+	}
+	if h == nil {
+		return false, nil, nil
+	}
+	hooked, ctx, err := hookfs.HookChain{h}.PreReadlinkWithContext(name, context)
+	return hooked, &gateCtx{op: hookfs.OpReadlink, ctx: ctx}, err
+}
+
+// PostReadlink implements hookfs.HookOnReadlinkWithContext
+func (g *gate) PostReadlink(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	gctx, ok := prehookCtx.(*gateCtx)
+	if !ok {
+		return false, nil
+	}
+	defer g.spend(gctx.op, time.Now())
+	return hookfs.HookChain(nil).PostReadlink(realRetCode, gctx.ctx)
+}
+
+// PreSymlinkWithContext implements hookfs.HookOnSymlinkWithContext
+func (g *gate) PreSymlinkWithContext(value string, linkName string, context *fuse.Context) (bool, hookfs.HookContext, error) {
+	defer g.spend(hookfs.OpSymlink, time.Now())
+	h, err := g.choose(hookfs.OpSymlink, linkName)
+	if err != nil {
+		return true, nil, err
+	}
+	if h == nil {
+		return false, nil, nil
+	}
+	hooked, ctx, err := hookfs.HookChain{h}.PreSymlinkWithContext(value, linkName, context)
+	return hooked, &gateCtx{op: hookfs.OpSymlink, ctx: ctx}, err
+}
+
+// PostSymlink implements hookfs.HookOnSymlinkWithContext
+func (g *gate) PostSymlink(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	gctx, ok := prehookCtx.(*gateCtx)
+	if !ok {
+		return false, nil
+	}
+	defer g.spend(gctx.op, time.Now())
+	return hookfs.HookChain(nil).PostSymlink(realRetCode, gctx.ctx)
+}
+
+// PreCreateWithContext implements hookfs.HookOnCreateWithContext
+func (g *gate) PreCreateWithContext(name string, flags uint32, mode uint32, context *fuse.Context) (bool, hookfs.HookContext, error) {
+	defer g.spend(hookfs.OpCreate, time.Now())
+	h, err := g.choose(hookfs.OpCreate, name)
+	if err != nil {
+		return true, nil, err
+	}
+	if h == nil {
+		return false, nil, nil
+	}
+	hooked, ctx, err := hookfs.HookChain{h}.PreCreateWithContext(name, flags, mode, context)
+	return hooked, &gateCtx{op: hookfs.OpCreate, ctx: ctx}, err
+}
+
+// PostCreate implements hookfs.HookOnCreateWithContext
+func (g *gate) PostCreate(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	gctx, ok := prehookCtx.(*gateCtx)
+	if !ok {
+		return false, nil
+	}
+	defer g.spend(gctx.op, time.Now())
+	return hookfs.HookChain(nil).PostCreate(realRetCode, gctx.ctx)
+}
+
+// PreAccessWithContext implements hookfs.HookOnAccessWithContext
+func (g *gate) PreAccessWithContext(name string, mode uint32, context *fuse.Context) (bool, hookfs.HookContext, error) {
+	defer g.spend(hookfs.OpAccess, time.Now())
+	h, err := g.choose(hookfs.OpAccess, name)
+	if err != nil {
+		return true, nil, err
+	}
+	if h == nil {
+		return false, nil, nil
+	}
+	hooked, ctx, err := hookfs.HookChain{h}.PreAccessWithContext(name, mode, context)
+	return hooked, &gateCtx{op: hookfs.OpAccess, ctx: ctx}, err
+}
+
+// PostAccess implements hookfs.HookOnAccessWithContext
+func (g *gate) PostAccess(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	gctx, ok := prehookCtx.(*gateCtx)
+	if !ok {
+		return false, nil
+	}
+	defer g.spend(gctx.op, time.Now())
+	return hookfs.HookChain(nil).PostAccess(realRetCode, gctx.ctx)
+}
+
+// PreLinkWithContext implements hookfs.HookOnLinkWithContext
+func (g *gate) PreLinkWithContext(oldName string, newName string, context *fuse.Context) (bool, hookfs.HookContext, error) {
+	defer g.spend(hookfs.OpLink, time.Now())
+	h, err := g.choose(hookfs.OpLink, oldName)
+	if err != nil {
+		return true, nil, err
+	}
+	if h == nil {
+		return false, nil, nil
+	}
+	hooked, ctx, err := hookfs.HookChain{h}.PreLinkWithContext(oldName, newName, context)
+	return hooked, &gateCtx{op: hookfs.OpLink, ctx: ctx}, err
+}
+
+// PostLink implements hookfs.HookOnLinkWithContext
+func (g *gate) PostLink(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	gctx, ok := prehookCtx.(*gateCtx)
+	if !ok {
+		return false, nil
+	}
+	defer g.spend(gctx.op, time.Now())
+	return hookfs.HookChain(nil).PostLink(realRetCode, gctx.ctx)
+}
+
+// PreMknodWithContext implements hookfs.HookOnMknodWithContext
+func (g *gate) PreMknodWithContext(name string, mode uint32, dev uint32, context *fuse.Context) (bool, hookfs.HookContext, error) {
+	defer g.spend(hookfs.OpMknod, time.Now())
+	h, err := g.choose(hookfs.OpMknod, name)
+	if err != nil {
+		return true, nil, err
+	}
+	if h == nil {
+		return false, nil, nil
+	}
+	hooked, ctx, err := hookfs.HookChain{h}.PreMknodWithContext(name, mode, dev, context)
+	return hooked, &gateCtx{op: hookfs.OpMknod, ctx: ctx}, err
+}
+
+// PostMknod implements hookfs.HookOnMknodWithContext
+func (g *gate) PostMknod(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	gctx, ok := prehookCtx.(*gateCtx)
+	if !ok {
+		return false, nil
+	}
+	defer g.spend(gctx.op, time.Now())
+	return hookfs.HookChain(nil).PostMknod(realRetCode, gctx.ctx)
+}
+
+// PreRenameWithContext implements hookfs.HookOnRenameWithContext
+func (g *gate) PreRenameWithContext(oldName string, newName string, context *fuse.Context) (bool, hookfs.HookContext, error) {
+	defer g.spend(hookfs.OpRename, time.Now())
+	h, err := g.choose(hookfs.OpRename, oldName)
+	if err != nil {
+		return true, nil, err
+	}
+	if h == nil {
+		return false, nil, nil
+	}
+	hooked, ctx, err := hookfs.HookChain{h}.PreRenameWithContext(oldName, newName, context)
+	return hooked, &gateCtx{op: hookfs.OpRename, ctx: ctx}, err
+}
+
+// PostRename implements hookfs.HookOnRenameWithContext
+func (g *gate) PostRename(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	gctx, ok := prehookCtx.(*gateCtx)
+	if !ok {
+		return false, nil
+	}
+	defer g.spend(gctx.op, time.Now())
+	return hookfs.HookChain(nil).PostRename(realRetCode, gctx.ctx)
+}
+
+// PreUnlinkWithContext implements hookfs.HookOnUnlinkWithContext
+func (g *gate) PreUnlinkWithContext(name string, context *fuse.Context) (bool, hookfs.HookContext, error) {
+	defer g.spend(hookfs.OpUnlink, time.Now())
+	h, err := g.choose(hookfs.OpUnlink, name)
+	if err != nil {
+		return true, nil, err
+	}
+	if h == nil {
+		return false, nil, nil
+	}
+	hooked, ctx, err := hookfs.HookChain{h}.PreUnlinkWithContext(name, context)
+	return hooked, &gateCtx{op: hookfs.OpUnlink, ctx: ctx}, err
+}
+
+// PostUnlink implements hookfs.HookOnUnlinkWithContext
+func (g *gate) PostUnlink(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	gctx, ok := prehookCtx.(*gateCtx)
+	if !ok {
+		return false, nil
+	}
+	defer g.spend(gctx.op, time.Now())
+	return hookfs.HookChain(nil).PostUnlink(realRetCode, gctx.ctx)
+}
+
+// PreGetXAttrWithContext implements hookfs.HookOnGetXAttrWithContext
+func (g *gate) PreGetXAttrWithContext(name string, attribute string, context *fuse.Context) (bool, hookfs.HookContext, error) {
+	defer g.spend(hookfs.OpGetXAttr, time.Now())
+	h, err := g.choose(hookfs.OpGetXAttr, name)
+	if err != nil {
+		return true, nil, err
+	}
+	if h == nil {
+		return false, nil, nil
+	}
+	hooked, ctx, err := hookfs.HookChain{h}.PreGetXAttrWithContext(name, attribute, context)
+	return hooked, &gateCtx{op: hookfs.OpGetXAttr, ctx: ctx}, err
+}
+
+// PostGetXAttr implements hookfs.HookOnGetXAttrWithContext
+func (g *gate) PostGetXAttr(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	gctx, ok := prehookCtx.(*gateCtx)
+	if !ok {
+		return false, nil
+	}
+	defer g.spend(gctx.op, time.Now())
+	return hookfs.HookChain(nil).PostGetXAttr(realRetCode, gctx.ctx)
+}
+
+// PreListXAttrWithContext implements hookfs.HookOnListXAttrWithContext
+func (g *gate) PreListXAttrWithContext(name string, context *fuse.Context) (bool, hookfs.HookContext, error) {
+	defer g.spend(hookfs.OpListXAttr, time.Now())
+	h, err := g.choose(hookfs.OpListXAttr, name)
+	if err != nil {
+		return true, nil, err
+	}
+	if h == nil {
+		return false, nil, nil
+	}
+	hooked, ctx, err := hookfs.HookChain{h}.PreListXAttrWithContext(name, context)
+	return hooked, &gateCtx{op: hookfs.OpListXAttr, ctx: ctx}, err
+}
+
+// PostListXAttr implements hookfs.HookOnListXAttrWithContext
+func (g *gate) PostListXAttr(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	gctx, ok := prehookCtx.(*gateCtx)
+	if !ok {
+		return false, nil
+	}
+	defer g.spend(gctx.op, time.Now())
+	return hookfs.HookChain(nil).PostListXAttr(realRetCode, gctx.ctx)
+}
+
+// PreRemoveXAttrWithContext implements hookfs.HookOnRemoveXAttrWithContext
+func (g *gate) PreRemoveXAttrWithContext(name string, attr string, context *fuse.Context) (bool, hookfs.HookContext, error) {
+	defer g.spend(hookfs.OpRemoveXAttr, time.Now())
+	h, err := g.choose(hookfs.OpRemoveXAttr, name)
+	if err != nil {
+		return true, nil, err
+	}
+	if h == nil {
+		return false, nil, nil
+	}
+	hooked, ctx, err := hookfs.HookChain{h}.PreRemoveXAttrWithContext(name, attr, context)
+	return hooked, &gateCtx{op: hookfs.OpRemoveXAttr, ctx: ctx}, err
+}
+
+// PostRemoveXAttr implements hookfs.HookOnRemoveXAttrWithContext
+func (g *gate) PostRemoveXAttr(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	gctx, ok := prehookCtx.(*gateCtx)
+	if !ok {
+		return false, nil
+	}
+	defer g.spend(gctx.op, time.Now())
+	return hookfs.HookChain(nil).PostRemoveXAttr(realRetCode, gctx.ctx)
+}
+
+// PreSetXAttrWithContext implements hookfs.HookOnSetXAttrWithContext
+func (g *gate) PreSetXAttrWithContext(name string, attr string, data []byte, flags int, context *fuse.Context) (bool, hookfs.HookContext, error) {
+	defer g.spend(hookfs.OpSetXAttr, time.Now())
+	h, err := g.choose(hookfs.OpSetXAttr, name)
+	if err != nil {
+		return true, nil, err
+	}
+	if h == nil {
+		return false, nil, nil
+	}
+	hooked, ctx, err := hookfs.HookChain{h}.PreSetXAttrWithContext(name, attr, data, flags, context)
+	return hooked, &gateCtx{op: hookfs.OpSetXAttr, ctx: ctx}, err
+}
+
+// PostSetXAttr implements hookfs.HookOnSetXAttrWithContext
+func (g *gate) PostSetXAttr(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	gctx, ok := prehookCtx.(*gateCtx)
+	if !ok {
+		return false, nil
+	}
+	defer g.spend(gctx.op, time.Now())
+	return hookfs.HookChain(nil).PostSetXAttr(realRetCode, gctx.ctx)
+}
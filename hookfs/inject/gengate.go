@@ -0,0 +1,241 @@
+//go:build ignore
+// +build ignore
+
+// gengate writes gateops.go: a method of gate for every prehook and posthook of
+// hookfs.HookChain, so that the gate supports exactly what the chain does. A prehook asks
+// pick for the hook of the operation, then runs it as a chain of one; a posthook runs the
+// chain's posthook on the context the prehook returned.
+//
+// Run it with go generate after changing the methods of hookfs.HookChain.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"log"
+	"strings"
+	"unicode"
+)
+
+// opSuffixes are stripped from the name of a prehook to get the name of its operation.
+var opSuffixes = []string{"WithContext", "WithHandle", "WithResult", "Into"}
+
+// resultNames name the results of a prehook after their type.
+var resultNames = map[string]string{
+	"bool":               "hooked",
+	"error":              "err",
+	"hookfs.HookContext": "ctx",
+	"[]byte":             "buf",
+	"int":                "n",
+	"*fuse.StatfsOut":    "out",
+}
+
+func main() {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "../chain.go", nil, parser.ParseComments)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	out.WriteString(`// Code generated by gengate.go from ../chain.go; DO NOT EDIT.
+
+package inject
+
+import (
+	"time"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	"github.com/hanwen/go-fuse/fuse"
+)
+`)
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv == nil || !isChain(fn.Recv.List[0].Type) {
+			continue
+		}
+		name := fn.Name.Name
+		switch {
+		case strings.HasPrefix(name, "Pre"):
+			writePre(&out, fn)
+		case strings.HasPrefix(name, "Post"):
+			writePost(&out, fn)
+		}
+	}
+
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		log.Fatalf("%v\n%s", err, out.Bytes())
+	}
+	if err := ioutil.WriteFile("gateops.go", src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func isChain(expr ast.Expr) bool {
+	ident, ok := expr.(*ast.Ident)
+	return ok && ident.Name == "HookChain"
+}
+
+type param struct {
+	name string
+	typ  string
+}
+
+// params flattens fields, naming the unnamed ones after their type.
+func params(fields *ast.FieldList) []param {
+	var ps []param
+	if fields == nil {
+		return ps
+	}
+	for _, field := range fields.List {
+		typ := typeString(field.Type)
+		if len(field.Names) == 0 {
+			name, ok := resultNames[typ]
+			if !ok {
+				name = fmt.Sprintf("r%d", len(ps))
+			}
+			ps = append(ps, param{name: name, typ: typ})
+			continue
+		}
+		for _, name := range field.Names {
+			ps = append(ps, param{name: name.Name, typ: typ})
+		}
+	}
+	return ps
+}
+
+// typeString prints expr, qualifying the identifiers of package hookfs.
+func typeString(expr ast.Expr) string {
+	return types.ExprString(qualify(expr))
+}
+
+func qualify(expr ast.Expr) ast.Expr {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		if unicode.IsUpper(rune(e.Name[0])) {
+			return &ast.SelectorExpr{X: ast.NewIdent("hookfs"), Sel: ast.NewIdent(e.Name)}
+		}
+	case *ast.StarExpr:
+		return &ast.StarExpr{X: qualify(e.X)}
+	case *ast.ArrayType:
+		return &ast.ArrayType{Len: e.Len, Elt: qualify(e.Elt)}
+	}
+	return expr
+}
+
+func zero(typ string) string {
+	switch typ {
+	case "bool":
+		return "false"
+	case "int", "int32", "int64", "uint32", "uint64":
+		return "0"
+	}
+	return "nil"
+}
+
+func signature(name string, ps, rs []param) string {
+	var args, results []string
+	for _, p := range ps {
+		args = append(args, p.name+" "+p.typ)
+	}
+	for _, r := range rs {
+		results = append(results, r.typ)
+	}
+	return fmt.Sprintf("func (g *gate) %s(%s) (%s)", name, strings.Join(args, ", "), strings.Join(results, ", "))
+}
+
+// doc returns the first sentence of the doc of fn, which tells the interface it implements.
+func doc(fn *ast.FuncDecl) string {
+	text := strings.TrimSpace(fn.Doc.Text())
+	if i := strings.Index(text, ". "); i >= 0 {
+		text = text[:i]
+	}
+	text = strings.Replace(text, "\n", " ", -1)
+	return "// " + strings.Replace(text, "implements ", "implements hookfs.", 1)
+}
+
+func writePre(out *bytes.Buffer, fn *ast.FuncDecl) {
+	name := fn.Name.Name
+	ps := params(fn.Type.Params)
+	rs := params(fn.Type.Results)
+
+	op := strings.TrimPrefix(name, "Pre")
+	for _, suffix := range opSuffixes {
+		op = strings.TrimSuffix(op, suffix)
+	}
+	op = "hookfs.Op" + op
+	path := ps[0].name
+	for _, p := range ps {
+		if p.name == "linkName" {
+			path = p.name
+		}
+	}
+
+	var failed, skipped, names, args, rets []string
+	canFail := false
+	for _, r := range rs {
+		skipped = append(skipped, zero(r.typ))
+		switch r.typ {
+		case "bool":
+			failed = append(failed, "true")
+		case "error":
+			failed = append(failed, "err")
+			canFail = true
+		default:
+			failed = append(failed, zero(r.typ))
+		}
+		names = append(names, r.name)
+		if r.typ == "hookfs.HookContext" {
+			rets = append(rets, fmt.Sprintf("&gateCtx{op: %s, ctx: %s}", op, r.name))
+		} else {
+			rets = append(rets, r.name)
+		}
+	}
+	for _, p := range ps {
+		args = append(args, p.name)
+	}
+
+	fmt.Fprintf(out, "\n%s\n%s {\n", doc(fn), signature(name, ps, rs))
+	fmt.Fprintf(out, "\tdefer g.spend(%s, time.Now())\n", op)
+	fmt.Fprintf(out, "\th, err := g.choose(%s, %s)\n", op, path)
+	if canFail {
+		fmt.Fprintf(out, "\tif err != nil {\n\t\treturn %s\n\t}\n", strings.Join(failed, ", "))
+		fmt.Fprintf(out, "\tif h == nil {\n\t\treturn %s\n\t}\n", strings.Join(skipped, ", "))
+	} else {
+		// the operation cannot fail, so neither can pick
+		fmt.Fprintf(out, "\tif err != nil || h == nil {\n\t\treturn %s\n\t}\n", strings.Join(skipped, ", "))
+	}
+	fmt.Fprintf(out, "\t%s := hookfs.HookChain{h}.%s(%s)\n", strings.Join(names, ", "), name, strings.Join(args, ", "))
+	fmt.Fprintf(out, "\treturn %s\n}\n", strings.Join(rets, ", "))
+}
+
+func writePost(out *bytes.Buffer, fn *ast.FuncDecl) {
+	name := fn.Name.Name
+	ps := params(fn.Type.Params)
+	rs := params(fn.Type.Results)
+
+	var skipped, args []string
+	for _, r := range rs {
+		skipped = append(skipped, zero(r.typ))
+	}
+	for _, p := range ps {
+		if p.typ == "hookfs.HookContext" {
+			args = append(args, "gctx.ctx")
+		} else {
+			args = append(args, p.name)
+		}
+	}
+
+	fmt.Fprintf(out, "\n%s\n%s {\n", doc(fn), signature(name, ps, rs))
+	fmt.Fprintf(out, "\tgctx, ok := prehookCtx.(*gateCtx)\n")
+	fmt.Fprintf(out, "\tif !ok {\n\t\treturn %s\n\t}\n", strings.Join(skipped, ", "))
+	fmt.Fprintf(out, "\tdefer g.spend(gctx.op, time.Now())\n")
+	fmt.Fprintf(out, "\treturn hookfs.HookChain(nil).%s(%s)\n}\n", name, strings.Join(args, ", "))
+}
@@ -0,0 +1,136 @@
+package inject
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	"github.com/hanwen/go-fuse/fuse"
+	log "github.com/sirupsen/logrus"
+)
+
+// OverflowID is the id reported by an IDMapHook for stored ids with no mapping,
+// as the kernel does for user namespaces.
+const OverflowID = 65534
+
+// IDRange maps Count consecutive ids starting at Caller, as presented by callers,
+// to as many ids starting at Stored, as stored in the original directory.
+type IDRange struct {
+	Caller uint32
+	Stored uint32
+	Count  uint32
+}
+
+// IDMap maps ids by ranges, like /proc/[pid]/uid_map. Ranges should not overlap.
+type IDMap []IDRange
+
+// ToStored maps an id presented by a caller to the id stored.
+func (m IDMap) ToStored(id uint32) (uint32, bool) {
+	for _, r := range m {
+		if id >= r.Caller && id-r.Caller < r.Count {
+			return r.Stored + id - r.Caller, true
+		}
+	}
+	return 0, false
+}
+
+// ToCaller maps a stored id to the id presented to callers.
+func (m IDMap) ToCaller(id uint32) (uint32, bool) {
+	for _, r := range m {
+		if id >= r.Stored && id-r.Stored < r.Count {
+			return r.Caller + id - r.Stored, true
+		}
+	}
+	return 0, false
+}
+
+// IDMapHook shifts uids and gids between callers and the original directory, like an idmapped
+// mount: chown stores the mapped ids, and GetAttr reports the ids stored mapped back. Chown to
+// an id with no mapping fails with EINVAL, and stored ids with no mapping are reported as
+// OverflowID.
+//
+// The hook chowns in Original itself, which takes the privileges to do so.
+//
+// IDMapHook implements hookfs.HookOnChown and hookfs.HookOnGetAttr.
+type IDMapHook struct {
+	// Original is the original directory of the mount.
+	Original string
+
+	uidMap IDMap
+	gidMap IDMap
+}
+
+// NewIDMapHook creates an IDMapHook for original mapping uids with uidMap and gids with gidMap.
+func NewIDMapHook(original string, uidMap IDMap, gidMap IDMap) *IDMapHook {
+	return &IDMapHook{
+		Original: original,
+		uidMap:   uidMap,
+		gidMap:   gidMap,
+	}
+}
+
+// UIDMap returns the mapping of uids.
+func (h *IDMapHook) UIDMap() IDMap {
+	return h.uidMap
+}
+
+// GIDMap returns the mapping of gids.
+func (h *IDMapHook) GIDMap() IDMap {
+	return h.gidMap
+}
+
+// PreChown implements hookfs.HookOnChown
+func (h *IDMapHook) PreChown(path string, uid uint32, gid uint32) (bool, hookfs.HookContext, error) {
+	// -1 leaves the id unchanged
+	storedUID, storedGID := -1, -1
+	if uid != ^uint32(0) {
+		id, ok := h.uidMap.ToStored(uid)
+		if !ok {
+			return true, nil, syscall.EINVAL
+		}
+		storedUID = int(id)
+	}
+	if gid != ^uint32(0) {
+		id, ok := h.gidMap.ToStored(gid)
+		if !ok {
+			return true, nil, syscall.EINVAL
+		}
+		storedGID = int(id)
+	}
+
+	log.WithFields(log.Fields{
+		"path":      path,
+		"uid":       uid,
+		"gid":       gid,
+		"storedUid": storedUID,
+		"storedGid": storedGID,
+	}).Debug("IDMapHook: chown")
+	return true, nil, os.Lchown(filepath.Join(h.Original, path), storedUID, storedGID)
+}
+
+// PostChown implements hookfs.HookOnChown
+func (h *IDMapHook) PostChown(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return false, nil
+}
+
+// PreGetAttr implements hookfs.HookOnGetAttr
+func (h *IDMapHook) PreGetAttr(path string) (bool, hookfs.HookContext, error) {
+	return false, nil, nil
+}
+
+// PostGetAttr implements hookfs.HookOnGetAttr
+func (h *IDMapHook) PostGetAttr(realRetCode int32, realAttr *fuse.Attr, prehookCtx hookfs.HookContext) (*fuse.Attr, bool, error) {
+	if realRetCode != 0 || realAttr == nil {
+		return nil, false, nil
+	}
+	attr := *realAttr
+	var ok bool
+	if attr.Uid, ok = h.uidMap.ToCaller(realAttr.Uid); !ok {
+		attr.Uid = OverflowID
+	}
+	if attr.Gid, ok = h.gidMap.ToCaller(realAttr.Gid); !ok {
+		attr.Gid = OverflowID
+	}
+	return &attr, true, nil
+}
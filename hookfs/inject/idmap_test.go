@@ -0,0 +1,56 @@
+package inject
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/ethercflow/hookfs/hookfs"
+)
+
+func TestIDMapHookChown(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("chowning to other users takes root")
+	}
+	idMap := IDMap{{Caller: 1000, Stored: 100000, Count: 10}}
+	original := t.TempDir()
+	hook := NewIDMapHook(original, idMap, idMap)
+	_, mnt := mountOriginal(t, original, hook, &hookfs.Options{AttrTimeout: -1, EntryTimeout: -1})
+	if err := ioutil.WriteFile(filepath.Join(original, "file"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chown(filepath.Join(mnt, "file"), 1001, 1002); err != nil {
+		t.Fatal(err)
+	}
+	var st syscall.Stat_t
+	if err := syscall.Stat(filepath.Join(original, "file"), &st); err != nil {
+		t.Fatal(err)
+	}
+	if st.Uid != 100001 || st.Gid != 100002 {
+		t.Errorf("stored ids %d:%d, want 100001:100002", st.Uid, st.Gid)
+	}
+	if err := syscall.Stat(filepath.Join(mnt, "file"), &st); err != nil {
+		t.Fatal(err)
+	}
+	if st.Uid != 1001 || st.Gid != 1002 {
+		t.Errorf("reported ids %d:%d, want 1001:1002", st.Uid, st.Gid)
+	}
+
+	if err := os.Chown(filepath.Join(mnt, "file"), 5, -1); !errors.Is(err, syscall.EINVAL) {
+		t.Errorf("chown to an unmapped uid = %v, want EINVAL", err)
+	}
+	// stored ids without a mapping are reported as the overflow id
+	if err := os.Chown(filepath.Join(original, "file"), 5, 5); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Stat(filepath.Join(mnt, "file"), &st); err != nil {
+		t.Fatal(err)
+	}
+	if st.Uid != OverflowID || st.Gid != OverflowID {
+		t.Errorf("reported ids %d:%d for unmapped ones, want %d", st.Uid, st.Gid, OverflowID)
+	}
+}
@@ -0,0 +1,163 @@
+package inject
+
+import (
+	"sync"
+	"syscall"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	log "github.com/sirupsen/logrus"
+)
+
+// InodeLimitHook caps the number of live entries created through the mount: once Count
+// reaches Limit, Create, Mkdir, Mknod, Symlink and Link fail with ENOSPC, until Unlink or
+// Rmdir frees some.
+//
+// Count starts at 0, so the entries already in the original directory are not counted, but
+// deleting them frees room all the same, as on a filesystem with that many inodes left.
+// Hard links count as entries. Renaming over an existing entry does not lower Count.
+//
+// InodeLimitHook implements hookfs.HookOnCreate, hookfs.HookOnMkdir, hookfs.HookOnMknod,
+// hookfs.HookOnSymlink, hookfs.HookOnLink, hookfs.HookOnUnlink and hookfs.HookOnRmdir.
+type InodeLimitHook struct {
+	mu    sync.Mutex
+	limit int64
+	count int64
+}
+
+// inodeLimitCtx is the change made to the count by a prehook, undone if the operation fails.
+type inodeLimitCtx struct {
+	delta int64
+}
+
+// NewInodeLimitHook creates an InodeLimitHook allowing limit live entries.
+func NewInodeLimitHook(limit int64) *InodeLimitHook {
+	return &InodeLimitHook{limit: limit}
+}
+
+// Limit returns the maximum number of live entries.
+func (h *InodeLimitHook) Limit() int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.limit
+}
+
+// SetLimit changes the maximum number of live entries. Entries in excess are kept.
+func (h *InodeLimitHook) SetLimit(limit int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.limit = limit
+}
+
+// Count returns the number of entries created minus the number deleted so far.
+// Operations in progress are counted.
+func (h *InodeLimitHook) Count() int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.count
+}
+
+// create reserves an entry, which is given back if the operation fails.
+func (h *InodeLimitHook) create(op string, path string) (bool, hookfs.HookContext, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.count >= h.limit {
+		log.WithFields(log.Fields{
+			"op":    op,
+			"path":  path,
+			"count": h.count,
+			"limit": h.limit,
+		}).Debug("InodeLimitHook: returning ENOSPC")
+		return true, nil, syscall.ENOSPC
+	}
+	h.count++
+	return false, &inodeLimitCtx{delta: 1}, nil
+}
+
+// remove frees an entry, which is taken back if the operation fails.
+func (h *InodeLimitHook) remove() (bool, hookfs.HookContext, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.count--
+	return false, &inodeLimitCtx{delta: -1}, nil
+}
+
+func (h *InodeLimitHook) done(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	ctx, ok := prehookCtx.(*inodeLimitCtx)
+	if !ok || realRetCode == 0 {
+		return false, nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.count -= ctx.delta
+	return false, nil
+}
+
+// PreCreate implements hookfs.HookOnCreate
+func (h *InodeLimitHook) PreCreate(name string, flags uint32, mode uint32) (bool, hookfs.HookContext, error) {
+	return h.create(hookfs.OpCreate, name)
+}
+
+// PostCreate implements hookfs.HookOnCreate
+func (h *InodeLimitHook) PostCreate(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return h.done(realRetCode, prehookCtx)
+}
+
+// PreMkdir implements hookfs.HookOnMkdir
+func (h *InodeLimitHook) PreMkdir(path string, mode uint32) (bool, hookfs.HookContext, error) {
+	return h.create(hookfs.OpMkdir, path)
+}
+
+// PostMkdir implements hookfs.HookOnMkdir
+func (h *InodeLimitHook) PostMkdir(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return h.done(realRetCode, prehookCtx)
+}
+
+// PreMknod implements hookfs.HookOnMknod
+func (h *InodeLimitHook) PreMknod(name string, mode uint32, dev uint32) (bool, hookfs.HookContext, error) {
+	return h.create(hookfs.OpMknod, name)
+}
+
+// PostMknod implements hookfs.HookOnMknod
+func (h *InodeLimitHook) PostMknod(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return h.done(realRetCode, prehookCtx)
+}
+
+// PreSymlink implements hookfs.HookOnSymlink
+func (h *InodeLimitHook) PreSymlink(value string, linkName string) (bool, hookfs.HookContext, error) {
+	return h.create(hookfs.OpSymlink, linkName)
+}
+
+// PostSymlink implements hookfs.HookOnSymlink
+func (h *InodeLimitHook) PostSymlink(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return h.done(realRetCode, prehookCtx)
+}
+
+// PreLink implements hookfs.HookOnLink
+func (h *InodeLimitHook) PreLink(oldName string, newName string) (bool, hookfs.HookContext, error) {
+	return h.create(hookfs.OpLink, newName)
+}
+
+// PostLink implements hookfs.HookOnLink
+func (h *InodeLimitHook) PostLink(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return h.done(realRetCode, prehookCtx)
+}
+
+// PreUnlink implements hookfs.HookOnUnlink
+func (h *InodeLimitHook) PreUnlink(name string) (bool, hookfs.HookContext, error) {
+	return h.remove()
+}
+
+// PostUnlink implements hookfs.HookOnUnlink
+func (h *InodeLimitHook) PostUnlink(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return h.done(realRetCode, prehookCtx)
+}
+
+// PreRmdir implements hookfs.HookOnRmdir
+func (h *InodeLimitHook) PreRmdir(path string) (bool, hookfs.HookContext, error) {
+	return h.remove()
+}
+
+// PostRmdir implements hookfs.HookOnRmdir
+func (h *InodeLimitHook) PostRmdir(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return h.done(realRetCode, prehookCtx)
+}
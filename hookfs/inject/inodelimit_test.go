@@ -0,0 +1,58 @@
+package inject
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+func TestInodeLimitHookCapsLiveEntries(t *testing.T) {
+	hook := NewInodeLimitHook(3)
+	h, err := hookfs.NewHookFs(t.TempDir(), t.TempDir(), hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := &fuse.Context{}
+	f, code := h.Create("file", syscall.O_WRONLY, 0644, ctx)
+	if !code.Ok() {
+		t.Fatal(code)
+	}
+	f.Release()
+	if code := h.Mkdir("dir", 0755, ctx); !code.Ok() {
+		t.Fatal(code)
+	}
+	if code := h.Symlink("file", "link", ctx); !code.Ok() {
+		t.Fatal(code)
+	}
+	if n := hook.Count(); n != 3 {
+		t.Fatalf("Count = %d at the limit, want 3", n)
+	}
+
+	if _, code := h.Create("more", syscall.O_WRONLY, 0644, ctx); code != fuse.Status(syscall.ENOSPC) {
+		t.Errorf("create past the limit: %v, want ENOSPC", code)
+	}
+	if code := h.Link("file", "hardlink", ctx); code != fuse.Status(syscall.ENOSPC) {
+		t.Errorf("link past the limit: %v, want ENOSPC", code)
+	}
+	// a failed deletion gives nothing back
+	if code := h.Unlink("missing", ctx); code != fuse.ENOENT {
+		t.Errorf("unlink of a missing file: %v, want ENOENT", code)
+	}
+	if n := hook.Count(); n != 3 {
+		t.Fatalf("Count = %d after failed operations, want 3", n)
+	}
+
+	if code := h.Rmdir("dir", ctx); !code.Ok() {
+		t.Fatal(code)
+	}
+	f, code = h.Create("more", syscall.O_WRONLY, 0644, ctx)
+	if !code.Ok() {
+		t.Fatalf("create after rmdir: %v", code)
+	}
+	f.Release()
+	if n := hook.Count(); n != 3 {
+		t.Errorf("Count = %d, want 3", n)
+	}
+}
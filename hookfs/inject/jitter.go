@@ -0,0 +1,55 @@
+package inject
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/ethercflow/hookfs/hookfs"
+)
+
+// JitterHook sleeps for a random duration in [0, Max) before every operation.
+// Unlike a fixed delay, this perturbs the order in which concurrent operations complete,
+// which helps to surface ordering assumptions and races.
+//
+// Every operation is delayed, so expect throughput to drop, noticeably so for
+// metadata-heavy workloads. With the same seed, the sequence of delays is the same,
+// although which operation gets which delay depends on scheduling.
+//
+// JitterHook implements all the hookfs.HookOnXXX interfaces.
+type JitterHook struct {
+	gate
+	max time.Duration
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+// NewJitterHook creates a JitterHook sleeping less than max (typically sub-millisecond),
+// with delays drawn from a generator seeded with seed.
+func NewJitterHook(max time.Duration, seed int64) *JitterHook {
+	h := &JitterHook{
+		max: max,
+		rnd: rand.New(rand.NewSource(seed)),
+	}
+	h.pick = func(op string, path string) (hookfs.Hook, error) {
+		time.Sleep(h.next())
+		return nil, nil
+	}
+	return h
+}
+
+// Max returns the upper bound of the delays.
+func (h *JitterHook) Max() time.Duration {
+	return h.max
+}
+
+// next returns the next delay.
+func (h *JitterHook) next() time.Duration {
+	if h.max <= 0 {
+		return 0
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return time.Duration(h.rnd.Int63n(int64(h.max)))
+}
@@ -0,0 +1,46 @@
+package inject
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestJitterHookBoundedAndSeeded(t *testing.T) {
+	const max = time.Millisecond
+	delays := func(seed int64) []time.Duration {
+		h := NewJitterHook(max, seed)
+		var d []time.Duration
+		for i := 0; i < 100; i++ {
+			d = append(d, h.next())
+		}
+		return d
+	}
+
+	a := delays(1)
+	for _, d := range a {
+		if d < 0 || d >= max {
+			t.Fatalf("delay %v out of [0, %v)", d, max)
+		}
+	}
+	if b := delays(1); !reflect.DeepEqual(a, b) {
+		t.Error("the same seed gave different delays")
+	}
+	if c := delays(2); reflect.DeepEqual(a, c) {
+		t.Error("different seeds gave the same delays")
+	}
+
+	// the operations sleep for the delays in turn
+	h := NewJitterHook(max, 1)
+	var want time.Duration
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		want += a[i]
+		if _, _, err := h.PreFlush("file"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if took := time.Since(start); took < want {
+		t.Errorf("10 operations took %v, want at least %v", took, want)
+	}
+}
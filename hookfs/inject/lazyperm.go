@@ -0,0 +1,171 @@
+package inject
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+// LazyPermissionHook models a backend applying permission changes asynchronously:
+// chmod and chown succeed right away, but GetAttr keeps reporting the previous mode and owner
+// until Delay has elapsed since the last change of the file.
+//
+// Changes are tracked by path, so a file renamed within Delay shows its real attributes
+// under the new name. The kernel caches attributes as well, so the real ones may show up
+// to an attribute timeout late.
+//
+// LazyPermissionHook implements hookfs.HookOnChmod, hookfs.HookOnChown and
+// hookfs.HookOnGetAttr.
+type LazyPermissionHook struct {
+	// Original is the original directory of the mount.
+	Original string
+
+	mu      sync.Mutex
+	delay   time.Duration
+	pending map[string]*staleAttr
+}
+
+// staleAttr is what GetAttr reports for a path until its changes have propagated.
+type staleAttr struct {
+	mode     uint32
+	hasMode  bool
+	uid, gid uint32
+	hasOwner bool
+	until    time.Time
+}
+
+// lazyPermCtx carries the attributes from before a change to the posthook.
+type lazyPermCtx struct {
+	path string
+	old  staleAttr
+}
+
+// NewLazyPermissionHook creates a LazyPermissionHook for original, where changes take delay to propagate.
+func NewLazyPermissionHook(original string, delay time.Duration) *LazyPermissionHook {
+	return &LazyPermissionHook{
+		Original: original,
+		delay:    delay,
+		pending:  make(map[string]*staleAttr),
+	}
+}
+
+// Delay returns the time changes take to propagate.
+func (h *LazyPermissionHook) Delay() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.delay
+}
+
+// SetDelay changes the time changes take to propagate. Changes already made are not affected.
+func (h *LazyPermissionHook) SetDelay(delay time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.delay = delay
+}
+
+// stat returns the attributes of path in Original as the stale ones, or nil.
+func (h *LazyPermissionHook) stat(path string) hookfs.HookContext {
+	path = cleanRel(path)
+	fi, err := os.Lstat(filepath.Join(h.Original, path))
+	if err != nil {
+		return nil
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	return &lazyPermCtx{
+		path: path,
+		old: staleAttr{
+			mode: st.Mode,
+			uid:  st.Uid,
+			gid:  st.Gid,
+		},
+	}
+}
+
+// changed records a successful change. If path has changes pending already, GetAttr keeps
+// reporting the attributes from before the first of them.
+func (h *LazyPermissionHook) changed(realRetCode int32, prehookCtx hookfs.HookContext, mode bool) {
+	ctx, ok := prehookCtx.(*lazyPermCtx)
+	if !ok || realRetCode != 0 {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := time.Now()
+	stale, ok := h.pending[ctx.path]
+	if !ok || !now.Before(stale.until) {
+		stale = &staleAttr{}
+		h.pending[ctx.path] = stale
+	}
+	if mode && !stale.hasMode {
+		stale.mode = ctx.old.mode
+		stale.hasMode = true
+	}
+	if !mode && !stale.hasOwner {
+		stale.uid, stale.gid = ctx.old.uid, ctx.old.gid
+		stale.hasOwner = true
+	}
+	stale.until = now.Add(h.delay)
+}
+
+// PreChmod implements hookfs.HookOnChmod
+func (h *LazyPermissionHook) PreChmod(path string, perms uint32) (bool, hookfs.HookContext, error) {
+	return false, h.stat(path), nil
+}
+
+// PostChmod implements hookfs.HookOnChmod
+func (h *LazyPermissionHook) PostChmod(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	h.changed(realRetCode, prehookCtx, true)
+	return false, nil
+}
+
+// PreChown implements hookfs.HookOnChown
+func (h *LazyPermissionHook) PreChown(path string, uid uint32, gid uint32) (bool, hookfs.HookContext, error) {
+	return false, h.stat(path), nil
+}
+
+// PostChown implements hookfs.HookOnChown
+func (h *LazyPermissionHook) PostChown(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	h.changed(realRetCode, prehookCtx, false)
+	return false, nil
+}
+
+// PreGetAttr implements hookfs.HookOnGetAttr
+func (h *LazyPermissionHook) PreGetAttr(path string) (bool, hookfs.HookContext, error) {
+	return false, cleanRel(path), nil
+}
+
+// PostGetAttr implements hookfs.HookOnGetAttr
+func (h *LazyPermissionHook) PostGetAttr(realRetCode int32, realAttr *fuse.Attr, prehookCtx hookfs.HookContext) (*fuse.Attr, bool, error) {
+	path, ok := prehookCtx.(string)
+	if !ok || realRetCode != 0 || realAttr == nil {
+		return nil, false, nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	stale, ok := h.pending[path]
+	if !ok {
+		return nil, false, nil
+	}
+	if !time.Now().Before(stale.until) {
+		delete(h.pending, path)
+		return nil, false, nil
+	}
+	attr := *realAttr
+	if stale.hasMode {
+		attr.Mode = stale.mode
+	}
+	if stale.hasOwner {
+		attr.Uid, attr.Gid = stale.uid, stale.gid
+	}
+	return &attr, true, nil
+}
@@ -0,0 +1,41 @@
+package inject
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethercflow/hookfs/hookfs"
+)
+
+func TestLazyPermissionHook(t *testing.T) {
+	const delay = 200 * time.Millisecond
+	original := t.TempDir()
+	hook := NewLazyPermissionHook(original, delay)
+	_, mnt := mountOriginal(t, original, hook, &hookfs.Options{AttrTimeout: -1})
+	if err := ioutil.WriteFile(filepath.Join(original, "file"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	mode := func() os.FileMode {
+		t.Helper()
+		fi, err := os.Stat(filepath.Join(mnt, "file"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fi.Mode().Perm()
+	}
+
+	if err := os.Chmod(filepath.Join(mnt, "file"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	changed := time.Now()
+	if got := mode(); got != 0644 && time.Since(changed) < delay {
+		t.Errorf("mode %v right after chmod, want the old 0644", got)
+	}
+	time.Sleep(delay)
+	if got := mode(); got != 0600 {
+		t.Errorf("mode %v after %v, want 0600", got, delay)
+	}
+}
@@ -0,0 +1,185 @@
+package inject
+
+import (
+	"sync"
+	"syscall"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	log "github.com/sirupsen/logrus"
+)
+
+// LeasePolicy is what a write lease excludes.
+type LeasePolicy int
+
+const (
+	// LeaseSingleWriter lets one handle at a time open a file for writing, while any number of
+	// handles read it.
+	LeaseSingleWriter LeasePolicy = iota
+	// LeaseExclusive lets one handle at a time open a file for writing, and no handle read it
+	// meanwhile, nor write it while it is being read, as with read and write leases.
+	LeaseExclusive
+)
+
+// String returns the name of the policy.
+func (p LeasePolicy) String() string {
+	switch p {
+	case LeaseSingleWriter:
+		return "single-writer"
+	case LeaseExclusive:
+		return "exclusive"
+	}
+	return "unknown"
+}
+
+// LeaseHook grants each handle opened on a file a read lease, a write lease or both, according
+// to its access mode, and fails the opens and creates whose lease conflicts with one held with
+// EWOULDBLOCK. Which leases conflict depends on the policy. Leases are given back on release.
+//
+// As with PerFileConcurrencyHook, handles opened before the hook was mounted hold no lease.
+//
+// LeaseHook implements hookfs.HookOnOpen, hookfs.HookOnCreate and hookfs.HookOnReleaseWithFlags.
+type LeaseHook struct {
+	mu        sync.Mutex
+	policy    LeasePolicy
+	leases    map[string]*fileHandles
+	conflicts uint64
+}
+
+// NewLeaseHook creates a LeaseHook enforcing policy.
+func NewLeaseHook(policy LeasePolicy) *LeaseHook {
+	return &LeaseHook{
+		policy: policy,
+		leases: make(map[string]*fileHandles),
+	}
+}
+
+// Policy returns what a write lease excludes.
+func (h *LeaseHook) Policy() LeasePolicy {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.policy
+}
+
+// SetPolicy changes what a write lease excludes. Leases already granted are kept.
+func (h *LeaseHook) SetPolicy(policy LeasePolicy) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.policy = policy
+}
+
+// Conflicts returns the number of opens and creates failed so far.
+func (h *LeaseHook) Conflicts() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.conflicts
+}
+
+// excluded returns whether the leases held on f exclude those of ctx. h.mu must be held.
+func (h *LeaseHook) excluded(f *fileHandles, ctx *perFileCtx) bool {
+	if ctx.writer && f.writers > 0 {
+		return true
+	}
+	if h.policy == LeaseExclusive {
+		return ctx.writer && f.readers > 0 || ctx.reader && f.writers > 0
+	}
+	return false
+}
+
+// acquire grants the leases of an open, which are given back if the open fails.
+func (h *LeaseHook) acquire(op string, path string, flags uint32) (bool, hookfs.HookContext, error) {
+	ctx := &perFileCtx{path: cleanRel(path)}
+	ctx.reader, ctx.writer = accessOf(flags)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	f, ok := h.leases[ctx.path]
+	if !ok {
+		f = &fileHandles{}
+	}
+	if h.excluded(f, ctx) {
+		h.conflicts++
+		log.WithFields(log.Fields{
+			"op":      op,
+			"path":    path,
+			"readers": f.readers,
+			"writers": f.writers,
+			"policy":  h.policy,
+		}).Debug("LeaseHook: lease held")
+		return true, nil, syscall.EWOULDBLOCK
+	}
+	h.add(ctx, 1)
+	return false, ctx, nil
+}
+
+// add adds n leases of the kind of ctx. h.mu must be held.
+func (h *LeaseHook) add(ctx *perFileCtx, n int) {
+	f, ok := h.leases[ctx.path]
+	if !ok {
+		f = &fileHandles{}
+		h.leases[ctx.path] = f
+	}
+	if ctx.reader {
+		f.readers += n
+	}
+	if ctx.writer {
+		f.writers += n
+	}
+	if f.readers <= 0 && f.writers <= 0 {
+		delete(h.leases, ctx.path)
+	}
+}
+
+func (h *LeaseHook) opened(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	ctx, ok := prehookCtx.(*perFileCtx)
+	if !ok || realRetCode == 0 {
+		return false, nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.add(ctx, -1)
+	return false, nil
+}
+
+// PreOpen implements hookfs.HookOnOpen
+func (h *LeaseHook) PreOpen(path string, flags uint32) (bool, hookfs.HookContext, error) {
+	return h.acquire(hookfs.OpOpen, path, flags)
+}
+
+// PostOpen implements hookfs.HookOnOpen
+func (h *LeaseHook) PostOpen(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return h.opened(realRetCode, prehookCtx)
+}
+
+// PreCreate implements hookfs.HookOnCreate
+func (h *LeaseHook) PreCreate(name string, flags uint32, mode uint32) (bool, hookfs.HookContext, error) {
+	return h.acquire(hookfs.OpCreate, name, flags)
+}
+
+// PostCreate implements hookfs.HookOnCreate
+func (h *LeaseHook) PostCreate(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return h.opened(realRetCode, prehookCtx)
+}
+
+// PreReleaseWithFlags implements hookfs.HookOnReleaseWithFlags
+func (h *LeaseHook) PreReleaseWithFlags(path string, flags uint32) (bool, hookfs.HookContext) {
+	ctx := &perFileCtx{path: cleanRel(path)}
+	ctx.reader, ctx.writer = accessOf(flags)
+	return false, ctx
+}
+
+// PostRelease implements hookfs.HookOnReleaseWithFlags
+func (h *LeaseHook) PostRelease(prehookCtx hookfs.HookContext) bool {
+	ctx, ok := prehookCtx.(*perFileCtx)
+	if !ok {
+		return false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	// don't go negative for handles opened before the hook counted them
+	f, ok := h.leases[ctx.path]
+	if !ok || ctx.reader && f.readers == 0 || ctx.writer && f.writers == 0 {
+		return false
+	}
+	h.add(ctx, -1)
+	return false
+}
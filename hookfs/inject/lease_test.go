@@ -0,0 +1,77 @@
+package inject
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+func TestLeaseHookBlocksSecondWriter(t *testing.T) {
+	for _, policy := range []LeasePolicy{LeaseSingleWriter, LeaseExclusive} {
+		t.Run(policy.String(), func(t *testing.T) {
+			original := t.TempDir()
+			if err := ioutil.WriteFile(filepath.Join(original, "file"), nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+			hook := NewLeaseHook(policy)
+			h, err := hookfs.NewHookFs(original, t.TempDir(), hook)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := &fuse.Context{}
+			first, code := h.Open("file", syscall.O_WRONLY, ctx)
+			if !code.Ok() {
+				t.Fatal(code)
+			}
+
+			r, code := h.Open("file", syscall.O_RDONLY, ctx)
+			if policy == LeaseExclusive && code != fuse.Status(syscall.EWOULDBLOCK) {
+				t.Errorf("reader during a write lease: %v, want EWOULDBLOCK", code)
+			}
+			if policy == LeaseSingleWriter {
+				if !code.Ok() {
+					t.Errorf("reader during a write lease: %v", code)
+				} else {
+					r.Release()
+				}
+			}
+
+			// the second writer retries until it gets the lease
+			var released int32
+			got := make(chan bool)
+			var refused int
+			go func() {
+				for {
+					second, code := h.Open("file", syscall.O_WRONLY, ctx)
+					if code.Ok() {
+						got <- atomic.LoadInt32(&released) == 1
+						second.Release()
+						return
+					}
+					if code != fuse.Status(syscall.EWOULDBLOCK) {
+						t.Errorf("second writer: %v, want EWOULDBLOCK", code)
+						got <- false
+						return
+					}
+					refused++
+					time.Sleep(time.Millisecond)
+				}
+			}()
+			time.Sleep(50 * time.Millisecond)
+			atomic.StoreInt32(&released, 1)
+			first.Release()
+			if afterRelease := <-got; !afterRelease {
+				t.Error("the second writer got the lease before the first one closed")
+			}
+			if refused == 0 || hook.Conflicts() < uint64(refused) {
+				t.Errorf("second writer refused %d times and Conflicts = %d, want it refused while the first was open", refused, hook.Conflicts())
+			}
+		})
+	}
+}
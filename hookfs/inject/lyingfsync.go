@@ -0,0 +1,186 @@
+package inject
+
+import (
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	log "github.com/sirupsen/logrus"
+)
+
+// LyingFsyncHook models a write cache that lies: with probability LieProbability, an fsync
+// reports success without making anything durable.
+//
+// Writes are volatile until an honest fsync of their file succeeds. Crash simulates a power
+// loss: every volatile write is undone in Original, oldest last, so files go back to their
+// content as of their last honest fsync. The hook keeps the previous content of every volatile
+// write in memory to do so. Only writes are undone; other operations, such as truncate and
+// rename, are considered durable right away.
+//
+// LyingFsyncHook implements hookfs.HookOnWrite and hookfs.HookOnFsync.
+type LyingFsyncHook struct {
+	// Original is the original directory of the mount.
+	Original string
+
+	mu             sync.Mutex
+	lieProbability float64
+	rnd            *rand.Rand
+	volatile       map[string][]undoRecord
+	lies           uint64
+}
+
+// undoRecord restores what a write overwrote.
+type undoRecord struct {
+	offset int64
+	data   []byte
+	size   int64 // size of the file before the write
+}
+
+type lyingFsyncCtx struct {
+	path string
+	// durable is the number of volatile writes made durable by the fsync
+	durable int
+}
+
+// NewLyingFsyncHook creates a LyingFsyncHook for original, lying with probability lieProbability
+// (0 to 1), drawing from a generator seeded with seed.
+func NewLyingFsyncHook(original string, lieProbability float64, seed int64) *LyingFsyncHook {
+	return &LyingFsyncHook{
+		Original:       original,
+		lieProbability: lieProbability,
+		rnd:            rand.New(rand.NewSource(seed)),
+		volatile:       make(map[string][]undoRecord),
+	}
+}
+
+// LieProbability returns the probability that an fsync lies.
+func (h *LyingFsyncHook) LieProbability() float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.lieProbability
+}
+
+// SetLieProbability changes the probability that an fsync lies.
+func (h *LyingFsyncHook) SetLieProbability(lieProbability float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lieProbability = lieProbability
+}
+
+// Lies returns the number of fsyncs that lied so far.
+func (h *LyingFsyncHook) Lies() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.lies
+}
+
+// Crash undoes all the volatile writes in Original. Files should not be written concurrently.
+// The kernel may still have the lost data cached; see hookfs.HookFs.InvalidateData.
+func (h *LyingFsyncHook) Crash() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var firstErr error
+	for path, records := range h.volatile {
+		if err := h.undo(path, records); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	h.volatile = make(map[string][]undoRecord)
+	return firstErr
+}
+
+func (h *LyingFsyncHook) undo(path string, records []undoRecord) error {
+	f, err := os.OpenFile(filepath.Join(h.Original, path), os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	log.WithFields(log.Fields{
+		"path":   path,
+		"writes": len(records),
+	}).Debug("LyingFsyncHook: dropping volatile writes")
+	for i := len(records) - 1; i >= 0; i-- {
+		r := records[i]
+		if _, err := f.WriteAt(r.data, r.offset); err != nil {
+			return err
+		}
+		if err := f.Truncate(r.size); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PreWrite implements hookfs.HookOnWrite
+func (h *LyingFsyncHook) PreWrite(path string, buf []byte, offset int64) (bool, hookfs.HookContext, error) {
+	path = cleanRel(path)
+	f, err := os.Open(filepath.Join(h.Original, path))
+	if err != nil {
+		return false, nil, nil
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return false, nil, nil
+	}
+	old := make([]byte, len(buf))
+	n, err := f.ReadAt(old, offset)
+	if err != nil && err != io.EOF {
+		return false, nil, nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.volatile[path] = append(h.volatile[path], undoRecord{
+		offset: offset,
+		data:   old[:n],
+		size:   fi.Size(),
+	})
+	return false, nil, nil
+}
+
+// PostWrite implements hookfs.HookOnWrite
+func (h *LyingFsyncHook) PostWrite(realRetCode int32, prehookCtx hookfs.HookContext) (uint32, bool, error) {
+	return 0, false, nil
+}
+
+// PreFsync implements hookfs.HookOnFsync
+func (h *LyingFsyncHook) PreFsync(path string, flags uint32) (bool, hookfs.HookContext, error) {
+	path = cleanRel(path)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.rnd.Float64() < h.lieProbability {
+		h.lies++
+		log.WithFields(log.Fields{
+			"path": path,
+		}).Debug("LyingFsyncHook: lying")
+		return true, nil, nil
+	}
+	return false, &lyingFsyncCtx{path: path, durable: len(h.volatile[path])}, nil
+}
+
+// PostFsync implements hookfs.HookOnFsync
+func (h *LyingFsyncHook) PostFsync(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	ctx, ok := prehookCtx.(*lyingFsyncCtx)
+	if !ok || realRetCode != 0 {
+		return false, nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	records := h.volatile[ctx.path]
+	if ctx.durable > len(records) {
+		// a crash in between
+		return false, nil
+	}
+	if ctx.durable == len(records) {
+		delete(h.volatile, ctx.path)
+	} else {
+		h.volatile[ctx.path] = append([]undoRecord(nil), records[ctx.durable:]...)
+	}
+	return false, nil
+}
@@ -0,0 +1,44 @@
+package inject
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethercflow/hookfs/hookfs"
+)
+
+func TestLyingFsyncHookLosesDataOnCrash(t *testing.T) {
+	original := t.TempDir()
+	hook := NewLyingFsyncHook(original, 0, 1)
+	_, mnt := mountOriginal(t, original, hook, &hookfs.Options{DirectIO: true})
+
+	f, err := os.Create(filepath.Join(mnt, "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	write := func(data string) {
+		t.Helper()
+		if _, err := f.WriteAt([]byte(data), 0); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Sync(); err != nil {
+			t.Fatalf("fsync = %v, want success", err)
+		}
+	}
+	write("durable")
+	hook.SetLieProbability(1)
+	write("lost!!!")
+	if hook.Lies() != 1 {
+		t.Errorf("%d lies, want 1", hook.Lies())
+	}
+
+	if err := hook.Crash(); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(original, "file")); err != nil || string(data) != "durable" {
+		t.Errorf("after the crash the file holds %q, %v, want what the honest fsync made durable", data, err)
+	}
+}
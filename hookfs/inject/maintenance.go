@@ -0,0 +1,121 @@
+package inject
+
+import (
+	"sync"
+	"syscall"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	"github.com/hanwen/go-fuse/fuse"
+	log "github.com/sirupsen/logrus"
+)
+
+// mutatingOps are the operations changing the contents, attributes or names of files.
+// Open and access are mutating depending on their flags.
+var mutatingOps = map[string]bool{
+	hookfs.OpWrite:       true,
+	hookfs.OpTruncate:    true,
+	hookfs.OpAllocate:    true,
+	hookfs.OpChown:       true,
+	hookfs.OpChmod:       true,
+	hookfs.OpUtimens:     true,
+	hookfs.OpSetXAttr:    true,
+	hookfs.OpRemoveXAttr: true,
+	hookfs.OpCreate:      true,
+	hookfs.OpMkdir:       true,
+	hookfs.OpMknod:       true,
+	hookfs.OpSymlink:     true,
+	hookfs.OpLink:        true,
+	hookfs.OpRename:      true,
+	hookfs.OpUnlink:      true,
+	hookfs.OpRmdir:       true,
+}
+
+// accessWrite is W_OK of access(2).
+const accessWrite = 2
+
+// MaintenanceModeHook makes the mount read-only while maintenance mode is on, without
+// remounting: operations changing files fail with EROFS, as do opens for writing or with
+// O_TRUNC and access(2) checks for W_OK, while reads go on. Handles opened for writing before
+// maintenance started stay open, but their writes fail until it ends.
+//
+// MaintenanceModeHook implements all the hookfs.HookOnXXX interfaces.
+type MaintenanceModeHook struct {
+	gate
+
+	mu       sync.Mutex
+	active   bool
+	rejected uint64
+}
+
+// NewMaintenanceModeHook creates a MaintenanceModeHook, in maintenance mode if active.
+func NewMaintenanceModeHook(active bool) *MaintenanceModeHook {
+	h := &MaintenanceModeHook{active: active}
+	h.pick = func(op string, path string) (hookfs.Hook, error) {
+		if !mutatingOps[op] {
+			return nil, nil
+		}
+		return nil, h.reject(op, path)
+	}
+	return h
+}
+
+// Active returns whether maintenance mode is on.
+func (h *MaintenanceModeHook) Active() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.active
+}
+
+// SetActive turns maintenance mode on or off. It is safe to call while mounted.
+func (h *MaintenanceModeHook) SetActive(active bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.active != active {
+		log.WithField("active", active).Info("MaintenanceModeHook: switching maintenance mode")
+	}
+	h.active = active
+}
+
+// Rejected returns the number of operations failed so far.
+func (h *MaintenanceModeHook) Rejected() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.rejected
+}
+
+// reject returns EROFS for op on path if maintenance mode is on, and nil otherwise.
+func (h *MaintenanceModeHook) reject(op string, path string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.active {
+		return nil
+	}
+	h.rejected++
+	log.WithFields(log.Fields{
+		"op":   op,
+		"path": path,
+	}).Debug("MaintenanceModeHook: read-only for maintenance")
+	return syscall.EROFS
+}
+
+// PreOpenWithContext implements hookfs.HookOnOpenWithContext
+func (h *MaintenanceModeHook) PreOpenWithContext(path string, flags uint32, context *fuse.Context) (bool, hookfs.HookContext, error) {
+	if _, writer := accessOf(flags); !writer && flags&syscall.O_TRUNC == 0 {
+		return false, nil, nil
+	}
+	if err := h.reject(hookfs.OpOpen, path); err != nil {
+		return true, nil, err
+	}
+	return false, nil, nil
+}
+
+// PreAccessWithContext implements hookfs.HookOnAccessWithContext
+func (h *MaintenanceModeHook) PreAccessWithContext(name string, mode uint32, context *fuse.Context) (bool, hookfs.HookContext, error) {
+	if mode&accessWrite == 0 {
+		return false, nil, nil
+	}
+	if err := h.reject(hookfs.OpAccess, name); err != nil {
+		return true, nil, err
+	}
+	return false, nil, nil
+}
@@ -0,0 +1,70 @@
+package inject
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+func TestMaintenanceModeHookRejectsWritesWhileActive(t *testing.T) {
+	original := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(original, "file"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	hook := NewMaintenanceModeHook(false)
+	h, err := hookfs.NewHookFs(original, t.TempDir(), hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := &fuse.Context{}
+	f, code := h.Open("file", syscall.O_RDWR, ctx)
+	if !code.Ok() {
+		t.Fatal(code)
+	}
+	defer f.Release()
+	if _, code := f.Write([]byte("D"), 0); !code.Ok() {
+		t.Fatalf("write before maintenance: %v", code)
+	}
+
+	hook.SetActive(true)
+	if _, code := f.Write([]byte("X"), 1); code != fuse.Status(syscall.EROFS) {
+		t.Errorf("write on a handle opened before maintenance: %v, want EROFS", code)
+	}
+	if _, code := h.Open("file", syscall.O_WRONLY, ctx); code != fuse.Status(syscall.EROFS) {
+		t.Errorf("open for writing during maintenance: %v, want EROFS", code)
+	}
+	if code := h.Mkdir("dir", 0755, ctx); code != fuse.Status(syscall.EROFS) {
+		t.Errorf("mkdir during maintenance: %v, want EROFS", code)
+	}
+	r, code := h.Open("file", syscall.O_RDONLY, ctx)
+	if !code.Ok() {
+		t.Fatalf("open for reading during maintenance: %v", code)
+	}
+	buf := make([]byte, 4)
+	res, code := r.Read(buf, 0)
+	if !code.Ok() {
+		t.Fatalf("read during maintenance: %v", code)
+	}
+	if data, _ := res.Bytes(buf); string(data) != "Data" {
+		t.Errorf("read %q during maintenance, want %q", data, "Data")
+	}
+	r.Release()
+	if n := hook.Rejected(); n != 3 {
+		t.Errorf("Rejected = %d, want 3", n)
+	}
+
+	hook.SetActive(false)
+	if _, code := f.Write([]byte("A"), 1); !code.Ok() {
+		t.Errorf("write after maintenance: %v", code)
+	}
+	if code := h.Mkdir("dir", 0755, ctx); !code.Ok() {
+		t.Errorf("mkdir after maintenance: %v", code)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(original, "file")); string(data) != "DAta" {
+		t.Errorf("original holds %q, want %q", data, "DAta")
+	}
+}
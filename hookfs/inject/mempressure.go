@@ -0,0 +1,198 @@
+package inject
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"syscall"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	log "github.com/sirupsen/logrus"
+)
+
+// memoryPressureOps are the operations a MemoryPressureHook can fail.
+var memoryPressureOps = []string{
+	hookfs.OpRead,
+	hookfs.OpWrite,
+	hookfs.OpAllocate,
+	hookfs.OpCreate,
+	hookfs.OpMkdir,
+	hookfs.OpMknod,
+	hookfs.OpSymlink,
+}
+
+// MemoryPressureHook fails operations with ENOMEM at random, as a filesystem short of memory
+// would, to exercise allocation failure paths. Only the target operations fail, and reads
+// and writes only if they are of at least MinSize bytes, so that small metadata operations
+// keep working.
+//
+// The operations that can be targeted are read, write, allocate, create, mkdir, mknod and
+// symlink (hookfs.OpXXX). By default, reads, allocates and creates are.
+//
+// MemoryPressureHook implements hookfs.HookOnReadMetadata, hookfs.HookOnWrite,
+// hookfs.HookOnAllocate, hookfs.HookOnCreate, hookfs.HookOnMkdir, hookfs.HookOnMknod and
+// hookfs.HookOnSymlink.
+type MemoryPressureHook struct {
+	mu          sync.Mutex
+	probability float64
+	minSize     int64
+	targets     map[string]bool
+	rnd         *rand.Rand
+}
+
+// NewMemoryPressureHook creates a MemoryPressureHook failing reads and writes of at least
+// minSize bytes, allocates and creates with probability probability (0 to 1), drawing from
+// a generator seeded with seed.
+func NewMemoryPressureHook(probability float64, minSize int64, seed int64) *MemoryPressureHook {
+	return &MemoryPressureHook{
+		probability: probability,
+		minSize:     minSize,
+		targets: map[string]bool{
+			hookfs.OpRead:     true,
+			hookfs.OpAllocate: true,
+			hookfs.OpCreate:   true,
+		},
+		rnd: rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Probability returns the probability that a target operation fails.
+func (h *MemoryPressureHook) Probability() float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.probability
+}
+
+// SetProbability changes the probability that a target operation fails.
+func (h *MemoryPressureHook) SetProbability(probability float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.probability = probability
+}
+
+// MinSize returns the size from which reads and writes may fail.
+func (h *MemoryPressureHook) MinSize() int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.minSize
+}
+
+// SetMinSize changes the size from which reads and writes may fail.
+func (h *MemoryPressureHook) SetMinSize(minSize int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.minSize = minSize
+}
+
+// Targets returns the operations that may fail, sorted.
+func (h *MemoryPressureHook) Targets() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	targets := make([]string, 0, len(h.targets))
+	for op := range h.targets {
+		targets = append(targets, op)
+	}
+	sort.Strings(targets)
+	return targets
+}
+
+// SetTargets changes the operations that may fail.
+// Operations that MemoryPressureHook can't fail are ignored.
+func (h *MemoryPressureHook) SetTargets(ops ...string) {
+	targets := make(map[string]bool)
+	for _, op := range ops {
+		for _, o := range memoryPressureOps {
+			if op == o {
+				targets[op] = true
+			}
+		}
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.targets = targets
+}
+
+// fail returns ENOMEM if the operation op of size bytes (-1 if it has no size) is to fail.
+func (h *MemoryPressureHook) fail(op string, path string, size int64) (bool, hookfs.HookContext, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.targets[op] || size >= 0 && size < h.minSize || h.rnd.Float64() >= h.probability {
+		return false, nil, nil
+	}
+	log.WithFields(log.Fields{
+		"op":   op,
+		"path": path,
+		"size": size,
+	}).Debug("MemoryPressureHook: returning ENOMEM")
+	return true, nil, syscall.ENOMEM
+}
+
+// PreReadMetadata implements hookfs.HookOnReadMetadata
+func (h *MemoryPressureHook) PreReadMetadata(path string, length int64, offset int64) (bool, hookfs.HookContext, error) {
+	return h.fail(hookfs.OpRead, path, length)
+}
+
+// PostReadMetadata implements hookfs.HookOnReadMetadata
+func (h *MemoryPressureHook) PostReadMetadata(realRetCode int32, realSize int, prehookCtx hookfs.HookContext) (bool, error) {
+	return false, nil
+}
+
+// PreWrite implements hookfs.HookOnWrite
+func (h *MemoryPressureHook) PreWrite(path string, buf []byte, offset int64) (bool, hookfs.HookContext, error) {
+	return h.fail(hookfs.OpWrite, path, int64(len(buf)))
+}
+
+// PostWrite implements hookfs.HookOnWrite
+func (h *MemoryPressureHook) PostWrite(realRetCode int32, prehookCtx hookfs.HookContext) (uint32, bool, error) {
+	return 0, false, nil
+}
+
+// PreAllocate implements hookfs.HookOnAllocate
+func (h *MemoryPressureHook) PreAllocate(path string, off uint64, size uint64, mode uint32) (bool, hookfs.HookContext, error) {
+	return h.fail(hookfs.OpAllocate, path, -1)
+}
+
+// PostAllocate implements hookfs.HookOnAllocate
+func (h *MemoryPressureHook) PostAllocate(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return false, nil
+}
+
+// PreCreate implements hookfs.HookOnCreate
+func (h *MemoryPressureHook) PreCreate(name string, flags uint32, mode uint32) (bool, hookfs.HookContext, error) {
+	return h.fail(hookfs.OpCreate, name, -1)
+}
+
+// PostCreate implements hookfs.HookOnCreate
+func (h *MemoryPressureHook) PostCreate(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return false, nil
+}
+
+// PreMkdir implements hookfs.HookOnMkdir
+func (h *MemoryPressureHook) PreMkdir(path string, mode uint32) (bool, hookfs.HookContext, error) {
+	return h.fail(hookfs.OpMkdir, path, -1)
+}
+
+// PostMkdir implements hookfs.HookOnMkdir
+func (h *MemoryPressureHook) PostMkdir(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return false, nil
+}
+
+// PreMknod implements hookfs.HookOnMknod
+func (h *MemoryPressureHook) PreMknod(name string, mode uint32, dev uint32) (bool, hookfs.HookContext, error) {
+	return h.fail(hookfs.OpMknod, name, -1)
+}
+
+// PostMknod implements hookfs.HookOnMknod
+func (h *MemoryPressureHook) PostMknod(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return false, nil
+}
+
+// PreSymlink implements hookfs.HookOnSymlink
+func (h *MemoryPressureHook) PreSymlink(value string, linkName string) (bool, hookfs.HookContext, error) {
+	return h.fail(hookfs.OpSymlink, linkName, -1)
+}
+
+// PostSymlink implements hookfs.HookOnSymlink
+func (h *MemoryPressureHook) PostSymlink(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return false, nil
+}
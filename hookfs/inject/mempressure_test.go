@@ -0,0 +1,58 @@
+package inject
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+func TestMemoryPressureHookFailsLargeReads(t *testing.T) {
+	original := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(original, "file"), make([]byte, 128<<10), 0644); err != nil {
+		t.Fatal(err)
+	}
+	h, err := hookfs.NewHookFs(original, t.TempDir(), NewMemoryPressureHook(0.3, 64<<10, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := &fuse.Context{}
+	f, code := h.Open("file", syscall.O_RDONLY, ctx)
+	if !code.Ok() {
+		t.Fatal(code)
+	}
+	defer f.Release()
+
+	const n = 200
+	read := func(size int) (failed int) {
+		t.Helper()
+		buf := make([]byte, size)
+		for i := 0; i < n; i++ {
+			switch _, code := f.Read(buf, 0); code {
+			case fuse.OK:
+			case fuse.Status(syscall.ENOMEM):
+				failed++
+			default:
+				t.Fatalf("read of %d bytes = %v, want OK or ENOMEM", size, code)
+			}
+		}
+		return failed
+	}
+	if failed := read(64 << 10); failed == 0 || failed == n {
+		t.Errorf("%d of %d large reads failed, want some of them", failed, n)
+	}
+	if failed := read(4096); failed != 0 {
+		t.Errorf("%d of %d small reads failed, want none", failed, n)
+	}
+	for i := 0; i < n; i++ {
+		if _, code := h.GetAttr("file", ctx); !code.Ok() {
+			t.Fatalf("getattr = %v, want OK", code)
+		}
+		if code := h.Access("file", syscall.F_OK, ctx); !code.Ok() {
+			t.Fatalf("access = %v, want OK", code)
+		}
+	}
+}
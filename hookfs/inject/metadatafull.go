@@ -0,0 +1,134 @@
+package inject
+
+import (
+	"sync/atomic"
+	"syscall"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	log "github.com/sirupsen/logrus"
+)
+
+// MetadataFullHook models a filesystem out of inodes but not of data blocks: operations creating
+// names (Create, Mkdir, Mknod, Symlink, Link, and Rename into another directory) fail with
+// ENOSPC, while existing files can still be written, unless FailWrites is set.
+//
+// MetadataFullHook implements hookfs.HookOnCreate, hookfs.HookOnMkdir, hookfs.HookOnMknod,
+// hookfs.HookOnSymlink, hookfs.HookOnLink, hookfs.HookOnRename and hookfs.HookOnWrite.
+type MetadataFullHook struct {
+	enabled    int32
+	failWrites int32
+}
+
+// NewMetadataFullHook creates an enabled MetadataFullHook letting writes to existing files through.
+func NewMetadataFullHook() *MetadataFullHook {
+	return &MetadataFullHook{enabled: 1}
+}
+
+// SetEnabled turns injection on or off. It is safe to call while mounted.
+func (h *MetadataFullHook) SetEnabled(enabled bool) {
+	atomic.StoreInt32(&h.enabled, boolToInt32(enabled))
+}
+
+// FailWrites returns whether writes to existing files fail with ENOSPC as well.
+func (h *MetadataFullHook) FailWrites() bool {
+	return atomic.LoadInt32(&h.failWrites) != 0
+}
+
+// SetFailWrites changes whether writes to existing files fail with ENOSPC as well.
+func (h *MetadataFullHook) SetFailWrites(failWrites bool) {
+	atomic.StoreInt32(&h.failWrites, boolToInt32(failWrites))
+}
+
+func boolToInt32(b bool) int32 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (h *MetadataFullHook) fail(op string, path string) (bool, hookfs.HookContext, error) {
+	if atomic.LoadInt32(&h.enabled) == 0 {
+		return false, nil, nil
+	}
+	log.WithFields(log.Fields{
+		"op":   op,
+		"path": path,
+	}).Debug("MetadataFullHook: returning ENOSPC")
+	return true, nil, syscall.ENOSPC
+}
+
+// PreCreate implements hookfs.HookOnCreate
+func (h *MetadataFullHook) PreCreate(name string, flags uint32, mode uint32) (bool, hookfs.HookContext, error) {
+	return h.fail(hookfs.OpCreate, name)
+}
+
+// PostCreate implements hookfs.HookOnCreate
+func (h *MetadataFullHook) PostCreate(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return false, nil
+}
+
+// PreMkdir implements hookfs.HookOnMkdir
+func (h *MetadataFullHook) PreMkdir(path string, mode uint32) (bool, hookfs.HookContext, error) {
+	return h.fail(hookfs.OpMkdir, path)
+}
+
+// PostMkdir implements hookfs.HookOnMkdir
+func (h *MetadataFullHook) PostMkdir(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return false, nil
+}
+
+// PreMknod implements hookfs.HookOnMknod
+func (h *MetadataFullHook) PreMknod(name string, mode uint32, dev uint32) (bool, hookfs.HookContext, error) {
+	return h.fail(hookfs.OpMknod, name)
+}
+
+// PostMknod implements hookfs.HookOnMknod
+func (h *MetadataFullHook) PostMknod(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return false, nil
+}
+
+// PreSymlink implements hookfs.HookOnSymlink
+func (h *MetadataFullHook) PreSymlink(value string, linkName string) (bool, hookfs.HookContext, error) {
+	return h.fail(hookfs.OpSymlink, linkName)
+}
+
+// PostSymlink implements hookfs.HookOnSymlink
+func (h *MetadataFullHook) PostSymlink(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return false, nil
+}
+
+// PreLink implements hookfs.HookOnLink
+func (h *MetadataFullHook) PreLink(oldName string, newName string) (bool, hookfs.HookContext, error) {
+	return h.fail(hookfs.OpLink, newName)
+}
+
+// PostLink implements hookfs.HookOnLink
+func (h *MetadataFullHook) PostLink(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return false, nil
+}
+
+// PreRename implements hookfs.HookOnRename
+func (h *MetadataFullHook) PreRename(oldName string, newName string) (bool, hookfs.HookContext, error) {
+	if parentRel(cleanRel(oldName)) == parentRel(cleanRel(newName)) {
+		return false, nil, nil
+	}
+	return h.fail(hookfs.OpRename, newName)
+}
+
+// PostRename implements hookfs.HookOnRename
+func (h *MetadataFullHook) PostRename(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return false, nil
+}
+
+// PreWrite implements hookfs.HookOnWrite
+func (h *MetadataFullHook) PreWrite(path string, buf []byte, offset int64) (bool, hookfs.HookContext, error) {
+	if !h.FailWrites() {
+		return false, nil, nil
+	}
+	return h.fail(hookfs.OpWrite, path)
+}
+
+// PostWrite implements hookfs.HookOnWrite
+func (h *MetadataFullHook) PostWrite(realRetCode int32, prehookCtx hookfs.HookContext) (uint32, bool, error) {
+	return 0, false, nil
+}
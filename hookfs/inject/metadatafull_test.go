@@ -0,0 +1,35 @@
+package inject
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/ethercflow/hookfs/hookfs"
+)
+
+func TestMetadataFullHook(t *testing.T) {
+	hook := NewMetadataFullHook()
+	_, original, mnt := mount(t, hook, &hookfs.Options{DirectIO: true})
+	if err := ioutil.WriteFile(filepath.Join(original, "existing"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(mnt, "new"), nil, 0644); !errors.Is(err, syscall.ENOSPC) {
+		t.Errorf("create = %v, want ENOSPC", err)
+	}
+	if err := os.Mkdir(filepath.Join(mnt, "dir"), 0755); !errors.Is(err, syscall.ENOSPC) {
+		t.Errorf("mkdir = %v, want ENOSPC", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(mnt, "existing"), []byte("data"), 0644); err != nil {
+		t.Errorf("writing an existing file: %v", err)
+	}
+
+	hook.SetFailWrites(true)
+	if err := ioutil.WriteFile(filepath.Join(mnt, "existing"), []byte("more"), 0644); !errors.Is(err, syscall.ENOSPC) {
+		t.Errorf("writing an existing file with FailWrites = %v, want ENOSPC", err)
+	}
+}
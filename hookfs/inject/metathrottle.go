@@ -0,0 +1,72 @@
+package inject
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/ethercflow/hookfs/hookfs"
+)
+
+// namespaceOps are the operations adding or removing names in directories.
+var namespaceOps = map[string]bool{
+	hookfs.OpCreate:  true,
+	hookfs.OpMkdir:   true,
+	hookfs.OpMknod:   true,
+	hookfs.OpSymlink: true,
+	hookfs.OpLink:    true,
+	hookfs.OpRename:  true,
+	hookfs.OpUnlink:  true,
+	hookfs.OpRmdir:   true,
+}
+
+// MetadataThrottleHook throttles the operations on directory entries (create, mkdir, mknod,
+// symlink, link, rename, unlink and rmdir) with a token bucket, making them wait rather than
+// fail, so that metadata-heavy workloads see a slow directory service while reads, writes
+// and the other operations run at full speed.
+//
+// MetadataThrottleHook implements all the hookfs.HookOnXXX interfaces.
+type MetadataThrottleHook struct {
+	gate
+	bucket *tokenBucket
+
+	throttled int64
+	waited    int64 // nanoseconds
+}
+
+// NewMetadataThrottleHook creates a MetadataThrottleHook admitting opsPerSecond operations on
+// average, with bursts of up to burst operations. A rate of 0 or less means no throttling.
+func NewMetadataThrottleHook(opsPerSecond float64, burst int) *MetadataThrottleHook {
+	h := &MetadataThrottleHook{bucket: newTokenBucket(opsPerSecond, burst)}
+	h.pick = func(op string, path string) (hookfs.Hook, error) {
+		if !namespaceOps[op] || h.bucket.getRate() <= 0 {
+			return nil, nil
+		}
+		if delay := h.bucket.wait(); delay > 0 {
+			atomic.AddInt64(&h.throttled, 1)
+			atomic.AddInt64(&h.waited, int64(delay))
+		}
+		return nil, nil
+	}
+	return h
+}
+
+// OpsPerSecond returns the sustained rate of operations on directory entries.
+func (h *MetadataThrottleHook) OpsPerSecond() float64 {
+	return h.bucket.getRate()
+}
+
+// SetOpsPerSecond changes the sustained rate of operations on directory entries.
+// It is safe to call while mounted.
+func (h *MetadataThrottleHook) SetOpsPerSecond(opsPerSecond float64) {
+	h.bucket.setRate(opsPerSecond)
+}
+
+// Throttled returns the number of operations that had to wait so far.
+func (h *MetadataThrottleHook) Throttled() int64 {
+	return atomic.LoadInt64(&h.throttled)
+}
+
+// Waited returns the total time operations waited so far.
+func (h *MetadataThrottleHook) Waited() time.Duration {
+	return time.Duration(atomic.LoadInt64(&h.waited))
+}
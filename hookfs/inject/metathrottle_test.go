@@ -0,0 +1,61 @@
+package inject
+
+import (
+	"fmt"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/hanwen/go-fuse/fuse/nodefs"
+)
+
+func TestMetadataThrottleHookCapsCreateRate(t *testing.T) {
+	const rate, creates = 50, 6
+	hook := NewMetadataThrottleHook(rate, 1)
+	h, err := hookfs.NewHookFs(t.TempDir(), t.TempDir(), hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := &fuse.Context{}
+
+	start := time.Now()
+	var f nodefs.File
+	for i := 0; i < creates; i++ {
+		created, code := h.Create(fmt.Sprintf("file%d", i), syscall.O_RDWR, 0644, ctx)
+		if !code.Ok() {
+			t.Fatal(code)
+		}
+		if i == 0 {
+			f = created
+		} else {
+			created.Release()
+		}
+	}
+	defer f.Release()
+	// the burst admits the first create right away, the others wait for a token each
+	if took, min := time.Since(start), time.Duration(creates-1)*time.Second/rate; took < min*9/10 {
+		t.Errorf("%d creates took %v, want at least %v", creates, took, min)
+	}
+	if n := hook.Throttled(); n != creates-1 {
+		t.Errorf("Throttled = %d, want %d", n, creates-1)
+	}
+
+	start = time.Now()
+	buf := make([]byte, 1)
+	for i := 0; i < 100; i++ {
+		if _, code := f.Read(buf, 0); !code.Ok() {
+			t.Fatal(code)
+		}
+		if _, code := h.GetAttr("file0", ctx); !code.Ok() {
+			t.Fatal(code)
+		}
+	}
+	if took := time.Since(start); took > time.Second/rate*10 {
+		t.Errorf("100 reads and getattrs took %v, want them unthrottled", took)
+	}
+	if n := hook.Throttled(); n != creates-1 {
+		t.Errorf("Throttled = %d after reads, want it unchanged", n)
+	}
+}
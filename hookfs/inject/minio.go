@@ -0,0 +1,180 @@
+package inject
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	log "github.com/sirupsen/logrus"
+)
+
+// MinIOStats counts the bytes asked for by callers and those actually transferred by
+// a MinIOSizeHook, the ratio being the I/O amplification.
+type MinIOStats struct {
+	ReadRequested  uint64
+	ReadFetched    uint64
+	WriteRequested uint64
+	WriteStored    uint64
+	// ReadModifyWrites is the number of writes that had to read a block first.
+	ReadModifyWrites uint64
+}
+
+// MinIOSizeHook models a backend doing I/O in whole blocks only: reads fetch the blocks covering
+// the requested range, and writes not covering whole blocks read the blocks, patch them and write
+// them back (read-modify-write). Blocks are never extended past the end of the file.
+//
+// The hook does the I/O on Original itself, bypassing the real read and write, so that it
+// transfers what a block device would. Stats reports the resulting amplification.
+//
+// MinIOSizeHook implements hookfs.HookOnRead and hookfs.HookOnWrite.
+type MinIOSizeHook struct {
+	// Original is the original directory of the mount.
+	Original string
+
+	blockSize int64
+
+	mu    sync.Mutex
+	stats MinIOStats
+}
+
+// NewMinIOSizeHook creates a MinIOSizeHook for original, doing I/O in blocks of blockSize bytes.
+func NewMinIOSizeHook(original string, blockSize int64) *MinIOSizeHook {
+	if blockSize <= 0 {
+		blockSize = 1
+	}
+	return &MinIOSizeHook{
+		Original:  original,
+		blockSize: blockSize,
+	}
+}
+
+// BlockSize returns the I/O size of the backend.
+func (h *MinIOSizeHook) BlockSize() int64 {
+	return h.blockSize
+}
+
+// Stats returns the bytes transferred so far.
+func (h *MinIOSizeHook) Stats() MinIOStats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.stats
+}
+
+// blocks returns the range of whole blocks covering [offset, offset+length),
+// clipped to size.
+func (h *MinIOSizeHook) blocks(offset int64, length int64, size int64) (int64, int64) {
+	start := offset / h.blockSize * h.blockSize
+	end := (offset + length + h.blockSize - 1) / h.blockSize * h.blockSize
+	if end > size {
+		end = size
+	}
+	if start > end {
+		start = end
+	}
+	return start, end
+}
+
+// readBlocks reads [start, end) of f.
+func readBlocks(f *os.File, start int64, end int64) ([]byte, error) {
+	buf := make([]byte, end-start)
+	n, err := f.ReadAt(buf, start)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// PreRead implements hookfs.HookOnRead
+func (h *MinIOSizeHook) PreRead(path string, length int64, offset int64) ([]byte, bool, hookfs.HookContext, error) {
+	f, err := os.Open(filepath.Join(h.Original, path))
+	if err != nil {
+		// let the real read report it
+		return nil, false, nil, nil
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, false, nil, nil
+	}
+
+	start, end := h.blocks(offset, length, fi.Size())
+	data, err := readBlocks(f, start, end)
+	if err != nil {
+		return nil, true, nil, err
+	}
+
+	h.mu.Lock()
+	h.stats.ReadRequested += uint64(length)
+	h.stats.ReadFetched += uint64(len(data))
+	h.mu.Unlock()
+
+	if offset-start >= int64(len(data)) {
+		return []byte{}, true, nil, nil
+	}
+	data = data[offset-start:]
+	if int64(len(data)) > length {
+		data = data[:length]
+	}
+	return data, true, nil, nil
+}
+
+// PostRead implements hookfs.HookOnRead
+func (h *MinIOSizeHook) PostRead(realRetCode int32, realBuf []byte, prehookCtx hookfs.HookContext) ([]byte, bool, error) {
+	return nil, false, nil
+}
+
+// PreWrite implements hookfs.HookOnWrite
+func (h *MinIOSizeHook) PreWrite(path string, buf []byte, offset int64) (bool, hookfs.HookContext, error) {
+	// serializes read-modify-writes, which would otherwise lose concurrent writes to a block
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	f, err := os.OpenFile(filepath.Join(h.Original, path), os.O_RDWR, 0)
+	if err != nil {
+		return false, nil, nil
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return false, nil, nil
+	}
+
+	end := offset + int64(len(buf))
+	size := fi.Size()
+	if end > size {
+		size = end
+	}
+	start, blocksEnd := h.blocks(offset, int64(len(buf)), size)
+	h.stats.WriteRequested += uint64(len(buf))
+
+	data := buf
+	if start != offset || blocksEnd != end {
+		data, err = readBlocks(f, start, blocksEnd)
+		if err != nil {
+			return true, nil, err
+		}
+		if int64(len(data)) < blocksEnd-start {
+			data = append(data, make([]byte, blocksEnd-start-int64(len(data)))...)
+		}
+		copy(data[offset-start:], buf)
+		h.stats.ReadModifyWrites++
+		h.stats.ReadFetched += uint64(len(data))
+	}
+
+	if _, err := f.WriteAt(data, start); err != nil {
+		log.WithFields(log.Fields{
+			"path":  path,
+			"error": err,
+		}).Warn("MinIOSizeHook: could not write blocks")
+		return true, nil, err
+	}
+	h.stats.WriteStored += uint64(len(data))
+	return true, nil, nil
+}
+
+// PostWrite implements hookfs.HookOnWrite
+func (h *MinIOSizeHook) PostWrite(realRetCode int32, prehookCtx hookfs.HookContext) (uint32, bool, error) {
+	return 0, false, nil
+}
@@ -0,0 +1,44 @@
+package inject
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethercflow/hookfs/hookfs"
+)
+
+func TestMinIOSizeHookReadModifyWrite(t *testing.T) {
+	const block = 4096
+	original := t.TempDir()
+	hook := NewMinIOSizeHook(original, block)
+	_, mnt := mountOriginal(t, original, hook, &hookfs.Options{DirectIO: true})
+	if err := ioutil.WriteFile(filepath.Join(original, "file"), bytes.Repeat([]byte("0"), 2*block), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.OpenFile(filepath.Join(mnt, "file"), os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte("1"), block+10); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	want := MinIOStats{WriteRequested: 1, ReadFetched: block, WriteStored: block, ReadModifyWrites: 1}
+	if got := hook.Stats(); got != want {
+		t.Errorf("stats %+v, want %+v", got, want)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(original, "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := bytes.Repeat([]byte("0"), 2*block)
+	expected[block+10] = '1'
+	if !bytes.Equal(data, expected) {
+		t.Error("the write did not patch the block in place")
+	}
+}
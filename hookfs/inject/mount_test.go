@@ -0,0 +1,81 @@
+package inject
+
+import (
+	"os/exec"
+	"runtime"
+	"runtime/debug"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ethercflow/hookfs/hookfs"
+)
+
+// mount serves a HookFs of a new original directory with hook and opts on a new mountpoint
+// until the end of the test. Tests mounting are skipped where fusermount is missing.
+func mount(t testing.TB, hook hookfs.Hook, opts *hookfs.Options) (h *hookfs.HookFs, original string, mountpoint string) {
+	t.Helper()
+	original = t.TempDir()
+	h, mountpoint = mountOriginal(t, original, hook, opts)
+	return h, original, mountpoint
+}
+
+// mountOriginal is mount for an original directory made by the test, e.g. to give it to
+// hooks before they are served.
+func mountOriginal(t testing.TB, original string, hook hookfs.Hook, opts *hookfs.Options) (h *hookfs.HookFs, mountpoint string) {
+	t.Helper()
+	if _, err := exec.LookPath("fusermount"); err != nil {
+		t.Skip("fusermount is needed to mount")
+	}
+	serveFromTest(t)
+	mountpoint = t.TempDir()
+	h, err := hookfs.NewHookFsWithOptions(original, mountpoint, hook, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var before syscall.Stat_t
+	if err := syscall.Stat(mountpoint, &before); err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() {
+		served <- h.Serve()
+	}()
+	// the mount is up once the mountpoint is on another device
+	for {
+		var st syscall.Stat_t
+		if err := syscall.Stat(mountpoint, &st); err == nil && st.Dev != before.Dev {
+			break
+		}
+		select {
+		case err := <-served:
+			t.Fatalf("Serve: %v", err)
+		case <-time.After(time.Millisecond):
+		}
+	}
+	t.Cleanup(func() {
+		// files closed by the test may still be released in the background
+		for i := 0; h.Unmount() != nil && i < 100; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err := <-served; err != nil {
+			t.Errorf("Serve: %v", err)
+		}
+	})
+	return h, mountpoint
+}
+
+// serveFromTest lets the test process serve the mount it uses until the end of the test.
+// The runtime adds the files the test opens to its poller, with FUSE_POLL requests that the
+// server can only answer if the opening goroutine, which keeps its processor meanwhile, left
+// it another one, and if the garbage collector does not wait for that processor to stop the
+// world.
+func serveFromTest(t testing.TB) {
+	if runtime.GOMAXPROCS(0) < 2 {
+		prev := runtime.GOMAXPROCS(2)
+		t.Cleanup(func() { runtime.GOMAXPROCS(prev) })
+	}
+	prev := debug.SetGCPercent(-1)
+	t.Cleanup(func() { debug.SetGCPercent(prev) })
+}
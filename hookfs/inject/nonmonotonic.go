@@ -0,0 +1,148 @@
+package inject
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	log "github.com/sirupsen/logrus"
+)
+
+// NonMonotonicTimeHook makes the mtime of files go backwards, as after a step of the clock of
+// the server: with probability Probability, a successful write or utimens on a regular file
+// is followed by setting its mtime Magnitude earlier than what it just became.
+//
+// The mtime is changed in Original, so that getattr, and everything else looking at the file,
+// reports it. Build tools comparing mtimes then see a file modified last as older than it was.
+// The kernel caches attributes for the attribute timeout of the mount, so the step may show
+// up that late.
+//
+// NonMonotonicTimeHook implements hookfs.HookOnWrite and hookfs.HookOnUtimens.
+type NonMonotonicTimeHook struct {
+	// Original is the original directory of the mount.
+	Original string
+
+	mu          sync.Mutex
+	rnd         *rand.Rand
+	probability float64
+	magnitude   time.Duration
+	steps       uint64
+}
+
+type nonMonotonicCtx struct {
+	path string
+}
+
+// NewNonMonotonicTimeHook creates a NonMonotonicTimeHook for original, stepping mtimes back by
+// magnitude with probability probability (0 to 1), drawing from a generator seeded with seed.
+func NewNonMonotonicTimeHook(original string, probability float64, magnitude time.Duration, seed int64) *NonMonotonicTimeHook {
+	return &NonMonotonicTimeHook{
+		Original:    original,
+		rnd:         rand.New(rand.NewSource(seed)),
+		probability: probability,
+		magnitude:   magnitude,
+	}
+}
+
+// Probability returns the probability that a write or utimens steps the mtime back.
+func (h *NonMonotonicTimeHook) Probability() float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.probability
+}
+
+// SetProbability changes the probability that a write or utimens steps the mtime back.
+func (h *NonMonotonicTimeHook) SetProbability(probability float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.probability = probability
+}
+
+// Magnitude returns how far back mtimes are stepped.
+func (h *NonMonotonicTimeHook) Magnitude() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.magnitude
+}
+
+// SetMagnitude changes how far back mtimes are stepped.
+func (h *NonMonotonicTimeHook) SetMagnitude(magnitude time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.magnitude = magnitude
+}
+
+// Steps returns the number of times an mtime was stepped back so far.
+func (h *NonMonotonicTimeHook) Steps() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.steps
+}
+
+// step sets the mtime of path back if the draw says so.
+func (h *NonMonotonicTimeHook) step(realRetCode int32, prehookCtx hookfs.HookContext) {
+	ctx, ok := prehookCtx.(*nonMonotonicCtx)
+	if !ok || realRetCode != 0 {
+		return
+	}
+
+	h.mu.Lock()
+	magnitude := h.magnitude
+	do := magnitude > 0 && h.rnd.Float64() < h.probability
+	h.mu.Unlock()
+	if !do {
+		return
+	}
+
+	path := filepath.Join(h.Original, ctx.path)
+	fi, err := os.Lstat(path)
+	if err != nil || !fi.Mode().IsRegular() {
+		return
+	}
+	atime := fi.ModTime()
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		atime = time.Unix(st.Atim.Unix())
+	}
+	mtime := fi.ModTime().Add(-magnitude)
+	if err := os.Chtimes(path, atime, mtime); err != nil {
+		log.WithFields(log.Fields{
+			"path":  ctx.path,
+			"error": err,
+		}).Warn("NonMonotonicTimeHook: could not step mtime back")
+		return
+	}
+	log.WithFields(log.Fields{
+		"path":  ctx.path,
+		"mtime": mtime,
+	}).Debug("NonMonotonicTimeHook: stepped mtime back")
+
+	h.mu.Lock()
+	h.steps++
+	h.mu.Unlock()
+}
+
+// PreWrite implements hookfs.HookOnWrite
+func (h *NonMonotonicTimeHook) PreWrite(path string, buf []byte, offset int64) (bool, hookfs.HookContext, error) {
+	return false, &nonMonotonicCtx{path: cleanRel(path)}, nil
+}
+
+// PostWrite implements hookfs.HookOnWrite
+func (h *NonMonotonicTimeHook) PostWrite(realRetCode int32, prehookCtx hookfs.HookContext) (uint32, bool, error) {
+	h.step(realRetCode, prehookCtx)
+	return 0, false, nil
+}
+
+// PreUtimens implements hookfs.HookOnUtimens
+func (h *NonMonotonicTimeHook) PreUtimens(path string, atime *time.Time, mtime *time.Time) (bool, hookfs.HookContext, error) {
+	return false, &nonMonotonicCtx{path: cleanRel(path)}, nil
+}
+
+// PostUtimens implements hookfs.HookOnUtimens
+func (h *NonMonotonicTimeHook) PostUtimens(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	h.step(realRetCode, prehookCtx)
+	return false, nil
+}
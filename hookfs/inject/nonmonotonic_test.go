@@ -0,0 +1,66 @@
+package inject
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+func TestNonMonotonicTimeHookMtimeDecreases(t *testing.T) {
+	original := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(original, "file"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	hook := NewNonMonotonicTimeHook(original, 0, time.Hour, 1)
+	h, err := hookfs.NewHookFs(original, t.TempDir(), hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := &fuse.Context{}
+	f, code := h.Open("file", syscall.O_WRONLY, ctx)
+	if !code.Ok() {
+		t.Fatal(code)
+	}
+	defer f.Release()
+	mtime := func() time.Time {
+		t.Helper()
+		attr, code := h.GetAttr("file", ctx)
+		if !code.Ok() {
+			t.Fatal(code)
+		}
+		return time.Unix(int64(attr.Mtime), int64(attr.Mtimensec))
+	}
+
+	if _, code := f.Write([]byte("a"), 0); !code.Ok() {
+		t.Fatal(code)
+	}
+	first := mtime()
+	if first.Before(time.Now().Add(-time.Minute)) {
+		t.Fatalf("mtime %v after a write with Probability 0, want it current", first)
+	}
+
+	hook.SetProbability(1)
+	if _, code := f.Write([]byte("b"), 1); !code.Ok() {
+		t.Fatal(code)
+	}
+	second := mtime()
+	if !second.Before(first) || second.After(first.Add(-50*time.Minute)) {
+		t.Errorf("mtime went from %v to %v over a write, want it about an hour earlier", first, second)
+	}
+
+	now := time.Now()
+	if code := h.Utimens("file", &now, &now, ctx); !code.Ok() {
+		t.Fatal(code)
+	}
+	if got := mtime(); !got.Before(now.Add(-50 * time.Minute)) {
+		t.Errorf("mtime %v after setting it to %v, want it an hour earlier", got, now)
+	}
+	if n := hook.Steps(); n != 2 {
+		t.Errorf("Steps = %d, want 2", n)
+	}
+}
@@ -0,0 +1,146 @@
+package inject
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	log "github.com/sirupsen/logrus"
+)
+
+// overloadSweepEvery is the number of accesses between sweeps of the paths no longer loaded.
+const overloadSweepEvery = 1024
+
+// OverloadHook models a resource that gets overloaded when accessed too often: every path has
+// a load, which every operation on it raises by 1 and which halves every Decay. Operations fail
+// with an errno, typically EAGAIN or EBUSY, with probability 1 - exp(-Sensitivity * load), so
+// hammering a path makes it fail more and more, and backing off lets it recover.
+//
+// OverloadHook implements all the hookfs.HookOnXXX interfaces.
+type OverloadHook struct {
+	gate
+	errno syscall.Errno
+
+	mu          sync.Mutex
+	rnd         *rand.Rand
+	sensitivity float64
+	decay       time.Duration
+	loads       map[string]*overloadLoad
+	accesses    uint64
+	failures    uint64
+}
+
+type overloadLoad struct {
+	load float64
+	at   time.Time
+}
+
+// NewOverloadHook creates an OverloadHook failing operations with errno, whose loads halve every
+// decay, drawing from a generator seeded with seed.
+func NewOverloadHook(sensitivity float64, decay time.Duration, errno syscall.Errno, seed int64) *OverloadHook {
+	h := &OverloadHook{
+		errno:       errno,
+		rnd:         rand.New(rand.NewSource(seed)),
+		sensitivity: sensitivity,
+		decay:       decay,
+		loads:       make(map[string]*overloadLoad),
+	}
+	h.pick = func(op string, path string) (hookfs.Hook, error) {
+		if !h.access(cleanRel(path), time.Now()) {
+			return nil, nil
+		}
+		log.WithFields(log.Fields{
+			"op":    op,
+			"path":  path,
+			"errno": h.errno,
+		}).Debug("OverloadHook: overloaded")
+		return nil, h.errno
+	}
+	return h
+}
+
+// Sensitivity returns how fast the failure probability rises with the load.
+func (h *OverloadHook) Sensitivity() float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.sensitivity
+}
+
+// SetSensitivity changes how fast the failure probability rises with the load.
+func (h *OverloadHook) SetSensitivity(sensitivity float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sensitivity = sensitivity
+}
+
+// Decay returns the half-life of the loads.
+func (h *OverloadHook) Decay() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.decay
+}
+
+// SetDecay changes the half-life of the loads.
+func (h *OverloadHook) SetDecay(decay time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.decay = decay
+}
+
+// Load returns the current load of path.
+func (h *OverloadHook) Load(path string) float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	l, ok := h.loads[cleanRel(path)]
+	if !ok {
+		return 0
+	}
+	return h.decayed(l, time.Now())
+}
+
+// Failures returns the number of operations failed so far.
+func (h *OverloadHook) Failures() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.failures
+}
+
+// decayed returns the load of l at now. h.mu must be held.
+func (h *OverloadHook) decayed(l *overloadLoad, now time.Time) float64 {
+	if h.decay <= 0 {
+		return l.load
+	}
+	return l.load * math.Exp2(-float64(now.Sub(l.at))/float64(h.decay))
+}
+
+// access records an operation on path and returns whether it fails.
+func (h *OverloadHook) access(path string, now time.Time) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.accesses++
+	if h.accesses%overloadSweepEvery == 0 {
+		for p, l := range h.loads {
+			if h.decayed(l, now) < 1e-3 {
+				delete(h.loads, p)
+			}
+		}
+	}
+
+	l, ok := h.loads[path]
+	if !ok {
+		l = &overloadLoad{}
+		h.loads[path] = l
+	}
+	l.load = h.decayed(l, now) + 1
+	l.at = now
+
+	p := 1 - math.Exp(-h.sensitivity*l.load)
+	if h.rnd.Float64() >= p {
+		return false
+	}
+	h.failures++
+	return true
+}
@@ -0,0 +1,56 @@
+package inject
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+func TestOverloadHookEscalatesAndRecovers(t *testing.T) {
+	const decay = 50 * time.Millisecond
+	original := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(original, "file"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	hook := NewOverloadHook(0.02, decay, syscall.EBUSY, 1)
+	h, err := hookfs.NewHookFs(original, t.TempDir(), hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// failures returns how many of n getattrs in a row fail
+	failures := func(n int) int {
+		t.Helper()
+		failed := 0
+		for i := 0; i < n; i++ {
+			_, code := h.GetAttr("file", &fuse.Context{})
+			switch {
+			case code == fuse.Status(syscall.EBUSY):
+				failed++
+			case !code.Ok():
+				t.Fatalf("getattr: %v, want EBUSY or success", code)
+			}
+		}
+		return failed
+	}
+
+	first, _, last := failures(50), failures(200), failures(50)
+	if first >= last || last < 45 {
+		t.Errorf("%d of the first 50 getattrs failed and %d of the last 50, want a rising failure rate", first, last)
+	}
+
+	time.Sleep(20 * decay)
+	if load := hook.Load("file"); load >= 1 {
+		t.Fatalf("Load = %v after a pause, want it decayed", load)
+	}
+	if after := failures(10); after > 5 {
+		t.Errorf("%d of 10 getattrs failed after a pause, want the path recovered", after)
+	}
+	if hook.Load("other") != 0 {
+		t.Errorf("Load of a path never accessed = %v, want 0", hook.Load("other"))
+	}
+}
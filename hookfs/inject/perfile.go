@@ -0,0 +1,186 @@
+package inject
+
+import (
+	"sync"
+	"syscall"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	log "github.com/sirupsen/logrus"
+)
+
+// PerFileConcurrencyHook caps the number of handles open on a file for reading and for writing.
+// Opens and creates in excess fail with an errno, typically EBUSY or EAGAIN.
+// A handle opened O_RDWR counts as both a reader and a writer.
+//
+// Handles are counted from Open and Create to Release, so handles opened before the hook was
+// mounted are not counted.
+//
+// PerFileConcurrencyHook implements hookfs.HookOnOpen, hookfs.HookOnCreate and
+// hookfs.HookOnReleaseWithFlags.
+type PerFileConcurrencyHook struct {
+	errno syscall.Errno
+
+	mu         sync.Mutex
+	maxReaders int
+	maxWriters int
+	handles    map[string]*fileHandles
+}
+
+type fileHandles struct {
+	readers, writers int
+}
+
+type perFileCtx struct {
+	path           string
+	reader, writer bool
+}
+
+// NewPerFileConcurrencyHook creates a PerFileConcurrencyHook allowing maxReaders readers and
+// maxWriters writers per file, failing excess opens with errno. A cap of 0 or less means no limit.
+func NewPerFileConcurrencyHook(maxReaders int, maxWriters int, errno syscall.Errno) *PerFileConcurrencyHook {
+	return &PerFileConcurrencyHook{
+		errno:      errno,
+		maxReaders: maxReaders,
+		maxWriters: maxWriters,
+		handles:    make(map[string]*fileHandles),
+	}
+}
+
+// MaxReaders returns the maximum number of handles open for reading per file.
+func (h *PerFileConcurrencyHook) MaxReaders() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.maxReaders
+}
+
+// SetMaxReaders changes the maximum number of handles open for reading per file.
+// Handles already open stay open.
+func (h *PerFileConcurrencyHook) SetMaxReaders(maxReaders int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.maxReaders = maxReaders
+}
+
+// MaxWriters returns the maximum number of handles open for writing per file.
+func (h *PerFileConcurrencyHook) MaxWriters() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.maxWriters
+}
+
+// SetMaxWriters changes the maximum number of handles open for writing per file.
+// Handles already open stay open.
+func (h *PerFileConcurrencyHook) SetMaxWriters(maxWriters int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.maxWriters = maxWriters
+}
+
+func accessOf(flags uint32) (reader bool, writer bool) {
+	switch flags & syscall.O_ACCMODE {
+	case syscall.O_RDONLY:
+		return true, false
+	case syscall.O_WRONLY:
+		return false, true
+	default:
+		return true, true
+	}
+}
+
+// acquire reserves a handle for an open, which is given back if the open fails.
+func (h *PerFileConcurrencyHook) acquire(op string, path string, flags uint32) (bool, hookfs.HookContext, error) {
+	ctx := &perFileCtx{path: cleanRel(path)}
+	ctx.reader, ctx.writer = accessOf(flags)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	f, ok := h.handles[ctx.path]
+	if !ok {
+		f = &fileHandles{}
+	}
+	if ctx.reader && h.maxReaders > 0 && f.readers >= h.maxReaders ||
+		ctx.writer && h.maxWriters > 0 && f.writers >= h.maxWriters {
+		log.WithFields(log.Fields{
+			"op":      op,
+			"path":    path,
+			"readers": f.readers,
+			"writers": f.writers,
+		}).Debug("PerFileConcurrencyHook: too many handles")
+		return true, nil, h.errno
+	}
+	h.add(ctx, 1)
+	return false, ctx, nil
+}
+
+// add adds n handles of the kind of ctx. h.mu must be held.
+func (h *PerFileConcurrencyHook) add(ctx *perFileCtx, n int) {
+	f, ok := h.handles[ctx.path]
+	if !ok {
+		f = &fileHandles{}
+		h.handles[ctx.path] = f
+	}
+	if ctx.reader {
+		f.readers += n
+	}
+	if ctx.writer {
+		f.writers += n
+	}
+	if f.readers <= 0 && f.writers <= 0 {
+		delete(h.handles, ctx.path)
+	}
+}
+
+func (h *PerFileConcurrencyHook) opened(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	ctx, ok := prehookCtx.(*perFileCtx)
+	if !ok || realRetCode == 0 {
+		return false, nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.add(ctx, -1)
+	return false, nil
+}
+
+// PreOpen implements hookfs.HookOnOpen
+func (h *PerFileConcurrencyHook) PreOpen(path string, flags uint32) (bool, hookfs.HookContext, error) {
+	return h.acquire(hookfs.OpOpen, path, flags)
+}
+
+// PostOpen implements hookfs.HookOnOpen
+func (h *PerFileConcurrencyHook) PostOpen(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return h.opened(realRetCode, prehookCtx)
+}
+
+// PreCreate implements hookfs.HookOnCreate
+func (h *PerFileConcurrencyHook) PreCreate(name string, flags uint32, mode uint32) (bool, hookfs.HookContext, error) {
+	return h.acquire(hookfs.OpCreate, name, flags)
+}
+
+// PostCreate implements hookfs.HookOnCreate
+func (h *PerFileConcurrencyHook) PostCreate(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return h.opened(realRetCode, prehookCtx)
+}
+
+// PreReleaseWithFlags implements hookfs.HookOnReleaseWithFlags
+func (h *PerFileConcurrencyHook) PreReleaseWithFlags(path string, flags uint32) (bool, hookfs.HookContext) {
+	ctx := &perFileCtx{path: cleanRel(path)}
+	ctx.reader, ctx.writer = accessOf(flags)
+	return false, ctx
+}
+
+// PostRelease implements hookfs.HookOnReleaseWithFlags
+func (h *PerFileConcurrencyHook) PostRelease(prehookCtx hookfs.HookContext) bool {
+	ctx, ok := prehookCtx.(*perFileCtx)
+	if !ok {
+		return false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	// don't go negative for handles opened before the hook counted them
+	f, ok := h.handles[ctx.path]
+	if !ok || ctx.reader && f.readers == 0 || ctx.writer && f.writers == 0 {
+		return false
+	}
+	h.add(ctx, -1)
+	return false
+}
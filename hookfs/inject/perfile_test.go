@@ -0,0 +1,63 @@
+package inject
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestPerFileConcurrencyHookCapsReaders(t *testing.T) {
+	const maxReaders, openers = 3, 10
+	hook := NewPerFileConcurrencyHook(maxReaders, 0, syscall.EBUSY)
+	_, original, mnt := mount(t, hook, nil)
+	if err := ioutil.WriteFile(filepath.Join(original, "file"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var opened []*os.File
+	busy := 0
+	var wg sync.WaitGroup
+	for i := 0; i < openers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f, err := os.Open(filepath.Join(mnt, "file"))
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				opened = append(opened, f)
+			case errors.Is(err, syscall.EBUSY):
+				busy++
+			default:
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if len(opened) != maxReaders || busy != openers-maxReaders {
+		t.Errorf("%d opens succeeded and %d got EBUSY, want %d and %d", len(opened), busy, maxReaders, openers-maxReaders)
+	}
+
+	for _, f := range opened {
+		f.Close()
+	}
+	// the kernel releases the handles in the background
+	for i := 0; ; i++ {
+		f, err := os.Open(filepath.Join(mnt, "file"))
+		if err == nil {
+			f.Close()
+			break
+		}
+		if i == 100 {
+			t.Fatalf("open after closing every handle: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
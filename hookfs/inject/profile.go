@@ -0,0 +1,161 @@
+package inject
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	log "github.com/sirupsen/logrus"
+)
+
+// Profile is a fault injection campaign for a ProfileHook: how each type of operation,
+// named by the hookfs.OpXXX constants, fails and is delayed. Operations without an entry
+// are left alone. For example, reads failing 1% of the time, writes 0.5% of the time,
+// and fsyncs taking up to 5ms more for 99% of them:
+//
+//	inject.Profile{
+//		hookfs.OpRead:  {FailProbability: 0.01, Errno: syscall.EIO},
+//		hookfs.OpWrite: {FailProbability: 0.005, Errno: syscall.EIO},
+//		hookfs.OpFsync: {Latency: []inject.Quantile{{0.99, 5 * time.Millisecond}, {1, 20 * time.Millisecond}}},
+//	}
+type Profile map[string]OpProfile
+
+// OpProfile is how a type of operation fails and is delayed.
+type OpProfile struct {
+	// FailProbability is the probability, from 0 to 1, that the operation fails with Errno
+	// (EIO if not set) instead of reaching the original filesystem. Release cannot fail.
+	FailProbability float64
+	Errno           syscall.Errno
+
+	// Latency is the distribution of the delay added to the operation, failed or not, as
+	// quantiles by increasing Fraction. The delay is interpolated linearly between quantiles,
+	// from 0 at fraction 0, and is the latency of the last quantile beyond it.
+	// No quantiles means no delay.
+	Latency []Quantile
+}
+
+// Quantile is a point of a latency distribution: a Fraction (0 to 1) of the delays
+// are at most Latency.
+type Quantile struct {
+	Fraction float64
+	Latency  time.Duration
+}
+
+// Validate returns an error if p is not a valid profile.
+func (p Profile) Validate() error {
+	for op, o := range p {
+		switch op {
+		case hookfs.OpOpen, hookfs.OpRelease, hookfs.OpGetLk, hookfs.OpSetLk, hookfs.OpSetLkw:
+		default:
+			if _, ok := opCategories[op]; !ok {
+				return fmt.Errorf("profile: unknown operation %q", op)
+			}
+		}
+		if o.FailProbability < 0 || o.FailProbability > 1 {
+			return fmt.Errorf("profile: %s: fail probability %v is not between 0 and 1", op, o.FailProbability)
+		}
+		prev := Quantile{}
+		for _, q := range o.Latency {
+			if q.Fraction <= prev.Fraction || q.Fraction > 1 || q.Latency < prev.Latency {
+				return fmt.Errorf("profile: %s: quantiles must increase within (0, 1]", op)
+			}
+			prev = q
+		}
+	}
+	return nil
+}
+
+// sample returns the delay at fraction u (0 to 1) of the distribution of o.
+func (o OpProfile) sample(u float64) time.Duration {
+	prev := Quantile{}
+	for _, q := range o.Latency {
+		if u <= q.Fraction {
+			r := (u - prev.Fraction) / (q.Fraction - prev.Fraction)
+			return prev.Latency + time.Duration(r*float64(q.Latency-prev.Latency))
+		}
+		prev = q
+	}
+	return prev.Latency
+}
+
+// ProfileHook applies a Profile, i.e. random failures and delays by operation type,
+// so that a whole fault campaign is one declarative value.
+//
+// ProfileHook implements all the hookfs.HookOnXXX interfaces.
+type ProfileHook struct {
+	gate
+
+	mu      sync.Mutex
+	profile Profile
+	rnd     *rand.Rand
+}
+
+// NewProfileHook creates a ProfileHook applying profile, drawing from a generator seeded
+// with seed. It returns an error if the profile is not valid.
+func NewProfileHook(profile Profile, seed int64) (*ProfileHook, error) {
+	h := &ProfileHook{rnd: rand.New(rand.NewSource(seed))}
+	if err := h.SetProfile(profile); err != nil {
+		return nil, err
+	}
+	h.pick = h.pickOp
+	return h, nil
+}
+
+// Profile returns the profile applied.
+func (h *ProfileHook) Profile() Profile {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.profile.clone()
+}
+
+// SetProfile changes the profile applied. It returns an error, and leaves the profile
+// unchanged, if profile is not valid. It is safe to call while mounted.
+func (h *ProfileHook) SetProfile(profile Profile) error {
+	if err := profile.Validate(); err != nil {
+		return err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.profile = profile.clone()
+	return nil
+}
+
+func (p Profile) clone() Profile {
+	c := make(Profile, len(p))
+	for op, o := range p {
+		o.Latency = append([]Quantile(nil), o.Latency...)
+		c[op] = o
+	}
+	return c
+}
+
+func (h *ProfileHook) pickOp(op string, path string) (hookfs.Hook, error) {
+	h.mu.Lock()
+	o, ok := h.profile[op]
+	if !ok {
+		h.mu.Unlock()
+		return nil, nil
+	}
+	delay := o.sample(h.rnd.Float64())
+	fail := op != hookfs.OpRelease && h.rnd.Float64() < o.FailProbability
+	h.mu.Unlock()
+
+	time.Sleep(delay)
+	if !fail {
+		return nil, nil
+	}
+	errno := o.Errno
+	if errno == 0 {
+		errno = syscall.EIO
+	}
+	log.WithFields(log.Fields{
+		"op":    op,
+		"path":  path,
+		"errno": errno,
+		"delay": delay,
+	}).Debug("ProfileHook: injecting")
+	return nil, errno
+}
@@ -0,0 +1,94 @@
+package inject
+
+import (
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+func TestProfileHookAppliesProfile(t *testing.T) {
+	hook, err := NewProfileHook(Profile{
+		hookfs.OpGetAttr: {FailProbability: 0.25, Errno: syscall.EACCES},
+		// all but the fastest 1% take 20ms
+		hookfs.OpMkdir: {Latency: []Quantile{{0.01, 20 * time.Millisecond}, {1, 20 * time.Millisecond}}},
+		hookfs.OpRmdir: {FailProbability: 1},
+	}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := hookfs.NewHookFs(t.TempDir(), t.TempDir(), hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := &fuse.Context{}
+
+	const n = 2000
+	failed := 0
+	for i := 0; i < n; i++ {
+		switch _, code := h.GetAttr("", ctx); code {
+		case fuse.OK:
+		case fuse.Status(syscall.EACCES):
+			failed++
+		default:
+			t.Fatalf("getattr = %v, want OK or EACCES", code)
+		}
+	}
+	if failed < n/5 || failed > n*3/10 {
+		t.Errorf("%d of %d getattrs failed, want about a quarter", failed, n)
+	}
+
+	start := time.Now()
+	if code := h.Mkdir("dir", 0755, ctx); !code.Ok() {
+		t.Errorf("mkdir = %v, want OK", code)
+	}
+	if took := time.Since(start); took < 20*time.Millisecond {
+		t.Errorf("mkdir took %v, want at least 20ms", took)
+	}
+	// errno defaults to EIO
+	if code := h.Rmdir("dir", ctx); code != fuse.EIO {
+		t.Errorf("rmdir = %v, want EIO", code)
+	}
+	// operations without a profile are left alone
+	for i := 0; i < 100; i++ {
+		if code := h.Access("", syscall.F_OK, ctx); !code.Ok() {
+			t.Fatalf("access = %v, want OK", code)
+		}
+	}
+}
+
+func TestProfileSample(t *testing.T) {
+	o := OpProfile{Latency: []Quantile{{0.5, 10 * time.Millisecond}, {1, 50 * time.Millisecond}}}
+	for _, tt := range []struct {
+		u    float64
+		want time.Duration
+	}{
+		{0, 0},
+		{0.25, 5 * time.Millisecond},
+		{0.5, 10 * time.Millisecond},
+		{0.75, 30 * time.Millisecond},
+		{1, 50 * time.Millisecond},
+	} {
+		if got := o.sample(tt.u); got != tt.want {
+			t.Errorf("sample(%v) = %v, want %v", tt.u, got, tt.want)
+		}
+	}
+}
+
+func TestProfileValidate(t *testing.T) {
+	for _, p := range []Profile{
+		{"nosuchop": {}},
+		{hookfs.OpRead: {FailProbability: 1.5}},
+		{hookfs.OpRead: {Latency: []Quantile{{0.9, time.Second}, {0.5, time.Second}}}},
+		{hookfs.OpRead: {Latency: []Quantile{{0.5, time.Second}, {0.9, time.Millisecond}}}},
+	} {
+		if err := p.Validate(); err == nil {
+			t.Errorf("%v is valid, want an error", p)
+		}
+		if _, err := NewProfileHook(p, 1); err == nil {
+			t.Errorf("NewProfileHook(%v) succeeded, want an error", p)
+		}
+	}
+}
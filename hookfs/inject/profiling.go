@@ -0,0 +1,136 @@
+package inject
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+// OpTiming is where the time of a type of operation went, as returned by ProfilingHook.Summary.
+type OpTiming struct {
+	Op    string
+	Calls uint64
+	// Total is the time the operations took in hookfs, from the kernel's request to the reply.
+	Total time.Duration
+	// Hook is the time spent in the prehooks and posthooks of the profiled hook.
+	Hook time.Duration
+	// Lower is the rest of Total: mostly the original filesystem, plus what hookfs itself takes.
+	Lower time.Duration
+}
+
+// ProfilingHook measures how much time each type of operation takes, and how that time splits
+// between a hook and the original filesystem, e.g. to check what a latency hook adds.
+// Operations go to hook, as if it was mounted itself, and the timings add up over all the
+// operations of a type. Summary reports them; WriteFolded renders them for flamegraphs.
+//
+// The calls of hookfs.GlobalHook are forwarded to hook as well, if it implements it, and count
+// as Lower rather than Hook.
+//
+// ProfilingHook implements hookfs.GlobalHook and all the hookfs.HookOnXXX interfaces.
+type ProfilingHook struct {
+	gate
+	hook hookfs.Hook
+
+	mu  sync.Mutex
+	ops map[string]*OpTiming
+}
+
+// NewProfilingHook creates a ProfilingHook profiling hook, which may be nil to profile
+// hookfs and the original filesystem alone.
+func NewProfilingHook(hook hookfs.Hook) *ProfilingHook {
+	h := &ProfilingHook{
+		hook: hook,
+		ops:  make(map[string]*OpTiming),
+	}
+	h.pick = func(op string, path string) (hookfs.Hook, error) {
+		return h.hook, nil
+	}
+	h.spent = func(op string, took time.Duration) {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.op(op).Hook += took
+	}
+	return h
+}
+
+// Hook returns the profiled hook.
+func (h *ProfilingHook) Hook() hookfs.Hook {
+	return h.hook
+}
+
+// op returns the timing of op, adding it if it is missing. h.mu must be held.
+func (h *ProfilingHook) op(op string) *OpTiming {
+	t, ok := h.ops[op]
+	if !ok {
+		t = &OpTiming{Op: op}
+		h.ops[op] = t
+	}
+	return t
+}
+
+// Summary returns the timings of the operations seen so far, by decreasing Total.
+func (h *ProfilingHook) Summary() []OpTiming {
+	h.mu.Lock()
+	summary := make([]OpTiming, 0, len(h.ops))
+	for _, t := range h.ops {
+		summary = append(summary, *t)
+	}
+	h.mu.Unlock()
+
+	for i := range summary {
+		// operations in progress may have spent time in the hook already
+		if summary[i].Lower = summary[i].Total - summary[i].Hook; summary[i].Lower < 0 {
+			summary[i].Lower = 0
+		}
+	}
+	sort.Slice(summary, func(i, j int) bool {
+		if summary[i].Total != summary[j].Total {
+			return summary[i].Total > summary[j].Total
+		}
+		return summary[i].Op < summary[j].Op
+	})
+	return summary
+}
+
+// WriteFolded writes the summary to w in the folded stacks format of flamegraph.pl, one
+// "op;hook" and one "op;lower" line per operation, weighted in microseconds.
+func (h *ProfilingHook) WriteFolded(w io.Writer) error {
+	for _, t := range h.Summary() {
+		if _, err := fmt.Fprintf(w, "%s;hook %d\n%s;lower %d\n",
+			t.Op, t.Hook/time.Microsecond, t.Op, t.Lower/time.Microsecond); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reset forgets the timings so far.
+func (h *ProfilingHook) Reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.ops = make(map[string]*OpTiming)
+}
+
+// BeforeOp implements hookfs.GlobalHook
+func (h *ProfilingHook) BeforeOp(op string, path string) {
+	if hook, ok := h.hook.(hookfs.GlobalHook); ok {
+		hook.BeforeOp(op, path)
+	}
+}
+
+// AfterOp implements hookfs.GlobalHook
+func (h *ProfilingHook) AfterOp(op string, path string, status fuse.Status, took time.Duration) {
+	if hook, ok := h.hook.(hookfs.GlobalHook); ok {
+		hook.AfterOp(op, path, status, took)
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	t := h.op(op)
+	t.Calls++
+	t.Total += took
+}
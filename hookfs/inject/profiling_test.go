@@ -0,0 +1,93 @@
+package inject
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+func TestProfilingHookAttributesLatency(t *testing.T) {
+	const delay = 20 * time.Millisecond
+	original := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(original, "file"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	hook := NewProfilingHook(&DelayHook{Delay: delay, Paths: []string{"file"}})
+	h, err := hookfs.NewHookFs(original, t.TempDir(), hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := &fuse.Context{}
+	for i := 0; i < 3; i++ {
+		if _, code := h.GetAttr("file", ctx); !code.Ok() {
+			t.Fatal(code)
+		}
+	}
+	f, code := h.Open("file", syscall.O_RDONLY, ctx)
+	if !code.Ok() {
+		t.Fatal(code)
+	}
+	buf := make([]byte, 4)
+	for i := 0; i < 2; i++ {
+		if _, code := f.Read(buf, 0); !code.Ok() {
+			t.Fatal(code)
+		}
+	}
+	f.Release()
+	// not delayed, the directory doesn't match
+	if _, code := h.GetAttr("", ctx); !code.Ok() {
+		t.Fatal(code)
+	}
+
+	timings := make(map[string]OpTiming)
+	for _, timing := range hook.Summary() {
+		timings[timing.Op] = timing
+		if timing.Hook+timing.Lower != timing.Total {
+			t.Errorf("%s: Hook %v and Lower %v don't add up to Total %v", timing.Op, timing.Hook, timing.Lower, timing.Total)
+		}
+	}
+	for _, want := range []struct {
+		op     string
+		calls  uint64
+		hookAt time.Duration
+	}{
+		{hookfs.OpGetAttr, 4, 3 * delay},
+		{hookfs.OpOpen, 1, delay},
+		{hookfs.OpRead, 2, 2 * delay},
+		{hookfs.OpRelease, 1, 0},
+	} {
+		got := timings[want.op]
+		if got.Calls != want.calls || got.Hook < want.hookAt || got.Hook > want.hookAt+delay {
+			t.Errorf("%s: %d calls with %v in the hook, want %d calls with %v", want.op, got.Calls, got.Hook, want.calls, want.hookAt)
+		}
+		// the loopback takes microseconds
+		if got.Lower > delay {
+			t.Errorf("%s: %v in the original filesystem, want it fast", want.op, got.Lower)
+		}
+	}
+	if summary := hook.Summary(); summary[0].Op != hookfs.OpGetAttr {
+		t.Errorf("Summary starts with %s, want %s, which took longest", summary[0].Op, hookfs.OpGetAttr)
+	}
+
+	var folded bytes.Buffer
+	if err := hook.WriteFolded(&folded); err != nil {
+		t.Fatal(err)
+	}
+	line := fmt.Sprintf("%s;hook %d\n", hookfs.OpGetAttr, timings[hookfs.OpGetAttr].Hook/time.Microsecond)
+	if !strings.HasPrefix(folded.String(), line) {
+		t.Errorf("folded stacks start with %q, want %q", folded.String(), line)
+	}
+
+	hook.Reset()
+	if summary := hook.Summary(); len(summary) != 0 {
+		t.Errorf("Summary = %v after Reset, want it empty", summary)
+	}
+}
@@ -0,0 +1,69 @@
+package inject
+
+import (
+	"syscall"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	log "github.com/sirupsen/logrus"
+)
+
+// OpenRateLimitHook limits the rate of Open and Create with a token bucket.
+// Opens in excess of the rate fail with EAGAIN, which is useful for simulating open storms.
+//
+// OpenRateLimitHook implements hookfs.HookOnOpen and hookfs.HookOnCreate.
+type OpenRateLimitHook struct {
+	bucket *tokenBucket
+}
+
+// NewOpenRateLimitHook creates an OpenRateLimitHook admitting opensPerSecond opens on average,
+// with bursts of up to burst opens.
+func NewOpenRateLimitHook(opensPerSecond float64, burst int) *OpenRateLimitHook {
+	return &OpenRateLimitHook{bucket: newTokenBucket(opensPerSecond, burst)}
+}
+
+// OpensPerSecond returns the sustained open rate.
+func (h *OpenRateLimitHook) OpensPerSecond() float64 {
+	return h.bucket.getRate()
+}
+
+// SetOpensPerSecond changes the sustained open rate. It is safe to call while mounted.
+func (h *OpenRateLimitHook) SetOpensPerSecond(opensPerSecond float64) {
+	h.bucket.setRate(opensPerSecond)
+}
+
+func (h *OpenRateLimitHook) admit(op string, path string) error {
+	if h.bucket.take() {
+		return nil
+	}
+	log.WithFields(log.Fields{
+		"op":   op,
+		"path": path,
+	}).Debug("OpenRateLimitHook: returning EAGAIN")
+	return syscall.EAGAIN
+}
+
+// PreOpen implements hookfs.HookOnOpen
+func (h *OpenRateLimitHook) PreOpen(path string, flags uint32) (bool, hookfs.HookContext, error) {
+	if err := h.admit("open", path); err != nil {
+		return true, nil, err
+	}
+	return false, nil, nil
+}
+
+// PostOpen implements hookfs.HookOnOpen
+func (h *OpenRateLimitHook) PostOpen(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return false, nil
+}
+
+// PreCreate implements hookfs.HookOnCreate
+func (h *OpenRateLimitHook) PreCreate(path string, flags uint32, mode uint32) (bool, hookfs.HookContext, error) {
+	if err := h.admit("create", path); err != nil {
+		return true, nil, err
+	}
+	return false, nil, nil
+}
+
+// PostCreate implements hookfs.HookOnCreate
+func (h *OpenRateLimitHook) PostCreate(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return false, nil
+}
@@ -0,0 +1,42 @@
+package inject
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestOpenRateLimitHook(t *testing.T) {
+	const rate, burst, window = 50, 5, 400 * time.Millisecond
+	hook := NewOpenRateLimitHook(rate, burst)
+	_, original, mnt := mount(t, hook, nil)
+	if err := ioutil.WriteFile(filepath.Join(original, "file"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opened, refused := 0, 0
+	for start := time.Now(); time.Since(start) < window; {
+		f, err := os.Open(filepath.Join(mnt, "file"))
+		if errors.Is(err, syscall.EAGAIN) {
+			refused++
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+		opened++
+	}
+	if refused == 0 {
+		t.Error("no open failed with EAGAIN")
+	}
+	// the burst, then the sustained rate over the window
+	want := burst + int(rate*window.Seconds())
+	if opened < want/2 || opened > want*3/2 {
+		t.Errorf("%d opens in %v succeeded, want about %d", opened, window, want)
+	}
+}
@@ -0,0 +1,103 @@
+package inject
+
+import (
+	"sync"
+	"syscall"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	log "github.com/sirupsen/logrus"
+)
+
+// ReadAheadLimitHook caps how far ahead of its previous read a handle may read: a read starting
+// more than Window bytes past the end of the previous read through the same handle fails with
+// EINVAL. Reads going backwards are allowed. The first read of a handle is measured from
+// offset 0.
+//
+// The kernel does its own read-ahead, so mount with hookfs.Options.DirectIO to limit the reads
+// of the application rather than those of the kernel.
+//
+// ReadAheadLimitHook implements hookfs.HookOnReadWithHandle and hookfs.HookOnReleaseWithHandle.
+type ReadAheadLimitHook struct {
+	mu       sync.Mutex
+	window   int64
+	next     map[uint64]int64 // end of the previous read, by handle
+	rejected uint64
+}
+
+type readAheadCtx struct {
+	handle uint64
+	end    int64
+}
+
+// NewReadAheadLimitHook creates a ReadAheadLimitHook allowing reads up to window bytes ahead.
+func NewReadAheadLimitHook(window int64) *ReadAheadLimitHook {
+	return &ReadAheadLimitHook{
+		window: window,
+		next:   make(map[uint64]int64),
+	}
+}
+
+// Window returns how many bytes past its previous read a handle may read.
+func (h *ReadAheadLimitHook) Window() int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.window
+}
+
+// SetWindow changes how many bytes past its previous read a handle may read.
+func (h *ReadAheadLimitHook) SetWindow(window int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.window = window
+}
+
+// Rejected returns the number of reads failed so far.
+func (h *ReadAheadLimitHook) Rejected() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.rejected
+}
+
+// PreReadWithHandle implements hookfs.HookOnReadWithHandle
+func (h *ReadAheadLimitHook) PreReadWithHandle(path string, length int64, offset int64, handle uint64) ([]byte, bool, hookfs.HookContext, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	next := h.next[handle]
+	if offset > next+h.window {
+		h.rejected++
+		log.WithFields(log.Fields{
+			"path":   path,
+			"handle": handle,
+			"offset": offset,
+			"next":   next,
+			"window": h.window,
+		}).Debug("ReadAheadLimitHook: reading too far ahead")
+		return nil, true, nil, syscall.EINVAL
+	}
+	return nil, false, &readAheadCtx{handle: handle, end: offset}, nil
+}
+
+// PostRead implements hookfs.HookOnReadWithHandle
+func (h *ReadAheadLimitHook) PostRead(realRetCode int32, realBuf []byte, prehookCtx hookfs.HookContext) ([]byte, bool, error) {
+	ctx, ok := prehookCtx.(*readAheadCtx)
+	if !ok || realRetCode != 0 {
+		return nil, false, nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.next[ctx.handle] = ctx.end + int64(len(realBuf))
+	return nil, false, nil
+}
+
+// PreReleaseWithHandle implements hookfs.HookOnReleaseWithHandle
+func (h *ReadAheadLimitHook) PreReleaseWithHandle(path string, flags uint32, handle uint64) (bool, hookfs.HookContext) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.next, handle)
+	return false, nil
+}
+
+// PostRelease implements hookfs.HookOnReleaseWithHandle
+func (h *ReadAheadLimitHook) PostRelease(prehookCtx hookfs.HookContext) bool {
+	return false
+}
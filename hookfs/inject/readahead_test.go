@@ -0,0 +1,56 @@
+package inject
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/ethercflow/hookfs/hookfs"
+)
+
+func TestReadAheadLimitHookPerHandle(t *testing.T) {
+	const window = 4096
+	hook := NewReadAheadLimitHook(window)
+	_, original, mnt := mount(t, hook, &hookfs.Options{DirectIO: true})
+	if err := ioutil.WriteFile(filepath.Join(original, "file"), make([]byte, 2<<20), 0644); err != nil {
+		t.Fatal(err)
+	}
+	open := func() *os.File {
+		t.Helper()
+		f, err := os.Open(filepath.Join(mnt, "file"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { f.Close() })
+		return f
+	}
+	buf := make([]byte, window)
+	f1, f2 := open(), open()
+
+	for off := int64(0); off < 4*window; off += window {
+		if _, err := f1.ReadAt(buf, off); err != nil {
+			t.Errorf("sequential read at %d = %v, want success", off, err)
+		}
+	}
+	if _, err := f1.ReadAt(buf, 1<<20); !errors.Is(err, syscall.EINVAL) {
+		t.Errorf("read far ahead = %v, want EINVAL", err)
+	}
+
+	// f2 has not read yet: where f1 is now is too far ahead for it
+	if _, err := f2.ReadAt(buf, 4*window); !errors.Is(err, syscall.EINVAL) {
+		t.Errorf("read of another handle at %d = %v, want EINVAL", 4*window, err)
+	}
+	if _, err := f2.ReadAt(buf, window); err != nil {
+		t.Errorf("read of another handle within its window = %v, want success", err)
+	}
+	// going back is fine
+	if _, err := f1.ReadAt(buf, 0); err != nil {
+		t.Errorf("read backwards = %v, want success", err)
+	}
+	if n := hook.Rejected(); n != 2 {
+		t.Errorf("Rejected = %d, want 2", n)
+	}
+}
@@ -0,0 +1,83 @@
+package inject
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	log "github.com/sirupsen/logrus"
+)
+
+// ReadCompareHook reads every range that is read through the mount from a secondary
+// directory as well, and reports divergence. This is useful for A/B verification
+// when migrating between storage systems.
+//
+// The secondary directory is read directly, never through the mount.
+//
+// ReadCompareHook implements hookfs.HookOnRead.
+type ReadCompareHook struct {
+	// Secondary is the root of the secondary copy of the original directory.
+	Secondary string
+	// OnMismatch, if set, is called for every read whose data differs.
+	// secondary is nil if the secondary could not be read at all.
+	OnMismatch func(path string, offset int64, primary []byte, secondary []byte)
+	// FailOnMismatch makes reads that differ fail with EIO.
+	FailOnMismatch bool
+}
+
+type readCompareCtx struct {
+	path   string
+	length int64
+	offset int64
+}
+
+// PreRead implements hookfs.HookOnRead
+func (h *ReadCompareHook) PreRead(path string, length int64, offset int64) ([]byte, bool, hookfs.HookContext, error) {
+	return nil, false, readCompareCtx{path: path, length: length, offset: offset}, nil
+}
+
+// PostRead implements hookfs.HookOnRead
+func (h *ReadCompareHook) PostRead(realRetCode int32, realBuf []byte, prehookCtx hookfs.HookContext) ([]byte, bool, error) {
+	ctx := prehookCtx.(readCompareCtx)
+	if realRetCode != 0 {
+		return nil, false, nil
+	}
+
+	secondary, err := h.readSecondary(ctx)
+	if err == nil && bytes.Equal(realBuf, secondary) {
+		return nil, false, nil
+	}
+
+	log.WithFields(log.Fields{
+		"path":         ctx.path,
+		"offset":       ctx.offset,
+		"primaryLen":   len(realBuf),
+		"secondaryLen": len(secondary),
+		"error":        err,
+	}).Warn("ReadCompareHook: primary and secondary differ")
+	if h.OnMismatch != nil {
+		h.OnMismatch(ctx.path, ctx.offset, realBuf, secondary)
+	}
+	if h.FailOnMismatch {
+		return nil, true, syscall.EIO
+	}
+	return nil, false, nil
+}
+
+func (h *ReadCompareHook) readSecondary(ctx readCompareCtx) ([]byte, error) {
+	f, err := os.Open(filepath.Join(h.Secondary, ctx.path))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, ctx.length)
+	n, err := f.ReadAt(buf, ctx.offset)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return buf[:n], nil
+}
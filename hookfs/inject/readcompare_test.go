@@ -0,0 +1,54 @@
+package inject
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+
+	"github.com/ethercflow/hookfs/hookfs"
+)
+
+func TestReadCompareHookDetectsDivergence(t *testing.T) {
+	for _, fail := range []bool{false, true} {
+		var mu sync.Mutex
+		mismatched := map[string]bool{}
+		hook := &ReadCompareHook{
+			Secondary: t.TempDir(),
+			OnMismatch: func(path string, offset int64, primary []byte, secondary []byte) {
+				mu.Lock()
+				defer mu.Unlock()
+				mismatched[path] = true
+			},
+			FailOnMismatch: fail,
+		}
+		_, original, mnt := mount(t, hook, &hookfs.Options{DirectIO: true})
+		for dir, files := range map[string]map[string]string{
+			original:       {"same": "identical", "diverged": "primary"},
+			hook.Secondary: {"same": "identical", "diverged": "secondary"},
+		} {
+			for name, data := range files {
+				if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+
+		if _, err := ioutil.ReadFile(filepath.Join(mnt, "same")); err != nil {
+			t.Errorf("FailOnMismatch %v: reading same: %v", fail, err)
+		}
+		_, err := ioutil.ReadFile(filepath.Join(mnt, "diverged"))
+		if fail && !errors.Is(err, syscall.EIO) {
+			t.Errorf("FailOnMismatch %v: reading diverged = %v, want EIO", fail, err)
+		} else if !fail && err != nil {
+			t.Errorf("FailOnMismatch %v: reading diverged: %v", fail, err)
+		}
+		mu.Lock()
+		if mismatched["same"] || !mismatched["diverged"] {
+			t.Errorf("FailOnMismatch %v: mismatches reported for %v, want diverged only", fail, mismatched)
+		}
+		mu.Unlock()
+	}
+}
@@ -0,0 +1,136 @@
+package inject
+
+import (
+	"context"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	log "github.com/sirupsen/logrus"
+)
+
+// RemoteAction is what a decision service tells a RemoteHook to do with an operation.
+type RemoteAction int
+
+const (
+	// RemotePass lets the operation through.
+	RemotePass RemoteAction = iota
+	// RemoteDelay delays the operation by Delay, then lets it through.
+	RemoteDelay
+	// RemoteFail fails the operation with Errno, EIO if not set.
+	RemoteFail
+)
+
+// RemoteRequest describes an operation to a decision service.
+type RemoteRequest struct {
+	Op   string
+	Path string
+}
+
+// RemoteDecision is the answer of a decision service.
+type RemoteDecision struct {
+	Action RemoteAction
+	Delay  time.Duration
+	Errno  syscall.Errno
+}
+
+// DecisionClient asks a decision service what to do with an operation. The gRPC client of
+// remotegrpc/decision.proto is remotegrpc.Client, in a module of its own so that hookfs does
+// not depend on gRPC.
+//
+// Decide must return once ctx is done: that is what makes the timeout of a RemoteHook work,
+// as a client ignoring ctx keeps the operation waiting for as long as it takes.
+type DecisionClient interface {
+	Decide(ctx context.Context, req RemoteRequest) (RemoteDecision, error)
+}
+
+// RemoteHook asks an out-of-process decision service, such as a central chaos controller,
+// what to do with every operation: let it through, delay it or fail it.
+//
+// A decision taking longer than Timeout, or failing, lets the operation through if the hook
+// fails open, and fails it with EIO otherwise. Timeout is enforced by cancelling the context
+// passed to the DecisionClient, so it only holds for clients honouring it. Release cannot fail, and is only delayed.
+// Every operation waits for its decision, so the service should answer quickly.
+//
+// Delays in progress end when the mount stops, so that hookfs.HookFs.Unmount does not wait
+// for them.
+//
+// RemoteHook implements hookfs.HookWithInit, hookfs.HookWithStop and all the hookfs.HookOnXXX
+// interfaces.
+type RemoteHook struct {
+	// accessed atomically; first for 64-bit alignment on 32-bit platforms
+	errors uint64
+
+	gate
+	stopper
+	client   DecisionClient
+	timeout  time.Duration
+	failOpen bool
+}
+
+// NewRemoteHook creates a RemoteHook asking client, waiting timeout at most for a decision
+// (no limit if 0), and letting operations through on errors if failOpen.
+func NewRemoteHook(client DecisionClient, timeout time.Duration, failOpen bool) *RemoteHook {
+	h := &RemoteHook{
+		client:   client,
+		timeout:  timeout,
+		failOpen: failOpen,
+	}
+	h.pick = h.pickOp
+	return h
+}
+
+// Timeout returns the longest time to wait for a decision.
+func (h *RemoteHook) Timeout() time.Duration {
+	return h.timeout
+}
+
+// FailOpen returns whether operations go through when no decision could be obtained.
+func (h *RemoteHook) FailOpen() bool {
+	return h.failOpen
+}
+
+// Errors returns the number of decisions that could not be obtained so far.
+func (h *RemoteHook) Errors() uint64 {
+	return atomic.LoadUint64(&h.errors)
+}
+
+func (h *RemoteHook) pickOp(op string, path string) (hookfs.Hook, error) {
+	ctx := context.Background()
+	if h.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+	}
+	d, err := h.client.Decide(ctx, RemoteRequest{Op: op, Path: path})
+	if err != nil {
+		atomic.AddUint64(&h.errors, 1)
+		log.WithFields(log.Fields{
+			"op":       op,
+			"path":     path,
+			"error":    err,
+			"failOpen": h.failOpen,
+		}).Warn("RemoteHook: no decision")
+		if h.failOpen {
+			return nil, nil
+		}
+		return nil, syscall.EIO
+	}
+
+	switch d.Action {
+	case RemoteDelay:
+		t := time.NewTimer(d.Delay)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-h.stopped():
+		}
+	case RemoteFail:
+		if d.Errno == 0 {
+			return nil, syscall.EIO
+		}
+		return nil, d.Errno
+	}
+	return nil, nil
+}
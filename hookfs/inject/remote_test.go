@@ -0,0 +1,107 @@
+package inject
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+// fakeDecisionClient answers every request with decide.
+type fakeDecisionClient struct {
+	decide func(req RemoteRequest) (RemoteDecision, error)
+}
+
+func (c fakeDecisionClient) Decide(ctx context.Context, req RemoteRequest) (RemoteDecision, error) {
+	return c.decide(req)
+}
+
+func newRemoteHookFs(t *testing.T, hook *RemoteHook) *hookfs.HookFs {
+	t.Helper()
+	original := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(original, "file"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	h, err := hookfs.NewHookFs(original, t.TempDir(), hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func TestRemoteHookAppliesDecisions(t *testing.T) {
+	const delay = 50 * time.Millisecond
+	client := fakeDecisionClient{func(req RemoteRequest) (RemoteDecision, error) {
+		switch req.Op {
+		case hookfs.OpGetAttr:
+			return RemoteDecision{Action: RemoteDelay, Delay: delay}, nil
+		case hookfs.OpOpen:
+			return RemoteDecision{Action: RemoteFail, Errno: syscall.EROFS}, nil
+		}
+		return RemoteDecision{Action: RemotePass}, nil
+	}}
+	h := newRemoteHookFs(t, NewRemoteHook(client, 0, false))
+
+	start := time.Now()
+	if _, code := h.GetAttr("file", &fuse.Context{}); !code.Ok() {
+		t.Errorf("delayed getattr: %v", code)
+	}
+	if took := time.Since(start); took < delay {
+		t.Errorf("delayed getattr took %v, want at least %v", took, delay)
+	}
+	if _, code := h.Open("file", syscall.O_RDONLY, &fuse.Context{}); code != fuse.Status(syscall.EROFS) {
+		t.Errorf("failed open: %v, want EROFS", code)
+	}
+	if code := h.Access("file", 0, &fuse.Context{}); !code.Ok() {
+		t.Errorf("passed access: %v", code)
+	}
+}
+
+func TestRemoteHookErrors(t *testing.T) {
+	client := fakeDecisionClient{func(req RemoteRequest) (RemoteDecision, error) {
+		return RemoteDecision{}, errors.New("unavailable")
+	}}
+	for _, failOpen := range []bool{false, true} {
+		hook := NewRemoteHook(client, time.Second, failOpen)
+		h := newRemoteHookFs(t, hook)
+		_, code := h.GetAttr("file", &fuse.Context{})
+		if failOpen && !code.Ok() {
+			t.Errorf("getattr failing open: %v, want it through", code)
+		}
+		if !failOpen && code != fuse.EIO {
+			t.Errorf("getattr failing closed: %v, want EIO", code)
+		}
+		if n := hook.Errors(); n != 1 {
+			t.Errorf("%d errors counted, want 1", n)
+		}
+	}
+}
+
+func TestRemoteHookStopEndsDelays(t *testing.T) {
+	client := fakeDecisionClient{func(req RemoteRequest) (RemoteDecision, error) {
+		return RemoteDecision{Action: RemoteDelay, Delay: time.Hour}, nil
+	}}
+	hook := NewRemoteHook(client, 0, false)
+	h := newRemoteHookFs(t, hook)
+	if err := hook.Init(); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.GetAttr("file", &fuse.Context{})
+	}()
+	time.Sleep(10 * time.Millisecond)
+	hook.Stop()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("a delayed getattr went on after the hook was stopped")
+	}
+}
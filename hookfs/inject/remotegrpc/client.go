@@ -0,0 +1,57 @@
+// Package remotegrpc connects inject.RemoteHook to a decision service over gRPC, as defined
+// by decision.proto, e.g.
+//
+//	conn, err := grpc.NewClient("controller:50051", grpc.WithTransportCredentials(insecure.NewCredentials()))
+//	...
+//	hook := inject.NewRemoteHook(remotegrpc.NewClient(conn), 100*time.Millisecond, true)
+//
+// It is a module of its own, so that hookfs and its other hooks don't depend on gRPC. It
+// requires a published version of hookfs: to build it against a local checkout, e.g. while
+// changing RemoteHook, put both modules in a go.work rather than adding a replace directive.
+package remotegrpc
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative decision.proto
+
+import (
+	"context"
+	"fmt"
+	"syscall"
+	"time"
+
+	"github.com/ethercflow/hookfs/hookfs/inject"
+	"google.golang.org/grpc"
+)
+
+// Client is an inject.DecisionClient asking a DecisionService over gRPC.
+type Client struct {
+	client DecisionServiceClient
+}
+
+// NewClient creates a Client asking the DecisionService served on conn.
+func NewClient(conn grpc.ClientConnInterface) *Client {
+	return &Client{client: NewDecisionServiceClient(conn)}
+}
+
+// Decide implements inject.DecisionClient. The call is cancelled when ctx is done, so the
+// timeout of the RemoteHook applies. An action Client does not know is an error.
+func (c *Client) Decide(ctx context.Context, req inject.RemoteRequest) (inject.RemoteDecision, error) {
+	d, err := c.client.Decide(ctx, &DecisionRequest{Op: req.Op, Path: req.Path})
+	if err != nil {
+		return inject.RemoteDecision{}, err
+	}
+	decision := inject.RemoteDecision{
+		Delay: time.Duration(d.GetDelayNs()),
+		Errno: syscall.Errno(d.GetErrno()),
+	}
+	switch d.GetAction() {
+	case Decision_PASS:
+		decision.Action = inject.RemotePass
+	case Decision_DELAY:
+		decision.Action = inject.RemoteDelay
+	case Decision_FAIL:
+		decision.Action = inject.RemoteFail
+	default:
+		return inject.RemoteDecision{}, fmt.Errorf("remotegrpc: unknown action %v", d.GetAction())
+	}
+	return decision, nil
+}
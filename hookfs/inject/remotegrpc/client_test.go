@@ -0,0 +1,97 @@
+package remotegrpc
+
+import (
+	"context"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ethercflow/hookfs/hookfs/inject"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// cannedServer decides by the path of the operation.
+type cannedServer struct {
+	UnimplementedDecisionServiceServer
+	decisions map[string]*Decision
+	// slow is a path answered too late
+	slow string
+}
+
+func (s *cannedServer) Decide(ctx context.Context, req *DecisionRequest) (*Decision, error) {
+	if req.GetPath() == s.slow {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	if d, ok := s.decisions[req.GetPath()]; ok {
+		return d, nil
+	}
+	return &Decision{}, nil
+}
+
+// serve serves s in process until the end of the test, returning a Client of it.
+func serve(t *testing.T, s DecisionServiceServer) *Client {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	RegisterDecisionServiceServer(server, s)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return NewClient(conn)
+}
+
+func TestRemoteHookOverGRPC(t *testing.T) {
+	client := serve(t, &cannedServer{
+		decisions: map[string]*Decision{
+			"delayed": {Action: Decision_DELAY, DelayNs: int64(50 * time.Millisecond)},
+			"full":    {Action: Decision_FAIL, Errno: int32(syscall.ENOSPC)},
+			"broken":  {Action: Decision_FAIL},
+		},
+		slow: "slow",
+	})
+
+	for _, failOpen := range []bool{false, true} {
+		hook := inject.NewRemoteHook(client, 20*time.Millisecond, failOpen)
+		slowErr := error(syscall.EIO)
+		if failOpen {
+			slowErr = nil
+		}
+		for _, tc := range []struct {
+			path    string
+			err     error
+			atLeast time.Duration
+		}{
+			{"passed", nil, 0},
+			{"delayed", nil, 50 * time.Millisecond},
+			{"full", syscall.ENOSPC, 0},
+			{"broken", syscall.EIO, 0},
+			{"slow", slowErr, 0},
+		} {
+			start := time.Now()
+			hooked, _, err := hook.PreMkdirWithContext(tc.path, 0755, nil)
+			took := time.Since(start)
+			if err != tc.err || hooked != (tc.err != nil) {
+				t.Errorf("failOpen %v: mkdir %s = hooked %v, %v, want %v", failOpen, tc.path, hooked, err, tc.err)
+			}
+			if took < tc.atLeast {
+				t.Errorf("failOpen %v: mkdir %s took %v, want at least %v", failOpen, tc.path, took, tc.atLeast)
+			}
+		}
+		if got := hook.Errors(); got != 1 {
+			t.Errorf("failOpen %v: %d decisions failed, want 1", failOpen, got)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+// Decision service consulted by inject.RemoteHook through remotegrpc.Client.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.10
+// 	protoc        (unknown)
+// source: decision.proto
+
+package remotegrpc
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Decision_Action int32
+
+const (
+	Decision_PASS  Decision_Action = 0
+	Decision_DELAY Decision_Action = 1
+	Decision_FAIL  Decision_Action = 2
+)
+
+// Enum value maps for Decision_Action.
+var (
+	Decision_Action_name = map[int32]string{
+		0: "PASS",
+		1: "DELAY",
+		2: "FAIL",
+	}
+	Decision_Action_value = map[string]int32{
+		"PASS":  0,
+		"DELAY": 1,
+		"FAIL":  2,
+	}
+)
+
+func (x Decision_Action) Enum() *Decision_Action {
+	p := new(Decision_Action)
+	*p = x
+	return p
+}
+
+func (x Decision_Action) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Decision_Action) Descriptor() protoreflect.EnumDescriptor {
+	return file_decision_proto_enumTypes[0].Descriptor()
+}
+
+func (Decision_Action) Type() protoreflect.EnumType {
+	return &file_decision_proto_enumTypes[0]
+}
+
+func (x Decision_Action) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Decision_Action.Descriptor instead.
+func (Decision_Action) EnumDescriptor() ([]byte, []int) {
+	return file_decision_proto_rawDescGZIP(), []int{1, 0}
+}
+
+type DecisionRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// op is one of the hookfs.OpXXX names, e.g. "read".
+	Op string `protobuf:"bytes,1,opt,name=op,proto3" json:"op,omitempty"`
+	// path is relative to the original directory, "" for its root.
+	Path          string `protobuf:"bytes,2,opt,name=path,proto3" json:"path,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DecisionRequest) Reset() {
+	*x = DecisionRequest{}
+	mi := &file_decision_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DecisionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DecisionRequest) ProtoMessage() {}
+
+func (x *DecisionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_decision_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DecisionRequest.ProtoReflect.Descriptor instead.
+func (*DecisionRequest) Descriptor() ([]byte, []int) {
+	return file_decision_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *DecisionRequest) GetOp() string {
+	if x != nil {
+		return x.Op
+	}
+	return ""
+}
+
+func (x *DecisionRequest) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+type Decision struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Action Decision_Action        `protobuf:"varint,1,opt,name=action,proto3,enum=hookfs.inject.Decision_Action" json:"action,omitempty"`
+	// delay_ns is how long DELAY delays the operation, in nanoseconds.
+	DelayNs int64 `protobuf:"varint,2,opt,name=delay_ns,json=delayNs,proto3" json:"delay_ns,omitempty"`
+	// errno is what FAIL fails the operation with, EIO if 0.
+	Errno         int32 `protobuf:"varint,3,opt,name=errno,proto3" json:"errno,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Decision) Reset() {
+	*x = Decision{}
+	mi := &file_decision_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Decision) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Decision) ProtoMessage() {}
+
+func (x *Decision) ProtoReflect() protoreflect.Message {
+	mi := &file_decision_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Decision.ProtoReflect.Descriptor instead.
+func (*Decision) Descriptor() ([]byte, []int) {
+	return file_decision_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Decision) GetAction() Decision_Action {
+	if x != nil {
+		return x.Action
+	}
+	return Decision_PASS
+}
+
+func (x *Decision) GetDelayNs() int64 {
+	if x != nil {
+		return x.DelayNs
+	}
+	return 0
+}
+
+func (x *Decision) GetErrno() int32 {
+	if x != nil {
+		return x.Errno
+	}
+	return 0
+}
+
+var File_decision_proto protoreflect.FileDescriptor
+
+const file_decision_proto_rawDesc = "" +
+	"\n" +
+	"\x0edecision.proto\x12\rhookfs.inject\"5\n" +
+	"\x0fDecisionRequest\x12\x0e\n" +
+	"\x02op\x18\x01 \x01(\tR\x02op\x12\x12\n" +
+	"\x04path\x18\x02 \x01(\tR\x04path\"\x9c\x01\n" +
+	"\bDecision\x126\n" +
+	"\x06action\x18\x01 \x01(\x0e2\x1e.hookfs.inject.Decision.ActionR\x06action\x12\x19\n" +
+	"\bdelay_ns\x18\x02 \x01(\x03R\adelayNs\x12\x14\n" +
+	"\x05errno\x18\x03 \x01(\x05R\x05errno\"'\n" +
+	"\x06Action\x12\b\n" +
+	"\x04PASS\x10\x00\x12\t\n" +
+	"\x05DELAY\x10\x01\x12\b\n" +
+	"\x04FAIL\x10\x022T\n" +
+	"\x0fDecisionService\x12A\n" +
+	"\x06Decide\x12\x1e.hookfs.inject.DecisionRequest\x1a\x17.hookfs.inject.DecisionB7Z5github.com/ethercflow/hookfs/hookfs/inject/remotegrpcb\x06proto3"
+
+var (
+	file_decision_proto_rawDescOnce sync.Once
+	file_decision_proto_rawDescData []byte
+)
+
+func file_decision_proto_rawDescGZIP() []byte {
+	file_decision_proto_rawDescOnce.Do(func() {
+		file_decision_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_decision_proto_rawDesc), len(file_decision_proto_rawDesc)))
+	})
+	return file_decision_proto_rawDescData
+}
+
+var file_decision_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_decision_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_decision_proto_goTypes = []any{
+	(Decision_Action)(0),    // 0: hookfs.inject.Decision.Action
+	(*DecisionRequest)(nil), // 1: hookfs.inject.DecisionRequest
+	(*Decision)(nil),        // 2: hookfs.inject.Decision
+}
+var file_decision_proto_depIdxs = []int32{
+	0, // 0: hookfs.inject.Decision.action:type_name -> hookfs.inject.Decision.Action
+	1, // 1: hookfs.inject.DecisionService.Decide:input_type -> hookfs.inject.DecisionRequest
+	2, // 2: hookfs.inject.DecisionService.Decide:output_type -> hookfs.inject.Decision
+	2, // [2:3] is the sub-list for method output_type
+	1, // [1:2] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
+}
+
+func init() { file_decision_proto_init() }
+func file_decision_proto_init() {
+	if File_decision_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_decision_proto_rawDesc), len(file_decision_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_decision_proto_goTypes,
+		DependencyIndexes: file_decision_proto_depIdxs,
+		EnumInfos:         file_decision_proto_enumTypes,
+		MessageInfos:      file_decision_proto_msgTypes,
+	}.Build()
+	File_decision_proto = out.File
+	file_decision_proto_goTypes = nil
+	file_decision_proto_depIdxs = nil
+}
@@ -0,0 +1,20 @@
+module github.com/ethercflow/hookfs/hookfs/inject/remotegrpc
+
+go 1.24.0
+
+require (
+	github.com/ethercflow/hookfs v0.0.0-20261016110626-ddb7d2b3399e
+	google.golang.org/grpc v1.79.3
+	google.golang.org/protobuf v1.36.10
+)
+
+require (
+	github.com/hanwen/go-fuse v0.0.0-20190111173210-425e8d5301f6 // indirect
+	github.com/sirupsen/logrus v1.3.0 // indirect
+	golang.org/x/crypto v0.46.0 // indirect
+	golang.org/x/net v0.48.0 // indirect
+	golang.org/x/sys v0.39.0 // indirect
+	golang.org/x/term v0.38.0 // indirect
+	golang.org/x/text v0.32.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20251202230838-ff82c1b0f217 // indirect
+)
@@ -0,0 +1,103 @@
+package inject
+
+import (
+	"path/filepath"
+	"sync"
+	"syscall"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	log "github.com/sirupsen/logrus"
+)
+
+// RenameFaultHook fails renames with an errno, typically EXDEV, to make applications take
+// their copy-and-delete path as if the names were on different filesystems, or ENOSPC, as if
+// the new name could not be allocated. Only renames whose old or new name matches one of the
+// patterns (as for filepath.Match, on paths relative to the original directory) fail; with no
+// pattern, all of them do.
+//
+// RenameFaultHook implements hookfs.HookOnRename.
+type RenameFaultHook struct {
+	mu       sync.Mutex
+	errno    syscall.Errno
+	patterns []string
+	injected uint64
+}
+
+// NewRenameFaultHook creates a RenameFaultHook failing renames matching patterns with errno.
+func NewRenameFaultHook(errno syscall.Errno, patterns ...string) *RenameFaultHook {
+	return &RenameFaultHook{
+		errno:    errno,
+		patterns: patterns,
+	}
+}
+
+// Errno returns the errno renames fail with.
+func (h *RenameFaultHook) Errno() syscall.Errno {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.errno
+}
+
+// SetErrno changes the errno renames fail with.
+func (h *RenameFaultHook) SetErrno(errno syscall.Errno) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.errno = errno
+}
+
+// Patterns returns the patterns selecting the renames to fail.
+func (h *RenameFaultHook) Patterns() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string(nil), h.patterns...)
+}
+
+// SetPatterns changes the patterns selecting the renames to fail.
+func (h *RenameFaultHook) SetPatterns(patterns ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.patterns = patterns
+}
+
+// Injected returns the number of renames failed so far.
+func (h *RenameFaultHook) Injected() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.injected
+}
+
+// matches returns whether one of names matches a pattern. h.mu must be held.
+func (h *RenameFaultHook) matches(names ...string) bool {
+	if len(h.patterns) == 0 {
+		return true
+	}
+	for _, pattern := range h.patterns {
+		for _, name := range names {
+			if ok, _ := filepath.Match(cleanRel(pattern), cleanRel(name)); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// PreRename implements hookfs.HookOnRename
+func (h *RenameFaultHook) PreRename(oldName string, newName string) (bool, hookfs.HookContext, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.matches(oldName, newName) {
+		return false, nil, nil
+	}
+	h.injected++
+	log.WithFields(log.Fields{
+		"oldName": oldName,
+		"newName": newName,
+		"errno":   h.errno,
+	}).Debug("RenameFaultHook: injecting")
+	return true, nil, h.errno
+}
+
+// PostRename implements hookfs.HookOnRename
+func (h *RenameFaultHook) PostRename(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return false, nil
+}
@@ -0,0 +1,76 @@
+package inject
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/ethercflow/hookfs/hookfs"
+)
+
+// moveFile renames oldPath to newPath, copying and removing it as mv(1) does when they are on
+// different filesystems. It returns whether it had to copy.
+func moveFile(oldPath string, newPath string) (bool, error) {
+	err := os.Rename(oldPath, newPath)
+	if !errors.Is(err, syscall.EXDEV) {
+		return false, err
+	}
+	src, err := os.Open(oldPath)
+	if err != nil {
+		return true, err
+	}
+	defer src.Close()
+	dst, err := os.Create(newPath)
+	if err != nil {
+		return true, err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return true, err
+	}
+	if err := dst.Close(); err != nil {
+		return true, err
+	}
+	return true, os.Remove(oldPath)
+}
+
+func TestRenameFaultHookForcesCopyFallback(t *testing.T) {
+	hook := NewRenameFaultHook(syscall.EXDEV, "*.tmp")
+	_, original, mnt := mount(t, hook, &hookfs.Options{DirectIO: true, AttrTimeout: -1, EntryTimeout: -1})
+	for _, name := range []string{"a.tmp", "b"} {
+		if err := ioutil.WriteFile(filepath.Join(original, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.Rename(filepath.Join(mnt, "a.tmp"), filepath.Join(mnt, "a")); !errors.Is(err, syscall.EXDEV) {
+		t.Fatalf("rename of a matched name: %v, want EXDEV", err)
+	}
+	copied, err := moveFile(filepath.Join(mnt, "a.tmp"), filepath.Join(mnt, "a"))
+	if err != nil || !copied {
+		t.Fatalf("moving a matched name copied %v: %v, want the fallback taken", copied, err)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(original, "a")); err != nil || string(data) != "a.tmp" {
+		t.Errorf("a holds %q, %v after the fallback, want %q", data, err, "a.tmp")
+	}
+	if _, err := os.Stat(filepath.Join(original, "a.tmp")); !os.IsNotExist(err) {
+		t.Errorf("a.tmp still there after the fallback: %v", err)
+	}
+
+	copied, err = moveFile(filepath.Join(mnt, "b"), filepath.Join(mnt, "c"))
+	if err != nil || copied {
+		t.Errorf("moving an unmatched name copied %v: %v, want it renamed", copied, err)
+	}
+	if n := hook.Injected(); n != 2 {
+		t.Errorf("Injected = %d, want 2", n)
+	}
+
+	hook.SetErrno(syscall.ENOSPC)
+	if err := os.Rename(filepath.Join(mnt, "a"), filepath.Join(mnt, "d.tmp")); !errors.Is(err, syscall.ENOSPC) {
+		t.Errorf("rename to a matched name: %v, want ENOSPC", err)
+	}
+}
@@ -0,0 +1,280 @@
+package inject
+
+import (
+	"math/rand"
+	"sync"
+	"syscall"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/hanwen/go-fuse/fuse/pathfs"
+	log "github.com/sirupsen/logrus"
+)
+
+// ReorderHook models a backend that applies writes in any order until an fsync: the writes
+// to a file are buffered, and applied to Original in random order by the next fsync of the
+// file, or when one of its handles is released. Meanwhile reads and GetAttr show the writes
+// in the order they were issued, as the application expects.
+//
+// Writes are buffered per file rather than per handle, which is what a page cache does.
+// Overlapping writes applied out of order leave the data of the wrong one in Original.
+// Crash applies a random subset of the buffered writes and drops the others, which is what
+// catches applications relying on the order of writes without fsync in between.
+// A truncate applies the buffered writes of its file first.
+//
+// The writes are applied through the file system of the HookFs, which opens the file for
+// writing again with the privileges of the hookfs process: an fsync of a file it may not
+// write, e.g. one created read-only, fails with EACCES.
+//
+// Mount with hookfs.Options.DirectIO, as the kernel may serve reads from its own cache.
+//
+// ReorderHook implements hookfs.HookOnWrite, hookfs.HookOnRead, hookfs.HookOnFsync,
+// hookfs.HookOnRelease, hookfs.HookOnTruncate, hookfs.HookOnGetAttr and
+// hookfs.HookWithBackend.
+type ReorderHook struct {
+	seed int64
+
+	mu      sync.Mutex
+	backend pathfs.FileSystem
+	rnd     *rand.Rand
+	pending map[string][]reorderWrite
+	applied uint64
+	dropped uint64
+}
+
+type reorderWrite struct {
+	offset int64
+	data   []byte
+}
+
+type reorderRead struct {
+	path   string
+	offset int64
+	length int64
+}
+
+// NewReorderHook creates a ReorderHook shuffling writes with a generator seeded with seed.
+func NewReorderHook(seed int64) *ReorderHook {
+	return &ReorderHook{
+		seed:    seed,
+		rnd:     rand.New(rand.NewSource(seed)),
+		pending: make(map[string][]reorderWrite),
+	}
+}
+
+// SetBackend implements hookfs.HookWithBackend
+func (h *ReorderHook) SetBackend(fs pathfs.FileSystem) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.backend = fs
+}
+
+// Seed returns the seed of the generator shuffling writes.
+func (h *ReorderHook) Seed() int64 {
+	return h.seed
+}
+
+// Pending returns the number of writes to path not applied yet.
+func (h *ReorderHook) Pending(path string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.pending[cleanRel(path)])
+}
+
+// Applied returns the number of writes applied to Original so far.
+func (h *ReorderHook) Applied() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.applied
+}
+
+// Dropped returns the number of writes dropped by crashes so far.
+func (h *ReorderHook) Dropped() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.dropped
+}
+
+// Crash applies a random subset of the buffered writes of every file, in random order,
+// and drops the others.
+func (h *ReorderHook) Crash() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var firstErr error
+	for path, writes := range h.pending {
+		h.rnd.Shuffle(len(writes), func(i, j int) { writes[i], writes[j] = writes[j], writes[i] })
+		n := h.rnd.Intn(len(writes) + 1)
+		h.dropped += uint64(len(writes) - n)
+		if err := h.apply(path, writes[:n]); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	h.pending = make(map[string][]reorderWrite)
+	return firstErr
+}
+
+// flush applies the buffered writes of path in random order.
+func (h *ReorderHook) flush(path string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	writes := h.pending[path]
+	if len(writes) == 0 {
+		return nil
+	}
+	delete(h.pending, path)
+	h.rnd.Shuffle(len(writes), func(i, j int) { writes[i], writes[j] = writes[j], writes[i] })
+	return h.apply(path, writes)
+}
+
+// apply writes writes to path through the backend. h.mu must be held.
+func (h *ReorderHook) apply(path string, writes []reorderWrite) error {
+	if len(writes) == 0 {
+		return nil
+	}
+	if h.backend == nil {
+		log.WithField("path", path).Warn("ReorderHook: no backend to apply writes to")
+		return syscall.EIO
+	}
+	f, code := h.backend.Open(path, syscall.O_WRONLY, nil)
+	if !code.Ok() {
+		return syscall.Errno(code)
+	}
+	defer f.Release()
+	log.WithFields(log.Fields{
+		"path":   path,
+		"writes": len(writes),
+	}).Debug("ReorderHook: applying writes")
+	for _, w := range writes {
+		if _, code := f.Write(w.data, w.offset); !code.Ok() {
+			return syscall.Errno(code)
+		}
+		h.applied++
+	}
+	return nil
+}
+
+// PreWrite implements hookfs.HookOnWrite
+func (h *ReorderHook) PreWrite(path string, buf []byte, offset int64) (bool, hookfs.HookContext, error) {
+	path = cleanRel(path)
+	// buf is reused by go-fuse once the write is done
+	w := reorderWrite{offset: offset, data: append([]byte(nil), buf...)}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.pending[path] = append(h.pending[path], w)
+	return true, nil, nil
+}
+
+// PostWrite implements hookfs.HookOnWrite
+func (h *ReorderHook) PostWrite(realRetCode int32, prehookCtx hookfs.HookContext) (uint32, bool, error) {
+	return 0, false, nil
+}
+
+// PreRead implements hookfs.HookOnRead
+func (h *ReorderHook) PreRead(path string, length int64, offset int64) ([]byte, bool, hookfs.HookContext, error) {
+	return nil, false, &reorderRead{path: cleanRel(path), offset: offset, length: length}, nil
+}
+
+// PostRead implements hookfs.HookOnRead
+func (h *ReorderHook) PostRead(realRetCode int32, realBuf []byte, prehookCtx hookfs.HookContext) ([]byte, bool, error) {
+	r, ok := prehookCtx.(*reorderRead)
+	if !ok || realRetCode != 0 {
+		return nil, false, nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	writes := h.pending[r.path]
+	if len(writes) == 0 {
+		return nil, false, nil
+	}
+
+	buf := make([]byte, r.length)
+	end := r.offset + int64(copy(buf, realBuf))
+	// the buffered writes go over the data, in the order they were issued
+	for _, w := range writes {
+		wEnd := w.offset + int64(len(w.data))
+		if w.offset >= r.offset+r.length || wEnd <= r.offset {
+			continue
+		}
+		from, to := w.offset, wEnd
+		if from < r.offset {
+			from = r.offset
+		}
+		if to > r.offset+r.length {
+			to = r.offset + r.length
+		}
+		copy(buf[from-r.offset:to-r.offset], w.data[from-w.offset:])
+		if to > end {
+			end = to
+		}
+	}
+	return buf[:end-r.offset], true, nil
+}
+
+// PreGetAttr implements hookfs.HookOnGetAttr
+func (h *ReorderHook) PreGetAttr(path string) (bool, hookfs.HookContext, error) {
+	return false, cleanRel(path), nil
+}
+
+// PostGetAttr implements hookfs.HookOnGetAttr
+func (h *ReorderHook) PostGetAttr(realRetCode int32, realAttr *fuse.Attr, prehookCtx hookfs.HookContext) (*fuse.Attr, bool, error) {
+	path, ok := prehookCtx.(string)
+	if !ok || realRetCode != 0 || realAttr == nil {
+		return nil, false, nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	writes := h.pending[path]
+	if len(writes) == 0 {
+		return nil, false, nil
+	}
+	attr := *realAttr
+	for _, w := range writes {
+		if end := uint64(w.offset) + uint64(len(w.data)); end > attr.Size {
+			attr.Size = end
+		}
+	}
+	return &attr, true, nil
+}
+
+// PreFsync implements hookfs.HookOnFsync
+func (h *ReorderHook) PreFsync(path string, flags uint32) (bool, hookfs.HookContext, error) {
+	if err := h.flush(cleanRel(path)); err != nil {
+		return true, nil, err
+	}
+	return false, nil, nil
+}
+
+// PostFsync implements hookfs.HookOnFsync
+func (h *ReorderHook) PostFsync(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return false, nil
+}
+
+// PreRelease implements hookfs.HookOnRelease
+func (h *ReorderHook) PreRelease(path string) (bool, hookfs.HookContext) {
+	if err := h.flush(cleanRel(path)); err != nil {
+		log.WithFields(log.Fields{
+			"path":  path,
+			"error": err,
+		}).Warn("ReorderHook: could not apply writes on release")
+	}
+	return false, nil
+}
+
+// PostRelease implements hookfs.HookOnRelease
+func (h *ReorderHook) PostRelease(prehookCtx hookfs.HookContext) bool {
+	return false
+}
+
+// PreTruncate implements hookfs.HookOnTruncate
+func (h *ReorderHook) PreTruncate(path string, size uint64) (bool, hookfs.HookContext, error) {
+	if err := h.flush(cleanRel(path)); err != nil {
+		return true, nil, err
+	}
+	return false, nil, nil
+}
+
+// PostTruncate implements hookfs.HookOnTruncate
+func (h *ReorderHook) PostTruncate(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return false, nil
+}
@@ -0,0 +1,125 @@
+package inject
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+// reorderRun writes the digits 1 to 8 one after another at the start of a file through a
+// ReorderHook seeded with seed, checks they are buffered and read back in order, fsyncs,
+// and returns the byte the original ends up holding.
+func reorderRun(t *testing.T, seed int64) byte {
+	t.Helper()
+	original := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(original, "file"), []byte("0"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	hook := NewReorderHook(seed)
+	h, err := hookfs.NewHookFs(original, t.TempDir(), hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, code := h.Open("file", syscall.O_RDWR, &fuse.Context{})
+	if !code.Ok() {
+		t.Fatal(code)
+	}
+	defer f.Release()
+	for c := byte('1'); c <= '8'; c++ {
+		if _, code := f.Write([]byte{c}, 0); !code.Ok() {
+			t.Fatal(code)
+		}
+	}
+	if n := hook.Pending("file"); n != 8 {
+		t.Fatalf("Pending = %d before fsync, want 8", n)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(original, "file")); string(data) != "0" {
+		t.Fatalf("original holds %q before fsync, want the writes held back", data)
+	}
+	buf := make([]byte, 1)
+	res, code := f.Read(buf, 0)
+	if !code.Ok() {
+		t.Fatal(code)
+	}
+	if data, _ := res.Bytes(buf); string(data) != "8" {
+		t.Fatalf("read %q before fsync, want the last write", data)
+	}
+
+	if code := f.Fsync(0); !code.Ok() {
+		t.Fatal(code)
+	}
+	if hook.Pending("file") != 0 || hook.Applied() != 8 {
+		t.Fatalf("Pending = %d and Applied = %d after fsync, want 0 and 8", hook.Pending("file"), hook.Applied())
+	}
+	data, err := ioutil.ReadFile(filepath.Join(original, "file"))
+	if err != nil || len(data) != 1 {
+		t.Fatalf("original holds %q, %v after fsync", data, err)
+	}
+	return data[0]
+}
+
+func TestReorderHookReordersUnbarrieredWrites(t *testing.T) {
+	reordered := false
+	for seed := int64(1); seed <= 20; seed++ {
+		got := reorderRun(t, seed)
+		if again := reorderRun(t, seed); again != got {
+			t.Errorf("seed %d left %q then %q, want the same order for the same seed", seed, got, again)
+		}
+		if got != '8' {
+			reordered = true
+		}
+	}
+	if !reordered {
+		t.Error("the last write was applied last for every seed, want writes reordered")
+	}
+}
+
+func TestReorderHookCrashDropsWrites(t *testing.T) {
+	original := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(original, "file"), []byte("0000"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	hook := NewReorderHook(1)
+	h, err := hookfs.NewHookFs(original, t.TempDir(), hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, code := h.Open("file", syscall.O_WRONLY, &fuse.Context{})
+	if !code.Ok() {
+		t.Fatal(code)
+	}
+	for i, c := range "1234" {
+		if _, code := f.Write([]byte{byte(c)}, int64(i)); !code.Ok() {
+			t.Fatal(code)
+		}
+	}
+	if err := hook.Crash(); err != nil {
+		t.Fatal(err)
+	}
+	f.Release()
+	if hook.Applied()+hook.Dropped() != 4 || hook.Pending("file") != 0 {
+		t.Fatalf("Applied = %d, Dropped = %d and Pending = %d after the crash, want all 4 writes accounted for",
+			hook.Applied(), hook.Dropped(), hook.Pending("file"))
+	}
+	data, err := ioutil.ReadFile(filepath.Join(original, "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept := uint64(0)
+	for i, c := range data {
+		switch c {
+		case '0':
+		case "1234"[i]:
+			kept++
+		default:
+			t.Errorf("byte %d is %q after the crash, want the old or the written one", i, c)
+		}
+	}
+	if kept != hook.Applied() {
+		t.Errorf("%d writes made it to the original, want Applied = %d", kept, hook.Applied())
+	}
+}
@@ -0,0 +1,105 @@
+package inject
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ethercflow/hookfs/hookfs"
+)
+
+// Window is a period of a schedule during which Hook is active.
+// Start and End are offsets from the origin of the schedule.
+type Window struct {
+	Start time.Duration
+	End   time.Duration
+	Hook  hookfs.Hook
+}
+
+// ScheduledHook activates other hooks only during configured time windows,
+// e.g. to make latency or error rates follow a diurnal pattern in soak tests.
+// Outside of every window, operations pass through unhooked.
+// If windows overlap, the first matching one wins.
+//
+// ScheduledHook implements hookfs.HookWithInit and all the hookfs.HookOnXXX interfaces.
+type ScheduledHook struct {
+	gate
+	// Period repeats the schedule every Period. Zero means the schedule runs once.
+	// Ignored when WallClock is set.
+	Period time.Duration
+	// WallClock makes window offsets relative to local midnight (repeating daily)
+	// instead of the time the filesystem was mounted.
+	WallClock bool
+	// Now returns the current time. It defaults to time.Now and can be replaced in tests.
+	Now func() time.Time
+
+	mu      sync.RWMutex
+	windows []Window
+	origin  time.Time
+}
+
+// NewScheduledHook creates a ScheduledHook with the given windows.
+// The schedule starts at mount time, or now if the hook is never mounted.
+func NewScheduledHook(windows ...Window) *ScheduledHook {
+	h := &ScheduledHook{
+		Now:     time.Now,
+		windows: windows,
+	}
+	h.origin = h.Now()
+	h.pick = func(op string, path string) (hookfs.Hook, error) {
+		return h.Active(), nil
+	}
+	return h
+}
+
+// Windows returns the schedule.
+func (h *ScheduledHook) Windows() []Window {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return append([]Window(nil), h.windows...)
+}
+
+// SetWindows replaces the schedule. It is safe to call while mounted.
+func (h *ScheduledHook) SetWindows(windows ...Window) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.windows = windows
+}
+
+// Active returns the hook of the window active now, or nil.
+func (h *ScheduledHook) Active() hookfs.Hook {
+	now := h.Now()
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	var offset time.Duration
+	if h.WallClock {
+		y, m, d := now.Date()
+		offset = now.Sub(time.Date(y, m, d, 0, 0, 0, 0, now.Location()))
+	} else {
+		offset = now.Sub(h.origin)
+		if h.Period > 0 {
+			offset %= h.Period
+		}
+	}
+	for _, w := range h.windows {
+		if offset >= w.Start && offset < w.End {
+			return w.Hook
+		}
+	}
+	return nil
+}
+
+// Init implements hookfs.HookWithInit. It restarts the schedule and initializes the hooks of all windows.
+func (h *ScheduledHook) Init() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.origin = h.Now()
+	for _, w := range h.windows {
+		if hook, ok := w.Hook.(hookfs.HookWithInit); ok {
+			if err := hook.Init(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
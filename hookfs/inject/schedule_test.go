@@ -0,0 +1,39 @@
+package inject
+
+import (
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+func TestScheduledHookInjectsOnlyWithinWindow(t *testing.T) {
+	origin := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := origin
+	h := NewScheduledHook(Window{Start: time.Hour, End: 2 * time.Hour, Hook: newErrorHook(t, "", syscall.EIO)})
+	h.Period = 24 * time.Hour
+	h.Now = func() time.Time { return now }
+	if err := h.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		at   time.Duration
+		fail bool
+	}{
+		{0, false},
+		{time.Hour - time.Second, false},
+		{time.Hour, true},
+		{90 * time.Minute, true},
+		{2 * time.Hour, false},
+		{25 * time.Hour, true},
+		{26 * time.Hour, false},
+	} {
+		now = origin.Add(tc.at)
+		_, _, err := h.PreOpenWithContext("file", syscall.O_RDONLY, &fuse.Context{})
+		if failed := err == syscall.EIO; failed != tc.fail {
+			t.Errorf("open %v after the start: %v, want failing %v", tc.at, err, tc.fail)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package inject
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ethercflow/hookfs/hookfs"
+)
+
+const mib = 1 << 20
+
+// SeekModel is the latency model of a SeekLatencyHook.
+type SeekModel struct {
+	// SeekPerMiB is the seek time per MiB between the end of the previous read and the start
+	// of the next one, up to MaxSeek if MaxSeek is positive (a full-stroke seek).
+	SeekPerMiB time.Duration
+	MaxSeek    time.Duration
+	// TransferPerMiB is the time to transfer a MiB once there.
+	TransferPerMiB time.Duration
+}
+
+// Delay returns the latency of reading length bytes distance bytes away from the previous read.
+func (m SeekModel) Delay(distance int64, length int64) time.Duration {
+	if distance < 0 {
+		distance = -distance
+	}
+	seek := time.Duration(float64(m.SeekPerMiB) * float64(distance) / mib)
+	if m.MaxSeek > 0 && seek > m.MaxSeek {
+		seek = m.MaxSeek
+	}
+	return seek + time.Duration(float64(m.TransferPerMiB)*float64(length)/mib)
+}
+
+// SeekLatencyHook models the seek latency of a spinning disk: every read is delayed in
+// proportion to the distance between its offset and the end of the previous read through
+// the same handle, plus a transfer time in proportion to its length. Sequential reads only
+// pay the transfer time. The first read of a handle seeks from offset 0.
+//
+// Mount with hookfs.Options.DirectIO, as the kernel reads ahead of the application and
+// serves reads from its own cache.
+//
+// SeekLatencyHook implements hookfs.HookOnReadWithHandle and hookfs.HookOnReleaseWithHandle.
+type SeekLatencyHook struct {
+	mu    sync.Mutex
+	model SeekModel
+	next  map[uint64]int64 // end of the previous read, by handle
+}
+
+type seekCtx struct {
+	handle uint64
+	offset int64
+}
+
+// NewSeekLatencyHook creates a SeekLatencyHook with model.
+func NewSeekLatencyHook(model SeekModel) *SeekLatencyHook {
+	return &SeekLatencyHook{
+		model: model,
+		next:  make(map[uint64]int64),
+	}
+}
+
+// Model returns the latency model.
+func (h *SeekLatencyHook) Model() SeekModel {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.model
+}
+
+// SetModel changes the latency model. It is safe to call while mounted.
+func (h *SeekLatencyHook) SetModel(model SeekModel) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.model = model
+}
+
+// PreReadWithHandle implements hookfs.HookOnReadWithHandle
+func (h *SeekLatencyHook) PreReadWithHandle(path string, length int64, offset int64, handle uint64) ([]byte, bool, hookfs.HookContext, error) {
+	h.mu.Lock()
+	delay := h.model.Delay(offset-h.next[handle], length)
+	h.mu.Unlock()
+	time.Sleep(delay)
+	return nil, false, &seekCtx{handle: handle, offset: offset}, nil
+}
+
+// PostRead implements hookfs.HookOnReadWithHandle
+func (h *SeekLatencyHook) PostRead(realRetCode int32, realBuf []byte, prehookCtx hookfs.HookContext) ([]byte, bool, error) {
+	ctx, ok := prehookCtx.(*seekCtx)
+	if !ok {
+		return nil, false, nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	// the head is where the read stopped, even if it failed
+	h.next[ctx.handle] = ctx.offset + int64(len(realBuf))
+	return nil, false, nil
+}
+
+// PreReleaseWithHandle implements hookfs.HookOnReleaseWithHandle
+func (h *SeekLatencyHook) PreReleaseWithHandle(path string, flags uint32, handle uint64) (bool, hookfs.HookContext) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.next, handle)
+	return false, nil
+}
+
+// PostRelease implements hookfs.HookOnReleaseWithHandle
+func (h *SeekLatencyHook) PostRelease(prehookCtx hookfs.HookContext) bool {
+	return false
+}
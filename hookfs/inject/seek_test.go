@@ -0,0 +1,74 @@
+package inject
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+func TestSeekModelDelay(t *testing.T) {
+	m := SeekModel{SeekPerMiB: 10 * time.Millisecond, MaxSeek: 15 * time.Millisecond, TransferPerMiB: 4 * time.Millisecond}
+	for _, test := range []struct {
+		distance, length int64
+		want             time.Duration
+	}{
+		{0, mib, 4 * time.Millisecond},
+		{mib, mib / 2, 12 * time.Millisecond},
+		{-mib, 0, 10 * time.Millisecond},
+		{10 * mib, 0, 15 * time.Millisecond},
+	} {
+		if got := m.Delay(test.distance, test.length); got != test.want {
+			t.Errorf("Delay(%d, %d) = %v, want %v", test.distance, test.length, got, test.want)
+		}
+	}
+}
+
+func TestSeekLatencyHookRandomReadsSlower(t *testing.T) {
+	const size, chunk, reads = 4 * mib, 4096, 16
+	original := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(original, "file"), bytes.Repeat([]byte("x"), size), 0644); err != nil {
+		t.Fatal(err)
+	}
+	hook := NewSeekLatencyHook(SeekModel{SeekPerMiB: 20 * time.Millisecond})
+	h, err := hookfs.NewHookFs(original, t.TempDir(), hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readAt := func(offsets []int64) time.Duration {
+		t.Helper()
+		f, code := h.Open("file", syscall.O_RDONLY, &fuse.Context{})
+		if !code.Ok() {
+			t.Fatal(code)
+		}
+		defer f.Release()
+		buf := make([]byte, chunk)
+		start := time.Now()
+		for _, off := range offsets {
+			res, code := f.Read(buf, off)
+			if !code.Ok() {
+				t.Fatal(code)
+			}
+			res.Done()
+		}
+		return time.Since(start)
+	}
+
+	var sequential, random []int64
+	rnd := rand.New(rand.NewSource(1))
+	for i := int64(0); i < reads; i++ {
+		sequential = append(sequential, i*chunk)
+		random = append(random, rnd.Int63n(size/chunk)*chunk)
+	}
+	seqTook, randTook := readAt(sequential), readAt(random)
+	// the random reads seek a MiB or more on average, 20ms each
+	if randTook < 10*seqTook || randTook < reads*10*time.Millisecond {
+		t.Errorf("%d random reads took %v and sequential ones %v, want random ones much slower", reads, randTook, seqTook)
+	}
+}
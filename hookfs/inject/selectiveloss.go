@@ -0,0 +1,245 @@
+package inject
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	log "github.com/sirupsen/logrus"
+)
+
+// LossRule selects writes to be lost by a SelectiveLossHook. A write is selected if it matches
+// every field set.
+type LossRule struct {
+	// Path, if set, is a pattern as for filepath.Match the path of the file must match.
+	Path string
+	// Start and End, if End is more than Start, select writes overlapping [Start, End).
+	Start int64
+	End   int64
+	// Pattern, if set, selects writes whose data contains it.
+	Pattern []byte
+}
+
+func (r LossRule) match(path string, buf []byte, offset int64) bool {
+	if r.Path != "" {
+		if ok, _ := filepath.Match(cleanRel(r.Path), path); !ok {
+			return false
+		}
+	}
+	if r.End > r.Start && (offset >= r.End || offset+int64(len(buf)) <= r.Start) {
+		return false
+	}
+	return len(r.Pattern) == 0 || bytes.Contains(buf, r.Pattern)
+}
+
+// SelectiveLossHook reproduces data loss on power failure precisely: the writes selected by its
+// rules are lost when Crash is called, fsync or not, and all the others are kept. Crash restores
+// in Original what the lost writes overwrote, except where later writes that are kept overwrote
+// it again, and shrinks back the files they extended.
+//
+// Like LyingFsyncHook, the hook keeps the previous content of every write selected until the
+// crash, and only writes are undone.
+//
+// SelectiveLossHook implements hookfs.HookOnWrite.
+type SelectiveLossHook struct {
+	// Original is the original directory of the mount.
+	Original string
+
+	mu     sync.Mutex
+	rules  []LossRule
+	writes map[string][]lossRecord
+	lost   uint64
+}
+
+type lossRecord struct {
+	offset int64
+	length int64
+	// selected writes only
+	selected bool
+	old      []byte
+	size     int64 // size of the file before the write
+}
+
+// NewSelectiveLossHook creates a SelectiveLossHook for original losing the writes matching any of rules.
+func NewSelectiveLossHook(original string, rules ...LossRule) *SelectiveLossHook {
+	return &SelectiveLossHook{
+		Original: original,
+		rules:    rules,
+		writes:   make(map[string][]lossRecord),
+	}
+}
+
+// Rules returns the rules selecting the writes to lose.
+func (h *SelectiveLossHook) Rules() []LossRule {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]LossRule(nil), h.rules...)
+}
+
+// SetRules changes the rules selecting the writes to lose. Writes already selected stay so.
+func (h *SelectiveLossHook) SetRules(rules ...LossRule) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.rules = rules
+}
+
+// Lost returns the number of writes lost by crashes so far.
+func (h *SelectiveLossHook) Lost() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.lost
+}
+
+// Pending returns the number of writes that the next crash would lose.
+func (h *SelectiveLossHook) Pending() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	n := 0
+	for _, records := range h.writes {
+		for _, r := range records {
+			if r.selected {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// Crash loses the selected writes in Original. Files should not be written concurrently.
+// The kernel may still have the lost data cached; see hookfs.HookFs.InvalidateData.
+func (h *SelectiveLossHook) Crash() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var firstErr error
+	for path, records := range h.writes {
+		if err := h.undo(path, records); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	h.writes = make(map[string][]lossRecord)
+	return firstErr
+}
+
+func (h *SelectiveLossHook) undo(path string, records []lossRecord) error {
+	f, err := os.OpenFile(filepath.Join(h.Original, path), os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size := fi.Size()
+
+	// kept are the writes kept after the one being undone
+	var kept []lossRecord
+	for i := len(records) - 1; i >= 0; i-- {
+		r := records[i]
+		if !r.selected {
+			kept = append(kept, r)
+			continue
+		}
+		log.WithFields(log.Fields{
+			"path":   path,
+			"offset": r.offset,
+			"length": r.length,
+		}).Debug("SelectiveLossHook: losing a write")
+		h.lost++
+
+		// what the write overwrote comes back, and what it appended becomes a hole
+		data := make([]byte, r.length)
+		copy(data, r.old)
+		keptEnd := r.size
+		for _, k := range kept {
+			if end := k.offset + k.length; end > keptEnd {
+				keptEnd = end
+			}
+		}
+		for j := int64(0); j < r.length; {
+			pos := r.offset + j
+			if pos >= size || pos >= keptEnd {
+				break
+			}
+			run := int64(1)
+			covered := lossCovered(kept, pos)
+			for j+run < r.length && lossCovered(kept, pos+run) == covered {
+				run++
+			}
+			if !covered {
+				if _, err := f.WriteAt(data[j:j+run], pos); err != nil {
+					return err
+				}
+			}
+			j += run
+		}
+		if r.offset+r.length > r.size && keptEnd < size {
+			size = keptEnd
+			if err := f.Truncate(size); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// lossCovered returns whether one of records wrote the byte at pos.
+func lossCovered(records []lossRecord, pos int64) bool {
+	for _, r := range records {
+		if pos >= r.offset && pos < r.offset+r.length {
+			return true
+		}
+	}
+	return false
+}
+
+// PreWrite implements hookfs.HookOnWrite
+func (h *SelectiveLossHook) PreWrite(path string, buf []byte, offset int64) (bool, hookfs.HookContext, error) {
+	path = cleanRel(path)
+	r := lossRecord{offset: offset, length: int64(len(buf))}
+
+	h.mu.Lock()
+	for _, rule := range h.rules {
+		if rule.match(path, buf, offset) {
+			r.selected = true
+			break
+		}
+	}
+	pending := len(h.writes[path]) > 0
+	h.mu.Unlock()
+	if !r.selected && !pending {
+		// nothing to lose before it
+		return false, nil, nil
+	}
+
+	if r.selected {
+		f, err := os.Open(filepath.Join(h.Original, path))
+		if err != nil {
+			return false, nil, nil
+		}
+		defer f.Close()
+		fi, err := f.Stat()
+		if err != nil {
+			return false, nil, nil
+		}
+		old := make([]byte, len(buf))
+		n, err := f.ReadAt(old, offset)
+		if err != nil && err != io.EOF {
+			return false, nil, nil
+		}
+		r.old, r.size = old[:n], fi.Size()
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.writes[path] = append(h.writes[path], r)
+	return false, nil, nil
+}
+
+// PostWrite implements hookfs.HookOnWrite
+func (h *SelectiveLossHook) PostWrite(realRetCode int32, prehookCtx hookfs.HookContext) (uint32, bool, error) {
+	return 0, false, nil
+}
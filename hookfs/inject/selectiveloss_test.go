@@ -0,0 +1,63 @@
+package inject
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+func TestSelectiveLossHookLosesSelectedWrites(t *testing.T) {
+	original := t.TempDir()
+	for _, name := range []string{"file", "other"} {
+		if err := ioutil.WriteFile(filepath.Join(original, name), []byte("aaaaaaaaaaaaaaaa"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hook := NewSelectiveLossHook(original,
+		LossRule{Path: "file", Start: 4, End: 6},
+		LossRule{Pattern: []byte("LOST")},
+	)
+	h, err := hookfs.NewHookFs(original, t.TempDir(), hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	write := func(name string, data string, offset int64) {
+		t.Helper()
+		f, code := h.Open(name, syscall.O_WRONLY, &fuse.Context{})
+		if !code.Ok() {
+			t.Fatal(code)
+		}
+		defer f.Release()
+		if _, code := f.Write([]byte(data), offset); !code.Ok() {
+			t.Fatal(code)
+		}
+	}
+	write("file", "BBBB", 0)
+	write("file", "CCCC", 4) // lost, overlapping [4, 6)
+	write("file", "EE", 6)   // kept over the end of the lost one
+	write("file", "DDDD", 8)
+	write("file", "xLOSTx", 16) // lost, extending the file
+	write("other", "BBBB", 4)   // kept, as the range is for file only
+	if n := hook.Pending(); n != 2 {
+		t.Errorf("Pending = %d before the crash, want 2", n)
+	}
+
+	if err := hook.Crash(); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"file":  "BBBBaaEEDDDDaaaa",
+		"other": "aaaaBBBBaaaaaaaa",
+	} {
+		if data, err := ioutil.ReadFile(filepath.Join(original, name)); err != nil || string(data) != want {
+			t.Errorf("after the crash %s holds %q, %v, want %q", name, data, err, want)
+		}
+	}
+	if hook.Lost() != 2 || hook.Pending() != 0 {
+		t.Errorf("Lost = %d and Pending = %d after the crash, want 2 and 0", hook.Lost(), hook.Pending())
+	}
+}
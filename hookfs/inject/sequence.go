@@ -0,0 +1,131 @@
+package inject
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	"github.com/hanwen/go-fuse/fuse"
+	log "github.com/sirupsen/logrus"
+)
+
+// SequenceMatcher matches an ordered sequence of successful operations on a path, e.g.
+// open, write, fsync. Other operations may come in between: the sequence is matched as
+// a subsequence of the operations observed. A SequenceMatcher is not safe for concurrent use.
+type SequenceMatcher struct {
+	// Path is the path the operations must be on, or "" for any path.
+	Path string
+	// Ops are the operations (hookfs.OpXXX) to observe, in order.
+	Ops []string
+
+	next int
+}
+
+// Observe feeds an operation to m and returns whether the sequence has been observed
+// entirely, now or earlier.
+func (m *SequenceMatcher) Observe(op string, path string, status fuse.Status) bool {
+	if m.Matched() {
+		return true
+	}
+	if !status.Ok() || m.Path != "" && cleanRel(path) != cleanRel(m.Path) {
+		return false
+	}
+	if op == m.Ops[m.next] {
+		m.next++
+	}
+	return m.Matched()
+}
+
+// Matched returns whether the sequence has been observed entirely.
+func (m *SequenceMatcher) Matched() bool {
+	return m.next >= len(m.Ops)
+}
+
+// Progress returns how many operations of the sequence have been observed so far.
+func (m *SequenceMatcher) Progress() int {
+	return m.next
+}
+
+// Reset starts matching the sequence over.
+func (m *SequenceMatcher) Reset() {
+	m.next = 0
+}
+
+// SequenceTriggerHook arms a hook once a sequence of operations has been observed, to inject
+// faults only after the application has done something in particular. Until then, operations
+// pass through unhooked; from the operation after the last of the sequence on, they go to Hook.
+// Once armed, the hook stays so until Reset.
+//
+// SequenceTriggerHook implements hookfs.GlobalHook and all the hookfs.HookOnXXX interfaces.
+// The armed hook gets the calls of hookfs.GlobalHook as well, if it implements it.
+type SequenceTriggerHook struct {
+	gate
+	hook hookfs.Hook
+
+	mu      sync.Mutex
+	matcher SequenceMatcher
+}
+
+// NewSequenceTriggerHook creates a SequenceTriggerHook arming hook after the operations ops
+// on path ("" for any path), in that order.
+func NewSequenceTriggerHook(hook hookfs.Hook, path string, ops ...string) *SequenceTriggerHook {
+	h := &SequenceTriggerHook{
+		hook:    hook,
+		matcher: SequenceMatcher{Path: path, Ops: ops},
+	}
+	h.pick = func(op string, path string) (hookfs.Hook, error) {
+		if h.Armed() {
+			return h.hook, nil
+		}
+		return nil, nil
+	}
+	return h
+}
+
+// Hook returns the hook armed by the sequence.
+func (h *SequenceTriggerHook) Hook() hookfs.Hook {
+	return h.hook
+}
+
+// Sequence returns the path and operations of the sequence.
+func (h *SequenceTriggerHook) Sequence() (string, []string) {
+	return h.matcher.Path, append([]string(nil), h.matcher.Ops...)
+}
+
+// Armed returns whether the sequence has been observed.
+func (h *SequenceTriggerHook) Armed() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.matcher.Matched()
+}
+
+// Reset disarms the hook and starts watching for the sequence over.
+func (h *SequenceTriggerHook) Reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.matcher.Reset()
+}
+
+// BeforeOp implements hookfs.GlobalHook
+func (h *SequenceTriggerHook) BeforeOp(op string, path string) {
+	if hook, ok := h.hook.(hookfs.GlobalHook); ok && h.Armed() {
+		hook.BeforeOp(op, path)
+	}
+}
+
+// AfterOp implements hookfs.GlobalHook
+func (h *SequenceTriggerHook) AfterOp(op string, path string, status fuse.Status, took time.Duration) {
+	h.mu.Lock()
+	armed := h.matcher.Matched()
+	if !armed && h.matcher.Observe(op, path, status) {
+		log.WithFields(log.Fields{
+			"op":   op,
+			"path": path,
+		}).Debug("SequenceTriggerHook: sequence observed, arming")
+	}
+	h.mu.Unlock()
+
+	if hook, ok := h.hook.(hookfs.GlobalHook); ok && armed {
+		hook.AfterOp(op, path, status, took)
+	}
+}
@@ -0,0 +1,86 @@
+package inject
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/hanwen/go-fuse/fuse/nodefs"
+)
+
+func TestSequenceTriggerHookArmsAfterSequence(t *testing.T) {
+	original := t.TempDir()
+	for _, name := range []string{"file", "other"} {
+		if err := ioutil.WriteFile(filepath.Join(original, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hook := NewSequenceTriggerHook(newErrorHook(t, "", syscall.EIO, hookfs.OpWrite),
+		"file", hookfs.OpOpen, hookfs.OpWrite, hookfs.OpFsync)
+	h, err := hookfs.NewHookFs(original, t.TempDir(), hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := &fuse.Context{}
+	open := func(name string) nodefs.File {
+		t.Helper()
+		f, code := h.Open(name, syscall.O_RDWR, ctx)
+		if !code.Ok() {
+			t.Fatal(code)
+		}
+		return f
+	}
+
+	// the sequence on another file doesn't count
+	other := open("other")
+	defer other.Release()
+	if _, code := other.Write([]byte("x"), 0); !code.Ok() {
+		t.Fatal(code)
+	}
+	if code := other.Fsync(0); !code.Ok() {
+		t.Fatal(code)
+	}
+	// nor does a fsync before the write
+	f := open("file")
+	defer f.Release()
+	if code := f.Fsync(0); !code.Ok() {
+		t.Fatal(code)
+	}
+	if _, code := f.Write([]byte("a"), 0); !code.Ok() {
+		t.Fatalf("write before the sequence is observed: %v", code)
+	}
+	if hook.Armed() {
+		t.Fatal("armed before fsync")
+	}
+	if code := f.Fsync(0); !code.Ok() {
+		t.Fatalf("fsync ending the sequence: %v", code)
+	}
+	if !hook.Armed() {
+		t.Fatal("not armed after open, write and fsync")
+	}
+
+	if _, code := f.Write([]byte("b"), 1); code != fuse.EIO {
+		t.Errorf("write after the sequence: %v, want EIO", code)
+	}
+	if _, code := other.Write([]byte("y"), 1); code != fuse.EIO {
+		t.Errorf("write to another file after the sequence: %v, want EIO", code)
+	}
+	buf := make([]byte, 1)
+	if _, code := f.Read(buf, 0); !code.Ok() {
+		t.Errorf("read after the sequence: %v, want it passed through", code)
+	}
+
+	hook.Reset()
+	if hook.Armed() {
+		t.Fatal("armed after Reset")
+	}
+	if _, code := f.Write([]byte("c"), 1); !code.Ok() {
+		t.Errorf("write after Reset: %v", code)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(original, "file")); string(data) != "ac" {
+		t.Errorf("original holds %q, want %q", data, "ac")
+	}
+}
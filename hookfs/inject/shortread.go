@@ -0,0 +1,113 @@
+package inject
+
+import (
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	log "github.com/sirupsen/logrus"
+)
+
+// ShortReadHook makes reads return fewer bytes than asked for, but at least MinSize bytes
+// and never 0 before the end of the file, to check that callers loop until they have read
+// what they need. Nothing is lost: the data past a short read is returned by the next one.
+//
+// The kernel takes a short read for the end of the file unless the mount uses direct I/O,
+// so mount with hookfs.Options.DirectIO for the short reads to reach the application.
+//
+// ShortReadHook implements hookfs.HookOnRead.
+type ShortReadHook struct {
+	// Original is the original directory of the mount.
+	Original string
+
+	mu          sync.Mutex
+	probability float64
+	minSize     int64
+	rnd         *rand.Rand
+}
+
+// NewShortReadHook creates a ShortReadHook for original, shortening a read with probability
+// probability (0 to 1), drawing from a generator seeded with seed.
+func NewShortReadHook(original string, probability float64, seed int64) *ShortReadHook {
+	return &ShortReadHook{
+		Original:    original,
+		probability: probability,
+		minSize:     1,
+		rnd:         rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Probability returns the probability that a read is shortened.
+func (h *ShortReadHook) Probability() float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.probability
+}
+
+// SetProbability changes the probability that a read is shortened.
+func (h *ShortReadHook) SetProbability(probability float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.probability = probability
+}
+
+// MinSize returns the minimum size of a short read.
+func (h *ShortReadHook) MinSize() int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.minSize
+}
+
+// SetMinSize changes the minimum size of a short read. It is at least 1.
+func (h *ShortReadHook) SetMinSize(minSize int64) {
+	if minSize < 1 {
+		minSize = 1
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.minSize = minSize
+}
+
+// shortLength returns the length to read instead of length, or length.
+func (h *ShortReadHook) shortLength(length int64) int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if length <= h.minSize || h.rnd.Float64() >= h.probability {
+		return length
+	}
+	return h.minSize + h.rnd.Int63n(length-h.minSize)
+}
+
+// PreRead implements hookfs.HookOnRead
+func (h *ShortReadHook) PreRead(path string, length int64, offset int64) ([]byte, bool, hookfs.HookContext, error) {
+	short := h.shortLength(length)
+	if short == length {
+		return nil, false, nil, nil
+	}
+	f, err := os.Open(filepath.Join(h.Original, path))
+	if err != nil {
+		// let the real read report it
+		return nil, false, nil, nil
+	}
+	defer f.Close()
+	buf := make([]byte, short)
+	n, err := f.ReadAt(buf, offset)
+	if err != nil && err != io.EOF {
+		return nil, false, nil, nil
+	}
+	log.WithFields(log.Fields{
+		"path":   path,
+		"offset": offset,
+		"length": length,
+		"short":  n,
+	}).Debug("ShortReadHook: shortening")
+	return buf[:n], true, nil, nil
+}
+
+// PostRead implements hookfs.HookOnRead
+func (h *ShortReadHook) PostRead(realRetCode int32, realBuf []byte, prehookCtx hookfs.HookContext) ([]byte, bool, error) {
+	return nil, false, nil
+}
@@ -0,0 +1,56 @@
+package inject
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethercflow/hookfs/hookfs"
+)
+
+func TestShortReadHookLosesNothing(t *testing.T) {
+	original := t.TempDir()
+	hook := NewShortReadHook(original, 0.8, 1)
+	_, mnt := mountOriginal(t, original, hook, &hookfs.Options{DirectIO: true})
+	data := make([]byte, 64<<10)
+	rand.New(rand.NewSource(1)).Read(data)
+	if err := ioutil.WriteFile(filepath.Join(original, "file"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(filepath.Join(mnt, "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var got []byte
+	buf := make([]byte, 4096)
+	reads, short := 0, 0
+	for {
+		n, err := f.Read(buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n == 0 {
+			t.Fatal("read 0 bytes before the end of the file")
+		}
+		reads++
+		if n < len(buf) && len(got)+n < len(data) {
+			short++
+		}
+		got = append(got, buf[:n]...)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("read %d bytes looping, not the %d bytes of the file", len(got), len(data))
+	}
+	if short < reads/2 {
+		t.Errorf("%d of %d reads were short, want most of them", short, reads)
+	}
+}
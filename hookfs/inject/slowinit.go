@@ -0,0 +1,88 @@
+package inject
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrSlowInit is the error of the failing Inits of a SlowInitHook.
+var ErrSlowInit = errors.New("SlowInitHook: backend not ready")
+
+// SlowInitHook models a backend slow to come up: every Init takes Delay, and the first
+// Failures of them fail with ErrSlowInit before one succeeds. Mount with
+// hookfs.Options.FailOnInitError for Serve to return the failures, so that the code
+// under test has to retry mounting.
+//
+// Once initialized, operations go to Hook, if set, which is initialized as well.
+//
+// SlowInitHook implements hookfs.HookWithInit and all the hookfs.HookOnXXX interfaces.
+type SlowInitHook struct {
+	gate
+	// Hook gets the operations, as if it was mounted directly.
+	Hook hookfs.Hook
+
+	mu       sync.Mutex
+	delay    time.Duration
+	failures int
+	attempts int
+}
+
+// NewSlowInitHook creates a SlowInitHook in front of hook (which may be nil), whose Init
+// takes delay and fails failures times before succeeding.
+func NewSlowInitHook(hook hookfs.Hook, delay time.Duration, failures int) *SlowInitHook {
+	h := &SlowInitHook{
+		Hook:     hook,
+		delay:    delay,
+		failures: failures,
+	}
+	h.pick = func(op string, path string) (hookfs.Hook, error) {
+		return h.Hook, nil
+	}
+	return h
+}
+
+// Delay returns how long Init takes.
+func (h *SlowInitHook) Delay() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.delay
+}
+
+// Failures returns how many times Init fails before succeeding.
+func (h *SlowInitHook) Failures() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.failures
+}
+
+// Attempts returns how many times Init was called so far.
+func (h *SlowInitHook) Attempts() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.attempts
+}
+
+// Init implements hookfs.HookWithInit
+func (h *SlowInitHook) Init() error {
+	h.mu.Lock()
+	h.attempts++
+	attempt, delay, failures := h.attempts, h.delay, h.failures
+	h.mu.Unlock()
+
+	time.Sleep(delay)
+	if attempt <= failures {
+		log.WithFields(log.Fields{
+			"attempt":  attempt,
+			"failures": failures,
+		}).Debug("SlowInitHook: failing Init")
+		return ErrSlowInit
+	}
+	if hook, ok := h.Hook.(hookfs.HookWithInit); ok {
+		return hook.Init()
+	}
+	return nil
+}
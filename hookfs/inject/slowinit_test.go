@@ -0,0 +1,74 @@
+package inject
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ethercflow/hookfs/hookfs"
+)
+
+func TestSlowInitHookRetriesMounting(t *testing.T) {
+	if _, err := exec.LookPath("fusermount"); err != nil {
+		t.Skip("fusermount is needed to mount")
+	}
+	serveFromTest(t)
+	hook := NewSlowInitHook(nil, 10*time.Millisecond, 2)
+	original, mnt := t.TempDir(), t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(original, "file"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	h, err := hookfs.NewHookFsWithOptions(original, mnt, hook, &hookfs.Options{FailOnInitError: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var before syscall.Stat_t
+	if err := syscall.Stat(mnt, &before); err != nil {
+		t.Fatal(err)
+	}
+
+	// what a service would do: retry until the backend is up
+	var served chan error
+	failures := 0
+retry:
+	for {
+		served = make(chan error, 1)
+		go func() {
+			served <- h.Serve()
+		}()
+		for {
+			var st syscall.Stat_t
+			// a failed Init mounts for a moment as well
+			if err := syscall.Stat(mnt, &st); err == nil && st.Dev != before.Dev && hook.Attempts() > hook.Failures() {
+				break retry
+			}
+			select {
+			case err := <-served:
+				if err != ErrSlowInit {
+					t.Fatalf("Serve = %v, want %v", err, ErrSlowInit)
+				}
+				failures++
+				continue retry
+			case <-time.After(time.Millisecond):
+			}
+		}
+	}
+	t.Cleanup(func() {
+		for i := 0; h.Unmount() != nil && i < 100; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err := <-served; err != nil {
+			t.Errorf("Serve: %v", err)
+		}
+	})
+
+	if failures != 2 || hook.Attempts() != 3 {
+		t.Errorf("mounted after %d failures and %d attempts, want 2 and 3", failures, hook.Attempts())
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(mnt, "file")); err != nil || string(data) != "data" {
+		t.Errorf("read through the mount = %q, %v, want data", data, err)
+	}
+}
@@ -0,0 +1,111 @@
+package inject
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	log "github.com/sirupsen/logrus"
+)
+
+// SpikeHook delays every operation by Baseline, and a few of them, with probability
+// SpikeProbability, by SpikeMagnitude more, modeling the rare pauses of real storage
+// (garbage collection, compactions) on top of its usual latency. With the same seed,
+// the same operations spike, scheduling permitting.
+//
+// SpikeHook implements all the hookfs.HookOnXXX interfaces.
+type SpikeHook struct {
+	gate
+
+	mu          sync.Mutex
+	baseline    time.Duration
+	probability float64
+	magnitude   time.Duration
+	rnd         *rand.Rand
+	spikes      uint64
+}
+
+// NewSpikeHook creates a SpikeHook delaying operations by baseline, plus magnitude with
+// probability probability (0 to 1), drawing from a generator seeded with seed.
+func NewSpikeHook(baseline time.Duration, probability float64, magnitude time.Duration, seed int64) *SpikeHook {
+	h := &SpikeHook{
+		baseline:    baseline,
+		probability: probability,
+		magnitude:   magnitude,
+		rnd:         rand.New(rand.NewSource(seed)),
+	}
+	h.pick = func(op string, path string) (hookfs.Hook, error) {
+		delay, spike := h.next()
+		if spike {
+			log.WithFields(log.Fields{
+				"op":    op,
+				"path":  path,
+				"delay": delay,
+			}).Debug("SpikeHook: spiking")
+		}
+		time.Sleep(delay)
+		return nil, nil
+	}
+	return h
+}
+
+// Baseline returns the delay of every operation.
+func (h *SpikeHook) Baseline() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.baseline
+}
+
+// SetBaseline changes the delay of every operation.
+func (h *SpikeHook) SetBaseline(baseline time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.baseline = baseline
+}
+
+// SpikeProbability returns the probability that an operation spikes.
+func (h *SpikeHook) SpikeProbability() float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.probability
+}
+
+// SetSpikeProbability changes the probability that an operation spikes.
+func (h *SpikeHook) SetSpikeProbability(probability float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.probability = probability
+}
+
+// SpikeMagnitude returns the extra delay of an operation that spikes.
+func (h *SpikeHook) SpikeMagnitude() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.magnitude
+}
+
+// SetSpikeMagnitude changes the extra delay of an operation that spikes.
+func (h *SpikeHook) SetSpikeMagnitude(magnitude time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.magnitude = magnitude
+}
+
+// Spikes returns the number of operations that spiked so far.
+func (h *SpikeHook) Spikes() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.spikes
+}
+
+// next returns the delay of the next operation, and whether it spikes.
+func (h *SpikeHook) next() (time.Duration, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.rnd.Float64() >= h.probability {
+		return h.baseline, false
+	}
+	h.spikes++
+	return h.baseline + h.magnitude, true
+}
@@ -0,0 +1,51 @@
+package inject
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+func TestSpikeHookLatencyTail(t *testing.T) {
+	const (
+		baseline  = time.Millisecond
+		magnitude = 30 * time.Millisecond
+		n         = 100
+	)
+	hook := NewSpikeHook(baseline, 0.1, magnitude, 1)
+	h, err := hookfs.NewHookFs(t.TempDir(), t.TempDir(), hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := &fuse.Context{}
+	took := make([]time.Duration, n)
+	for i := range took {
+		start := time.Now()
+		if _, code := h.GetAttr("", ctx); !code.Ok() {
+			t.Fatal(code)
+		}
+		took[i] = time.Since(start)
+	}
+	sort.Slice(took, func(i, j int) bool { return took[i] < took[j] })
+
+	if took[0] < baseline {
+		t.Errorf("fastest operation took %v, want at least the baseline %v", took[0], baseline)
+	}
+	if p50 := took[n/2]; p50 >= baseline+magnitude {
+		t.Errorf("median took %v, want under a spike of %v", p50, baseline+magnitude)
+	}
+	spiked := 0
+	for _, d := range took {
+		if d >= baseline+magnitude {
+			spiked++
+		}
+	}
+	if spikes := hook.Spikes(); spikes < n/20 || spikes > n/5 {
+		t.Errorf("%d of %d operations spiked, want about a tenth", spikes, n)
+	} else if uint64(spiked) != spikes {
+		t.Errorf("%d operations took a spike, want the %d Spikes", spiked, spikes)
+	}
+}
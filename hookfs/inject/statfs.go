@@ -0,0 +1,80 @@
+package inject
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+// StatFsHook reports fabricated statfs results for configured subtrees,
+// so that e.g. one directory appears full while the rest of the mount has space.
+//
+// StatFsHook implements hookfs.HookOnStatFsWithResult.
+type StatFsHook struct {
+	mu       sync.RWMutex
+	subtrees map[string]fuse.StatfsOut
+}
+
+// NewStatFsHook creates a StatFsHook with no subtrees configured.
+func NewStatFsHook() *StatFsHook {
+	return &StatFsHook{subtrees: make(map[string]fuse.StatfsOut)}
+}
+
+// SetSubtree makes statfs on dir (relative to the original directory, "" for the root)
+// and anything below it report out. The deepest configured subtree wins.
+func (h *StatFsHook) SetSubtree(dir string, out fuse.StatfsOut) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.subtrees[cleanRel(dir)] = out
+}
+
+// RemoveSubtree removes a subtree set by SetSubtree.
+func (h *StatFsHook) RemoveSubtree(dir string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subtrees, cleanRel(dir))
+}
+
+func (h *StatFsHook) lookup(path string) (fuse.StatfsOut, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for p := cleanRel(path); ; p = parentRel(p) {
+		if out, ok := h.subtrees[p]; ok {
+			return out, true
+		}
+		if p == "" {
+			return fuse.StatfsOut{}, false
+		}
+	}
+}
+
+// PreStatFsWithResult implements hookfs.HookOnStatFsWithResult
+func (h *StatFsHook) PreStatFsWithResult(path string) (*fuse.StatfsOut, bool, hookfs.HookContext, error) {
+	out, ok := h.lookup(path)
+	if !ok {
+		return nil, false, nil, nil
+	}
+	return &out, true, nil, nil
+}
+
+// PostStatFsWithResult implements hookfs.HookOnStatFsWithResult
+func (h *StatFsHook) PostStatFsWithResult(realOut *fuse.StatfsOut, prehookCtx hookfs.HookContext) (*fuse.StatfsOut, bool, error) {
+	return nil, false, nil
+}
+
+// cleanRel normalizes a path relative to the original directory. The root is "".
+func cleanRel(path string) string {
+	return strings.Trim(filepath.Clean("/"+path), "/")
+}
+
+// parentRel returns the parent of a path normalized by cleanRel.
+func parentRel(path string) string {
+	dir := filepath.Dir(path)
+	if dir == "." {
+		return ""
+	}
+	return dir
+}
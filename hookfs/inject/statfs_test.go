@@ -0,0 +1,32 @@
+package inject
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+func TestStatFsHookSubtrees(t *testing.T) {
+	hook := NewStatFsHook()
+	hook.SetSubtree("full", fuse.StatfsOut{Blocks: 1000, Bfree: 0, Bavail: 0, Bsize: 4096})
+	hook.SetSubtree("", fuse.StatfsOut{Blocks: 1000, Bfree: 900, Bavail: 900, Bsize: 4096})
+	_, original, mnt := mount(t, hook, nil)
+	for _, dir := range []string{"full/sub", "roomy"} {
+		if err := os.MkdirAll(filepath.Join(original, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for path, want := range map[string]uint64{"full/sub": 0, "roomy": 900, "": 900} {
+		var st syscall.Statfs_t
+		if err := syscall.Statfs(filepath.Join(mnt, path), &st); err != nil {
+			t.Fatal(err)
+		}
+		if st.Bavail != want {
+			t.Errorf("statfs %q: %d blocks available, want %d", path, st.Bavail, want)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package inject
+
+import (
+	"context"
+	"sync"
+)
+
+// stopper ends the waits of a hook when the HookFs stops serving, so that unmounting does not
+// wait for them: Init gives the mount a context, and Stop cancels it.
+type stopper struct {
+	mu     sync.Mutex
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Init implements hookfs.HookWithInit
+func (s *stopper) Init() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	return nil
+}
+
+// Stop implements hookfs.HookWithStop
+func (s *stopper) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		s.cancel()
+	}
+}
+
+// stopped returns a channel closed once the hook is stopped, never closed if it is not mounted.
+func (s *stopper) stopped() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ctx == nil {
+		return nil
+	}
+	return s.ctx.Done()
+}
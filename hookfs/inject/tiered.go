@@ -0,0 +1,139 @@
+package inject
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	log "github.com/sirupsen/logrus"
+)
+
+// TieredStorageHook models tiered storage: a file starts cold, and the first Open or Read of
+// a cold file waits PromotionDelay while the file is promoted to the fast tier. Accesses to
+// a hot file are not delayed. A file that is not accessed for DemoteAfter goes cold again.
+//
+// Concurrent accesses to a cold file all wait for the promotion.
+//
+// TieredStorageHook implements hookfs.HookOnOpen and hookfs.HookOnReadMetadata.
+type TieredStorageHook struct {
+	mu             sync.Mutex
+	promotionDelay time.Duration
+	demoteAfter    time.Duration
+	files          map[string]*tieredFile
+}
+
+type tieredFile struct {
+	// promoted is closed once the file is hot
+	promoted   chan struct{}
+	lastAccess time.Time
+}
+
+// NewTieredStorageHook creates a TieredStorageHook promoting files in promotionDelay
+// and demoting them after demoteAfter without access.
+func NewTieredStorageHook(promotionDelay time.Duration, demoteAfter time.Duration) *TieredStorageHook {
+	return &TieredStorageHook{
+		promotionDelay: promotionDelay,
+		demoteAfter:    demoteAfter,
+		files:          make(map[string]*tieredFile),
+	}
+}
+
+// PromotionDelay returns the delay of the first access to a cold file.
+func (h *TieredStorageHook) PromotionDelay() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.promotionDelay
+}
+
+// SetPromotionDelay changes the delay of the first access to a cold file.
+func (h *TieredStorageHook) SetPromotionDelay(promotionDelay time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.promotionDelay = promotionDelay
+}
+
+// DemoteAfter returns how long a file stays hot without access.
+func (h *TieredStorageHook) DemoteAfter() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.demoteAfter
+}
+
+// SetDemoteAfter changes how long a file stays hot without access.
+func (h *TieredStorageHook) SetDemoteAfter(demoteAfter time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.demoteAfter = demoteAfter
+}
+
+// Hot returns whether path is in the fast tier.
+func (h *TieredStorageHook) Hot(path string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	f, ok := h.files[cleanRel(path)]
+	if !ok || time.Since(f.lastAccess) >= h.demoteAfter {
+		return false
+	}
+	select {
+	case <-f.promoted:
+		return true
+	default:
+		return false
+	}
+}
+
+// access waits for path to be hot.
+func (h *TieredStorageHook) access(op string, path string) {
+	path = cleanRel(path)
+	now := time.Now()
+
+	h.mu.Lock()
+	f, ok := h.files[path]
+	if ok && now.Sub(f.lastAccess) >= h.demoteAfter {
+		delete(h.files, path)
+		ok = false
+	}
+	if ok {
+		f.lastAccess = now
+		h.mu.Unlock()
+		<-f.promoted
+		return
+	}
+	f = &tieredFile{
+		promoted:   make(chan struct{}),
+		lastAccess: now,
+	}
+	h.files[path] = f
+	delay := h.promotionDelay
+	h.mu.Unlock()
+
+	log.WithFields(log.Fields{
+		"op":    op,
+		"path":  path,
+		"delay": delay,
+	}).Debug("TieredStorageHook: promoting a cold file")
+	time.Sleep(delay)
+	close(f.promoted)
+}
+
+// PreOpen implements hookfs.HookOnOpen
+func (h *TieredStorageHook) PreOpen(path string, flags uint32) (bool, hookfs.HookContext, error) {
+	h.access(hookfs.OpOpen, path)
+	return false, nil, nil
+}
+
+// PostOpen implements hookfs.HookOnOpen
+func (h *TieredStorageHook) PostOpen(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return false, nil
+}
+
+// PreReadMetadata implements hookfs.HookOnReadMetadata
+func (h *TieredStorageHook) PreReadMetadata(path string, length int64, offset int64) (bool, hookfs.HookContext, error) {
+	h.access(hookfs.OpRead, path)
+	return false, nil, nil
+}
+
+// PostReadMetadata implements hookfs.HookOnReadMetadata
+func (h *TieredStorageHook) PostReadMetadata(realRetCode int32, realSize int, prehookCtx hookfs.HookContext) (bool, error) {
+	return false, nil
+}
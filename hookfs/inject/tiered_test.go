@@ -0,0 +1,36 @@
+package inject
+
+import (
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestTieredStorageHookTransitions(t *testing.T) {
+	const promotion, demotion = 50 * time.Millisecond, 150 * time.Millisecond
+	h := NewTieredStorageHook(promotion, demotion)
+	open := func() time.Duration {
+		start := time.Now()
+		if _, _, err := h.PreOpen("file", syscall.O_RDONLY); err != nil {
+			t.Fatal(err)
+		}
+		return time.Since(start)
+	}
+
+	if took := open(); took < promotion {
+		t.Errorf("cold open took %v, want at least %v", took, promotion)
+	}
+	if !h.Hot("file") {
+		t.Error("not hot after the first open")
+	}
+	if took := open(); took >= promotion {
+		t.Errorf("hot open took %v, want less than %v", took, promotion)
+	}
+	time.Sleep(demotion)
+	if h.Hot("file") {
+		t.Errorf("still hot after %v without access", demotion)
+	}
+	if took := open(); took < promotion {
+		t.Errorf("open after demotion took %v, want at least %v", took, promotion)
+	}
+}
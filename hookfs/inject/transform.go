@@ -0,0 +1,122 @@
+package inject
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	log "github.com/sirupsen/logrus"
+)
+
+// TransformHook transparently transforms file contents, e.g. to convert line endings or
+// text encodings: Encode is applied to data written through the mount before it is stored,
+// and Decode is applied to stored data before it is returned to readers.
+//
+// Because Encode and Decode may change the length of the data, offsets in the mount and in
+// the original file don't correspond. TransformHook therefore works on whole files: a read
+// decodes the whole stored file and returns the requested range of the result, and a write
+// decodes the stored file, applies the write and stores the whole file encoded again.
+// This makes any offset work, but costs O(file size) per read and write, so it is meant for
+// small text files. Other limitations:
+//
+//   - The sizes reported by getattr are those of the stored file. The kernel does not read past
+//     that size, so Decode should not make data longer than what is stored unless the caller
+//     uses direct I/O.
+//   - Truncate, fallocate and lseek work on the stored, encoded file.
+//   - Encode and Decode must handle arbitrary (possibly empty) data and should be inverses.
+//
+// TransformHook implements hookfs.HookOnRead and hookfs.HookOnWrite.
+type TransformHook struct {
+	// Original is the original directory of the mount.
+	Original string
+	// Encode transforms data on its way to Original. nil leaves data as is.
+	Encode func([]byte) []byte
+	// Decode transforms data on its way to readers. nil leaves data as is.
+	Decode func([]byte) []byte
+
+	mu sync.Mutex
+}
+
+// LFToCRLF converts "\n" line endings to "\r\n". It can be used as Encode or Decode.
+func LFToCRLF(data []byte) []byte {
+	return bytes.Replace(CRLFToLF(data), []byte("\n"), []byte("\r\n"), -1)
+}
+
+// CRLFToLF converts "\r\n" line endings to "\n". It can be used as Encode or Decode.
+func CRLFToLF(data []byte) []byte {
+	return bytes.Replace(data, []byte("\r\n"), []byte("\n"), -1)
+}
+
+func (h *TransformHook) decoded(path string) ([]byte, error) {
+	stored, err := ioutil.ReadFile(filepath.Join(h.Original, path))
+	if err != nil {
+		return nil, err
+	}
+	if h.Decode == nil {
+		return stored, nil
+	}
+	return h.Decode(stored), nil
+}
+
+// PreRead implements hookfs.HookOnRead
+func (h *TransformHook) PreRead(path string, length int64, offset int64) ([]byte, bool, hookfs.HookContext, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	data, err := h.decoded(path)
+	if err != nil {
+		// let the real read report it
+		return nil, false, nil, nil
+	}
+	if offset >= int64(len(data)) {
+		return []byte{}, true, nil, nil
+	}
+	end := offset + length
+	if end > int64(len(data)) {
+		end = int64(len(data))
+	}
+	return data[offset:end], true, nil, nil
+}
+
+// PostRead implements hookfs.HookOnRead
+func (h *TransformHook) PostRead(realRetCode int32, realBuf []byte, prehookCtx hookfs.HookContext) ([]byte, bool, error) {
+	return nil, false, nil
+}
+
+// PreWrite implements hookfs.HookOnWrite
+func (h *TransformHook) PreWrite(path string, buf []byte, offset int64) (bool, hookfs.HookContext, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	data, err := h.decoded(path)
+	if err != nil {
+		return false, nil, nil
+	}
+	if end := offset + int64(len(buf)); end > int64(len(data)) {
+		data = append(data, make([]byte, end-int64(len(data)))...)
+	}
+	copy(data[offset:], buf)
+	if h.Encode != nil {
+		data = h.Encode(data)
+	}
+
+	f, err := os.OpenFile(filepath.Join(h.Original, path), os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return true, nil, err
+	}
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		log.WithFields(log.Fields{
+			"path":  path,
+			"error": err,
+		}).Warn("TransformHook: could not store transformed data")
+		return true, nil, err
+	}
+	return true, nil, nil
+}
+
+// PostWrite implements hookfs.HookOnWrite
+func (h *TransformHook) PostWrite(realRetCode int32, prehookCtx hookfs.HookContext) (uint32, bool, error) {
+	return 0, false, nil
+}
@@ -0,0 +1,44 @@
+package inject
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethercflow/hookfs/hookfs"
+)
+
+func TestTransformHookLineEndings(t *testing.T) {
+	original := t.TempDir()
+	hook := &TransformHook{Original: original, Encode: LFToCRLF, Decode: CRLFToLF}
+	_, mnt := mountOriginal(t, original, hook, &hookfs.Options{DirectIO: true})
+
+	f, err := os.Create(filepath.Join(mnt, "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"first\n", "second\n", "third\n"} {
+		if _, err := f.WriteString(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := ioutil.ReadFile(filepath.Join(original, "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "first\r\nsecond\r\nthird\r\n"; string(stored) != want {
+		t.Errorf("stored %q, want %q", stored, want)
+	}
+	read, err := ioutil.ReadFile(filepath.Join(mnt, "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "first\nsecond\nthird\n"; string(read) != want {
+		t.Errorf("read %q back, want %q", read, want)
+	}
+}
@@ -0,0 +1,144 @@
+package inject
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	"github.com/hanwen/go-fuse/fuse"
+	log "github.com/sirupsen/logrus"
+)
+
+// TripwireViolation is an operation on a guarded path.
+type TripwireViolation struct {
+	Op   string
+	Path string
+	Time time.Time
+}
+
+// TripwireHook guards paths that the code under test must not touch: every operation on a
+// guarded path, or under a guarded directory, is recorded as a violation, so that a test can
+// assert there was none. With FailOnViolation set, the operations fail with EPERM as well,
+// except Release, which cannot fail.
+//
+// Paths are relative to the original directory, as passed to hooks. Lookups reach hookfs as
+// getattr, so merely checking that a guarded path exists trips the wire. Renames and links
+// trip it through either name.
+//
+// TripwireHook implements all the hookfs.HookOnXXX interfaces.
+type TripwireHook struct {
+	gate
+	paths []string
+	fail  int32
+
+	mu         sync.Mutex
+	violations []TripwireViolation
+}
+
+// NewTripwireHook creates a TripwireHook guarding paths, recording violations only.
+func NewTripwireHook(paths ...string) *TripwireHook {
+	h := &TripwireHook{}
+	for _, path := range paths {
+		h.paths = append(h.paths, cleanRel(path))
+	}
+	h.pick = func(op string, path string) (hookfs.Hook, error) {
+		return nil, h.check(op, path)
+	}
+	return h
+}
+
+// Paths returns the guarded paths.
+func (h *TripwireHook) Paths() []string {
+	return append([]string(nil), h.paths...)
+}
+
+// FailOnViolation returns whether operations on guarded paths fail with EPERM.
+func (h *TripwireHook) FailOnViolation() bool {
+	return atomic.LoadInt32(&h.fail) != 0
+}
+
+// SetFailOnViolation changes whether operations on guarded paths fail with EPERM.
+// It is safe to call while mounted.
+func (h *TripwireHook) SetFailOnViolation(fail bool) {
+	atomic.StoreInt32(&h.fail, boolToInt32(fail))
+}
+
+// Violations returns the violations so far, oldest first.
+func (h *TripwireHook) Violations() []TripwireViolation {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]TripwireViolation(nil), h.violations...)
+}
+
+// Reset forgets the violations so far.
+func (h *TripwireHook) Reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.violations = nil
+}
+
+// guarded returns whether path is a guarded path or under one.
+func (h *TripwireHook) guarded(path string) bool {
+	for _, p := range h.paths {
+		if path == p || p == "" || strings.HasPrefix(path, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// check records a violation if path is guarded, and returns the error to fail with, if any.
+func (h *TripwireHook) check(op string, path string) error {
+	path = cleanRel(path)
+	if !h.guarded(path) {
+		return nil
+	}
+	log.WithFields(log.Fields{
+		"op":   op,
+		"path": path,
+	}).Warn("TripwireHook: guarded path touched")
+
+	h.mu.Lock()
+	h.violations = append(h.violations, TripwireViolation{Op: op, Path: path, Time: time.Now()})
+	h.mu.Unlock()
+	if !h.FailOnViolation() {
+		return nil
+	}
+	return syscall.EPERM
+}
+
+// check2 is check for operations on two paths.
+func (h *TripwireHook) check2(op string, oldName string, newName string) (bool, hookfs.HookContext, error) {
+	errOld := h.check(op, oldName)
+	errNew := h.check(op, newName)
+	if errOld != nil {
+		return true, nil, errOld
+	}
+	if errNew != nil {
+		return true, nil, errNew
+	}
+	return false, nil, nil
+}
+
+// PreRenameWithContext implements hookfs.HookOnRenameWithContext
+func (h *TripwireHook) PreRenameWithContext(oldName string, newName string, context *fuse.Context) (bool, hookfs.HookContext, error) {
+	return h.check2(hookfs.OpRename, oldName, newName)
+}
+
+// PostRename implements hookfs.HookOnRenameWithContext
+func (h *TripwireHook) PostRename(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return false, nil
+}
+
+// PreLinkWithContext implements hookfs.HookOnLinkWithContext
+func (h *TripwireHook) PreLinkWithContext(oldName string, newName string, context *fuse.Context) (bool, hookfs.HookContext, error) {
+	return h.check2(hookfs.OpLink, oldName, newName)
+}
+
+// PostLink implements hookfs.HookOnLinkWithContext
+func (h *TripwireHook) PostLink(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	return false, nil
+}
@@ -0,0 +1,51 @@
+package inject
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/ethercflow/hookfs/hookfs"
+)
+
+func TestTripwireHookFiresOnRead(t *testing.T) {
+	hook := NewTripwireHook("secret")
+	_, original, mnt := mount(t, hook, &hookfs.Options{DirectIO: true, AttrTimeout: -1, EntryTimeout: -1})
+	for _, name := range []string{"other", "secret"} {
+		if err := ioutil.WriteFile(filepath.Join(original, name), []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := ioutil.ReadFile(filepath.Join(mnt, "other")); err != nil {
+		t.Fatal(err)
+	}
+	if v := hook.Violations(); len(v) != 0 {
+		t.Errorf("violations after reading another file: %v, want none", v)
+	}
+
+	if _, err := ioutil.ReadFile(filepath.Join(mnt, "secret")); err != nil {
+		t.Fatal(err)
+	}
+	read := false
+	for _, v := range hook.Violations() {
+		if v.Path != "secret" {
+			t.Errorf("violation on %q, want secret only", v.Path)
+		}
+		read = read || v.Op == hookfs.OpRead
+	}
+	if !read {
+		t.Errorf("violations %v, want a read of secret", hook.Violations())
+	}
+
+	hook.Reset()
+	hook.SetFailOnViolation(true)
+	if _, err := ioutil.ReadFile(filepath.Join(mnt, "secret")); !errors.Is(err, syscall.EPERM) {
+		t.Errorf("read of secret failing on violation = %v, want EPERM", err)
+	}
+	if len(hook.Violations()) == 0 {
+		t.Error("no violation recorded while failing")
+	}
+}
@@ -0,0 +1,256 @@
+package inject
+
+import (
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	log "github.com/sirupsen/logrus"
+)
+
+// TruncatePolicy is what a TruncateWindowHook does to the first write following a truncation
+// to zero.
+type TruncatePolicy int
+
+const (
+	// TruncateFlag only logs and counts the truncations to zero.
+	TruncateFlag TruncatePolicy = iota
+	// TruncateDelay delays the first write by Delay, keeping the file empty for longer.
+	TruncateDelay
+	// TruncateFail fails the first write with EIO, leaving the file empty as a crash would.
+	// The writes after it go through.
+	TruncateFail
+)
+
+// TruncateWindowHook watches the window in which a file has been truncated to zero but not
+// rewritten yet, where a crash loses the whole file, as with configuration files rewritten
+// in place instead of replaced atomically.
+//
+// A window opens with a successful truncate to zero or open with O_TRUNC, and closes with the
+// next successful write to the file, or its removal. Renaming a file in its window moves the
+// window along, and renaming another file over it closes it.
+//
+// TruncateWindowHook implements hookfs.HookOnTruncate, hookfs.HookOnOpen, hookfs.HookOnWrite,
+// hookfs.HookOnRename and hookfs.HookOnUnlink.
+type TruncateWindowHook struct {
+	mu      sync.Mutex
+	policy  TruncatePolicy
+	delay   time.Duration
+	windows map[string]*truncateWindow
+	count   uint64
+}
+
+type truncateWindow struct {
+	opened time.Time
+	// faulted is set once the first write has been failed or delayed
+	faulted bool
+}
+
+type truncateWindowCtx struct {
+	path string
+}
+
+// NewTruncateWindowHook creates a TruncateWindowHook applying policy, delaying writes by delay
+// with TruncateDelay.
+func NewTruncateWindowHook(policy TruncatePolicy, delay time.Duration) *TruncateWindowHook {
+	return &TruncateWindowHook{
+		policy:  policy,
+		delay:   delay,
+		windows: make(map[string]*truncateWindow),
+	}
+}
+
+// Policy returns what is done to the first write in a window.
+func (h *TruncateWindowHook) Policy() TruncatePolicy {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.policy
+}
+
+// SetPolicy changes what is done to the first write in a window.
+func (h *TruncateWindowHook) SetPolicy(policy TruncatePolicy) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.policy = policy
+}
+
+// Delay returns how long TruncateDelay delays the first write.
+func (h *TruncateWindowHook) Delay() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.delay
+}
+
+// SetDelay changes how long TruncateDelay delays the first write.
+func (h *TruncateWindowHook) SetDelay(delay time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.delay = delay
+}
+
+// InWindow returns whether path has been truncated to zero and not rewritten yet.
+func (h *TruncateWindowHook) InWindow(path string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, ok := h.windows[cleanRel(path)]
+	return ok
+}
+
+// Windows returns the paths in their window, sorted.
+func (h *TruncateWindowHook) Windows() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	paths := make([]string, 0, len(h.windows))
+	for path := range h.windows {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Count returns the number of windows opened so far.
+func (h *TruncateWindowHook) Count() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.count
+}
+
+// truncated opens the window of the path of prehookCtx if the truncation succeeded.
+func (h *TruncateWindowHook) truncated(op string, realRetCode int32, prehookCtx hookfs.HookContext) {
+	ctx, ok := prehookCtx.(*truncateWindowCtx)
+	if !ok || realRetCode != 0 {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.windows[ctx.path]; ok {
+		return
+	}
+	h.windows[ctx.path] = &truncateWindow{opened: time.Now()}
+	h.count++
+	log.WithFields(log.Fields{
+		"op":   op,
+		"path": ctx.path,
+	}).Warn("TruncateWindowHook: file truncated to zero, a crash now loses it")
+}
+
+// PreTruncate implements hookfs.HookOnTruncate
+func (h *TruncateWindowHook) PreTruncate(path string, size uint64) (bool, hookfs.HookContext, error) {
+	if size != 0 {
+		return false, nil, nil
+	}
+	return false, &truncateWindowCtx{path: cleanRel(path)}, nil
+}
+
+// PostTruncate implements hookfs.HookOnTruncate
+func (h *TruncateWindowHook) PostTruncate(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	h.truncated(hookfs.OpTruncate, realRetCode, prehookCtx)
+	return false, nil
+}
+
+// PreOpen implements hookfs.HookOnOpen
+func (h *TruncateWindowHook) PreOpen(path string, flags uint32) (bool, hookfs.HookContext, error) {
+	if flags&syscall.O_TRUNC == 0 || flags&syscall.O_ACCMODE == syscall.O_RDONLY {
+		return false, nil, nil
+	}
+	return false, &truncateWindowCtx{path: cleanRel(path)}, nil
+}
+
+// PostOpen implements hookfs.HookOnOpen
+func (h *TruncateWindowHook) PostOpen(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	h.truncated(hookfs.OpOpen, realRetCode, prehookCtx)
+	return false, nil
+}
+
+// PreWrite implements hookfs.HookOnWrite
+func (h *TruncateWindowHook) PreWrite(path string, buf []byte, offset int64) (bool, hookfs.HookContext, error) {
+	path = cleanRel(path)
+
+	h.mu.Lock()
+	w, ok := h.windows[path]
+	if !ok {
+		h.mu.Unlock()
+		return false, nil, nil
+	}
+	ctx := &truncateWindowCtx{path: path}
+	if w.faulted || h.policy == TruncateFlag {
+		h.mu.Unlock()
+		return false, ctx, nil
+	}
+	w.faulted = true
+	policy, delay := h.policy, h.delay
+	h.mu.Unlock()
+
+	log.WithFields(log.Fields{
+		"path":   path,
+		"policy": policy,
+		"window": time.Since(w.opened),
+	}).Debug("TruncateWindowHook: first write after truncation")
+	if policy == TruncateFail {
+		return true, nil, syscall.EIO
+	}
+	time.Sleep(delay)
+	return false, ctx, nil
+}
+
+// PostWrite implements hookfs.HookOnWrite
+func (h *TruncateWindowHook) PostWrite(realRetCode int32, prehookCtx hookfs.HookContext) (uint32, bool, error) {
+	ctx, ok := prehookCtx.(*truncateWindowCtx)
+	if !ok || realRetCode != 0 {
+		return 0, false, nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.windows, ctx.path)
+	return 0, false, nil
+}
+
+type truncateWindowRenameCtx struct {
+	oldName, newName string
+}
+
+// PreRename implements hookfs.HookOnRename
+func (h *TruncateWindowHook) PreRename(oldName string, newName string) (bool, hookfs.HookContext, error) {
+	return false, &truncateWindowRenameCtx{oldName: cleanRel(oldName), newName: cleanRel(newName)}, nil
+}
+
+// PostRename implements hookfs.HookOnRename
+func (h *TruncateWindowHook) PostRename(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	ctx, ok := prehookCtx.(*truncateWindowRenameCtx)
+	if !ok || realRetCode != 0 || ctx.oldName == ctx.newName {
+		return false, nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	w, ok := h.windows[ctx.oldName]
+	delete(h.windows, ctx.oldName)
+	if ok {
+		h.windows[ctx.newName] = w
+	} else {
+		delete(h.windows, ctx.newName)
+	}
+	return false, nil
+}
+
+// PreUnlink implements hookfs.HookOnUnlink
+func (h *TruncateWindowHook) PreUnlink(name string) (bool, hookfs.HookContext, error) {
+	return false, &truncateWindowCtx{path: cleanRel(name)}, nil
+}
+
+// PostUnlink implements hookfs.HookOnUnlink
+func (h *TruncateWindowHook) PostUnlink(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	ctx, ok := prehookCtx.(*truncateWindowCtx)
+	if !ok || realRetCode != 0 {
+		return false, nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.windows, ctx.path)
+	return false, nil
+}
@@ -0,0 +1,47 @@
+package inject
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/ethercflow/hookfs/hookfs"
+)
+
+func TestTruncateWindowHookLosesFileOnCrash(t *testing.T) {
+	hook := NewTruncateWindowHook(TruncateFail, 0)
+	_, original, mnt := mount(t, hook, &hookfs.Options{DirectIO: true})
+	if err := ioutil.WriteFile(filepath.Join(original, "config"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// rewriting in place: the first write after the truncation "crashes"
+	f, err := os.OpenFile(filepath.Join(mnt, "config"), os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if !hook.InWindow("config") || hook.Count() != 1 {
+		t.Errorf("config is not in its window after the truncation: %v", hook.Windows())
+	}
+	if _, err := f.WriteAt([]byte("new"), 0); !errors.Is(err, syscall.EIO) {
+		t.Errorf("first write = %v, want EIO", err)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(original, "config")); err != nil || len(data) != 0 {
+		t.Errorf("after the crash config holds %q, %v, want nothing", data, err)
+	}
+
+	// the writes after it go through, closing the window
+	if _, err := f.WriteAt([]byte("new"), 0); err != nil {
+		t.Errorf("second write = %v, want success", err)
+	}
+	if hook.InWindow("config") {
+		t.Error("config is still in its window after a write")
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(original, "config")); err != nil || string(data) != "new" {
+		t.Errorf("config holds %q, %v, want new", data, err)
+	}
+}
@@ -0,0 +1,202 @@
+package inject
+
+import (
+	"sync"
+	"syscall"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	"github.com/hanwen/go-fuse/fuse"
+	log "github.com/sirupsen/logrus"
+)
+
+// PerUserQuotaHook gives each user a budget of bytes written: once a uid has written its
+// limit, its writes fail with EDQUOT while other users carry on.
+//
+// Writes carry no caller, so they are charged to the uid that opened or created the file
+// for writing, the last one if several users have the file open for writing. Every byte
+// written counts, including overwrites, and nothing is refunded on truncate or unlink.
+// Users without a limit are not limited.
+//
+// PerUserQuotaHook implements hookfs.HookOnOpenWithContext, hookfs.HookOnCreateWithContext,
+// hookfs.HookOnWrite and hookfs.HookOnReleaseWithFlags.
+type PerUserQuotaHook struct {
+	mu     sync.Mutex
+	limits map[uint32]uint64
+	used   map[uint32]uint64
+	// writers maps the paths open for writing to their writer
+	writers map[string]*quotaWriter
+}
+
+type quotaWriter struct {
+	uid     uint32
+	handles int
+}
+
+type quotaOpenCtx struct {
+	path string
+	uid  uint32
+}
+
+type quotaWriteCtx struct {
+	uid uint32
+	n   uint64
+}
+
+// NewPerUserQuotaHook creates a PerUserQuotaHook without limits.
+func NewPerUserQuotaHook() *PerUserQuotaHook {
+	return &PerUserQuotaHook{
+		limits:  make(map[uint32]uint64),
+		used:    make(map[uint32]uint64),
+		writers: make(map[string]*quotaWriter),
+	}
+}
+
+// Limit returns the number of bytes uid may write, and false if uid is not limited.
+func (h *PerUserQuotaHook) Limit(uid uint32) (uint64, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	limit, ok := h.limits[uid]
+	return limit, ok
+}
+
+// SetLimit limits uid to limit bytes written.
+func (h *PerUserQuotaHook) SetLimit(uid uint32, limit uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.limits[uid] = limit
+}
+
+// RemoveLimit lets uid write without limit.
+func (h *PerUserQuotaHook) RemoveLimit(uid uint32) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.limits, uid)
+}
+
+// Used returns the number of bytes written by uid.
+func (h *PerUserQuotaHook) Used(uid uint32) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.used[uid]
+}
+
+// Reset sets the bytes written by uid back to zero.
+func (h *PerUserQuotaHook) Reset(uid uint32) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.used, uid)
+}
+
+func (h *PerUserQuotaHook) open(path string, flags uint32, context *fuse.Context) hookfs.HookContext {
+	if _, writer := accessOf(flags); !writer || context == nil {
+		return nil
+	}
+	return &quotaOpenCtx{path: cleanRel(path), uid: context.Uid}
+}
+
+// opened records the writer of the path of prehookCtx if the open succeeded.
+func (h *PerUserQuotaHook) opened(realRetCode int32, prehookCtx hookfs.HookContext) {
+	ctx, ok := prehookCtx.(*quotaOpenCtx)
+	if !ok || realRetCode != 0 {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	w, ok := h.writers[ctx.path]
+	if !ok {
+		w = &quotaWriter{}
+		h.writers[ctx.path] = w
+	}
+	w.uid = ctx.uid
+	w.handles++
+}
+
+// PreOpenWithContext implements hookfs.HookOnOpenWithContext
+func (h *PerUserQuotaHook) PreOpenWithContext(path string, flags uint32, context *fuse.Context) (bool, hookfs.HookContext, error) {
+	return false, h.open(path, flags, context), nil
+}
+
+// PostOpen implements hookfs.HookOnOpenWithContext
+func (h *PerUserQuotaHook) PostOpen(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	h.opened(realRetCode, prehookCtx)
+	return false, nil
+}
+
+// PreCreateWithContext implements hookfs.HookOnCreateWithContext
+func (h *PerUserQuotaHook) PreCreateWithContext(name string, flags uint32, mode uint32, context *fuse.Context) (bool, hookfs.HookContext, error) {
+	return false, h.open(name, flags, context), nil
+}
+
+// PostCreate implements hookfs.HookOnCreateWithContext
+func (h *PerUserQuotaHook) PostCreate(realRetCode int32, prehookCtx hookfs.HookContext) (bool, error) {
+	h.opened(realRetCode, prehookCtx)
+	return false, nil
+}
+
+// PreWrite implements hookfs.HookOnWrite
+func (h *PerUserQuotaHook) PreWrite(path string, buf []byte, offset int64) (bool, hookfs.HookContext, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	w, ok := h.writers[cleanRel(path)]
+	if !ok {
+		return false, nil, nil
+	}
+	n := uint64(len(buf))
+	if limit, ok := h.limits[w.uid]; ok && h.used[w.uid]+n > limit {
+		log.WithFields(log.Fields{
+			"path":  path,
+			"uid":   w.uid,
+			"used":  h.used[w.uid],
+			"limit": limit,
+		}).Debug("PerUserQuotaHook: quota exceeded")
+		return true, nil, syscall.EDQUOT
+	}
+	// reserved until the write is done, so that concurrent writes can't overshoot
+	h.used[w.uid] += n
+	return false, &quotaWriteCtx{uid: w.uid, n: n}, nil
+}
+
+// PostWrite implements hookfs.HookOnWrite
+func (h *PerUserQuotaHook) PostWrite(realRetCode int32, prehookCtx hookfs.HookContext) (uint32, bool, error) {
+	ctx, ok := prehookCtx.(*quotaWriteCtx)
+	if !ok || realRetCode == 0 {
+		return 0, false, nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	// the count may have been reset in between
+	if h.used[ctx.uid] < ctx.n {
+		h.used[ctx.uid] = 0
+	} else {
+		h.used[ctx.uid] -= ctx.n
+	}
+	return 0, false, nil
+}
+
+// PreReleaseWithFlags implements hookfs.HookOnReleaseWithFlags
+func (h *PerUserQuotaHook) PreReleaseWithFlags(path string, flags uint32) (bool, hookfs.HookContext) {
+	if _, writer := accessOf(flags); !writer {
+		return false, nil
+	}
+	return false, cleanRel(path)
+}
+
+// PostRelease implements hookfs.HookOnReleaseWithFlags
+func (h *PerUserQuotaHook) PostRelease(prehookCtx hookfs.HookContext) bool {
+	path, ok := prehookCtx.(string)
+	if !ok {
+		return false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	w, ok := h.writers[path]
+	if !ok {
+		return false
+	}
+	w.handles--
+	if w.handles <= 0 {
+		delete(h.writers, path)
+	}
+	return false
+}
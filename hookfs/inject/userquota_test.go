@@ -0,0 +1,55 @@
+package inject
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/hanwen/go-fuse/fuse/nodefs"
+)
+
+func TestPerUserQuotaHook(t *testing.T) {
+	hook := NewPerUserQuotaHook()
+	hook.SetLimit(1000, 10)
+	hook.SetLimit(1001, 100)
+	h, err := hookfs.NewHookFs(t.TempDir(), t.TempDir(), hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	create := func(name string, uid uint32) nodefs.File {
+		t.Helper()
+		f, code := h.Create(name, syscall.O_WRONLY|syscall.O_CREAT, 0644, &fuse.Context{Owner: fuse.Owner{Uid: uid}})
+		if !code.Ok() {
+			t.Fatal(code)
+		}
+		return f
+	}
+	f1, f2 := create("a", 1000), create("b", 1001)
+	defer f1.Release()
+	defer f2.Release()
+
+	if _, code := f1.Write(make([]byte, 8), 0); !code.Ok() {
+		t.Errorf("write within quota = %v, want OK", code)
+	}
+	if _, code := f1.Write(make([]byte, 8), 8); code != fuse.Status(syscall.EDQUOT) {
+		t.Errorf("write over quota = %v, want EDQUOT", code)
+	}
+	// the other user is not held back
+	for i := int64(0); i < 5; i++ {
+		if _, code := f2.Write(make([]byte, 8), 8*i); !code.Ok() {
+			t.Errorf("write %d of the other user = %v, want OK", i, code)
+		}
+	}
+	if used := hook.Used(1000); used != 8 {
+		t.Errorf("uid 1000 used %d bytes, want 8", used)
+	}
+	if used := hook.Used(1001); used != 40 {
+		t.Errorf("uid 1001 used %d bytes, want 40", used)
+	}
+
+	hook.Reset(1000)
+	if _, code := f1.Write(make([]byte, 8), 8); !code.Ok() {
+		t.Errorf("write after Reset = %v, want OK", code)
+	}
+}
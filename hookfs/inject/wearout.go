@@ -0,0 +1,109 @@
+package inject
+
+import (
+	"sync"
+	"syscall"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	log "github.com/sirupsen/logrus"
+)
+
+// WearOutScope selects what a WearOutHook counts writes against.
+type WearOutScope int
+
+const (
+	// WearOutMount counts the writes to all the files together, so the whole mount wears out at once.
+	WearOutMount WearOutScope = iota
+	// WearOutPerPath counts the writes to each file separately, so files wear out one by one.
+	WearOutPerPath
+)
+
+// WearOutHook models flash wear-out: once Threshold writes have been let through,
+// further writes fail with EROFS. Reads, and all the other operations, keep working.
+//
+// A write is counted when it is let through, whether or not it then succeeds in Original.
+//
+// WearOutHook implements hookfs.HookOnWrite.
+type WearOutHook struct {
+	scope WearOutScope
+
+	mu        sync.Mutex
+	threshold uint64
+	total     uint64
+	perPath   map[string]uint64
+}
+
+// NewWearOutHook creates a WearOutHook letting threshold writes through in scope.
+func NewWearOutHook(threshold uint64, scope WearOutScope) *WearOutHook {
+	return &WearOutHook{
+		scope:     scope,
+		threshold: threshold,
+		perPath:   make(map[string]uint64),
+	}
+}
+
+// Scope returns what writes are counted against.
+func (h *WearOutHook) Scope() WearOutScope {
+	return h.scope
+}
+
+// Threshold returns the number of writes let through before wearing out.
+func (h *WearOutHook) Threshold() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.threshold
+}
+
+// SetThreshold changes the number of writes let through. Writes already counted stay counted.
+func (h *WearOutHook) SetThreshold(threshold uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.threshold = threshold
+}
+
+// WornOut returns whether writes to path fail.
+func (h *WearOutHook) WornOut(path string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.count(path) >= h.threshold
+}
+
+// Reset forgets all the writes counted so far.
+func (h *WearOutHook) Reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.total = 0
+	h.perPath = make(map[string]uint64)
+}
+
+// count returns the number of writes counted against path. h.mu must be held.
+func (h *WearOutHook) count(path string) uint64 {
+	if h.scope == WearOutPerPath {
+		return h.perPath[cleanRel(path)]
+	}
+	return h.total
+}
+
+// PreWrite implements hookfs.HookOnWrite
+func (h *WearOutHook) PreWrite(path string, buf []byte, offset int64) (bool, hookfs.HookContext, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.count(path) >= h.threshold {
+		log.WithFields(log.Fields{
+			"path":      path,
+			"threshold": h.threshold,
+		}).Debug("WearOutHook: returning EROFS")
+		return true, nil, syscall.EROFS
+	}
+	if h.scope == WearOutPerPath {
+		h.perPath[cleanRel(path)]++
+	} else {
+		h.total++
+	}
+	return false, nil, nil
+}
+
+// PostWrite implements hookfs.HookOnWrite
+func (h *WearOutHook) PostWrite(realRetCode int32, prehookCtx hookfs.HookContext) (uint32, bool, error) {
+	return 0, false, nil
+}
@@ -0,0 +1,42 @@
+package inject
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/ethercflow/hookfs/hookfs"
+)
+
+func TestWearOutHook(t *testing.T) {
+	const threshold = 3
+	hook := NewWearOutHook(threshold, WearOutPerPath)
+	_, _, mnt := mount(t, hook, &hookfs.Options{DirectIO: true})
+
+	f, err := os.OpenFile(filepath.Join(mnt, "worn"), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for i := 0; i < threshold; i++ {
+		if _, err := f.Write([]byte("x")); err != nil {
+			t.Fatalf("write %d: %v", i+1, err)
+		}
+	}
+	if _, err := f.Write([]byte("x")); !errors.Is(err, syscall.EROFS) {
+		t.Errorf("write past the threshold = %v, want EROFS", err)
+	}
+	if !hook.WornOut("worn") {
+		t.Error("WornOut = false past the threshold")
+	}
+
+	if data, err := ioutil.ReadFile(filepath.Join(mnt, "worn")); err != nil || string(data) != "xxx" {
+		t.Errorf("read %q, %v from the worn out file, want %q", data, err, "xxx")
+	}
+	if err := ioutil.WriteFile(filepath.Join(mnt, "fresh"), []byte("x"), 0644); err != nil {
+		t.Errorf("writing another file: %v", err)
+	}
+}
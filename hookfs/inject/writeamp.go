@@ -0,0 +1,116 @@
+package inject
+
+import (
+	"os"
+	"sync"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	log "github.com/sirupsen/logrus"
+)
+
+// WriteAmplificationHook accounts every successful write as Factor times its size in physical
+// bytes, as RAID parity or copy-on-write would, and reports the totals.
+//
+// If Scratch is set, the extra bytes are actually written to that file, from its start, so that
+// the device under Scratch does the extra I/O. The file grows up to the largest extra write.
+//
+// WriteAmplificationHook implements hookfs.HookOnWrite.
+type WriteAmplificationHook struct {
+	// Scratch, if set, is the path of the file the extra bytes are written to.
+	Scratch string
+
+	mu       sync.Mutex
+	factor   float64
+	logical  uint64
+	physical uint64
+}
+
+type writeAmpCtx struct {
+	size int
+}
+
+// NewWriteAmplificationHook creates a WriteAmplificationHook amplifying writes by factor,
+// accounting for the extra bytes without writing them.
+func NewWriteAmplificationHook(factor float64) *WriteAmplificationHook {
+	return &WriteAmplificationHook{factor: factor}
+}
+
+// Factor returns the number of physical bytes per logical byte written.
+func (h *WriteAmplificationHook) Factor() float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.factor
+}
+
+// SetFactor changes the number of physical bytes per logical byte written.
+func (h *WriteAmplificationHook) SetFactor(factor float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.factor = factor
+}
+
+// LogicalBytes returns the bytes written by callers so far.
+func (h *WriteAmplificationHook) LogicalBytes() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.logical
+}
+
+// PhysicalBytes returns the bytes accounted as physically written so far.
+func (h *WriteAmplificationHook) PhysicalBytes() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.physical
+}
+
+// Amplification returns PhysicalBytes over LogicalBytes, 0 before any write.
+func (h *WriteAmplificationHook) Amplification() float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.logical == 0 {
+		return 0
+	}
+	return float64(h.physical) / float64(h.logical)
+}
+
+// writeExtra writes size bytes to the start of Scratch.
+func (h *WriteAmplificationHook) writeExtra(size uint64) {
+	f, err := os.OpenFile(h.Scratch, os.O_WRONLY|os.O_CREATE, 0600)
+	if err == nil {
+		_, err = f.WriteAt(make([]byte, size), 0)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"scratch": h.Scratch,
+			"size":    size,
+			"error":   err,
+		}).Warn("WriteAmplificationHook: could not write extra bytes")
+	}
+}
+
+// PreWrite implements hookfs.HookOnWrite
+func (h *WriteAmplificationHook) PreWrite(path string, buf []byte, offset int64) (bool, hookfs.HookContext, error) {
+	return false, &writeAmpCtx{size: len(buf)}, nil
+}
+
+// PostWrite implements hookfs.HookOnWrite
+func (h *WriteAmplificationHook) PostWrite(realRetCode int32, prehookCtx hookfs.HookContext) (uint32, bool, error) {
+	ctx, ok := prehookCtx.(*writeAmpCtx)
+	if !ok || realRetCode != 0 {
+		return 0, false, nil
+	}
+
+	h.mu.Lock()
+	physical := uint64(float64(ctx.size) * h.factor)
+	h.logical += uint64(ctx.size)
+	h.physical += physical
+	h.mu.Unlock()
+
+	if h.Scratch != "" && physical > uint64(ctx.size) {
+		h.writeExtra(physical - uint64(ctx.size))
+	}
+	return 0, false, nil
+}
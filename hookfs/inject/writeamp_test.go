@@ -0,0 +1,45 @@
+package inject
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/ethercflow/hookfs/hookfs"
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+func TestWriteAmplificationHookRecordsPhysicalBytes(t *testing.T) {
+	hook := NewWriteAmplificationHook(3)
+	hook.Scratch = filepath.Join(t.TempDir(), "scratch")
+	h, err := hookfs.NewHookFs(t.TempDir(), t.TempDir(), hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, code := h.Create("file", syscall.O_WRONLY, 0644, &fuse.Context{})
+	if !code.Ok() {
+		t.Fatal(code)
+	}
+	defer f.Release()
+	if _, code := f.Write(bytes.Repeat([]byte("x"), 1024), 0); !code.Ok() {
+		t.Fatal(code)
+	}
+	if hook.LogicalBytes() != 1024 || hook.PhysicalBytes() != 3*1024 || hook.Amplification() != 3 {
+		t.Errorf("LogicalBytes = %d, PhysicalBytes = %d and Amplification = %v, want 1024, %d and 3",
+			hook.LogicalBytes(), hook.PhysicalBytes(), hook.Amplification(), 3*1024)
+	}
+	// the extra bytes went to the scratch file
+	if fi, err := os.Stat(hook.Scratch); err != nil || fi.Size() != 2*1024 {
+		t.Errorf("scratch file: %v, want %d bytes", err, 2*1024)
+	}
+
+	hook.SetFactor(1.5)
+	if _, code := f.Write(bytes.Repeat([]byte("x"), 1024), 1024); !code.Ok() {
+		t.Fatal(code)
+	}
+	if hook.LogicalBytes() != 2048 || hook.PhysicalBytes() != 3*1024+1536 {
+		t.Errorf("LogicalBytes = %d and PhysicalBytes = %d, want 2048 and %d", hook.LogicalBytes(), hook.PhysicalBytes(), 3*1024+1536)
+	}
+}
@@ -0,0 +1,55 @@
+package hookfs
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+// conflictHook reports a conflict for every write lock, as if another process held one,
+// recording the locks it sees.
+type conflictHook struct {
+	mu    sync.Mutex
+	locks []fuse.FileLock
+}
+
+func (h *conflictHook) PreSetLk(path string, owner uint64, lk *fuse.FileLock, flags uint32) (bool, HookContext, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.locks = append(h.locks, *lk)
+	if lk.Typ != syscall.F_WRLCK {
+		return false, nil, nil
+	}
+	return true, nil, syscall.EAGAIN
+}
+
+func (h *conflictHook) PostSetLk(realRetCode int32, prehookCtx HookContext) (bool, error) {
+	return false, nil
+}
+
+func TestSetLkConflictReturnsEAGAIN(t *testing.T) {
+	hook := &conflictHook{}
+	_, _, mnt := mount(t, hook, &Options{EnableLocks: true})
+	f, err := os.Create(filepath.Join(mnt, "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	lk := syscall.Flock_t{Type: syscall.F_WRLCK, Whence: 0, Start: 10, Len: 20}
+	if err := syscall.FcntlFlock(f.Fd(), syscall.F_SETLK, &lk); err != syscall.EAGAIN {
+		t.Fatalf("F_SETLK of a write lock: %v, want EAGAIN", err)
+	}
+	hook.mu.Lock()
+	defer hook.mu.Unlock()
+	if len(hook.locks) != 1 {
+		t.Fatalf("hook saw %d locks, want 1", len(hook.locks))
+	}
+	if got := hook.locks[0]; got.Start != 10 || got.End != 29 || got.Typ != syscall.F_WRLCK {
+		t.Errorf("hook saw lock %+v, want a write lock of [10, 29]", got)
+	}
+}
@@ -0,0 +1,47 @@
+package hookfs
+
+import (
+	"testing"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+// metadataHook records the test case of its metadata on mkdir.
+type metadataHook struct {
+	metadata map[string]string
+	seen     string
+}
+
+func (h *metadataHook) SetMetadata(metadata map[string]string) {
+	h.metadata = metadata
+}
+
+func (h *metadataHook) PreMkdir(path string, mode uint32) (bool, HookContext, error) {
+	h.seen = h.metadata["case"]
+	return false, nil, nil
+}
+
+func (h *metadataHook) PostMkdir(realRetCode int32, prehookCtx HookContext) (bool, error) {
+	return false, nil
+}
+
+func TestHookSeesMetadata(t *testing.T) {
+	metadata := map[string]string{"case": "TestHookSeesMetadata"}
+	hook := &metadataHook{}
+	h, err := NewHookFsWithOptions(t.TempDir(), t.TempDir(), hook, &Options{Metadata: metadata})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// copied by NewHookFsWithOptions
+	metadata["case"] = "changed"
+
+	if code := h.Mkdir("dir", 0755, &fuse.Context{}); !code.Ok() {
+		t.Fatal(code)
+	}
+	if hook.seen != "TestHookSeesMetadata" {
+		t.Errorf("hook saw case %q, want %q", hook.seen, "TestHookSeesMetadata")
+	}
+	if got := h.Metadata()["case"]; got != "TestHookSeesMetadata" {
+		t.Errorf("Metadata()[case] = %q, want %q", got, "TestHookSeesMetadata")
+	}
+}
@@ -0,0 +1,73 @@
+package hookfs
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// readErrorHook fails every read with err, unless it is nil.
+type readErrorHook struct {
+	err error
+}
+
+func (h readErrorHook) PreRead(path string, length int64, offset int64) ([]byte, bool, HookContext, error) {
+	return nil, h.err != nil, nil, h.err
+}
+
+func (readErrorHook) PostRead(realRetCode int32, realBuf []byte, prehookCtx HookContext) ([]byte, bool, error) {
+	return nil, false, nil
+}
+
+// TestMmapHelper prints the first byte of the file named by HOOKFS_MMAP_FILE through
+// mmap(2). It is run by TestMmapReadErrorRaisesSIGBUS in a process of its own: a goroutine
+// faulting on a mount of its own process keeps its processor, which the server may need.
+func TestMmapHelper(t *testing.T) {
+	path := os.Getenv("HOOKFS_MMAP_FILE")
+	if path == "" {
+		t.Skip("run by TestMmapReadErrorRaisesSIGBUS")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem, err := syscall.Mmap(int(f.Fd()), 0, os.Getpagesize(), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a failed fault kills the process with SIGBUS here
+	fmt.Printf("mapped %q\n", mem[0])
+}
+
+func TestMmapReadErrorRaisesSIGBUS(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		hook Hook
+		want string
+	}{
+		{"passing", readErrorHook{}, "mapped 'x'"},
+		{"failing", readErrorHook{err: syscall.EIO}, "signal SIGBUS"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			original := t.TempDir()
+			data := bytes.Repeat([]byte("x"), os.Getpagesize())
+			if err := ioutil.WriteFile(filepath.Join(original, "file"), data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, _, mnt := mountOn(t, original, tc.hook, nil)
+
+			cmd := exec.Command(os.Args[0], "-test.run=^TestMmapHelper$")
+			cmd.Env = append(os.Environ(), "HOOKFS_MMAP_FILE="+filepath.Join(mnt, "file"))
+			out, err := cmd.CombinedOutput()
+			if !strings.Contains(string(out), tc.want) {
+				t.Errorf("mapping the file: %v\n%s\nwant %q", err, out, tc.want)
+			}
+		})
+	}
+}
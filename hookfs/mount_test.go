@@ -0,0 +1,78 @@
+package hookfs
+
+import (
+	"os/exec"
+	"runtime"
+	"runtime/debug"
+	"testing"
+	"time"
+)
+
+// mount serves a HookFs of a new original directory with hook and opts on a new mountpoint
+// until the end of the test. Tests mounting are skipped where fusermount is missing.
+func mount(t testing.TB, hook Hook, opts *Options) (h *HookFs, original string, mountpoint string) {
+	t.Helper()
+	return mountOn(t, t.TempDir(), hook, opts)
+}
+
+// mountOn is mount on the original directory given.
+func mountOn(t testing.TB, original string, hook Hook, opts *Options) (h *HookFs, _ string, mountpoint string) {
+	t.Helper()
+	if _, err := exec.LookPath("fusermount"); err != nil {
+		t.Skip("fusermount is needed to mount")
+	}
+	mountpoint = t.TempDir()
+	h, err := NewHookFsWithOptions(original, mountpoint, hook, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serveMounted(t, h)
+	return h, original, mountpoint
+}
+
+// serveMounted runs h.Serve until the end of the test, returning once the mount is up.
+func serveMounted(t testing.TB, h *HookFs) {
+	t.Helper()
+	serveFromTest(t)
+	served := make(chan error, 1)
+	go func() {
+		served <- h.Serve()
+	}()
+	for {
+		h.serverMu.Lock()
+		server := h.server
+		h.serverMu.Unlock()
+		if server != nil {
+			server.WaitMount()
+			break
+		}
+		select {
+		case err := <-served:
+			t.Fatalf("Serve: %v", err)
+		case <-time.After(time.Millisecond):
+		}
+	}
+	t.Cleanup(func() {
+		// files closed by the test may still be released in the background
+		for i := 0; h.Unmount() != nil && i < 100; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err := <-served; err != nil {
+			t.Errorf("Serve: %v", err)
+		}
+	})
+}
+
+// serveFromTest lets the test process serve the mount it uses until the end of the test.
+// The runtime adds the files the test opens to its poller, with FUSE_POLL requests that the
+// server can only answer if the opening goroutine, which keeps its processor meanwhile, left
+// it another one, and if the garbage collector does not wait for that processor to stop the
+// world.
+func serveFromTest(t testing.TB) {
+	if runtime.GOMAXPROCS(0) < 2 {
+		prev := runtime.GOMAXPROCS(2)
+		t.Cleanup(func() { runtime.GOMAXPROCS(prev) })
+	}
+	prev := debug.SetGCPercent(-1)
+	t.Cleanup(func() { debug.SetGCPercent(prev) })
+}
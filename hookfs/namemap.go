@@ -0,0 +1,254 @@
+package hookfs
+
+import (
+	"strings"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/hanwen/go-fuse/fuse/nodefs"
+	"github.com/hanwen/go-fuse/fuse/pathfs"
+)
+
+// NameMapper translates the names of the mount to the names stored in Original, and back.
+// See Options.NameMapper.
+type NameMapper interface {
+	// ToBackend returns the name stored in Original for name, a component of a path of the
+	// mount.
+	ToBackend(name string) string
+	// FromBackend returns the name in the mount of name, a component of a path in Original.
+	// It must undo ToBackend.
+	FromBackend(name string) string
+}
+
+// SambaCompatMapper stores names with characters or forms Windows reserves under names
+// Windows accepts, e.g. for an Original shared by Samba, and maps them back in the mount.
+// The scheme is the private range mapping of Services for Macintosh, which the catia and
+// fruit modules of Samba use as well:
+//
+//	"  *  :  <  >  ?  \  |  →  U+F020 to U+F027, in this order
+//	control characters     →  U+F001 to U+F01F
+//	a trailing space       →  U+F028
+//	a trailing period      →  U+F029
+//
+// Names reserved for devices, such as CON, nul.txt or LPT1, get their last character before
+// any extension mapped to U+F000 plus that character, e.g. CON to CO followed by U+F04E.
+// Names in Original with characters in U+F000 to U+F0FF are taken for mapped ones, and so
+// are mapped back.
+type SambaCompatMapper struct{}
+
+// sambaReserved are the characters Windows refuses in names, in the order of their mapping.
+const sambaReserved = "\"*:<>?\\|"
+
+const (
+	sambaPrivate       = 0xF000
+	sambaReservedFirst = 0xF020
+	sambaTrailingSpace = 0xF028
+	sambaTrailingDot   = 0xF029
+)
+
+// sambaDevice tells whether name is reserved for a device by Windows, whatever its extension.
+func sambaDevice(name string) bool {
+	base := strings.ToUpper(name)
+	if i := strings.IndexByte(base, '.'); i >= 0 {
+		base = base[:i]
+	}
+	switch base {
+	case "CON", "PRN", "AUX", "NUL":
+		return true
+	}
+	return len(base) == 4 && (strings.HasPrefix(base, "COM") || strings.HasPrefix(base, "LPT")) &&
+		base[3] >= '1' && base[3] <= '9'
+}
+
+// ToBackend implements NameMapper.
+func (SambaCompatMapper) ToBackend(name string) string {
+	runes := []rune(name)
+	for i, r := range runes {
+		if r > 0 && r < 0x20 {
+			runes[i] = sambaPrivate + r
+		} else if j := strings.IndexRune(sambaReserved, r); j >= 0 {
+			runes[i] = sambaReservedFirst + rune(j)
+		}
+	}
+	if n := len(runes); n > 0 && name != "." && name != ".." {
+		switch runes[n-1] {
+		case ' ':
+			runes[n-1] = sambaTrailingSpace
+		case '.':
+			runes[n-1] = sambaTrailingDot
+		}
+	}
+	if sambaDevice(name) {
+		last := strings.IndexByte(name, '.')
+		if last < 0 {
+			last = len(name)
+		}
+		// the device names are ASCII, so bytes and runes are the same up to there
+		runes[last-1] = sambaPrivate + runes[last-1]
+	}
+	return string(runes)
+}
+
+// FromBackend implements NameMapper.
+func (SambaCompatMapper) FromBackend(name string) string {
+	if strings.IndexFunc(name, isSambaPrivate) < 0 {
+		return name
+	}
+	runes := []rune(name)
+	for i, r := range runes {
+		switch {
+		case r == sambaTrailingSpace:
+			runes[i] = ' '
+		case r == sambaTrailingDot:
+			runes[i] = '.'
+		case r >= sambaReservedFirst && r < sambaReservedFirst+rune(len(sambaReserved)):
+			runes[i] = rune(sambaReserved[r-sambaReservedFirst])
+		case isSambaPrivate(r):
+			runes[i] = r - sambaPrivate
+		}
+	}
+	return string(runes)
+}
+
+func isSambaPrivate(r rune) bool {
+	return r >= sambaPrivate && r <= 0xF0FF
+}
+
+// mapPath maps each component of the path name with f.
+func mapPath(name string, f func(string) string) string {
+	if name == "" {
+		return name
+	}
+	elems := strings.Split(name, "/")
+	for i, elem := range elems {
+		elems[i] = f(elem)
+	}
+	return strings.Join(elems, "/")
+}
+
+// mappedFileSystem translates the names of the operations on fs with mapper, for
+// Options.NameMapper.
+type mappedFileSystem struct {
+	pathfs.FileSystem
+	mapper NameMapper
+}
+
+func (m *mappedFileSystem) backend(name string) string {
+	return mapPath(name, m.mapper.ToBackend)
+}
+
+// GetAttr implements hanwen/go-fuse/fuse/pathfs.FileSystem.
+func (m *mappedFileSystem) GetAttr(name string, context *fuse.Context) (*fuse.Attr, fuse.Status) {
+	return m.FileSystem.GetAttr(m.backend(name), context)
+}
+
+// Chmod implements hanwen/go-fuse/fuse/pathfs.FileSystem.
+func (m *mappedFileSystem) Chmod(name string, mode uint32, context *fuse.Context) fuse.Status {
+	return m.FileSystem.Chmod(m.backend(name), mode, context)
+}
+
+// Chown implements hanwen/go-fuse/fuse/pathfs.FileSystem.
+func (m *mappedFileSystem) Chown(name string, uid uint32, gid uint32, context *fuse.Context) fuse.Status {
+	return m.FileSystem.Chown(m.backend(name), uid, gid, context)
+}
+
+// Utimens implements hanwen/go-fuse/fuse/pathfs.FileSystem.
+func (m *mappedFileSystem) Utimens(name string, atime *time.Time, mtime *time.Time, context *fuse.Context) fuse.Status {
+	return m.FileSystem.Utimens(m.backend(name), atime, mtime, context)
+}
+
+// Truncate implements hanwen/go-fuse/fuse/pathfs.FileSystem.
+func (m *mappedFileSystem) Truncate(name string, size uint64, context *fuse.Context) fuse.Status {
+	return m.FileSystem.Truncate(m.backend(name), size, context)
+}
+
+// Access implements hanwen/go-fuse/fuse/pathfs.FileSystem.
+func (m *mappedFileSystem) Access(name string, mode uint32, context *fuse.Context) fuse.Status {
+	return m.FileSystem.Access(m.backend(name), mode, context)
+}
+
+// Link implements hanwen/go-fuse/fuse/pathfs.FileSystem.
+func (m *mappedFileSystem) Link(oldName string, newName string, context *fuse.Context) fuse.Status {
+	return m.FileSystem.Link(m.backend(oldName), m.backend(newName), context)
+}
+
+// Mkdir implements hanwen/go-fuse/fuse/pathfs.FileSystem.
+func (m *mappedFileSystem) Mkdir(name string, mode uint32, context *fuse.Context) fuse.Status {
+	return m.FileSystem.Mkdir(m.backend(name), mode, context)
+}
+
+// Mknod implements hanwen/go-fuse/fuse/pathfs.FileSystem.
+func (m *mappedFileSystem) Mknod(name string, mode uint32, dev uint32, context *fuse.Context) fuse.Status {
+	return m.FileSystem.Mknod(m.backend(name), mode, dev, context)
+}
+
+// Rename implements hanwen/go-fuse/fuse/pathfs.FileSystem.
+func (m *mappedFileSystem) Rename(oldName string, newName string, context *fuse.Context) fuse.Status {
+	return m.FileSystem.Rename(m.backend(oldName), m.backend(newName), context)
+}
+
+// Rmdir implements hanwen/go-fuse/fuse/pathfs.FileSystem.
+func (m *mappedFileSystem) Rmdir(name string, context *fuse.Context) fuse.Status {
+	return m.FileSystem.Rmdir(m.backend(name), context)
+}
+
+// Unlink implements hanwen/go-fuse/fuse/pathfs.FileSystem.
+func (m *mappedFileSystem) Unlink(name string, context *fuse.Context) fuse.Status {
+	return m.FileSystem.Unlink(m.backend(name), context)
+}
+
+// GetXAttr implements hanwen/go-fuse/fuse/pathfs.FileSystem.
+func (m *mappedFileSystem) GetXAttr(name string, attribute string, context *fuse.Context) ([]byte, fuse.Status) {
+	return m.FileSystem.GetXAttr(m.backend(name), attribute, context)
+}
+
+// ListXAttr implements hanwen/go-fuse/fuse/pathfs.FileSystem.
+func (m *mappedFileSystem) ListXAttr(name string, context *fuse.Context) ([]string, fuse.Status) {
+	return m.FileSystem.ListXAttr(m.backend(name), context)
+}
+
+// RemoveXAttr implements hanwen/go-fuse/fuse/pathfs.FileSystem.
+func (m *mappedFileSystem) RemoveXAttr(name string, attr string, context *fuse.Context) fuse.Status {
+	return m.FileSystem.RemoveXAttr(m.backend(name), attr, context)
+}
+
+// SetXAttr implements hanwen/go-fuse/fuse/pathfs.FileSystem.
+func (m *mappedFileSystem) SetXAttr(name string, attr string, data []byte, flags int, context *fuse.Context) fuse.Status {
+	return m.FileSystem.SetXAttr(m.backend(name), attr, data, flags, context)
+}
+
+// Open implements hanwen/go-fuse/fuse/pathfs.FileSystem.
+func (m *mappedFileSystem) Open(name string, flags uint32, context *fuse.Context) (nodefs.File, fuse.Status) {
+	return m.FileSystem.Open(m.backend(name), flags, context)
+}
+
+// Create implements hanwen/go-fuse/fuse/pathfs.FileSystem.
+func (m *mappedFileSystem) Create(name string, flags uint32, mode uint32, context *fuse.Context) (nodefs.File, fuse.Status) {
+	return m.FileSystem.Create(m.backend(name), flags, mode, context)
+}
+
+// OpenDir implements hanwen/go-fuse/fuse/pathfs.FileSystem. The names of the entries are
+// mapped back.
+func (m *mappedFileSystem) OpenDir(name string, context *fuse.Context) ([]fuse.DirEntry, fuse.Status) {
+	entries, code := m.FileSystem.OpenDir(m.backend(name), context)
+	for i := range entries {
+		entries[i].Name = m.mapper.FromBackend(entries[i].Name)
+	}
+	return entries, code
+}
+
+// Symlink implements hanwen/go-fuse/fuse/pathfs.FileSystem. The value of the symlink is
+// stored as it is.
+func (m *mappedFileSystem) Symlink(value string, linkName string, context *fuse.Context) fuse.Status {
+	return m.FileSystem.Symlink(value, m.backend(linkName), context)
+}
+
+// Readlink implements hanwen/go-fuse/fuse/pathfs.FileSystem.
+func (m *mappedFileSystem) Readlink(name string, context *fuse.Context) (string, fuse.Status) {
+	return m.FileSystem.Readlink(m.backend(name), context)
+}
+
+// StatFs implements hanwen/go-fuse/fuse/pathfs.FileSystem.
+func (m *mappedFileSystem) StatFs(name string) *fuse.StatfsOut {
+	return m.FileSystem.StatFs(m.backend(name))
+}
@@ -0,0 +1,92 @@
+package hookfs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestSambaCompatMapperRoundTrip(t *testing.T) {
+	var m SambaCompatMapper
+	for name, want := range map[string]string{
+		"plain.txt":   "plain.txt",
+		`a:b\c`:       "a\uf022b\uf026c",
+		`<"*?>|`:      "\uf023\uf020\uf021\uf025\uf024\uf027",
+		"trailing. ":  "trailing.\uf028",
+		"trailing.":   "trailing\uf029",
+		"CON":         "CO\uf04e",
+		"nul.txt":     "nu\uf06c.txt",
+		"lpt1":        "lpt\uf031",
+		"console":     "console",
+		"tab\there":   "tab\uf009here",
+		"unicode é:ü": "unicode é\uf022ü",
+	} {
+		got := m.ToBackend(name)
+		if got != want {
+			t.Errorf("ToBackend(%q) = %q, want %q", name, got, want)
+		}
+		if strings.ContainsAny(got, `"*:<>?\|`) {
+			t.Errorf("ToBackend(%q) = %q keeps a reserved character", name, got)
+		}
+		if back := m.FromBackend(got); back != name {
+			t.Errorf("FromBackend(%q) = %q, want %q", got, back, name)
+		}
+	}
+}
+
+func TestNameMapperSambaCompat(t *testing.T) {
+	h, original, mnt := mount(t, nil, &Options{NameMapper: SambaCompatMapper{}})
+	names := []string{"a:b", `back\slash`, "what?.txt", "CON"}
+	if err := os.Mkdir(filepath.Join(mnt, "dir:1"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if err := ioutil.WriteFile(filepath.Join(mnt, "dir:1", name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, name := range names {
+		data, err := ioutil.ReadFile(filepath.Join(mnt, "dir:1", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != name {
+			t.Errorf("read %q from %q", data, name)
+		}
+	}
+	listed, err := ioutil.ReadDir(filepath.Join(mnt, "dir:1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, fi := range listed {
+		got = append(got, fi.Name())
+	}
+	sort.Strings(got)
+	want := append([]string(nil), names...)
+	sort.Strings(want)
+	if strings.Join(got, "/") != strings.Join(want, "/") {
+		t.Errorf("listed %q, want %q", got, want)
+	}
+
+	// Original has none of the reserved names
+	err = filepath.Walk(original, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.ContainsAny(fi.Name(), `:\?`) || strings.EqualFold(fi.Name(), "CON") {
+			t.Errorf("%q is stored as is", path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(h.BackendPath("dir:1/a:b")); err != nil {
+		t.Errorf("BackendPath: %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package hookfs
+
+import (
+	"errors"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/fuse"
+	"github.com/hanwen/go-fuse/fuse/pathfs"
+)
+
+// The methods below use the go-fuse notify API (pathfs.PathNodeFs.FileNotify and EntryNotify)
+// to tell the kernel to drop what it has cached. They only work while mounted.
+//
+// Changes made through the mount are seen by the kernel anyway. Changes made directly in Original
+// (e.g. by a hook simulating an external writer) are not: the kernel keeps serving the cached
+// attributes until AttrTimeout expires unless it is told to invalidate them. Not calling these
+// methods is how a test leaves stale attributes in place.
+//
+// The kernel may block a notification until pending requests on the same inode are answered,
+// so don't call these synchronously from a hook handling an operation on the same path.
+
+var errNotMounted = errors.New("hookfs is not mounted")
+
+// InvalidateAttr makes the kernel drop the cached attributes of path (relative to Original).
+func (h *HookFs) InvalidateAttr(path string) error {
+	nodeFs := h.mountedNodeFs()
+	if nodeFs == nil {
+		return errNotMounted
+	}
+	// a negative offset invalidates the attributes but not the page cache
+	return statusError(nodeFs.FileNotify(path, -1, 0))
+}
+
+// InvalidateData makes the kernel drop the cached attributes and file contents of path.
+func (h *HookFs) InvalidateData(path string) error {
+	nodeFs := h.mountedNodeFs()
+	if nodeFs == nil {
+		return errNotMounted
+	}
+	return statusError(nodeFs.FileNotify(path, 0, 0))
+}
+
+// InvalidateEntry makes the kernel drop the cached lookup of name in dir.
+func (h *HookFs) InvalidateEntry(dir string, name string) error {
+	nodeFs := h.mountedNodeFs()
+	if nodeFs == nil {
+		return errNotMounted
+	}
+	return statusError(nodeFs.EntryNotify(dir, name))
+}
+
+// mountedNodeFs returns the node file system given by OnMount, or nil before the mount.
+func (h *HookFs) mountedNodeFs() *pathfs.PathNodeFs {
+	h.backendMu.RLock()
+	defer h.backendMu.RUnlock()
+	return h.nodeFs
+}
+
+func statusError(code fuse.Status) error {
+	// ENOENT means the kernel has never looked the path up, so nothing is cached
+	if code.Ok() || code == fuse.ENOENT {
+		return nil
+	}
+	return syscall.Errno(code)
+}
@@ -0,0 +1,41 @@
+package hookfs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestInvalidateAttr(t *testing.T) {
+	h, original, mnt := mount(t, nil, &Options{AttrTimeout: time.Hour})
+	if err := ioutil.WriteFile(filepath.Join(original, "file"), []byte("12345"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	size := func() int64 {
+		t.Helper()
+		fi, err := os.Stat(filepath.Join(mnt, "file"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fi.Size()
+	}
+	if got := size(); got != 5 {
+		t.Fatalf("size %d, want 5", got)
+	}
+
+	// grown behind the back of the kernel
+	if err := os.Truncate(filepath.Join(original, "file"), 10); err != nil {
+		t.Fatal(err)
+	}
+	if got := size(); got != 5 {
+		t.Errorf("size %d without invalidation, want the stale 5", got)
+	}
+	if err := h.InvalidateAttr("file"); err != nil {
+		t.Fatal(err)
+	}
+	if got := size(); got != 10 {
+		t.Errorf("size %d after invalidation, want 10", got)
+	}
+}
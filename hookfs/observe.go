@@ -0,0 +1,114 @@
+package hookfs
+
+import (
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+// Disposition tells how the hook took part in an operation.
+type Disposition int
+
+const (
+	// DispositionPassed means the real operation was done and its result returned.
+	DispositionPassed Disposition = iota
+	// DispositionPrehooked means the prehook returned the result, without the real operation.
+	DispositionPrehooked
+	// DispositionPosthooked means the real operation was done, but the posthook returned the result.
+	DispositionPosthooked
+)
+
+func (d Disposition) String() string {
+	switch d {
+	case DispositionPassed:
+		return "passed"
+	case DispositionPrehooked:
+		return "prehooked"
+	case DispositionPosthooked:
+		return "posthooked"
+	}
+	return "unknown"
+}
+
+// OpResult is an operation done by a HookFs, as passed to the callback set by SetResultCallback.
+type OpResult struct {
+	Op   string
+	Path string
+	// Status is the status returned to the kernel. Release has none and is always fuse.OK.
+	Status fuse.Status
+	// Bytes is the number of bytes read or written by a successful Read or Write.
+	Bytes       int
+	Disposition Disposition
+	Start       time.Time
+	Duration    time.Duration
+}
+
+// SetResultCallback makes h call callback after every operation, before the result goes back
+// to the kernel, typically for tests to assert on. The operation waits for callback, which
+// must not do I/O on the mount. A nil callback removes it.
+func (h *HookFs) SetResultCallback(callback func(OpResult)) {
+	h.onResult.Store(callback)
+}
+
+// opSpan is an operation in progress.
+type opSpan struct {
+	op    string
+	path  string
+	start time.Time
+	// tid is the thread of the operation in the trace (Options.TraceFile)
+	tid int
+	// set by the operation along the way
+	bytes       int
+	disposition Disposition
+}
+
+// begin starts an operation. Every operation begins with:
+//
+//	span := h.begin(OpXXX, name)
+//	defer h.observe(span, &code)
+func (h *HookFs) begin(op string, path string) *opSpan {
+	if hook, ok := h.currentHook().(GlobalHook); ok {
+		hook.BeforeOp(op, path)
+	}
+	span := &opSpan{
+		op:    op,
+		path:  path,
+		start: time.Now(),
+	}
+	if h.trace != nil {
+		span.tid = h.trace.begin(span)
+	}
+	return span
+}
+
+// observe records a finished operation.
+// code may be nil for operations without a status.
+func (h *HookFs) observe(op *opSpan, code *fuse.Status) {
+	status := fuse.OK
+	if code != nil {
+		status = *code
+	}
+	end := time.Now()
+	took := end.Sub(op.start)
+	if h.trace != nil {
+		h.trace.end(op, status, end)
+	}
+	h.stats.observe(op.op, status, op.disposition)
+	if h.expvar != nil {
+		h.expvar.observe(op.op, status, took)
+	}
+	if hook, ok := h.currentHook().(GlobalHook); ok {
+		hook.AfterOp(op.op, op.path, status, took)
+	}
+	if callback, _ := h.onResult.Load().(func(OpResult)); callback != nil {
+		callback(OpResult{
+			Op:          op.op,
+			Path:        op.path,
+			Status:      status,
+			Bytes:       op.bytes,
+			Disposition: op.disposition,
+			Start:       op.start,
+			Duration:    took,
+		})
+	}
+}
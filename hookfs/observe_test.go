@@ -0,0 +1,137 @@
+package hookfs
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+// globalRecorder records BeforeOp and AfterOp, and delays mkdir by slow.
+type globalRecorder struct {
+	slow time.Duration
+
+	mu     sync.Mutex
+	events []string
+	took   map[string]time.Duration
+}
+
+func (h *globalRecorder) BeforeOp(op string, path string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.events = append(h.events, "before "+op+" "+path)
+}
+
+func (h *globalRecorder) AfterOp(op string, path string, status fuse.Status, took time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.events = append(h.events, "after "+op+" "+path+" "+status.String())
+	h.took[op] = took
+}
+
+func (h *globalRecorder) PreMkdir(path string, mode uint32) (bool, HookContext, error) {
+	time.Sleep(h.slow)
+	return false, nil, nil
+}
+
+func (h *globalRecorder) PostMkdir(realRetCode int32, prehookCtx HookContext) (bool, error) {
+	return false, nil
+}
+
+func TestGlobalHookWrapsOperations(t *testing.T) {
+	hook := &globalRecorder{slow: 20 * time.Millisecond, took: make(map[string]time.Duration)}
+	original := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(original, "file"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	h, err := NewHookFs(original, t.TempDir(), hook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := &fuse.Context{}
+	h.Mkdir("dir", 0755, ctx)
+	h.GetAttr("missing", ctx)
+	f, _ := h.Open("file", syscall.O_RDONLY, ctx)
+	f.Read(make([]byte, 4), 0)
+	f.Release()
+
+	want := []string{
+		"before mkdir dir", "after mkdir dir OK",
+		"before getattr missing", "after getattr missing " + fuse.ENOENT.String(),
+		"before open file", "after open file OK",
+		"before read file", "after read file OK",
+		"before release file", "after release file OK",
+	}
+	if !reflect.DeepEqual(hook.events, want) {
+		t.Errorf("events\n%q\nwant\n%q", hook.events, want)
+	}
+	if took := hook.took[OpMkdir]; took < hook.slow || took > time.Second {
+		t.Errorf("mkdir took %v, want the %v of its prehook and a bit", took, hook.slow)
+	}
+	if took := hook.took[OpGetAttr]; took >= hook.slow {
+		t.Errorf("getattr took %v, want less than %v", took, hook.slow)
+	}
+}
+
+// denyMkdirHook denies making directories, and fakes the attributes of a missing fake file.
+type denyMkdirHook struct {
+	fakeAttrHook
+}
+
+func (h *denyMkdirHook) PreMkdir(path string, mode uint32) (bool, HookContext, error) {
+	return true, nil, syscall.EACCES
+}
+
+func (h *denyMkdirHook) PostMkdir(realRetCode int32, prehookCtx HookContext) (bool, error) {
+	return false, nil
+}
+
+func TestResultCallback(t *testing.T) {
+	original := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(original, "file"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	h, err := NewHookFs(original, t.TempDir(), &denyMkdirHook{fakeAttrHook{fake: "fake", size: 42}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var results []OpResult
+	h.SetResultCallback(func(r OpResult) {
+		results = append(results, r)
+	})
+	ctx := &fuse.Context{}
+	h.Mkdir("dir", 0755, ctx)
+	h.GetAttr("fake", ctx)
+	f, _ := h.Open("file", syscall.O_RDWR, ctx)
+	f.Read(make([]byte, 16), 0)
+	f.Write([]byte("xy"), 4)
+	f.Release()
+	h.SetResultCallback(nil)
+	h.GetAttr("file", ctx)
+
+	want := []OpResult{
+		{Op: OpMkdir, Path: "dir", Status: fuse.Status(syscall.EACCES), Disposition: DispositionPrehooked},
+		{Op: OpGetAttr, Path: "fake", Status: fuse.OK, Disposition: DispositionPosthooked},
+		{Op: OpOpen, Path: "file", Status: fuse.OK},
+		{Op: OpRead, Path: "file", Status: fuse.OK, Bytes: 4},
+		{Op: OpWrite, Path: "file", Status: fuse.OK, Bytes: 2},
+		{Op: OpRelease, Path: "file", Status: fuse.OK},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("%d results, want %d: %+v", len(results), len(want), results)
+	}
+	for i, r := range results {
+		if r.Start.IsZero() || r.Duration < 0 {
+			t.Errorf("result %d started at %v and took %v", i, r.Start, r.Duration)
+		}
+		r.Start, r.Duration = time.Time{}, 0
+		if r != want[i] {
+			t.Errorf("result %d = %+v, want %+v", i, r, want[i])
+		}
+	}
+}
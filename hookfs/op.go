@@ -0,0 +1,36 @@
+package hookfs
+
+// Operation names, as used by hooks that handle several operations uniformly.
+const (
+	OpOpen        = "open"
+	OpRead        = "read"
+	OpWrite       = "write"
+	OpMkdir       = "mkdir"
+	OpRmdir       = "rmdir"
+	OpOpenDir     = "opendir"
+	OpFsync       = "fsync"
+	OpFlush       = "flush"
+	OpRelease     = "release"
+	OpTruncate    = "truncate"
+	OpGetAttr     = "getattr"
+	OpChown       = "chown"
+	OpChmod       = "chmod"
+	OpUtimens     = "utimens"
+	OpAllocate    = "allocate"
+	OpGetLk       = "getlk"
+	OpSetLk       = "setlk"
+	OpSetLkw      = "setlkw"
+	OpStatFs      = "statfs"
+	OpReadlink    = "readlink"
+	OpSymlink     = "symlink"
+	OpCreate      = "create"
+	OpAccess      = "access"
+	OpLink        = "link"
+	OpMknod       = "mknod"
+	OpRename      = "rename"
+	OpUnlink      = "unlink"
+	OpGetXAttr    = "getxattr"
+	OpListXAttr   = "listxattr"
+	OpRemoveXAttr = "removexattr"
+	OpSetXAttr    = "setxattr"
+)
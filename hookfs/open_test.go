@@ -0,0 +1,56 @@
+package hookfs
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+)
+
+// openFlagsRecorder records the flags of the opens it sees.
+type openFlagsRecorder struct {
+	mu    sync.Mutex
+	flags []uint32
+}
+
+func (h *openFlagsRecorder) PreOpen(path string, flags uint32) (bool, HookContext, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.flags = append(h.flags, flags)
+	return false, nil, nil
+}
+
+func (h *openFlagsRecorder) PostOpen(realRetCode int32, prehookCtx HookContext) (bool, error) {
+	return false, nil
+}
+
+func (h *openFlagsRecorder) recorded() []uint32 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]uint32(nil), h.flags...)
+}
+
+// TestOpenCloexecNotVisible shows the limitation documented on HookOnOpen: opens with and
+// without O_CLOEXEC reach the hook with the same flags, so non-cloexec opens can't be audited.
+func TestOpenCloexecNotVisible(t *testing.T) {
+	hook := &openFlagsRecorder{}
+	_, original, mnt := mount(t, hook, &Options{DirectIO: true})
+	if err := ioutil.WriteFile(filepath.Join(original, "file"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, flags := range []int{syscall.O_RDONLY, syscall.O_RDONLY | syscall.O_CLOEXEC} {
+		fd, err := syscall.Open(filepath.Join(mnt, "file"), flags, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		syscall.Close(fd)
+	}
+	seen := hook.recorded()
+	if len(seen) != 2 {
+		t.Fatalf("hook saw %d opens, want 2", len(seen))
+	}
+	if seen[0] != seen[1] {
+		t.Errorf("opens without and with O_CLOEXEC reached the hook with flags %#o and %#o, want the same", seen[0], seen[1])
+	}
+}
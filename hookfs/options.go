@@ -0,0 +1,117 @@
+package hookfs
+
+import (
+	"time"
+)
+
+// Options configures a HookFs. The zero value is what NewHookFs uses.
+type Options struct {
+	// FsyncCoalesceWindow, if non-zero, coalesces fsyncs on the same file handle.
+	// An fsync waits up to FsyncCoalesceWindow for more fsyncs on the handle to arrive,
+	// then a single real fsync is issued and its result is returned to all of them.
+	//
+	// Every acknowledged fsync is still backed by a real fsync that started after the fsync
+	// was received, so writes completed before an fsync are durable when it returns.
+	// The cost is up to FsyncCoalesceWindow of extra latency per fsync.
+	FsyncCoalesceWindow time.Duration
+
+	// ExpvarName, if set, publishes per-operation call and error counts and latency histograms
+	// with the expvar package under this name, so they show up on /debug/vars.
+	// HookFs objects using the same name share the counters.
+	// This is the only metrics sink of hookfs: there is no Prometheus one, but HookFs.Stats
+	// returns the counters for applications to export wherever they like.
+	ExpvarName string
+
+	// SyncWrites opens every file that is opened for writing with O_SYNC in Original,
+	// so that all writes are durable when they return whatever flags the caller used.
+	// Hooks still see the flags of the caller.
+	SyncWrites bool
+
+	// DirectIO opens every file in direct I/O mode, bypassing the page cache of the kernel:
+	// reads and writes reach hookfs with the offsets and sizes of the application, and what
+	// hooks return, short reads included, reaches the application as is. Without it, the
+	// kernel reads whole pages ahead of the application, and takes a short read for the end
+	// of the file. Shared mmap(2) of the files may fail in direct I/O mode.
+	DirectIO bool
+
+	// WritebackCache holds writes back and merges those extending one another, up to 1 MiB
+	// per file handle, as the writeback cache of the kernel does. The go-fuse version hookfs
+	// is built with does not negotiate FUSE_WRITEBACK_CACHE, so hookfs does it itself. Write
+	// hooks see fewer and larger writes, at the offsets of their data and in order, and the
+	// errors of the writes are returned by the next fsync(2) or close(2) of the handle rather
+	// than by write(2). What is held back is written before any read, fstat(2), truncation,
+	// allocation or utimes on the handle, and when it is released; other handles and
+	// operations by path may not see it until then. Leave it off for hooks that need the
+	// writes as the application issued them.
+	WritebackCache bool
+
+	// FailOnInitError makes Serve unmount and return the error of the Init of a HookWithInit,
+	// so that the caller can retry. By default, a hook whose Init fails is
+	// disabled, and the mount goes on without it.
+	FailOnInitError bool
+
+	// ThroughputPaths, if non-zero, counts the bytes read and written per path for up to
+	// ThroughputPaths paths, forgetting the least recently used ones beyond that.
+	// See HookFs.Throughput.
+	ThroughputPaths int
+
+	// TraceFile, if set, is created and receives a Chrome trace event for the beginning and
+	// the end of every operation, to be viewed with chrome://tracing or Perfetto.
+	// See HookFs.CloseTrace.
+	TraceFile string
+
+	// DisallowOther keeps users other than the one mounting out of the mount. By default,
+	// the mount is made with allow_other, which takes user_allow_other in /etc/fuse.conf
+	// unless mounting as root. It is the negation of fuse.MountOptions.AllowOther on purpose:
+	// NewHookFs has always mounted with allow_other, and the zero Options must keep doing so.
+	DisallowOther bool
+
+	// MountSource, if set, is the source of the mount shown in /proc/mounts and by df(1),
+	// instead of the absolute path of Original; it is passed as fuse.MountOptions.FsName. It is
+	// not called FsName on purpose, as HookFs.FsName is already the type of the mount.
+	MountSource string
+
+	// Debug logs every FUSE request and reply of the server, as the maximum log level does.
+	Debug bool
+
+	// EntryTimeout, AttrTimeout and NegativeTimeout are how long the kernel caches name
+	// lookups, attributes and failed lookups respectively. Zero means one second, and
+	// a negative duration disables caching.
+	EntryTimeout    time.Duration
+	AttrTimeout     time.Duration
+	NegativeTimeout time.Duration
+
+	// ReadOnly fails every operation modifying the mount with EROFS before it reaches hooks or
+	// Original, and mounts read-only, so that Original can be inspected safely. Opening files
+	// for reading, reading them, listing directories and reading links keep working.
+	ReadOnly bool
+
+	// EnableLocks forwards fcntl(2) and flock(2) locks to hookfs, which takes them on the
+	// files in Original. Without it, the kernel keeps locks to itself, and HookOnGetLk,
+	// HookOnSetLk and HookOnSetLkw are never called.
+	EnableLocks bool
+
+	// ContainPaths keeps the operations of hookfs on Original within it. Names with a ".."
+	// component are refused with EACCES, and so are names resolving outside of Original
+	// through symlinks: in their directories for every operation, and in their last component
+	// too for the operations following it, such as open(2) and chmod(2). Symlinks within
+	// Original keep working. For a HookFs created by WrapFileSystem, only ".." is refused.
+	//
+	// Names are resolved with the mounts of the hookfs process, before the operation itself,
+	// so this does not stop a race with whoever can write to Original directly: a directory
+	// replaced by a symlink between the check and the operation is followed. On Linux, run
+	// hookfs in a mount namespace of its own, or don't let untrusted users write to Original
+	// other than through the mount, to close that window.
+	ContainPaths bool
+
+	// NameMapper, if set, translates the names of the mount to the names stored in Original,
+	// e.g. SambaCompatMapper for an Original shared by Samba. Names are mapped before every
+	// operation on Original, and the names listed in its directories are mapped back. Hooks
+	// see the names of the mount; HookFs.BackendPath returns the mapped ones.
+	NameMapper NameMapper
+
+	// Metadata is static data, such as a test case ID or a tenant name, handed to hooks
+	// implementing HookWithMetadata, e.g. to tag the logs and metrics they emit.
+	// It is also available from HookFs.Metadata.
+	Metadata map[string]string
+}
@@ -0,0 +1,42 @@
+package hookfs
+
+import (
+	"sync"
+)
+
+// pathLocks is a set of mutexes keyed by path. Entries are dropped when unused.
+type pathLocks struct {
+	mu    sync.Mutex
+	locks map[string]*pathLock
+}
+
+type pathLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lock locks path and returns the function unlocking it.
+func (p *pathLocks) lock(path string) func() {
+	p.mu.Lock()
+	if p.locks == nil {
+		p.locks = make(map[string]*pathLock)
+	}
+	l, ok := p.locks[path]
+	if !ok {
+		l = &pathLock{}
+		p.locks[path] = l
+	}
+	l.refs++
+	p.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		p.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(p.locks, path)
+		}
+		p.mu.Unlock()
+	}
+}
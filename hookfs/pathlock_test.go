@@ -0,0 +1,50 @@
+package hookfs
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slowCreateHook sleeps in PreCreate, widening the window for racing creates.
+type slowCreateHook struct{}
+
+func (slowCreateHook) PreCreate(name string, flags uint32, mode uint32) (bool, HookContext, error) {
+	time.Sleep(time.Millisecond)
+	return false, nil, nil
+}
+
+func (slowCreateHook) PostCreate(realRetCode int32, prehookCtx HookContext) (bool, error) {
+	return false, nil
+}
+
+func TestExclusiveCreateHasOneWinner(t *testing.T) {
+	const racers = 20
+	_, _, mnt := mount(t, slowCreateHook{}, &Options{NegativeTimeout: -1})
+
+	var won, lost int32
+	var wg sync.WaitGroup
+	for i := 0; i < racers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f, err := os.OpenFile(filepath.Join(mnt, "file"), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+			switch {
+			case err == nil:
+				atomic.AddInt32(&won, 1)
+				f.Close()
+			case os.IsExist(err):
+				atomic.AddInt32(&lost, 1)
+			default:
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if won != 1 || lost != racers-1 {
+		t.Errorf("%d exclusive creates won and %d got EEXIST, want 1 and %d", won, lost, racers-1)
+	}
+}
@@ -0,0 +1,61 @@
+package hookfs
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+)
+
+// resizeReadHook returns the data read, cut or padded with 'y' to size bytes.
+type resizeReadHook struct {
+	size int64
+}
+
+func (h *resizeReadHook) PreRead(path string, length int64, offset int64) ([]byte, bool, HookContext, error) {
+	return nil, false, nil, nil
+}
+
+func (h *resizeReadHook) PostRead(realRetCode int32, realBuf []byte, prehookCtx HookContext) ([]byte, bool, error) {
+	size := int(atomic.LoadInt64(&h.size))
+	if size <= len(realBuf) {
+		return realBuf[:size], true, nil
+	}
+	return append(append([]byte(nil), realBuf...), bytes.Repeat([]byte("y"), size-len(realBuf))...), true, nil
+}
+
+func TestPostReadBufferIsClamped(t *testing.T) {
+	const length = 4096
+	hook := &resizeReadHook{}
+	_, original, mnt := mount(t, hook, &Options{DirectIO: true})
+	if err := ioutil.WriteFile(filepath.Join(original, "file"), bytes.Repeat([]byte("x"), 2*length), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(filepath.Join(mnt, "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	for _, tc := range []struct {
+		name string
+		size int64
+		want []byte
+	}{
+		{"shorter", 3, []byte("xxx")},
+		{"oversized", 3 * length, bytes.Repeat([]byte("x"), length)},
+	} {
+		atomic.StoreInt64(&hook.size, tc.size)
+		buf := make([]byte, length)
+		n, err := syscall.Pread(int(f.Fd()), buf, 0)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if !bytes.Equal(buf[:n], tc.want) {
+			t.Errorf("%s: read %d bytes, want %d", tc.name, n, len(tc.want))
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package hookfs
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+func TestReadOnlyMountRejectsCreate(t *testing.T) {
+	hook := &writeRecorder{}
+	_, original, mnt := mount(t, hook, &Options{ReadOnly: true})
+	if err := ioutil.WriteFile(filepath.Join(original, "file"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Create(filepath.Join(mnt, "new")); !errors.Is(err, syscall.EROFS) {
+		t.Errorf("create on a read-only mount: %v, want EROFS", err)
+	}
+	if _, err := os.Stat(filepath.Join(original, "new")); !os.IsNotExist(err) {
+		t.Errorf("new was created in the original directory: %v", err)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(mnt, "file")); err != nil || string(data) != "data" {
+		t.Errorf("read %q, %v on a read-only mount, want %q", data, err, "data")
+	}
+}
+
+func TestReadOnlyRejectsMutationsBeforeTheLowerFs(t *testing.T) {
+	original := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(original, "file"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	hook := &writeRecorder{}
+	h, err := NewHookFsWithOptions(original, t.TempDir(), hook, &Options{ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := &fuse.Context{}
+	erofs := fuse.Status(syscall.EROFS)
+	if _, code := h.Create("new", syscall.O_WRONLY, 0644, ctx); code != erofs {
+		t.Errorf("create: %v, want EROFS", code)
+	}
+	if code := h.Unlink("file", ctx); code != erofs {
+		t.Errorf("unlink: %v, want EROFS", code)
+	}
+	if code := h.Chmod("file", 0600, ctx); code != erofs {
+		t.Errorf("chmod: %v, want EROFS", code)
+	}
+	if _, code := h.Open("file", syscall.O_WRONLY, ctx); code != erofs {
+		t.Errorf("open for writing: %v, want EROFS", code)
+	}
+	f, code := h.Open("file", syscall.O_RDONLY, ctx)
+	if !code.Ok() {
+		t.Fatalf("open for reading: %v", code)
+	}
+	defer f.Release()
+	if _, code := f.Write([]byte("x"), 0); code != erofs {
+		t.Errorf("write: %v, want EROFS", code)
+	}
+	if writes := hook.recorded(); len(writes) != 0 {
+		t.Errorf("hook saw writes %v, want none", writes)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(original, "file")); string(data) != "data" {
+		t.Errorf("original holds %q, want it untouched", data)
+	}
+}
@@ -1,38 +1,91 @@
 package hookfs
 
 import (
-	"path/filepath"
+	"bytes"
+	"fmt"
+	"os/exec"
 	"time"
 
-	// log "github.com/sirupsen/logrus"
 	"github.com/hanwen/go-fuse/fuse"
 	"github.com/hanwen/go-fuse/fuse/nodefs"
 	"github.com/hanwen/go-fuse/fuse/pathfs"
+	log "github.com/sirupsen/logrus"
 )
 
+// cacheTimeout returns the kernel cache timeout for the Options value d.
+func cacheTimeout(d time.Duration) time.Duration {
+	switch {
+	case d == 0:
+		return time.Second
+	case d < 0:
+		return 0
+	}
+	return d
+}
+
 func newHookServer(hookfs *HookFs) (*fuse.Server, error) {
 	opts := &nodefs.Options{
-		NegativeTimeout: time.Second,
-		AttrTimeout:     time.Second,
-		EntryTimeout:    time.Second,
+		NegativeTimeout: cacheTimeout(hookfs.opts.NegativeTimeout),
+		AttrTimeout:     cacheTimeout(hookfs.opts.AttrTimeout),
+		EntryTimeout:    cacheTimeout(hookfs.opts.EntryTimeout),
 	}
 	pathFsOpts := &pathfs.PathNodeFsOptions{ClientInodes: true}
 	pathFs := pathfs.NewPathNodeFs(hookfs, pathFsOpts)
 	conn := nodefs.NewFileSystemConnector(pathFs.Root(), opts)
-	originalAbs, _ := filepath.Abs(hookfs.Original)
 	mOpts := &fuse.MountOptions{
-		AllowOther: true,
-		Name:       hookfs.FsName,
-		FsName:     originalAbs,
+		AllowOther:  !hookfs.opts.DisallowOther,
+		Name:        hookfs.FsName,
+		FsName:      hookfs.originalAbs,
+		EnableLocks: hookfs.opts.EnableLocks,
+	}
+	if hookfs.opts.MountSource != "" {
+		mOpts.FsName = hookfs.opts.MountSource
+	}
+	if hookfs.opts.ReadOnly {
+		mOpts.Options = append(mOpts.Options, "ro")
 	}
 	server, err := fuse.NewServer(conn.RawFS(), hookfs.Mountpoint, mOpts)
 	if err != nil {
 		return nil, err
 	}
+	// OnMount, and the Init of the hook with it, runs once mounted: undo the mount, serving
+	// it meanwhile for the requests already made to it
+	if hookfs.initErr != nil {
+		unmountUnserved(server, hookfs.Mountpoint)
+		return nil, hookfs.initErr
+	}
 
-	if LogLevel() == LogLevelMax {
+	if hookfs.opts.Debug || LogLevel() == LogLevelMax {
 		server.SetDebug(true)
 	}
 
 	return server, nil
 }
+
+// unmountUnserved unmounts mountpoint, whose server is not serving yet, serving it until it is gone.
+//
+// server.Unmount would race with server.Serve starting: it waits for the serving loops that
+// Serve adds. fusermount is run directly instead, and Serve returns once the kernel has
+// closed the connection.
+func unmountUnserved(server *fuse.Server, mountpoint string) {
+	served := make(chan struct{})
+	go func() {
+		server.Serve()
+		close(served)
+	}()
+
+	var err error
+	delay := time.Duration(0)
+	for try := 0; try < 5; try++ {
+		out, uerr := exec.Command("fusermount", "-u", mountpoint).CombinedOutput()
+		if uerr == nil {
+			<-served
+			return
+		}
+		err = fmt.Errorf("%v: %s", uerr, bytes.TrimSpace(out))
+		// requests being served may keep the mount busy for a while
+		delay = 2*delay + 5*time.Millisecond
+		time.Sleep(delay)
+	}
+	log.WithField("error", err).Warn("Unmounting after a failed Init")
+}
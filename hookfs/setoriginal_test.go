@@ -0,0 +1,40 @@
+package hookfs
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestSetOriginalSwapsBackend(t *testing.T) {
+	h, primary, mnt := mount(t, nil, &Options{DirectIO: true, AttrTimeout: -1, EntryTimeout: -1})
+	if err := ioutil.WriteFile(filepath.Join(mnt, "file"), []byte("primary"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	replica := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(replica, "file"), []byte("replica"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := h.SetOriginal(replica); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(mnt, "file")); err != nil || string(data) != "replica" {
+		t.Errorf("read %q, %v after the swap, want the replica", data, err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(mnt, "new"), []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadFile(filepath.Join(replica, "new")); err != nil {
+		t.Errorf("write after the swap did not reach the replica: %v", err)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(primary, "file")); err != nil || string(data) != "primary" {
+		t.Errorf("primary holds %q, %v, want what was written before the swap", data, err)
+	}
+
+	if err := h.SetOriginal(filepath.Join(replica, "file")); !errors.Is(err, syscall.ENOTDIR) {
+		t.Errorf("SetOriginal to a file = %v, want ENOTDIR", err)
+	}
+}
@@ -0,0 +1,77 @@
+package hookfs
+
+import (
+	"sync/atomic"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+// OpStat counts the calls of an operation, as returned by HookFs.Stats.
+type OpStat struct {
+	Calls      uint64
+	Prehooked  uint64
+	Posthooked uint64
+	// Errors is the number of calls that returned a status other than fuse.OK to the kernel.
+	Errors uint64
+}
+
+// allOps are the operations HookFs counts.
+var allOps = []string{
+	OpOpen, OpRead, OpWrite, OpMkdir, OpRmdir, OpOpenDir, OpFsync, OpFlush, OpRelease,
+	OpTruncate, OpGetAttr, OpChown, OpChmod, OpUtimens, OpAllocate, OpGetLk, OpSetLk,
+	OpSetLkw, OpStatFs, OpReadlink, OpSymlink, OpCreate, OpAccess, OpLink, OpMknod,
+	OpRename, OpUnlink, OpGetXAttr, OpListXAttr, OpRemoveXAttr, OpSetXAttr,
+}
+
+// opCounters are the counters of an operation, accessed atomically.
+type opCounters struct {
+	calls      uint64
+	prehooked  uint64
+	posthooked uint64
+	errors     uint64
+}
+
+// opStats maps the operations to their counters. It is filled once by newOpStats and only
+// read afterwards, so it needs no lock.
+type opStats map[string]*opCounters
+
+func newOpStats() opStats {
+	s := make(opStats, len(allOps))
+	for _, op := range allOps {
+		s[op] = &opCounters{}
+	}
+	return s
+}
+
+func (s opStats) observe(op string, code fuse.Status, disposition Disposition) {
+	c, ok := s[op]
+	if !ok {
+		return
+	}
+	atomic.AddUint64(&c.calls, 1)
+	switch disposition {
+	case DispositionPrehooked:
+		atomic.AddUint64(&c.prehooked, 1)
+	case DispositionPosthooked:
+		atomic.AddUint64(&c.posthooked, 1)
+	}
+	if !code.Ok() {
+		atomic.AddUint64(&c.errors, 1)
+	}
+}
+
+// Stats returns the counts of every operation since h was created, keyed by OpXXX, including
+// the operations not called yet. The counters are read one by one while operations may be
+// running, so the counts of an operation are not necessarily consistent with each other.
+func (h *HookFs) Stats() map[string]OpStat {
+	stats := make(map[string]OpStat, len(h.stats))
+	for op, c := range h.stats {
+		stats[op] = OpStat{
+			Calls:      atomic.LoadUint64(&c.calls),
+			Prehooked:  atomic.LoadUint64(&c.prehooked),
+			Posthooked: atomic.LoadUint64(&c.posthooked),
+			Errors:     atomic.LoadUint64(&c.errors),
+		}
+	}
+	return stats
+}
@@ -0,0 +1,41 @@
+package hookfs
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"unsafe"
+)
+
+// statx(2) is missing from package syscall
+const (
+	sysStatx  = 332
+	statxMode = 0x2
+)
+
+// TestStatxSubsetIsPlainGetAttr shows the limitation documented on HookOnGetAttr: a statx(2)
+// asking for the mode only reaches the hook as a getattr of all the attributes.
+func TestStatxSubsetIsPlainGetAttr(t *testing.T) {
+	hook := &getAttrRecorder{}
+	_, original, mnt := mount(t, hook, &Options{AttrTimeout: -1})
+	if err := ioutil.WriteFile(filepath.Join(original, "file"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	path, err := syscall.BytePtrFromString(filepath.Join(mnt, "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf [256]byte
+	atFdcwd := -100
+	if _, _, errno := syscall.Syscall6(sysStatx, uintptr(atFdcwd), uintptr(unsafe.Pointer(path)), 0, statxMode, uintptr(unsafe.Pointer(&buf[0])), 0); errno != 0 {
+		if errno == syscall.ENOSYS {
+			t.Skip("no statx")
+		}
+		t.Fatal(errno)
+	}
+	if !hook.seen("file") {
+		t.Error("statx asking for the mode did not reach PreGetAttr")
+	}
+}
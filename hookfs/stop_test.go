@@ -0,0 +1,30 @@
+package hookfs
+
+import (
+	"sync/atomic"
+	"testing"
+)
+
+// stopCountingHook counts the calls to Stop.
+type stopCountingHook struct {
+	stops int32
+}
+
+func (h *stopCountingHook) Stop() {
+	atomic.AddInt32(&h.stops, 1)
+}
+
+func TestUnmountStopsHook(t *testing.T) {
+	hook := &stopCountingHook{}
+	// runs after the unmount of mount
+	t.Cleanup(func() {
+		if n := atomic.LoadInt32(&hook.stops); n == 0 {
+			t.Error("the hook was not stopped by unmounting")
+		}
+	})
+	// through a chain, which stops its members
+	mount(t, NewHookChain(hook), nil)
+	if n := atomic.LoadInt32(&hook.stops); n != 0 {
+		t.Errorf("the hook was stopped %d times while serving, want 0", n)
+	}
+}
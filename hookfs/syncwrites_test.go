@@ -0,0 +1,76 @@
+package hookfs
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// backendFlags returns the flags of the file descriptor this process has open on path,
+// from /proc/self/fdinfo.
+func backendFlags(t *testing.T, path string) int {
+	t.Helper()
+	fds, err := ioutil.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fd := range fds {
+		if target, _ := os.Readlink(filepath.Join("/proc/self/fd", fd.Name())); target != path {
+			continue
+		}
+		info, err := os.Open(fmt.Sprintf("/proc/self/fdinfo/%s", fd.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer info.Close()
+		scanner := bufio.NewScanner(info)
+		for scanner.Scan() {
+			if value := strings.TrimPrefix(scanner.Text(), "flags:"); value != scanner.Text() {
+				flags, err := strconv.ParseInt(strings.TrimSpace(value), 8, 64)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return int(flags)
+			}
+		}
+		t.Fatalf("no flags in the fdinfo of %s", path)
+	}
+	t.Fatalf("%s is not open", path)
+	return 0
+}
+
+func TestSyncWritesOpensBackendWithOSync(t *testing.T) {
+	for _, tc := range []struct {
+		syncWrites bool
+		flags      int
+		want       bool
+	}{
+		{false, 0, false},
+		{false, syscall.O_SYNC, true},
+		{true, 0, true},
+	} {
+		_, original, mnt := mount(t, nil, &Options{SyncWrites: tc.syncWrites})
+		f, err := os.OpenFile(filepath.Join(mnt, "file"), os.O_WRONLY|os.O_CREATE|tc.flags, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte("data")); err != nil {
+			t.Fatal(err)
+		}
+		got := backendFlags(t, filepath.Join(original, "file"))&syscall.O_SYNC == syscall.O_SYNC
+		if got != tc.want {
+			t.Errorf("SyncWrites %v, flags %#o: O_SYNC in Original %v, want %v", tc.syncWrites, tc.flags, got, tc.want)
+		}
+		// in Original before the file is closed
+		if data, err := ioutil.ReadFile(filepath.Join(original, "file")); err != nil || string(data) != "data" {
+			t.Errorf("SyncWrites %v, flags %#o: Original holds %q, %v after the write", tc.syncWrites, tc.flags, data, err)
+		}
+		f.Close()
+	}
+}
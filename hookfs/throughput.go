@@ -0,0 +1,105 @@
+package hookfs
+
+import (
+	"container/list"
+	"sort"
+	"sync"
+	"time"
+)
+
+// PathThroughput is the number of bytes read from and written to a file through the mount
+// (Options.ThroughputPaths).
+type PathThroughput struct {
+	Path         string
+	ReadBytes    uint64
+	WrittenBytes uint64
+	// Since is when the path started being tracked, At when the snapshot was taken.
+	Since time.Time
+	At    time.Time
+}
+
+// ReadRate returns the average number of bytes read per second over the tracking period.
+func (t PathThroughput) ReadRate() float64 {
+	return rate(t.ReadBytes, t.At.Sub(t.Since))
+}
+
+// WriteRate returns the average number of bytes written per second over the tracking period.
+func (t PathThroughput) WriteRate() float64 {
+	return rate(t.WrittenBytes, t.At.Sub(t.Since))
+}
+
+func rate(bytes uint64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(bytes) / d.Seconds()
+}
+
+// throughputCounters counts the bytes read and written per path, keeping the most recently
+// used paths only.
+type throughputCounters struct {
+	max int
+
+	mu sync.Mutex
+	// lru holds the *PathThroughput of the tracked paths, most recently used first
+	lru   *list.List
+	paths map[string]*list.Element
+}
+
+func newThroughputCounters(max int) *throughputCounters {
+	return &throughputCounters{
+		max:   max,
+		lru:   list.New(),
+		paths: make(map[string]*list.Element),
+	}
+}
+
+// add counts read and written bytes for path. t may be nil, in which case nothing is counted.
+func (t *throughputCounters) add(path string, read int, written int) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	e, ok := t.paths[path]
+	if ok {
+		t.lru.MoveToFront(e)
+	} else {
+		if t.lru.Len() >= t.max {
+			oldest := t.lru.Back()
+			delete(t.paths, oldest.Value.(*PathThroughput).Path)
+			t.lru.Remove(oldest)
+		}
+		e = t.lru.PushFront(&PathThroughput{Path: path, Since: time.Now()})
+		t.paths[path] = e
+	}
+	c := e.Value.(*PathThroughput)
+	c.ReadBytes += uint64(read)
+	c.WrittenBytes += uint64(written)
+}
+
+func (t *throughputCounters) snapshot() []PathThroughput {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	s := make([]PathThroughput, 0, t.lru.Len())
+	for e := t.lru.Front(); e != nil; e = e.Next() {
+		c := *e.Value.(*PathThroughput)
+		c.At = now
+		s = append(s, c)
+	}
+	return s
+}
+
+// Throughput returns the bytes read and written per path, busiest path first,
+// or nil unless Options.ThroughputPaths is set.
+func (h *HookFs) Throughput() []PathThroughput {
+	if h.throughput == nil {
+		return nil
+	}
+	s := h.throughput.snapshot()
+	sort.SliceStable(s, func(i, j int) bool {
+		return s[i].ReadBytes+s[i].WrittenBytes > s[j].ReadBytes+s[j].WrittenBytes
+	})
+	return s
+}
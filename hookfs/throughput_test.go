@@ -0,0 +1,63 @@
+package hookfs
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+func TestThroughputPerPath(t *testing.T) {
+	original := t.TempDir()
+	for _, name := range []string{"a", "b", "c"} {
+		if err := ioutil.WriteFile(filepath.Join(original, name), make([]byte, 100), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h, err := NewHookFsWithOptions(original, t.TempDir(), nil, &Options{ThroughputPaths: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := &fuse.Context{}
+	access := func(name string, read int, written int) {
+		t.Helper()
+		f, code := h.Open(name, syscall.O_RDWR, ctx)
+		if !code.Ok() {
+			t.Fatal(code)
+		}
+		defer f.Release()
+		if read > 0 {
+			if _, code := f.Read(make([]byte, read), 0); !code.Ok() {
+				t.Fatal(code)
+			}
+		}
+		if written > 0 {
+			if _, code := f.Write(make([]byte, written), 0); !code.Ok() {
+				t.Fatal(code)
+			}
+		}
+	}
+	access("a", 10, 0)
+	access("b", 0, 30)
+	access("a", 5, 20)
+
+	got := h.Throughput()
+	if len(got) != 2 || got[0].Path != "a" || got[1].Path != "b" {
+		t.Fatalf("Throughput = %+v, want a then b", got)
+	}
+	if got[0].ReadBytes != 15 || got[0].WrittenBytes != 20 {
+		t.Errorf("a read %d and wrote %d bytes, want 15 and 20", got[0].ReadBytes, got[0].WrittenBytes)
+	}
+	if got[1].ReadBytes != 0 || got[1].WrittenBytes != 30 {
+		t.Errorf("b read %d and wrote %d bytes, want 0 and 30", got[1].ReadBytes, got[1].WrittenBytes)
+	}
+
+	// c takes the place of b, the least recently used path
+	access("c", 1, 0)
+	got = h.Throughput()
+	if len(got) != 2 || got[0].Path != "a" || got[1].Path != "c" {
+		t.Errorf("Throughput after eviction = %+v, want a then c", got)
+	}
+}
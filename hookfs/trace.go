@@ -0,0 +1,166 @@
+package hookfs
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+// traceWriter writes every operation to a file as a pair of Chrome trace events
+// (Options.TraceFile), which chrome://tracing and Perfetto can load.
+//
+// The file is in the JSON Array Format of the Trace Event Format, one event per line:
+//
+//	[
+//	{"name":"read","cat":"hookfs","ph":"B","ts":1520.3,"pid":4242,"tid":1,"args":{"path":"dir/file"}},
+//	{"name":"read","cat":"hookfs","ph":"E","ts":1551.9,"pid":4242,"tid":1,"args":{"status":"OK"}}
+//	]
+//
+// ts is in microseconds since the trace started. Operations run concurrently, so each
+// operation is given the lowest tid that is not in use by another one, which keeps every
+// begin (B) and end (E) pair properly nested on its tid. The closing bracket is written by
+// HookFs.CloseTrace; the viewers load a trace without it as well.
+type traceWriter struct {
+	mu     sync.Mutex
+	f      *os.File
+	w      *bufio.Writer
+	pid    int
+	start  time.Time
+	events int
+	// lanes[i] is whether tid i+1 is in use
+	lanes []bool
+	err   error
+}
+
+type traceEvent struct {
+	Name  string            `json:"name"`
+	Cat   string            `json:"cat"`
+	Phase string            `json:"ph"`
+	TS    float64           `json:"ts"`
+	PID   int               `json:"pid"`
+	TID   int               `json:"tid"`
+	Args  map[string]string `json:"args"`
+}
+
+func newTraceWriter(path string) (*traceWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	t := &traceWriter{
+		f:     f,
+		w:     bufio.NewWriter(f),
+		pid:   os.Getpid(),
+		start: time.Now(),
+	}
+	if _, err := t.w.WriteString("["); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// write writes an event. t.mu must be held.
+func (t *traceWriter) write(ev traceEvent) {
+	if t.err != nil {
+		return
+	}
+	b, err := json.Marshal(ev)
+	if err != nil {
+		t.err = err
+		return
+	}
+	sep := ",\n"
+	if t.events == 0 {
+		sep = "\n"
+	}
+	t.events++
+	if _, err := t.w.WriteString(sep); err != nil {
+		t.err = err
+		return
+	}
+	_, t.err = t.w.Write(b)
+}
+
+func (t *traceWriter) ts(at time.Time) float64 {
+	return float64(at.Sub(t.start)) / float64(time.Microsecond)
+}
+
+// begin writes the begin event of op and returns its tid.
+func (t *traceWriter) begin(op *opSpan) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	lane := 0
+	for lane < len(t.lanes) && t.lanes[lane] {
+		lane++
+	}
+	if lane == len(t.lanes) {
+		t.lanes = append(t.lanes, true)
+	} else {
+		t.lanes[lane] = true
+	}
+	tid := lane + 1
+	t.write(traceEvent{
+		Name:  op.op,
+		Cat:   "hookfs",
+		Phase: "B",
+		TS:    t.ts(op.start),
+		PID:   t.pid,
+		TID:   tid,
+		Args:  map[string]string{"path": op.path},
+	})
+	return tid
+}
+
+// end writes the end event of op and flushes the file.
+func (t *traceWriter) end(op *opSpan, status fuse.Status, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lanes[op.tid-1] = false
+	t.write(traceEvent{
+		Name:  op.op,
+		Cat:   "hookfs",
+		Phase: "E",
+		TS:    t.ts(at),
+		PID:   t.pid,
+		TID:   op.tid,
+		Args:  map[string]string{"status": status.String()},
+	})
+	if t.err == nil {
+		t.err = t.w.Flush()
+	}
+}
+
+func (t *traceWriter) close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.err == nil {
+		_, t.err = t.w.WriteString("\n]\n")
+	}
+	if t.err == nil {
+		t.err = t.w.Flush()
+	}
+	if err := t.f.Close(); t.err == nil {
+		t.err = err
+	}
+	err := t.err
+	if err == nil {
+		// stops tracing
+		t.err = os.ErrClosed
+	}
+	return err
+}
+
+// CloseTrace terminates and closes the trace file of Options.TraceFile, and returns the first
+// error writing it, if any. Operations after CloseTrace are not traced anymore.
+// It is a no-op unless Options.TraceFile is set.
+func (h *HookFs) CloseTrace() error {
+	if h.trace == nil {
+		return nil
+	}
+	return h.trace.close()
+}
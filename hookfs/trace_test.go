@@ -0,0 +1,63 @@
+package hookfs
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+func TestTraceFileHasBeginEndPairs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.json")
+	h, err := NewHookFsWithOptions(t.TempDir(), t.TempDir(), nil, &Options{TraceFile: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := &fuse.Context{}
+	h.Mkdir("dir", 0755, ctx)
+	h.GetAttr("dir", ctx)
+	h.GetAttr("missing", ctx)
+	if err := h.CloseTrace(); err != nil {
+		t.Fatal(err)
+	}
+	// not traced anymore
+	h.GetAttr("dir", ctx)
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []traceEvent
+	if err := json.Unmarshal(data, &events); err != nil {
+		t.Fatalf("trace is not valid JSON: %v\n%s", err, data)
+	}
+	if len(events) != 6 {
+		t.Fatalf("%d events, want 6:\n%s", len(events), data)
+	}
+	// the operations ran one after the other, so each begin is followed by its end
+	want := []struct {
+		name   string
+		status fuse.Status
+	}{
+		{"mkdir", fuse.OK},
+		{"getattr", fuse.OK},
+		{"getattr", fuse.ENOENT},
+	}
+	for i, w := range want {
+		b, e := events[2*i], events[2*i+1]
+		if b.Phase != "B" || e.Phase != "E" || b.Name != w.name || e.Name != w.name || b.TID != e.TID {
+			t.Errorf("events %d and %d = %+v, %+v, want a %s begin and end pair", 2*i, 2*i+1, b, e, w.name)
+		}
+		if e.TS < b.TS {
+			t.Errorf("%s ends at %v before it begins at %v", w.name, e.TS, b.TS)
+		}
+		if e.Args["status"] != w.status.String() {
+			t.Errorf("%s ended with status %q, want %q", w.name, e.Args["status"], w.status)
+		}
+	}
+	if events[0].Args["path"] != "dir" || events[4].Args["path"] != "missing" {
+		t.Errorf("paths %q and %q, want dir and missing", events[0].Args["path"], events[4].Args["path"])
+	}
+}
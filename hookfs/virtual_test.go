@@ -0,0 +1,60 @@
+package hookfs
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"syscall"
+	"testing"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+// virtualDirHook presents a directory "virtual" with the files "a" and "b".
+type virtualDirHook struct{}
+
+func (virtualDirHook) VirtualOpenDir(path string) ([]fuse.DirEntry, bool, error) {
+	if path != "virtual" {
+		return nil, false, nil
+	}
+	return []fuse.DirEntry{{Name: "a", Mode: fuse.S_IFREG}, {Name: "b", Mode: fuse.S_IFREG}}, true, nil
+}
+
+func (virtualDirHook) VirtualGetAttr(path string) (*fuse.Attr, bool, error) {
+	switch path {
+	case "virtual":
+		return &fuse.Attr{Mode: syscall.S_IFDIR | 0755, Nlink: 2}, true, nil
+	case "virtual/a", "virtual/b":
+		return &fuse.Attr{Mode: syscall.S_IFREG | 0644, Nlink: 1, Size: 3}, true, nil
+	}
+	return nil, false, nil
+}
+
+func TestVirtualDirectoryListing(t *testing.T) {
+	_, _, mnt := mount(t, virtualDirHook{}, nil)
+
+	fi, err := os.Stat(filepath.Join(mnt, "virtual"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fi.IsDir() {
+		t.Errorf("virtual is %v, want a directory", fi.Mode())
+	}
+	dir, err := os.Open(filepath.Join(mnt, "virtual"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, err := dir.Readdirnames(-1)
+	dir.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(names)
+	if want := []string{"a", "b"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("listed %q, want %q", names, want)
+	}
+	if fi, err := os.Stat(filepath.Join(mnt, "virtual", "b")); err != nil || fi.Size() != 3 {
+		t.Errorf("stat of a virtual child: %v", err)
+	}
+}
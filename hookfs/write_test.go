@@ -0,0 +1,64 @@
+package hookfs
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+// acceptHook reports accepted bytes as written by every write that went through.
+type acceptHook struct {
+	accepted uint32
+}
+
+func (h *acceptHook) PreWrite(path string, buf []byte, offset int64) (bool, HookContext, error) {
+	return false, nil, nil
+}
+
+func (h *acceptHook) PostWrite(realRetCode int32, prehookCtx HookContext) (uint32, bool, error) {
+	return h.accepted, true, nil
+}
+
+func TestWriteReturnsBytesWritten(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), 4096)
+	for _, tc := range []struct {
+		name string
+		hook Hook
+		want uint32
+	}{
+		{"passthrough", &writeRecorder{}, 4096},
+		{"short", &acceptHook{accepted: 100}, 100},
+		{"clamped", &acceptHook{accepted: 8192}, 4096},
+	} {
+		h, err := NewHookFs(t.TempDir(), t.TempDir(), tc.hook)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, code := h.Create("file", syscall.O_WRONLY, 0644, &fuse.Context{})
+		if !code.Ok() {
+			t.Fatal(code)
+		}
+		written, code := f.Write(data, 0)
+		f.Release()
+		if !code.Ok() || written != tc.want {
+			t.Errorf("%s: wrote %d bytes: %v, want %d", tc.name, written, code, tc.want)
+		}
+	}
+}
+
+func TestWriteThroughMountReturnsLength(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), 4096)
+	_, _, mnt := mount(t, &writeRecorder{}, &Options{DirectIO: true})
+	f, err := os.Create(filepath.Join(mnt, "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if n, err := f.Write(data); err != nil || n != len(data) {
+		t.Errorf("wrote %d bytes: %v, want %d", n, err, len(data))
+	}
+}
@@ -0,0 +1,74 @@
+package hookfs
+
+import (
+	"sync"
+
+	"github.com/hanwen/go-fuse/fuse"
+)
+
+// writebackMax is how many bytes Options.WritebackCache holds back per file handle.
+const writebackMax = 1 << 20
+
+// writebackCache implements Options.WritebackCache for a single file handle.
+type writebackCache struct {
+	mu  sync.Mutex
+	off int64
+	buf []byte
+	// code is the first failure of a write since the last flush
+	code fuse.Status
+}
+
+func newWritebackCache(enabled bool) *writebackCache {
+	if !enabled {
+		return nil
+	}
+	return &writebackCache{}
+}
+
+// add holds data back, writing what is held with write first unless data extends it.
+func (c *writebackCache) add(data []byte, off int64, write func([]byte, int64) (uint32, fuse.Status)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.buf) > 0 && (off != c.off+int64(len(c.buf)) || len(c.buf)+len(data) > writebackMax) {
+		c.writeLocked(write)
+	}
+	if len(c.buf) == 0 {
+		c.off = off
+	}
+	// go-fuse reuses data for the next request
+	c.buf = append(c.buf, data...)
+}
+
+// sync writes what is held back, keeping a failure for flush.
+func (c *writebackCache) sync(write func([]byte, int64) (uint32, fuse.Status)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writeLocked(write)
+}
+
+// flush writes what is held back, and returns the first failure of a write since the last
+// flush.
+func (c *writebackCache) flush(write func([]byte, int64) (uint32, fuse.Status)) fuse.Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writeLocked(write)
+	code := c.code
+	c.code = fuse.OK
+	return code
+}
+
+func (c *writebackCache) writeLocked(write func([]byte, int64) (uint32, fuse.Status)) {
+	if len(c.buf) == 0 {
+		return
+	}
+	written, code := write(c.buf, c.off)
+	if code.Ok() && int(written) < len(c.buf) {
+		// nobody is left to retry the rest
+		code = fuse.EIO
+	}
+	if !code.Ok() && c.code.Ok() {
+		c.code = code
+	}
+	// hooks may keep the buffer they were given
+	c.buf = nil
+}
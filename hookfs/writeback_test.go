@@ -0,0 +1,95 @@
+package hookfs
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"syscall"
+	"testing"
+)
+
+// writeRecorder records the offsets and sizes of the writes it sees, failing them with fail
+// if set.
+type writeRecorder struct {
+	mu     sync.Mutex
+	writes [][2]int64
+	fail   error
+}
+
+func (h *writeRecorder) PreWrite(path string, buf []byte, offset int64) (bool, HookContext, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.writes = append(h.writes, [2]int64{offset, int64(len(buf))})
+	return h.fail != nil, nil, h.fail
+}
+
+func (h *writeRecorder) PostWrite(realRetCode int32, prehookCtx HookContext) (uint32, bool, error) {
+	return 0, false, nil
+}
+
+func (h *writeRecorder) recorded() [][2]int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([][2]int64(nil), h.writes...)
+}
+
+func TestWritebackCacheMergesWrites(t *testing.T) {
+	const chunk, chunks = 4096, 16
+	data := bytes.Repeat([]byte("0123456789abcdef"), chunk*chunks/16)
+
+	var direct [][2]int64
+	for i := int64(0); i < chunks; i++ {
+		direct = append(direct, [2]int64{i * chunk, chunk})
+	}
+	for _, tc := range []struct {
+		writeback bool
+		want      [][2]int64
+	}{
+		{false, direct},
+		{true, [][2]int64{{0, chunk * chunks}}},
+	} {
+		hook := &writeRecorder{}
+		_, original, mnt := mount(t, hook, &Options{WritebackCache: tc.writeback})
+		f, err := os.Create(filepath.Join(mnt, "file"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < chunks; i++ {
+			if _, err := f.Write(data[i*chunk : (i+1)*chunk]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if got := hook.recorded(); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("WritebackCache %v: hook saw writes %v, want %v", tc.writeback, got, tc.want)
+		}
+		written, err := ioutil.ReadFile(filepath.Join(original, "file"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(written, data) {
+			t.Errorf("WritebackCache %v: wrote %d bytes differing from the %d written", tc.writeback, len(written), len(data))
+		}
+	}
+}
+
+func TestWritebackCacheReportsErrorsOnClose(t *testing.T) {
+	hook := &writeRecorder{fail: syscall.ENOSPC}
+	_, _, mnt := mount(t, hook, &Options{WritebackCache: true})
+	f, err := os.Create(filepath.Join(mnt, "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("data")); err != nil {
+		t.Fatalf("write = %v, want the error held back", err)
+	}
+	if err := f.Close(); !errors.Is(err, syscall.ENOSPC) {
+		t.Errorf("close = %v, want ENOSPC", err)
+	}
+}